@@ -1,18 +1,26 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
 	"github.com/llamasearch/llamachat/internal/ai"
 	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/avatar"
 	"github.com/llamasearch/llamachat/internal/config"
 	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/handlers"
+	"github.com/llamasearch/llamachat/internal/middleware"
 	"github.com/llamasearch/llamachat/internal/server"
+	"github.com/llamasearch/llamachat/internal/storage"
+	"github.com/llamasearch/llamachat/internal/websocket"
 )
 
 // Version information (set during build)
@@ -28,16 +36,47 @@ func convertCORSConfig(cors config.CORS) server.CORS {
 		AllowedOrigins: cors.AllowedOrigins,
 		AllowedMethods: cors.AllowedMethods,
 		AllowedHeaders: cors.AllowedHeaders,
+		MaxAge:         time.Duration(cors.MaxAgeSeconds) * time.Second,
+		DisabledPaths:  cors.DisabledPaths,
 	}
 }
 
+// newRedisClient connects to Redis, returning nil if it isn't configured or
+// reachable since features that use it fall back to in-process state
+func newRedisClient(cfg config.Redis) *redis.Client {
+	if cfg.Host == "" {
+		return nil
+	}
+
+	client := redis.NewClient(&redis.Options{
+		Addr:     fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
+		Password: cfg.Password,
+		DB:       cfg.DB,
+		PoolSize: cfg.MaxConnections,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		log.Warn().Err(err).Msg("Redis is unavailable; falling back to in-process state")
+		client.Close()
+		return nil
+	}
+
+	log.Info().Str("addr", client.Options().Addr).Msg("Connected to Redis")
+	return client
+}
+
 func main() {
 	// Setup logger
 	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
 	log.Logger = log.With().Timestamp().Logger()
+	// Code running outside a request logs through log.Ctx too
+	zerolog.DefaultContextLogger = &log.Logger
 
 	// Parse command line flags
-	configPath := flag.String("config", "config.json", "Path to configuration file")
+	configPath := flag.String("config", "config.json", "Path to configuration file (.json, .yaml or .yml)")
 	port := flag.Int("port", 0, "Override port number from config file")
 	webDir := flag.String("web-dir", "", "Override web directory from config file")
 	debug := flag.Bool("debug", false, "Enable debug mode")
@@ -81,6 +120,10 @@ func main() {
 		zerolog.SetGlobalLevel(level)
 	}
 
+	if err := cfg.EnsureJWTSecret(); err != nil {
+		log.Fatal().Err(err).Msg("Invalid configuration")
+	}
+
 	// Connect to database
 	dbConfig := database.Config{
 		Driver:             cfg.Database.Driver,
@@ -92,19 +135,49 @@ func main() {
 		SSLMode:            cfg.Database.SSLMode,
 		MaxConnections:     cfg.Database.MaxConnections,
 		ConnectionLifetime: cfg.Database.ConnectionLifetime,
+		Cache: database.CacheConfig{
+			Enabled:    cfg.Database.Cache.Enabled,
+			TTL:        time.Duration(cfg.Database.Cache.TTLSeconds) * time.Second,
+			MaxEntries: cfg.Database.Cache.MaxEntries,
+		},
 	}
-	db, err := database.NewPostgresStore(dbConfig)
+	db, err := database.NewStore(dbConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to connect to database")
 	}
 	defer db.Close()
 
+	// Set up attachment storage
+	files, err := storage.New(storage.Config{
+		Backend: cfg.Storage.Backend,
+		Dir:     cfg.Attachments.Dir,
+		S3: storage.S3Config{
+			Endpoint:        cfg.Storage.Endpoint,
+			Region:          cfg.Storage.Region,
+			Bucket:          cfg.Storage.Bucket,
+			AccessKeyID:     cfg.Storage.AccessKeyID,
+			SecretAccessKey: cfg.Storage.SecretAccessKey,
+			UsePathStyle:    cfg.Storage.UsePathStyle,
+			PresignExpiry:   time.Duration(cfg.Storage.PresignExpirySeconds) * time.Second,
+		},
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to set up attachment storage")
+	}
+
+	// Connect to Redis (optional)
+	rdb := newRedisClient(cfg.Redis)
+	if rdb != nil {
+		defer rdb.Close()
+	}
+
 	// Create auth service
 	authConfig := auth.Config{
 		JWT: auth.JWTConfig{
-			Secret:          cfg.Auth.JWT.Secret,
-			ExpirationHours: cfg.Auth.JWT.ExpirationHours,
-			Issuer:          cfg.Auth.JWT.Issuer,
+			Secret:                 cfg.Auth.JWT.Secret,
+			ExpirationHours:        cfg.Auth.JWT.ExpirationHours,
+			Issuer:                 cfg.Auth.JWT.Issuer,
+			RefreshExpirationHours: cfg.Auth.JWT.RefreshExpirationHours,
 		},
 		Password: auth.PasswordConfig{
 			MinLength:        cfg.Auth.Password.MinLength,
@@ -113,19 +186,96 @@ func main() {
 			RequireNumber:    cfg.Auth.Password.RequireNumber,
 			RequireSpecial:   cfg.Auth.Password.RequireSpecial,
 		},
+		Hashing: auth.HashingConfig{
+			Algorithm:  cfg.Auth.Hashing.Algorithm,
+			BcryptCost: cfg.Auth.Hashing.BcryptCost,
+			Argon2: auth.Argon2Params{
+				Memory:      cfg.Auth.Hashing.Argon2.MemoryKB,
+				Iterations:  cfg.Auth.Hashing.Argon2.Iterations,
+				Parallelism: cfg.Auth.Hashing.Argon2.Parallelism,
+				SaltLength:  cfg.Auth.Hashing.Argon2.SaltLength,
+				KeyLength:   cfg.Auth.Hashing.Argon2.KeyLength,
+			},
+		},
+		EmailThrottle: auth.EmailThrottleConfig{
+			Cooldown:             time.Duration(cfg.Auth.EmailThrottle.CooldownSeconds) * time.Second,
+			MaxOutstandingTokens: cfg.Auth.EmailThrottle.MaxOutstandingTokens,
+			TokenTTL:             time.Duration(cfg.Auth.EmailThrottle.TokenTTLMinutes) * time.Minute,
+			MinResponseTime:      time.Duration(cfg.Auth.EmailThrottle.MinResponseMillis) * time.Millisecond,
+		},
+		Lockout: auth.LockoutConfig{
+			Threshold:   cfg.Auth.Lockout.Threshold,
+			Duration:    time.Duration(cfg.Auth.Lockout.DurationSeconds) * time.Second,
+			MaxDuration: time.Duration(cfg.Auth.Lockout.MaxDurationSeconds) * time.Second,
+		},
+		Mail: auth.MailConfig{
+			Driver:       cfg.Auth.Mail.Driver,
+			From:         cfg.Auth.Mail.From,
+			SMTPHost:     cfg.Auth.Mail.SMTPHost,
+			SMTPPort:     cfg.Auth.Mail.SMTPPort,
+			SMTPUsername: cfg.Auth.Mail.SMTPUsername,
+			SMTPPassword: cfg.Auth.Mail.SMTPPassword,
+		},
+		PasswordResetURL:    cfg.Auth.PasswordResetURL,
+		AllowedRedirectURLs: cfg.Auth.AllowedRedirectURLs,
+	}
+	authService, err := auth.NewService(authConfig, db, rdb)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to create auth service")
+	}
+	if cfg.Auth.Mail.Driver == auth.MailDriverNone {
+		log.Warn().Msg("No mailer configured; password reset by email is disabled")
 	}
-	authService := auth.NewService(authConfig, db)
 
 	// Create AI service
 	aiConfig := ai.Config{
-		Provider:     cfg.AI.Provider,
-		APIKey:       cfg.AI.APIKey,
-		Model:        cfg.AI.Model,
-		Temperature:  cfg.AI.Temperature,
-		MaxTokens:    cfg.AI.MaxTokens,
-		SystemPrompt: cfg.AI.SystemPrompt,
+		Provider:      cfg.AI.Provider,
+		APIKey:        cfg.AI.APIKey,
+		Model:         cfg.AI.Model,
+		Temperature:   cfg.AI.Temperature,
+		MaxTokens:     cfg.AI.MaxTokens,
+		SystemPrompt:  cfg.AI.SystemPrompt,
+		AllowedModels: cfg.AI.AllowedModels,
+		MaxRetries:    cfg.AI.MaxRetries,
+
+		MinTriggerLength:  cfg.AI.MinTriggerLength,
+		ShortTriggerReply: cfg.AI.ShortTriggerReply,
+		Triggers:          cfg.AI.Triggers,
+		MonthlyTokenQuota: cfg.AI.MonthlyTokenQuota,
+
+		ContextWindow:           cfg.AI.ContextWindowTokens,
+		SummarizeDroppedContext: cfg.AI.SummarizeDroppedContext,
+		Cache: ai.CacheConfig{
+			Enabled:        cfg.AI.Cache.Enabled,
+			TTL:            time.Duration(cfg.AI.Cache.TTLSeconds) * time.Second,
+			MaxEntries:     cfg.AI.Cache.MaxEntries,
+			MaxTemperature: cfg.AI.Cache.MaxTemperature,
+		},
+		Moderation: ai.ModerationConfig{
+			Enabled: cfg.AI.Moderation.Enabled,
+			URL:     cfg.AI.Moderation.URL,
+			Model:   cfg.AI.Moderation.Model,
+		},
+		Embeddings: ai.EmbeddingsConfig{
+			URL:       cfg.AI.Embeddings.URL,
+			Model:     cfg.AI.Embeddings.Model,
+			BatchSize: cfg.AI.Embeddings.BatchSize,
+		},
+		PostProcess: ai.PostProcessConfig{
+			StripPatterns: cfg.AI.PostProcess.StripPatterns,
+			MaxLength:     cfg.AI.PostProcess.MaxLength,
+			Disclaimer:    cfg.AI.PostProcess.Disclaimer,
+		},
+		Webhook: ai.WebhookConfig{
+			URL:             cfg.AI.Webhook.URL,
+			Headers:         cfg.AI.Webhook.Headers,
+			RequestTemplate: cfg.AI.Webhook.RequestTemplate,
+			ResponsePath:    cfg.AI.Webhook.ResponsePath,
+		},
 	}
 	aiService := ai.NewService(aiConfig)
+	aiService.SetUsageStore(db)
+	aiService.SetRedis(rdb)
 
 	// Start server
 	serverConfig := server.Config{
@@ -135,8 +285,96 @@ func main() {
 		WebDir:    cfg.Server.WebDir,
 		CORS:      convertCORSConfig(cfg.Server.CORS),
 		RateLimit: cfg.Server.RateLimit,
+		Concurrency: middleware.ConcurrencyLimiterConfig{
+			MaxInFlight: cfg.Server.Concurrency.MaxInFlight,
+			RetryAfter:  time.Duration(cfg.Server.Concurrency.RetryAfterSeconds) * time.Second,
+		},
+		Security: middleware.SecurityHeadersConfig{
+			Disabled:              cfg.Server.SecurityHeaders.Disabled,
+			FrameOptions:          cfg.Server.SecurityHeaders.FrameOptions,
+			ContentSecurityPolicy: cfg.Server.SecurityHeaders.ContentSecurityPolicy,
+			ReferrerPolicy:        cfg.Server.SecurityHeaders.ReferrerPolicy,
+			HSTSMaxAge:            time.Duration(cfg.Server.SecurityHeaders.HSTSMaxAgeSeconds) * time.Second,
+			HSTSIncludeSubdomains: cfg.Server.SecurityHeaders.HSTSIncludeSubdomains,
+		},
+		Compression: middleware.CompressionConfig{
+			Disabled: cfg.Server.Compression.Disabled,
+			MinSize:  cfg.Server.Compression.MinSizeBytes,
+			Level:    cfg.Server.Compression.Level,
+		},
+		Assistant: server.AssistantConfig{
+			ContextMessages:      cfg.AI.ContextMessages,
+			ThreadContext:        cfg.AI.ThreadContext,
+			MaxConcurrentPerUser: cfg.AI.MaxConcurrentPerUser,
+		},
+		SemanticSearch: cfg.AI.SemanticSearch,
+		Avatar: avatar.Config{
+			Style: cfg.Avatar.Style,
+			Size:  cfg.Avatar.Size,
+		},
+		Profile: handlers.ProfileLimits{
+			MaxUsernameLength:    cfg.Profile.MaxUsernameLength,
+			MaxDisplayNameLength: cfg.Profile.MaxDisplayNameLength,
+			MaxBioLength:         cfg.Profile.MaxBioLength,
+		},
+		Chat: handlers.ChatConfig{
+			MaxReplyDepth:          cfg.Chat.MaxReplyDepth,
+			ReplyDepthMode:         cfg.Chat.ReplyDepthMode,
+			DeletedUserAttribution: cfg.Chat.DeletedUserAttribution,
+			DeletedMessages:        cfg.Chat.DeletedMessages,
+			AllowedReactions:       cfg.Chat.AllowedReactions,
+			MaxFavorites:           cfg.Chat.MaxFavorites,
+			MaxForwardTargets:      cfg.Chat.MaxForwardTargets,
+			ForwardsPerMinute:      cfg.Chat.ForwardsPerMinute,
+			MaxSeenBy:              cfg.Chat.MaxSeenBy,
+			BulkMode:               cfg.Chat.BulkMode,
+			MaxMessageLength:       cfg.Chat.MaxMessageLength,
+			DeleteWhenEmpty:        cfg.Chat.DeleteWhenEmpty,
+			EditGrace:              time.Duration(cfg.Chat.EditGraceSeconds) * time.Second,
+		},
+		Attachments: handlers.AttachmentConfig{
+			ThumbnailCacheBytes: int64(cfg.Attachments.ThumbnailCacheMB) << 20,
+			MaxFileBytes:        int64(cfg.Attachments.MaxFileMB) << 20,
+			AllowedTypes:        cfg.Attachments.AllowedTypes,
+		},
+		WebSocket: websocket.HubConfig{
+			PresenceIdleTimeout: time.Duration(cfg.WebSocket.PresenceIdleSeconds) * time.Second,
+			WriteBatchSize:      cfg.WebSocket.WriteBatchSize,
+			ReadReceiptWindow:   time.Duration(cfg.WebSocket.ReadReceiptWindowMillis) * time.Millisecond,
+			MissedBufferSize:    cfg.WebSocket.MissedBufferSize,
+			MissedBufferTTL:     time.Duration(cfg.WebSocket.MissedBufferTTLSeconds) * time.Second,
+			MaxReplay:           cfg.WebSocket.MaxReplayMessages,
+			MessagesPerMinute:   cfg.Chat.MessagesPerMinute,
+			TypingPerMinute:     cfg.Chat.TypingPerMinute,
+			PingInterval:        time.Duration(cfg.WebSocket.PingIntervalSeconds) * time.Second,
+			TypingTTL:           time.Duration(cfg.WebSocket.TypingTTLSeconds) * time.Second,
+			MaxMessageLength:    cfg.Chat.MaxMessageLength,
+			Fanout: websocket.FanoutConfig{
+				Workers:        cfg.WebSocket.FanoutWorkers,
+				QueueSize:      cfg.WebSocket.FanoutQueueSize,
+				EnqueueTimeout: time.Duration(cfg.WebSocket.FanoutEnqueueTimeoutMillis) * time.Millisecond,
+			},
+		},
+		Build: handlers.BuildInfo{
+			Version:   Version,
+			GitCommit: GitCommit,
+		},
+		Metrics: server.MetricsConfig{
+			Enabled:    cfg.Metrics.Enabled,
+			Path:       cfg.Metrics.Path,
+			ListenAddr: cfg.Metrics.ListenAddr,
+		},
+		TLS: server.TLSConfig{
+			Enabled:          cfg.Server.TLS.Enabled,
+			CertFile:         cfg.Server.TLS.CertFile,
+			KeyFile:          cfg.Server.TLS.KeyFile,
+			AutocertDomains:  cfg.Server.TLS.AutocertDomains,
+			AutocertCacheDir: cfg.Server.TLS.AutocertCacheDir,
+			AutocertEmail:    cfg.Server.TLS.AutocertEmail,
+			RedirectAddr:     cfg.Server.TLS.RedirectAddr,
+		},
 	}
-	s := server.NewServer(serverConfig, db, authService, aiService)
+	s := server.NewServer(serverConfig, db, files, authService, aiService, rdb)
 
 	log.Info().
 		Str("version", Version).
@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/lru"
+	"github.com/llamasearch/llamachat/internal/metrics"
+)
+
+// Response cache defaults
+const (
+	defaultCacheTTL     = time.Hour
+	defaultCacheEntries = 1000
+	cacheKeyPrefix      = "ai_cache:"
+)
+
+// CacheConfig holds response cache configuration
+type CacheConfig struct {
+	// Enabled turns on the response cache
+	Enabled bool
+	// TTL is how long a response is served for an identical request
+	TTL time.Duration
+	// MaxEntries bounds the in-memory cache. Redis expires entries by TTL
+	// only.
+	MaxEntries int
+	// MaxTemperature is the highest temperature whose responses are
+	// cached, since hotter sampling is meant to vary. Zero caches only
+	// deterministic requests.
+	MaxTemperature float64
+}
+
+// responseCache stores completion results by request hash
+type responseCache interface {
+	get(ctx context.Context, key string) (*CompletionResult, bool, error)
+	set(ctx context.Context, key string, result *CompletionResult) error
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context whose completions always call the provider
+// and aren't cached
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// SetRedis moves the response cache to Redis, so identical requests are
+// served from it across instances. rdb may be nil. It must be called before
+// the service is used.
+func (s *Service) SetRedis(rdb *redis.Client) {
+	if s.cache != nil && rdb != nil {
+		s.cache = &redisResponseCache{client: rdb, ttl: s.config.Cache.TTL}
+	}
+}
+
+// newResponseCache returns the in-memory response cache for config, or nil
+// if caching is disabled
+func newResponseCache(config *CacheConfig) responseCache {
+	if !config.Enabled {
+		return nil
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultCacheTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultCacheEntries
+	}
+	return &memoryResponseCache{entries: lru.New[string](lru.Config[CompletionResult]{TTL: config.TTL, MaxEntries: config.MaxEntries})}
+}
+
+// cacheKey returns the cache key for a request, or false if its response
+// shouldn't be cached
+func (s *Service) cacheKey(ctx context.Context, chatReq ChatRequest) (string, bool) {
+	if s.cache == nil || chatReq.Temperature > s.config.Cache.MaxTemperature {
+		return "", false
+	}
+	if skip, _ := ctx.Value(noCacheKey{}).(bool); skip {
+		return "", false
+	}
+
+	body, err := json.Marshal(chatReq)
+	if err != nil {
+		return "", false
+	}
+	sum := sha256.Sum256(body)
+	return cacheKeyPrefix + hex.EncodeToString(sum[:]), true
+}
+
+// cachedCompletion returns the cached result for a key, if any. Cache
+// failures are logged and count as misses.
+func (s *Service) cachedCompletion(ctx context.Context, key string) *CompletionResult {
+	result, ok, err := s.cache.get(ctx, key)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to read AI response cache")
+	}
+	if !ok {
+		metrics.AICacheLookupsTotal.WithLabelValues(metrics.CacheMiss).Inc()
+		return nil
+	}
+
+	metrics.AICacheLookupsTotal.WithLabelValues(metrics.CacheHit).Inc()
+	result.Cached = true
+	result.LatencyMillis = 0
+	return result
+}
+
+// cacheCompletion stores a result for a key, logging failures
+func (s *Service) cacheCompletion(ctx context.Context, key string, result *CompletionResult) {
+	if err := s.cache.set(ctx, key, result); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to write AI response cache")
+	}
+}
+
+// redisResponseCache keeps responses in Redis, shared between instances
+type redisResponseCache struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func (c *redisResponseCache) get(ctx context.Context, key string) (*CompletionResult, bool, error) {
+	data, err := c.client.Get(ctx, key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	var result CompletionResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false, err
+	}
+	return &result, true, nil
+}
+
+func (c *redisResponseCache) set(ctx context.Context, key string, result *CompletionResult) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, key, data, c.ttl).Err()
+}
+
+// memoryResponseCache keeps responses in process memory
+type memoryResponseCache struct {
+	entries *lru.Cache[string, CompletionResult]
+}
+
+func (c *memoryResponseCache) get(_ context.Context, key string) (*CompletionResult, bool, error) {
+	result, ok := c.entries.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	return &result, true, nil
+}
+
+func (c *memoryResponseCache) set(_ context.Context, key string, result *CompletionResult) error {
+	c.entries.Add(key, *result)
+	return nil
+}
@@ -0,0 +1,160 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Embeddings defaults
+const (
+	defaultEmbeddingsURL   = "https://api.openai.com/v1/embeddings"
+	defaultEmbeddingsModel = "text-embedding-3-small"
+	// defaultEmbeddingsBatchSize keeps requests well under the provider's
+	// limit on inputs per request
+	defaultEmbeddingsBatchSize = 100
+)
+
+// EmbeddingsConfig holds text embedding configuration
+type EmbeddingsConfig struct {
+	// URL is an OpenAI-compatible embeddings endpoint. Defaults to OpenAI's.
+	URL string
+	// Model is the embedding model to request
+	Model string
+	// BatchSize is the most texts sent in one request
+	BatchSize int
+}
+
+// embeddingsRequest is the body sent to the embeddings endpoint
+type embeddingsRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+// embeddingsResponse holds one embedding per input, identified by index
+type embeddingsResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// EmbeddingsModel returns the model embeddings are generated with
+func (s *Service) EmbeddingsModel() string {
+	return s.config.Embeddings.Model
+}
+
+// EmbeddingsBatchSize returns the most texts Embed sends in one request
+func (s *Service) EmbeddingsBatchSize() int {
+	return s.config.Embeddings.BatchSize
+}
+
+// Embed returns an embedding for each of texts, in order. Texts are sent in
+// batches of at most BatchSize, and failed batches are retried like chat
+// requests.
+func (s *Service) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(texts))
+	for start := 0; start < len(texts); start += s.config.Embeddings.BatchSize {
+		end := min(start+s.config.Embeddings.BatchSize, len(texts))
+		batch, err := s.embedBatch(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// embedBatch embeds one batch of texts, retrying rate-limited and
+// server-side failures with exponential backoff
+func (s *Service) embedBatch(ctx context.Context, texts []string) ([][]float32, error) {
+	reqBody, err := json.Marshal(embeddingsRequest{Model: s.config.Embeddings.Model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		embeddings, retryAfter, err := s.sendEmbeddingsRequest(ctx, reqBody, len(texts))
+		if err == nil {
+			return embeddings, nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= s.config.MaxRetries {
+			return nil, fmt.Errorf("error calling embeddings endpoint: %w", err)
+		}
+
+		delay := backoff(attempt, retryAfter)
+		log.Ctx(ctx).Debug().Err(err).Int("attempt", attempt+1).Dur("delay", delay).Msg("Retrying embeddings request")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendEmbeddingsRequest makes a single embeddings call for want texts.
+// Failures worth retrying are wrapped in retryableError.
+func (s *Service) sendEmbeddingsRequest(ctx context.Context, reqBody []byte, want int) ([][]float32, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.config.Embeddings.URL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, &retryableError{err: fmt.Errorf("error sending request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, 0, ErrAIUnauthorized
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("API returned non-200 status code %d: %s", resp.StatusCode, body)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &retryableError{err: err}
+		}
+		return nil, 0, err
+	}
+
+	var embResp embeddingsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&embResp); err != nil {
+		return nil, 0, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// The provider may return embeddings in any order
+	embeddings := make([][]float32, want)
+	for _, d := range embResp.Data {
+		if d.Index < 0 || d.Index >= want {
+			return nil, 0, fmt.Errorf("embedding index %d out of range", d.Index)
+		}
+		embeddings[d.Index] = d.Embedding
+	}
+	for i, e := range embeddings {
+		if len(e) == 0 {
+			return nil, 0, fmt.Errorf("no embedding returned for input %d", i)
+		}
+	}
+
+	return embeddings, 0, nil
+}
@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/llamasearch/llamachat/internal/lru"
+)
+
+// ErrContentFlagged is matched by the ModerationError returned when a
+// message is blocked by moderation
+var ErrContentFlagged = errors.New("content was flagged by moderation")
+
+// Moderation defaults
+const (
+	defaultModerationURL    = "https://api.openai.com/v1/moderations"
+	defaultModerationModel  = "omni-moderation-latest"
+	moderationCacheTTL      = time.Hour
+	moderationCacheEntries  = 1000
+	moderationBlockedNotice = "The assistant can't respond to that message because it appears to violate the content policy."
+)
+
+// ModerationConfig holds content moderation configuration
+type ModerationConfig struct {
+	// Enabled screens messages before they are sent to the model
+	Enabled bool
+	// URL is an OpenAI-compatible moderation endpoint. Defaults to OpenAI's.
+	URL string
+	// Model is the moderation model to request
+	Model string
+}
+
+// Moderator screens text, reporting whether it is flagged and under which
+// categories
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (flagged bool, categories []string, err error)
+}
+
+// ModerationError is returned with the policy notice when a message was
+// blocked, so callers can log or escalate the categories it was flagged for
+type ModerationError struct {
+	Categories []string
+}
+
+func (e *ModerationError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrContentFlagged, strings.Join(e.Categories, ", "))
+}
+
+func (e *ModerationError) Is(target error) bool { return target == ErrContentFlagged }
+
+// moderationResult is a cached verdict
+type moderationResult struct {
+	flagged    bool
+	categories []string
+}
+
+// SetModerator replaces the moderation check with a custom one, enabling
+// moderation. It must be called before the service is used.
+func (s *Service) SetModerator(m Moderator) {
+	s.moderator = m
+	if s.moderations == nil {
+		s.moderations = lru.New[string](lru.Config[moderationResult]{TTL: moderationCacheTTL, MaxEntries: moderationCacheEntries})
+	}
+}
+
+// Moderate screens text with the configured moderator. Verdicts are cached
+// by text, so the same content isn't checked twice. Without a moderator
+// nothing is flagged.
+func (s *Service) Moderate(ctx context.Context, text string) (bool, []string, error) {
+	if s.moderator == nil {
+		return false, nil, nil
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	key := hex.EncodeToString(sum[:])
+	if result, ok := s.moderations.Get(key); ok {
+		return result.flagged, result.categories, nil
+	}
+
+	flagged, categories, err := s.moderator.Moderate(ctx, text)
+	if err != nil {
+		return false, nil, fmt.Errorf("failed to moderate content: %w", err)
+	}
+	s.moderations.Add(key, moderationResult{flagged: flagged, categories: categories})
+	return flagged, categories, nil
+}
+
+// openAIModerator checks text with an OpenAI-compatible moderation endpoint
+type openAIModerator struct {
+	client *http.Client
+	url    string
+	model  string
+	apiKey string
+}
+
+// moderationRequest is the body sent to the moderation endpoint
+type moderationRequest struct {
+	Model string `json:"model,omitempty"`
+	Input string `json:"input"`
+}
+
+// moderationResponse is the moderation endpoint's verdict
+type moderationResponse struct {
+	Results []struct {
+		Flagged    bool            `json:"flagged"`
+		Categories map[string]bool `json:"categories"`
+	} `json:"results"`
+}
+
+func (m *openAIModerator) Moderate(ctx context.Context, text string) (bool, []string, error) {
+	body, err := json.Marshal(moderationRequest{Model: m.model, Input: text})
+	if err != nil {
+		return false, nil, fmt.Errorf("error marshaling request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.url, bytes.NewBuffer(body))
+	if err != nil {
+		return false, nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+m.apiKey)
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return false, nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return false, nil, fmt.Errorf("moderation endpoint returned non-200 status code %d: %s", resp.StatusCode, body)
+	}
+
+	var modResp moderationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&modResp); err != nil {
+		return false, nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if len(modResp.Results) == 0 {
+		return false, nil, fmt.Errorf("no result from moderation endpoint")
+	}
+
+	result := modResp.Results[0]
+	var categories []string
+	for category, hit := range result.Categories {
+		if hit {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return result.Flagged, categories, nil
+}
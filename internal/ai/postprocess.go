@@ -0,0 +1,105 @@
+package ai
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ellipsis marks a response shortened to the configured maximum length
+const ellipsis = "…"
+
+// PostProcessConfig configures the rewriting applied to model responses
+// before they are shown to users. Rules run in field order.
+type PostProcessConfig struct {
+	// StripPatterns are regular expressions whose matches are removed, e.g.
+	// `^(?i)as an ai language model,?\s*`
+	StripPatterns []string
+	// MaxLength caps the response at this many characters, ending it with an
+	// ellipsis. Zero disables the cap.
+	MaxLength int
+	// Disclaimer is appended to every response, on its own paragraph
+	Disclaimer string
+}
+
+// PostProcessor rewrites a model response
+type PostProcessor interface {
+	Process(response string) string
+}
+
+// PostProcessorFunc adapts a function to the PostProcessor interface
+type PostProcessorFunc func(response string) string
+
+// Process calls f(response)
+func (f PostProcessorFunc) Process(response string) string {
+	return f(response)
+}
+
+// NewPostProcessors builds the pipeline described by config
+func NewPostProcessors(config PostProcessConfig) ([]PostProcessor, error) {
+	var processors []PostProcessor
+
+	if len(config.StripPatterns) > 0 {
+		patterns := make([]*regexp.Regexp, 0, len(config.StripPatterns))
+		for _, pattern := range config.StripPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid strip pattern %q: %w", pattern, err)
+			}
+			patterns = append(patterns, re)
+		}
+		processors = append(processors, StripPatterns(patterns))
+	}
+
+	if config.MaxLength > 0 {
+		processors = append(processors, MaxLength(config.MaxLength))
+	}
+
+	if config.Disclaimer != "" {
+		processors = append(processors, AppendDisclaimer(config.Disclaimer))
+	}
+
+	return processors, nil
+}
+
+// StripPatterns removes every match of the patterns, then trims surrounding
+// whitespace left behind
+func StripPatterns(patterns []*regexp.Regexp) PostProcessor {
+	return PostProcessorFunc(func(response string) string {
+		for _, re := range patterns {
+			response = re.ReplaceAllString(response, "")
+		}
+		return strings.TrimSpace(response)
+	})
+}
+
+// MaxLength shortens responses longer than max characters, replacing the
+// end with an ellipsis so the result is exactly max characters
+func MaxLength(max int) PostProcessor {
+	return PostProcessorFunc(func(response string) string {
+		if utf8.RuneCountInString(response) <= max {
+			return response
+		}
+		runes := []rune(response)
+		return strings.TrimRight(string(runes[:max-1]), " \t\n") + ellipsis
+	})
+}
+
+// AppendDisclaimer adds a disclaimer paragraph to the end of responses
+func AppendDisclaimer(disclaimer string) PostProcessor {
+	return PostProcessorFunc(func(response string) string {
+		if response == "" {
+			return disclaimer
+		}
+		return response + "\n\n" + disclaimer
+	})
+}
+
+// postProcess runs a response through the pipeline
+func (s *Service) postProcess(response string) string {
+	for _, p := range s.postProcessors {
+		response = p.Process(response)
+	}
+	return response
+}
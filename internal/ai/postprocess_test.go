@@ -0,0 +1,95 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+)
+
+func TestPostProcessRules(t *testing.T) {
+	tests := []struct {
+		name      string
+		processor PostProcessor
+		in, want  string
+	}{
+		{
+			"strip boilerplate",
+			StripPatterns([]*regexp.Regexp{regexp.MustCompile(`^(?i)as an ai language model,?\s*`)}),
+			"As an AI language model, I think Paris.", "I think Paris.",
+		},
+		{
+			"strip every match of every pattern",
+			StripPatterns([]*regexp.Regexp{regexp.MustCompile(`\[citation needed\]`), regexp.MustCompile(`(?m)^Note:.*$`)}),
+			"Paris[citation needed] is large[citation needed].\nNote: internal", "Paris is large.",
+		},
+		{"short response is kept", MaxLength(10), "Paris.", "Paris."},
+		{"exactly at the cap", MaxLength(6), "Paris.", "Paris."},
+		{"cap counts characters", MaxLength(5), "añejo", "añejo"},
+		{"over the cap", MaxLength(8), "Paris is the capital", "Paris i…"},
+		{"trailing space dropped before ellipsis", MaxLength(7), "Paris is the capital", "Paris…"},
+		{"disclaimer", AppendDisclaimer("AI-generated."), "Paris.", "Paris.\n\nAI-generated."},
+		{"disclaimer on empty response", AppendDisclaimer("AI-generated."), "", "AI-generated."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.processor.Process(tt.in); got != tt.want {
+				t.Errorf("Process(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxLengthNeverExceedsCap(t *testing.T) {
+	for max := 1; max < 20; max++ {
+		got := MaxLength(max).Process(strings.Repeat("ñ ", 20))
+		if n := utf8.RuneCountInString(got); n > max {
+			t.Errorf("MaxLength(%d) gave %d characters: %q", max, n, got)
+		}
+	}
+}
+
+func TestNewPostProcessorsRejectsInvalidPattern(t *testing.T) {
+	if _, err := NewPostProcessors(PostProcessConfig{StripPatterns: []string{"(unclosed"}}); err == nil {
+		t.Error("invalid strip pattern accepted")
+	}
+	processors, err := NewPostProcessors(PostProcessConfig{})
+	if err != nil || len(processors) != 0 {
+		t.Errorf("empty config = %d processors, %v; want none", len(processors), err)
+	}
+}
+
+func TestGenerateCompletionPostProcesses(t *testing.T) {
+	const raw = "As an AI, I'd say the answer is forty-two, give or take."
+	provider := newFakeProvider(t, raw, FinishReasonStop)
+	s := provider.service(Config{PostProcess: PostProcessConfig{
+		StripPatterns: []string{`^As an AI, `},
+		MaxLength:     20,
+		Disclaimer:    "Answers may be wrong.",
+	}})
+
+	// Rules run in order: the cap applies after stripping, the disclaimer
+	// is added after the cap, and custom rules run last
+	s.AddPostProcessor(PostProcessorFunc(strings.ToUpper))
+
+	var logs bytes.Buffer
+	ctx := zerolog.New(&logs).WithContext(context.Background())
+
+	result, err := s.GenerateCompletion(ctx, "", "what is the answer?", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	if want := "I'D SAY THE ANSWER…\n\nANSWERS MAY BE WRONG."; result.Content != want {
+		t.Errorf("content = %q, want %q", result.Content, want)
+	}
+
+	// The raw response stays available in the debug log
+	if !strings.Contains(logs.String(), "forty-two, give or take") {
+		t.Errorf("raw response not logged: %s", logs.String())
+	}
+}
@@ -0,0 +1,103 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGenerateCompletionResultFields(t *testing.T) {
+	provider := newFakeProvider(t, "", "")
+	provider.respond = func(w http.ResponseWriter, req ChatRequest) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ChatResponse{
+			// Providers report the dated model that actually answered
+			Model: req.Model + "-2024-08-06",
+			Choices: []Choice{{
+				Message:      Message{Role: "assistant", Content: "forty-two"},
+				FinishReason: FinishReasonStop,
+			}},
+			Usage: Usage{PromptTokens: 31, CompletionTokens: 4, TotalTokens: 35},
+		})
+	}
+	s := provider.service(Config{})
+
+	result, err := s.GenerateCompletion(context.Background(), "gpt-test", "what is the answer?", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+
+	if result.Content != "forty-two" {
+		t.Errorf("Content = %q, want the provider's response", result.Content)
+	}
+	if result.Model != "gpt-test-2024-08-06" {
+		t.Errorf("Model = %q, want the model the provider reported", result.Model)
+	}
+	if want := (Usage{PromptTokens: 31, CompletionTokens: 4, TotalTokens: 35}); result.Usage != want {
+		t.Errorf("Usage = %+v, want %+v", result.Usage, want)
+	}
+	if result.FinishReason != FinishReasonStop {
+		t.Errorf("FinishReason = %q, want %q", result.FinishReason, FinishReasonStop)
+	}
+	if result.LatencyMillis < 20 {
+		t.Errorf("LatencyMillis = %d, want at least the provider's 20ms", result.LatencyMillis)
+	}
+	if result.Cached {
+		t.Error("Cached set on a result from the provider")
+	}
+
+	// The string-only method returns the same content
+	content, err := s.GenerateResponse(context.Background(), "what is the answer?", nil)
+	if err != nil {
+		t.Fatalf("GenerateResponse: %v", err)
+	}
+	if content != result.Content {
+		t.Errorf("GenerateResponse = %q, want %q", content, result.Content)
+	}
+}
+
+func TestGenerateCompletionResultFallsBackToRequestedModel(t *testing.T) {
+	provider := newFakeProvider(t, "", "")
+	provider.respond = func(w http.ResponseWriter, req ChatRequest) {
+		writeCompletion(w, "", "ok", FinishReasonStop)
+	}
+	s := provider.service(Config{})
+
+	result, err := s.GenerateCompletion(context.Background(), "gpt-test", "hi", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	if result.Model != "gpt-test" {
+		t.Errorf("Model = %q, want the requested model when the provider doesn't say", result.Model)
+	}
+}
+
+func TestGenerateCompletionResultFromCache(t *testing.T) {
+	provider := newFakeProvider(t, "cached answer", FinishReasonStop)
+	s := provider.service(Config{Cache: CacheConfig{Enabled: true}})
+
+	first, err := s.GenerateCompletion(context.Background(), "gpt-test", "hi", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	second, err := s.GenerateCompletion(context.Background(), "gpt-test", "hi", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+
+	if len(provider.calls()) != 1 {
+		t.Errorf("provider called %d times, want 1", len(provider.calls()))
+	}
+	if first.Cached || !second.Cached {
+		t.Errorf("Cached = %v, %v; want false then true", first.Cached, second.Cached)
+	}
+	if second.LatencyMillis != 0 {
+		t.Errorf("cached LatencyMillis = %d, want 0", second.LatencyMillis)
+	}
+	if second.Content != first.Content || second.Usage != first.Usage || second.Model != first.Model {
+		t.Errorf("cached result = %+v, want the first result's content, model and usage", second)
+	}
+}
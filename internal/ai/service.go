@@ -4,12 +4,57 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/lru"
+	"github.com/llamasearch/llamachat/internal/metrics"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+var (
+	// ErrModelNotAllowed is returned when a requested model is not in the allowlist
+	ErrModelNotAllowed = errors.New("model is not allowed")
+	// ErrResponseFiltered is returned when the provider withheld the response
+	ErrResponseFiltered = errors.New("response was filtered by the provider")
+	// ErrResponseTruncated is returned alongside the partial content when the
+	// response hit the token limit
+	ErrResponseTruncated = errors.New("response was cut off")
+	// ErrAIUnauthorized is returned when the API key is missing or rejected by the provider
+	ErrAIUnauthorized = errors.New("AI provider rejected the API key")
+)
+
+// Finish reasons reported by the provider
+const (
+	FinishReasonStop          = "stop"
+	FinishReasonLength        = "length"
+	FinishReasonContentFilter = "content_filter"
+)
+
+// Notices shown to users in place of, or after, an incomplete AI response
+const (
+	filteredNotice     = "The assistant's response was filtered by the provider's content policy."
+	truncatedNotice    = "(response was cut off)"
+	unconfiguredNotice = "The assistant is not configured. Please contact an administrator."
+	tooLongNotice      = "That message is too long for the assistant to answer."
+)
+
+// Retry timing for transient API failures
+const (
+	defaultMaxRetries = 3
+	baseRetryDelay    = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
 )
 
 // Config holds AI provider configuration
@@ -20,12 +65,61 @@ type Config struct {
 	Temperature  float64
 	MaxTokens    int
 	SystemPrompt string
+	// AllowedModels restricts which models may be requested. Empty means no restriction.
+	AllowedModels []string
+	// MaxRetries is how many times a rate-limited or failed request is
+	// retried. Zero disables retries; a negative value means unset and uses
+	// the default of 3.
+	MaxRetries int
+	// MinTriggerLength is the fewest characters a message must have, once the
+	// trigger is removed, to be sent to the model. Zero disables the check.
+	MinTriggerLength int
+	// ShortTriggerReply is posted in response to messages under
+	// MinTriggerLength. Empty ignores them silently.
+	ShortTriggerReply string
+	// Triggers address a message to the assistant. Those starting with "@"
+	// are mentions matched anywhere in a message; others, such as "/ai", are
+	// commands matched only at its start. Empty means DefaultTrigger.
+	Triggers []string
+	// PostProcess rewrites responses before they are returned
+	PostProcess PostProcessConfig
+	// Webhook is the gateway called when Provider is ProviderWebhook
+	Webhook WebhookConfig
+	// ContextWindow is the model's context size in tokens, which the system
+	// prompt, history, message and reply must fit in. Zero uses a size known
+	// for the model.
+	ContextWindow int
+	// SummarizeDroppedContext replaces history trimmed to fit the context
+	// window with a system note quoting it
+	SummarizeDroppedContext bool
+	// Cache serves repeated identical requests without calling the provider
+	Cache CacheConfig
+	// Moderation screens messages before they are sent to the model
+	Moderation ModerationConfig
+	// Embeddings is the endpoint and model Embed uses
+	Embeddings EmbeddingsConfig
+	// MonthlyTokenQuota caps the tokens each user's requests may use per
+	// calendar month (UTC). Zero means no limit. Enforced once a usage store
+	// is set.
+	MonthlyTokenQuota int
 }
 
 // Service provides AI functionality
 type Service struct {
-	config Config
-	client *http.Client
+	config         Config
+	client         *http.Client
+	postProcessors []PostProcessor
+	// webhookTemplate and webhookPath are parsed from config.Webhook
+	webhookTemplate *template.Template
+	webhookPath     []string
+	// usage records token usage and backs the monthly quota, if set
+	usage UsageStore
+	// cache holds responses to identical requests, if enabled
+	cache responseCache
+	// moderator screens messages before they are sent, if set, and
+	// moderations caches its verdicts
+	moderator   Moderator
+	moderations *lru.Cache[string, moderationResult]
 }
 
 // Message represents a message in a conversation
@@ -44,84 +138,276 @@ type ChatRequest struct {
 
 // ChatResponse represents a response from the chat API
 type ChatResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Choices []struct {
-		Message      Message `json:"message"`
-		FinishReason string  `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
+}
+
+// Choice is one candidate response
+type Choice struct {
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// Usage is the number of tokens a request used
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// CompletionResult is a generated response along with what it took to
+// produce it
+type CompletionResult struct {
+	// Content is the post-processed response
+	Content string `json:"content"`
+	// Model is the model that answered, as reported by the provider
+	Model string `json:"model"`
+	Usage Usage  `json:"usage"`
+	// FinishReason is why the model stopped, one of the FinishReason* values
+	FinishReason string `json:"finish_reason"`
+	// LatencyMillis is how long the provider took, retries included
+	LatencyMillis int64 `json:"latency_ms"`
+	// Cached is set when the result was served without calling the provider
+	Cached bool `json:"cached"`
 }
 
 // NewService creates a new AI service
 func NewService(config Config) *Service {
-	return &Service{
+	if config.MaxRetries < 0 {
+		config.MaxRetries = defaultMaxRetries
+	}
+	if config.Embeddings.URL == "" {
+		config.Embeddings.URL = defaultEmbeddingsURL
+	}
+	if config.Embeddings.Model == "" {
+		config.Embeddings.Model = defaultEmbeddingsModel
+	}
+	if config.Embeddings.BatchSize <= 0 {
+		config.Embeddings.BatchSize = defaultEmbeddingsBatchSize
+	}
+
+	// AI is optional, so a missing key only disables the assistant. Webhooks
+	// may not need one.
+	if config.APIKey == "" && !IsWebhookProvider(config.Provider) {
+		log.Warn().Msg("AI API key is not configured; the assistant will be unavailable")
+	}
+
+	if len(config.AllowedModels) > 0 && !isModelAllowed(config.Model, config.AllowedModels) {
+		log.Warn().
+			Str("model", config.Model).
+			Strs("allowed_models", config.AllowedModels).
+			Msg("Configured AI model is not in the allowlist; requests will be rejected")
+	}
+
+	postProcessors, err := NewPostProcessors(config.PostProcess)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid AI post-processing configuration; responses will not be post-processed")
+	}
+
+	service := &Service{
 		config: config,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		postProcessors: postProcessors,
 	}
+	service.cache = newResponseCache(&service.config.Cache)
+
+	if config.Moderation.Enabled {
+		moderator := &openAIModerator{
+			client: service.client,
+			url:    config.Moderation.URL,
+			model:  config.Moderation.Model,
+			apiKey: config.APIKey,
+		}
+		if moderator.url == "" {
+			moderator.url = defaultModerationURL
+			if moderator.model == "" {
+				moderator.model = defaultModerationModel
+			}
+		}
+		service.SetModerator(moderator)
+	}
+
+	if IsWebhookProvider(config.Provider) {
+		if err := ValidateWebhook(config.Webhook); err != nil {
+			log.Error().Err(err).Msg("Invalid AI webhook configuration; requests will fail")
+		}
+		service.webhookTemplate, _ = parseRequestTemplate(config.Webhook.RequestTemplate)
+		service.webhookPath, _ = parseResponsePath(config.Webhook.ResponsePath)
+	}
+
+	return service
 }
 
-// GenerateResponse generates a response to a user message
+// AddPostProcessor appends a custom rule to the end of the response
+// post-processing pipeline. It must be called before the service is used.
+func (s *Service) AddPostProcessor(p PostProcessor) {
+	s.postProcessors = append(s.postProcessors, p)
+}
+
+// GenerateResponse generates a response to a user message using the configured model
 func (s *Service) GenerateResponse(ctx context.Context, userMessage string, conversationHistory []Message) (string, error) {
-	var messages []Message
+	result, err := s.GenerateCompletion(ctx, s.config.Model, userMessage, conversationHistory)
+	if result == nil {
+		return "", err
+	}
+	return result.Content, err
+}
 
-	// Add system prompt if provided
-	if s.config.SystemPrompt != "" {
-		messages = append(messages, Message{
-			Role:    "system",
-			Content: s.config.SystemPrompt,
-		})
+// GenerateCompletion generates a response using the given model, which must
+// be permitted by the configured allowlist. A filtered response returns the
+// result with ErrResponseFiltered and no content; a truncated one returns the
+// result, partial content included, with ErrResponseTruncated.
+func (s *Service) GenerateCompletion(ctx context.Context, model, userMessage string, conversationHistory []Message) (*CompletionResult, error) {
+	if err := s.ValidateModel(model); err != nil {
+		return nil, err
 	}
 
-	// Add conversation history
-	messages = append(messages, conversationHistory...)
+	if s.config.APIKey == "" && !IsWebhookProvider(s.config.Provider) {
+		return nil, ErrAIUnauthorized
+	}
 
-	// Add user message
-	messages = append(messages, Message{
-		Role:    "user",
-		Content: userMessage,
-	})
+	// Long conversations lose their oldest turns to fit the context window
+	messages, dropped, err := s.buildMessages(model, userMessage, conversationHistory)
+	if err != nil {
+		return nil, err
+	}
+	if dropped > 0 {
+		log.Ctx(ctx).Debug().Str("model", model).Int("dropped", dropped).Msg("Conversation history trimmed to fit the context window")
+	}
 
 	// Create chat request
 	chatReq := ChatRequest{
-		Model:       s.config.Model,
+		Model:       model,
 		Messages:    messages,
 		Temperature: s.config.Temperature,
 		MaxTokens:   s.config.MaxTokens,
 	}
 
-	// Send request to OpenAI API
-	resp, err := s.callOpenAI(ctx, chatReq)
+	// Identical requests at low temperatures get the same answer
+	cacheKey, cacheable := s.cacheKey(ctx, chatReq)
+	if cacheable {
+		if result := s.cachedCompletion(ctx, cacheKey); result != nil {
+			return result, nil
+		}
+	}
+
+	// Send request to the provider
+	start := time.Now()
+	resp, err := s.callProvider(ctx, chatReq)
 	if err != nil {
-		return "", fmt.Errorf("error calling OpenAI API: %w", err)
+		return nil, fmt.Errorf("error calling AI provider: %w", err)
 	}
 
 	// Check if there are any choices
 	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response from AI")
+		return nil, fmt.Errorf("no response from AI")
+	}
+
+	choice := resp.Choices[0]
+	result := &CompletionResult{
+		Model:         resp.Model,
+		Usage:         resp.Usage,
+		FinishReason:  choice.FinishReason,
+		LatencyMillis: time.Since(start).Milliseconds(),
+	}
+	if result.Model == "" {
+		result.Model = model
+	}
+
+	// Signal incomplete responses so callers can tell users what happened
+	if choice.FinishReason == FinishReasonContentFilter {
+		return result, ErrResponseFiltered
 	}
 
-	// Return the first choice's message content
-	return resp.Choices[0].Message.Content, nil
+	// The raw response is only logged; callers get the post-processed one
+	raw := choice.Message.Content
+	result.Content = s.postProcess(raw)
+	if result.Content != raw {
+		log.Ctx(ctx).Debug().Str("model", model).Str("raw_response", raw).Msg("AI response post-processed")
+	}
+
+	if choice.FinishReason == FinishReasonLength {
+		return result, ErrResponseTruncated
+	}
+
+	if cacheable {
+		s.cacheCompletion(ctx, cacheKey, result)
+	}
+
+	return result, nil
 }
 
-// callOpenAI sends a request to the OpenAI API
-func (s *Service) callOpenAI(ctx context.Context, chatReq ChatRequest) (*ChatResponse, error) {
-	reqBody, err := json.Marshal(chatReq)
+// callProvider sends a request to the configured provider, retrying
+// rate-limited and server-side failures with exponential backoff
+func (s *Service) callProvider(ctx context.Context, chatReq ChatRequest) (resp *ChatResponse, err error) {
+	send := s.sendOpenAIRequest
+	var reqBody []byte
+	if IsWebhookProvider(s.config.Provider) {
+		send = s.sendWebhookRequest
+		reqBody, err = s.webhookBody(chatReq)
+	} else {
+		reqBody, err = json.Marshal(chatReq)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error marshaling request: %w", err)
 	}
 
+	defer func(start time.Time) {
+		outcome := metrics.OutcomeSuccess
+		if err != nil {
+			outcome = metrics.OutcomeError
+		}
+		metrics.AIRequestsTotal.WithLabelValues(chatReq.Model, outcome).Inc()
+		metrics.AIRequestDuration.WithLabelValues(chatReq.Model).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	for attempt := 0; ; attempt++ {
+		resp, retryAfter, err := send(ctx, chatReq.Model, reqBody)
+		if err == nil {
+			if attempt > 0 {
+				log.Ctx(ctx).Debug().Str("model", chatReq.Model).Int("retries", attempt).Msg("AI provider call succeeded after retries")
+			}
+			return resp, nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) || attempt >= s.config.MaxRetries {
+			if attempt > 0 {
+				log.Ctx(ctx).Debug().Err(err).Str("model", chatReq.Model).Int("retries", attempt).Msg("AI provider call failed after retries")
+			}
+			return nil, err
+		}
+
+		delay := backoff(attempt, retryAfter)
+		log.Ctx(ctx).Debug().
+			Err(err).
+			Str("model", chatReq.Model).
+			Int("retry", attempt+1).
+			Dur("delay", delay).
+			Msg("Retrying AI provider call")
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// sendOpenAIRequest makes a single API call. Failures worth retrying are
+// wrapped in retryableError, along with any Retry-After delay the API asked for.
+func (s *Service) sendOpenAIRequest(ctx context.Context, model string, reqBody []byte) (*ChatResponse, time.Duration, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return nil, 0, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
@@ -130,46 +416,132 @@ func (s *Service) callOpenAI(ctx context.Context, chatReq ChatRequest) (*ChatRes
 	start := time.Now()
 	resp, err := s.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error sending request: %w", err)
+		// A cancelled or expired context is the caller giving up, not a transient failure
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, &retryableError{err: fmt.Errorf("error sending request: %w", err)}
 	}
 	defer resp.Body.Close()
 
-	log.Debug().
-		Str("model", s.config.Model).
+	log.Ctx(ctx).Debug().
+		Str("model", model).
 		Dur("duration", time.Since(start)).
 		Int("status_code", resp.StatusCode).
 		Msg("OpenAI API call completed")
 
+	// The body of a 401 only restates that the key is bad, so don't log it
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, 0, ErrAIUnauthorized
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned non-200 status code %d: %s", resp.StatusCode, body)
+		err := fmt.Errorf("API returned non-200 status code %d: %s", resp.StatusCode, body)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &retryableError{err: err}
+		}
+		return nil, 0, err
 	}
 
 	var chatResp ChatResponse
 	if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
-		return nil, fmt.Errorf("error decoding response: %w", err)
+		return nil, 0, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	return &chatResp, nil
+	return &chatResp, 0, nil
 }
 
-// ProcessMessageWithAI checks if a message should be processed by AI and generates a response
-func (s *Service) ProcessMessageWithAI(ctx context.Context, message string, conversationHistory []Message) (bool, string, error) {
-	// Check if the message appears to be addressed to the AI
-	// This is a simple check - in a real application, this would be more sophisticated
-	// For example, checking if the message starts with "@ai" or contains the bot's name
+// retryableError marks a failure that may succeed if the request is repeated
+type retryableError struct {
+	err error
+}
 
-	// For now, just check if the message contains the trigger word
-	// This is just an example and would be customized in a real application
-	const aiTrigger = "@ai"
+func (e *retryableError) Error() string { return e.err.Error() }
 
-	if containsIgnoreCase(message, aiTrigger) {
-		// Remove the trigger from the message
-		cleanMessage := removeSubstring(message, aiTrigger)
+func (e *retryableError) Unwrap() error { return e.err }
 
-		// Generate AI response
-		response, err := s.GenerateResponse(ctx, cleanMessage, conversationHistory)
+// backoff returns the delay before the given retry: the server's Retry-After
+// if it sent one, otherwise exponential backoff with full jitter
+func backoff(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, maxRetryDelay)
+	}
+
+	ceiling := min(baseRetryDelay<<attempt, maxRetryDelay)
+	return time.Duration(rand.Int63n(int64(ceiling)) + 1)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// ProcessMessageWithAI checks if a message should be processed by AI and generates a response.
+// userID is the user who sent it, whose token quota is checked and charged.
+// model overrides the configured model when it isn't empty, and must be in
+// the allowlist. A message flagged by moderation is answered with a policy
+// notice and a *ModerationError.
+func (s *Service) ProcessMessageWithAI(ctx context.Context, userID uuid.UUID, model, message string, conversationHistory []Message) (bool, string, error) {
+	if model == "" {
+		model = s.config.Model
+	}
+
+	if cleanMessage, ok := s.stripTrigger(message); ok {
+
+		// Too little to go on is not worth a model call
+		if s.config.MinTriggerLength > 0 && utf8.RuneCountInString(strings.TrimSpace(cleanMessage)) < s.config.MinTriggerLength {
+			if s.config.ShortTriggerReply == "" {
+				return false, "", nil
+			}
+			return true, s.config.ShortTriggerReply, nil
+		}
+
+		// Flagged content never reaches the model; the caller gets the
+		// categories to log or escalate along with the notice
+		flagged, categories, err := s.Moderate(ctx, cleanMessage)
+		if err != nil {
+			return false, "", err
+		}
+		if flagged {
+			return true, moderationBlockedNotice, &ModerationError{Categories: categories}
+		}
+
+		over, err := s.overQuota(ctx, userID)
 		if err != nil {
+			return false, "", err
+		}
+		if over {
+			return true, quotaNotice, nil
+		}
+
+		// Generate AI response
+		result, err := s.GenerateCompletion(ctx, model, cleanMessage, conversationHistory)
+		s.recordUsage(ctx, userID, result)
+		var response string
+		if result != nil {
+			response = result.Content
+		}
+		switch {
+		case errors.Is(err, ErrResponseFiltered):
+			return true, filteredNotice, nil
+		case errors.Is(err, ErrResponseTruncated):
+			return true, response + "\n\n" + truncatedNotice, nil
+		case errors.Is(err, ErrContextTooLong):
+			return true, tooLongNotice, nil
+		case errors.Is(err, ErrAIUnauthorized):
+			log.Ctx(ctx).Error().Err(err).Msg("AI assistant triggered but the API key is missing or invalid")
+			return true, unconfiguredNotice, nil
+		case err != nil:
 			return false, "", fmt.Errorf("error generating AI response: %w", err)
 		}
 
@@ -180,25 +552,46 @@ func (s *Service) ProcessMessageWithAI(ctx context.Context, message string, conv
 	return false, "", nil
 }
 
+// HistoryFromMessages converts chat messages, oldest first, into conversation
+// history. Deleted and encrypted messages are skipped since their content is
+// either gone or unreadable to the model.
+func HistoryFromMessages(messages []*models.Message) []Message {
+	history := make([]Message, 0, len(messages))
+	for _, m := range messages {
+		if m.IsDeleted || m.ContentEncrypted {
+			continue
+		}
+		role := "user"
+		if m.IsAIGenerated {
+			role = "assistant"
+		}
+		history = append(history, Message{
+			Role:    role,
+			Content: m.Content,
+		})
+	}
+	return history
+}
+
+// ValidateModel checks that a model may be used according to the allowlist
+func (s *Service) ValidateModel(model string) error {
+	if len(s.config.AllowedModels) == 0 {
+		return nil
+	}
+	if !isModelAllowed(model, s.config.AllowedModels) {
+		return fmt.Errorf("%w: %q", ErrModelNotAllowed, model)
+	}
+	return nil
+}
+
 // Helper functions
 
-// containsIgnoreCase checks if a string contains a substring, ignoring case
-func containsIgnoreCase(s, substr string) bool {
-	// Simple implementation for demo purposes
-	// In a real application, you would use a more sophisticated approach
-	return bytes.Contains(
-		bytes.ToLower([]byte(s)),
-		bytes.ToLower([]byte(substr)),
-	)
-}
-
-// removeSubstring removes a substring from a string
-func removeSubstring(s, substr string) string {
-	// Simple implementation for demo purposes
-	// In a real application, you would use a more sophisticated approach
-	return string(bytes.ReplaceAll(
-		[]byte(s),
-		[]byte(substr),
-		[]byte(""),
-	))
+// isModelAllowed checks if a model is present in the allowlist
+func isModelAllowed(model string, allowed []string) bool {
+	for _, m := range allowed {
+		if m == model {
+			return true
+		}
+	}
+	return false
 }
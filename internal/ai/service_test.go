@@ -0,0 +1,288 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// fakeProvider stands in for the provider's chat completions API. It records
+// the requests it receives and answers each with respond.
+type fakeProvider struct {
+	t       *testing.T
+	server  *httptest.Server
+	respond func(w http.ResponseWriter, req ChatRequest)
+
+	mu       sync.Mutex
+	requests []ChatRequest
+}
+
+// newFakeProvider starts a fake provider that answers every request with the
+// given content and finish reason
+func newFakeProvider(t *testing.T, content, finishReason string) *fakeProvider {
+	p := &fakeProvider{t: t}
+	p.respond = func(w http.ResponseWriter, req ChatRequest) {
+		writeCompletion(w, req.Model, content, finishReason)
+	}
+	p.server = httptest.NewServer(http.HandlerFunc(p.serveHTTP))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeProvider) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var req ChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		p.t.Errorf("provider got an invalid request: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	p.requests = append(p.requests, req)
+	p.mu.Unlock()
+
+	p.respond(w, req)
+}
+
+// calls returns the requests received so far
+func (p *fakeProvider) calls() []ChatRequest {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]ChatRequest(nil), p.requests...)
+}
+
+// service creates a Service whose provider calls go to the fake
+func (p *fakeProvider) service(config Config) *Service {
+	if config.APIKey == "" {
+		config.APIKey = "test-key"
+	}
+	if config.Model == "" {
+		config.Model = "gpt-test"
+	}
+	s := NewService(config)
+
+	target, _ := url.Parse(p.server.URL)
+	s.client.Transport = redirectTransport{target: target}
+	return s
+}
+
+// redirectTransport sends every request to target, keeping its path
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = rt.target.Scheme
+	req.URL.Host = rt.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// writeCompletion writes a chat completion response with one choice
+func writeCompletion(w http.ResponseWriter, model, content, finishReason string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChatResponse{
+		Model: model,
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: content},
+			FinishReason: finishReason,
+		}},
+		Usage: Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15},
+	})
+}
+
+func TestValidateModel(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		model   string
+		wantErr bool
+	}{
+		{"empty allowlist allows anything", nil, "any-model", false},
+		{"listed model", []string{"gpt-4o", "gpt-4o-mini"}, "gpt-4o-mini", false},
+		{"unlisted model", []string{"gpt-4o"}, "gpt-4-32k", true},
+		{"match is exact", []string{"gpt-4o"}, "gpt-4o-2024", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(Config{APIKey: "k", Model: "gpt-4o", AllowedModels: tt.allowed})
+			err := s.ValidateModel(tt.model)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("ValidateModel(%q) = %v, want error: %v", tt.model, err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrModelNotAllowed) {
+				t.Errorf("error = %v, want ErrModelNotAllowed", err)
+			}
+		})
+	}
+}
+
+func TestGenerateCompletionRejectsDisallowedModel(t *testing.T) {
+	provider := newFakeProvider(t, "hello", FinishReasonStop)
+	s := provider.service(Config{Model: "gpt-4o", AllowedModels: []string{"gpt-4o"}})
+
+	_, err := s.GenerateCompletion(context.Background(), "gpt-4-32k", "hi", nil)
+	if !errors.Is(err, ErrModelNotAllowed) {
+		t.Fatalf("GenerateCompletion error = %v, want ErrModelNotAllowed", err)
+	}
+	if n := len(provider.calls()); n != 0 {
+		t.Errorf("provider was called %d times for a disallowed model", n)
+	}
+}
+
+func TestProcessMessageWithAIModelOverride(t *testing.T) {
+	provider := newFakeProvider(t, "hello", FinishReasonStop)
+	s := provider.service(Config{Model: "gpt-4o", AllowedModels: []string{"gpt-4o", "gpt-4o-mini"}})
+	ctx := context.Background()
+
+	handled, response, err := s.ProcessMessageWithAI(ctx, uuid.Nil, "gpt-4o-mini", "@ai what's up?", nil)
+	if err != nil || !handled || response != "hello" {
+		t.Fatalf("allowed override: got (%v, %q, %v), want (true, %q, nil)", handled, response, err, "hello")
+	}
+	calls := provider.calls()
+	if len(calls) != 1 || calls[0].Model != "gpt-4o-mini" {
+		t.Fatalf("provider requests = %+v, want one for gpt-4o-mini", calls)
+	}
+
+	_, _, err = s.ProcessMessageWithAI(ctx, uuid.Nil, "gpt-4-32k", "@ai what's up?", nil)
+	if !errors.Is(err, ErrModelNotAllowed) {
+		t.Errorf("disallowed override error = %v, want ErrModelNotAllowed", err)
+	}
+	if n := len(provider.calls()); n != 1 {
+		t.Errorf("provider was called for a disallowed override")
+	}
+
+	// No override uses the configured model
+	if _, _, err := s.ProcessMessageWithAI(ctx, uuid.Nil, "", "@ai what's up?", nil); err != nil {
+		t.Fatalf("no override: %v", err)
+	}
+	if calls := provider.calls(); calls[len(calls)-1].Model != "gpt-4o" {
+		t.Errorf("model without override = %q, want gpt-4o", calls[len(calls)-1].Model)
+	}
+}
+
+func TestGenerateCompletionFinishReasons(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		wantErr      error
+		wantContent  string
+	}{
+		{FinishReasonStop, nil, "partial answer"},
+		{FinishReasonLength, ErrResponseTruncated, "partial answer"},
+		{FinishReasonContentFilter, ErrResponseFiltered, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.finishReason, func(t *testing.T) {
+			provider := newFakeProvider(t, "partial answer", tt.finishReason)
+			s := provider.service(Config{})
+
+			result, err := s.GenerateCompletion(context.Background(), "gpt-test", "hi", nil)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if result == nil {
+				t.Fatal("no result returned")
+			}
+			if result.FinishReason != tt.finishReason {
+				t.Errorf("FinishReason = %q, want %q", result.FinishReason, tt.finishReason)
+			}
+			if result.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", result.Content, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestProcessMessageWithAIFinishReasonNotices(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		want         string
+	}{
+		{FinishReasonStop, "partial answer"},
+		{FinishReasonLength, "partial answer\n\n" + truncatedNotice},
+		{FinishReasonContentFilter, filteredNotice},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.finishReason, func(t *testing.T) {
+			provider := newFakeProvider(t, "partial answer", tt.finishReason)
+			s := provider.service(Config{})
+
+			handled, response, err := s.ProcessMessageWithAI(context.Background(), uuid.Nil, "", "@ai tell me a story", nil)
+			if err != nil {
+				t.Fatalf("ProcessMessageWithAI: %v", err)
+			}
+			if !handled || response != tt.want {
+				t.Errorf("got (%v, %q), want (true, %q)", handled, response, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessMessageWithAIMinTriggerLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		minLength   int
+		shortReply  string
+		message     string
+		wantHandled bool
+		wantReply   string
+		wantCall    bool
+	}{
+		{"off by default", 0, "", "@ai ok", true, "answer", true},
+		{"short is skipped", 5, "", "@ai ok", false, "", false},
+		{"emoji counts as one character", 2, "", "@ai 👍", false, "", false},
+		{"surrounding space doesn't count", 5, "", "@ai    hi    ", false, "", false},
+		{"at the threshold", 5, "", "@ai hello", true, "answer", true},
+		{"multibyte at the threshold", 3, "", "@ai ¿qué", true, "answer", true},
+		{"canned reply", 5, "Could you say a bit more?", "@ai ok", true, "Could you say a bit more?", false},
+		{"untriggered message is untouched", 5, "Could you say a bit more?", "ok", false, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newFakeProvider(t, "answer", FinishReasonStop)
+			s := provider.service(Config{MinTriggerLength: tt.minLength, ShortTriggerReply: tt.shortReply})
+
+			handled, reply, err := s.ProcessMessageWithAI(context.Background(), uuid.Nil, "", tt.message, nil)
+			if err != nil {
+				t.Fatalf("ProcessMessageWithAI: %v", err)
+			}
+			if handled != tt.wantHandled || reply != tt.wantReply {
+				t.Errorf("got (%v, %q), want (%v, %q)", handled, reply, tt.wantHandled, tt.wantReply)
+			}
+			if called := len(provider.calls()) > 0; called != tt.wantCall {
+				t.Errorf("provider called = %v, want %v", called, tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestMaxRetries(t *testing.T) {
+	if got := NewService(Config{MaxRetries: -1}).config.MaxRetries; got != defaultMaxRetries {
+		t.Errorf("unset MaxRetries = %d, want the default %d", got, defaultMaxRetries)
+	}
+
+	// Zero turns retries off
+	provider := newFakeProvider(t, "", "")
+	provider.respond = func(w http.ResponseWriter, req ChatRequest) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}
+	s := provider.service(Config{MaxRetries: 0})
+
+	if _, err := s.GenerateCompletion(context.Background(), "", "hi", nil); err == nil {
+		t.Fatal("GenerateCompletion succeeded against a failing provider")
+	}
+	if n := len(provider.calls()); n != 1 {
+		t.Errorf("provider was called %d times with retries off, want 1", n)
+	}
+}
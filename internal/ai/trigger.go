@@ -0,0 +1,131 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultTrigger addresses the assistant when no triggers are configured
+const DefaultTrigger = "@ai"
+
+// Triggers starting with mentionPrefix are mentions, matched anywhere in a
+// message. Any other trigger is a command, such as "/ai", matched only at
+// the start.
+const mentionPrefix = "@"
+
+// ValidateTriggers checks that every trigger is a single non-empty word that
+// is more than a bare "@"
+func ValidateTriggers(triggers []string) error {
+	for _, trigger := range triggers {
+		if trigger == "" || trigger == mentionPrefix {
+			return fmt.Errorf("trigger %q is empty", trigger)
+		}
+		if strings.IndexFunc(trigger, unicode.IsSpace) >= 0 {
+			return fmt.Errorf("trigger %q contains whitespace", trigger)
+		}
+	}
+	return nil
+}
+
+// IsAddressed reports whether a message is addressed to the assistant: it
+// starts with a command trigger or mentions it with a mention trigger
+func (s *Service) IsAddressed(message string) bool {
+	_, ok := s.stripTrigger(message)
+	return ok
+}
+
+// stripTrigger returns message with the trigger that addresses the
+// assistant removed, and whether there was one. Only that first trigger is
+// removed; later occurrences are part of what was said.
+func (s *Service) stripTrigger(message string) (string, bool) {
+	triggers := s.config.Triggers
+	if len(triggers) == 0 {
+		triggers = []string{DefaultTrigger}
+	}
+
+	// A leading trigger of either kind wins over a mention further in
+	trimmed := strings.TrimLeftFunc(message, unicode.IsSpace)
+	for _, trigger := range triggers {
+		if end, ok := matchTrigger(trimmed, 0, trigger); ok {
+			return strings.TrimSpace(trimmed[end:]), true
+		}
+	}
+
+	start, end := -1, -1
+	for _, trigger := range triggers {
+		if !strings.HasPrefix(trigger, mentionPrefix) {
+			continue
+		}
+		for i := range message {
+			if start >= 0 && i >= start {
+				break
+			}
+			if e, ok := matchTrigger(message, i, trigger); ok {
+				start, end = i, e
+				break
+			}
+		}
+	}
+	if start < 0 {
+		return message, false
+	}
+
+	before := strings.TrimRightFunc(message[:start], unicode.IsSpace)
+	after := strings.TrimLeftFunc(message[end:], unicode.IsSpace)
+	if first, _ := utf8.DecodeRuneInString(after); before == "" || after == "" || unicode.IsPunct(first) {
+		return strings.TrimSpace(before + after), true
+	}
+	return strings.TrimSpace(before + " " + after), true
+}
+
+// matchTrigger reports whether trigger occurs in s at byte offset i as a
+// whole word, ignoring case, and returns the offset just past it
+func matchTrigger(s string, i int, trigger string) (int, bool) {
+	if i > 0 {
+		prev, _ := utf8.DecodeLastRuneInString(s[:i])
+		if isWordRune(prev) {
+			return 0, false
+		}
+	}
+
+	end := i
+	for _, want := range trigger {
+		if end >= len(s) {
+			return 0, false
+		}
+		got, size := utf8.DecodeRuneInString(s[end:])
+		if !equalFoldRune(got, want) {
+			return 0, false
+		}
+		end += size
+	}
+
+	if end < len(s) {
+		next, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(next) {
+			return 0, false
+		}
+	}
+	return end, true
+}
+
+// equalFoldRune reports whether two runes are equal under Unicode case folding
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for r := unicode.SimpleFold(a); r != a; r = unicode.SimpleFold(r) {
+		if r == b {
+			return true
+		}
+	}
+	return false
+}
+
+// isWordRune reports whether r can be part of a word, so that a trigger
+// next to it is part of a longer word, name or address
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_' || r == '@'
+}
@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStripTrigger(t *testing.T) {
+	tests := []struct {
+		name      string
+		triggers  []string
+		message   string
+		want      string
+		addressed bool
+	}{
+		{"default mention", nil, "@ai what time is it?", "what time is it?", true},
+		{"mention ignores case", nil, "@AI what time is it?", "what time is it?", true},
+		{"mention mid-sentence", nil, "hey @ai, what time is it?", "hey, what time is it?", true},
+		{"mention at the end", nil, "what time is it @ai", "what time is it", true},
+		{"no trigger", nil, "what time is it?", "what time is it?", false},
+
+		// The trigger word in ordinary text doesn't address the assistant
+		{"bare word", nil, "the ai said hello", "the ai said hello", false},
+		{"inside a word", nil, "email me at bob@aiven.io", "email me at bob@aiven.io", false},
+		{"inside an address", nil, "write to team@ai", "write to team@ai", false},
+		{"longer mention", nil, "ask @aisha about it", "ask @aisha about it", false},
+		{"word after trigger", []string{"/ai"}, "/aim higher", "/aim higher", false},
+
+		// Only the mention that addresses the assistant is removed
+		{"later mentions kept", nil, "@ai who is @ai?", "who is @ai?", true},
+		{"command then mention", []string{"/ai", "@ai"}, "/ai tell @ai hi", "tell @ai hi", true},
+
+		{"command at start", []string{"/ai"}, "/ai summarize this", "summarize this", true},
+		{"command after spaces", []string{"/ai"}, "   /ai summarize this", "summarize this", true},
+		{"command mid-sentence", []string{"/ai"}, "type /ai to ask the bot", "type /ai to ask the bot", false},
+		{"first configured match", []string{"@assistant", "/ask"}, "hi @assistant", "hi", true},
+		{"default replaced", []string{"@assistant"}, "@ai hello", "@ai hello", false},
+
+		// Matching folds Unicode case and works on runes, not bytes
+		{"unicode mention", []string{"@ассистент"}, "@АССИСТЕНТ привет", "привет", true},
+		{"unicode neighbours", []string{"@bot"}, "café@bot", "café@bot", false},
+		{"accented continuation", []string{"@bot"}, "@botá hi", "@botá hi", false},
+		{"trigger alone", nil, "@ai", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewService(Config{APIKey: "k", Triggers: tt.triggers})
+
+			got, addressed := s.stripTrigger(tt.message)
+			if got != tt.want || addressed != tt.addressed {
+				t.Errorf("stripTrigger(%q) = %q, %v; want %q, %v", tt.message, got, addressed, tt.want, tt.addressed)
+			}
+			if s.IsAddressed(tt.message) != tt.addressed {
+				t.Errorf("IsAddressed(%q) = %v, want %v", tt.message, !tt.addressed, tt.addressed)
+			}
+		})
+	}
+}
+
+func TestValidateTriggers(t *testing.T) {
+	tests := []struct {
+		triggers []string
+		wantErr  bool
+	}{
+		{nil, false},
+		{[]string{"@ai", "/ai", "@ассистент"}, false},
+		{[]string{""}, true},
+		{[]string{"@"}, true},
+		{[]string{"@ai", "/ask me"}, true},
+		{[]string{"@ai\t"}, true},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateTriggers(tt.triggers); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateTriggers(%q) = %v, want error: %v", tt.triggers, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProcessMessageWithAIUsesTriggers(t *testing.T) {
+	provider := newFakeProvider(t, "done", FinishReasonStop)
+	s := provider.service(Config{Triggers: []string{"@assistant", "/ai"}})
+	ctx := context.Background()
+
+	for _, message := range []string{
+		"the @ai trigger is gone now",
+		"our assistant is great",
+		"type /ai to ask",
+	} {
+		handled, _, err := s.ProcessMessageWithAI(ctx, uuid.New(), "", message, nil)
+		if err != nil || handled {
+			t.Errorf("%q: handled %v, err %v; want it ignored", message, handled, err)
+		}
+	}
+	if n := len(provider.calls()); n != 0 {
+		t.Fatalf("provider called %d times for messages not addressed to it", n)
+	}
+
+	handled, reply, err := s.ProcessMessageWithAI(ctx, uuid.New(), "", "/ai what does @assistant do?", nil)
+	if err != nil || !handled || reply != "done" {
+		t.Fatalf("handled %v, reply %q, err %v; want the provider's reply", handled, reply, err)
+	}
+	calls := provider.calls()
+	if len(calls) != 1 {
+		t.Fatalf("provider called %d times, want 1", len(calls))
+	}
+	sent := calls[0].Messages[len(calls[0].Messages)-1].Content
+	if sent != "what does @assistant do?" {
+		t.Errorf("provider got %q, want the message without its leading command", sent)
+	}
+}
@@ -0,0 +1,100 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// captureLog sends the global logger's output to a buffer until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+	return &buf
+}
+
+func TestNewServiceWarnsWithoutAPIKey(t *testing.T) {
+	const warning = "AI API key is not configured"
+
+	tests := []struct {
+		name   string
+		config Config
+		warn   bool
+	}{
+		{"missing key", Config{}, true},
+		{"key set", Config{APIKey: "sk-test"}, false},
+		{"webhook without key", Config{Provider: ProviderWebhook, Webhook: WebhookConfig{URL: "http://localhost/bot"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+			NewService(tt.config)
+
+			if got := strings.Contains(buf.String(), warning); got != tt.warn {
+				t.Errorf("warned = %v, want %v; log: %s", got, tt.warn, buf)
+			}
+			if tt.warn && !strings.Contains(buf.String(), `"level":"warn"`) {
+				t.Errorf("missing key logged at the wrong level: %s", buf)
+			}
+		})
+	}
+}
+
+func TestGenerateCompletionUnauthorized(t *testing.T) {
+	provider := newFakeProvider(t, "", "")
+	provider.respond = func(w http.ResponseWriter, req ChatRequest) {
+		http.Error(w, `{"error":{"message":"Incorrect API key provided: sk-wrong"}}`, http.StatusUnauthorized)
+	}
+	buf := captureLog(t)
+	s := provider.service(Config{APIKey: "sk-wrong"})
+
+	_, err := s.GenerateCompletion(context.Background(), "", "hello", nil)
+	if !errors.Is(err, ErrAIUnauthorized) {
+		t.Fatalf("err = %v, want ErrAIUnauthorized", err)
+	}
+	if n := len(provider.calls()); n != 1 {
+		t.Errorf("provider called %d times, want 1: a rejected key isn't retried", n)
+	}
+	if strings.Contains(buf.String(), "sk-wrong") {
+		t.Errorf("provider's 401 body was logged: %s", buf)
+	}
+}
+
+func TestGenerateCompletionWithoutAPIKey(t *testing.T) {
+	provider := newFakeProvider(t, "unused", FinishReasonStop)
+	s := provider.service(Config{})
+	s.config.APIKey = ""
+
+	if _, err := s.GenerateCompletion(context.Background(), "", "hello", nil); !errors.Is(err, ErrAIUnauthorized) {
+		t.Fatalf("err = %v, want ErrAIUnauthorized", err)
+	}
+	if n := len(provider.calls()); n != 0 {
+		t.Errorf("provider called %d times without a key", n)
+	}
+}
+
+func TestProcessMessageWithAIUnauthorizedNotice(t *testing.T) {
+	provider := newFakeProvider(t, "", "")
+	provider.respond = func(w http.ResponseWriter, req ChatRequest) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	s := provider.service(Config{})
+
+	handled, response, err := s.ProcessMessageWithAI(context.Background(), uuid.Nil, "", "@ai are you there?", nil)
+	if err != nil {
+		t.Fatalf("ProcessMessageWithAI: %v", err)
+	}
+	if !handled || response != unconfiguredNotice {
+		t.Errorf("got (%v, %q), want (true, %q)", handled, response, unconfiguredNotice)
+	}
+}
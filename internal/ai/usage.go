@@ -0,0 +1,74 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// quotaNotice is posted instead of a reply once a user has used up their
+// monthly token quota
+const quotaNotice = "You've used up your assistant allowance for this month. It resets at the start of next month."
+
+// UsageStore records the tokens AI requests use, for quotas and reporting
+type UsageStore interface {
+	RecordAIUsage(ctx context.Context, usage *models.AIUsage) error
+	GetUserTokenUsage(ctx context.Context, userID uuid.UUID, since time.Time) (int, error)
+}
+
+// SetUsageStore has the tokens each user's requests use recorded in store,
+// and the monthly quota enforced against them. It must be called before the
+// service is used.
+func (s *Service) SetUsageStore(store UsageStore) {
+	s.usage = store
+}
+
+// MonthlyTokenQuota returns the tokens each user may use per calendar month,
+// or zero if there is no limit
+func (s *Service) MonthlyTokenQuota() int {
+	return s.config.MonthlyTokenQuota
+}
+
+// QuotaPeriodStart returns the start of the quota period containing t: the
+// first of its month, in UTC
+func QuotaPeriodStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// overQuota reports whether a user has used up this month's token quota
+func (s *Service) overQuota(ctx context.Context, userID uuid.UUID) (bool, error) {
+	if s.usage == nil || s.config.MonthlyTokenQuota <= 0 || userID == uuid.Nil {
+		return false, nil
+	}
+
+	used, err := s.usage.GetUserTokenUsage(ctx, userID, QuotaPeriodStart(time.Now()))
+	if err != nil {
+		return false, fmt.Errorf("failed to check AI token quota: %w", err)
+	}
+	return used >= s.config.MonthlyTokenQuota, nil
+}
+
+// recordUsage stores the tokens a request made for a user used. Failures are
+// only logged, since the response has already been paid for.
+func (s *Service) recordUsage(ctx context.Context, userID uuid.UUID, result *CompletionResult) {
+	if s.usage == nil || userID == uuid.Nil || result == nil || result.Cached {
+		return
+	}
+
+	err := s.usage.RecordAIUsage(ctx, &models.AIUsage{
+		UserID:           userID,
+		Model:            result.Model,
+		PromptTokens:     result.Usage.PromptTokens,
+		CompletionTokens: result.Usage.CompletionTokens,
+		TotalTokens:      result.Usage.TotalTokens,
+	})
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", userID.String()).Msg("Failed to record AI usage")
+	}
+}
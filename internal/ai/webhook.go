@@ -0,0 +1,253 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Providers the service can call
+const (
+	ProviderOpenAI = "openai"
+	// ProviderWebhook posts to a custom gateway described by WebhookConfig
+	ProviderWebhook = "webhook"
+	// ProviderCustom is an alias for ProviderWebhook
+	ProviderCustom = "custom"
+)
+
+// WebhookConfig describes a custom model gateway's contract
+type WebhookConfig struct {
+	// URL receives a POST for every completion
+	URL string
+	// Headers are added to every request, after the Authorization header set
+	// from the API key, so they can replace it
+	Headers map[string]string
+	// RequestTemplate is a text/template rendering the JSON request body from
+	// WebhookRequest. Values are inserted with the json function, as in
+	// {"prompt": {{json .Prompt}}}. Empty sends an OpenAI-style request.
+	RequestTemplate string
+	// ResponsePath locates the completion in the JSON response: object keys
+	// and array indexes separated by dots, as in choices.0.message.content
+	ResponsePath string
+}
+
+// WebhookRequest is the data a webhook request template is rendered with
+type WebhookRequest struct {
+	Model        string
+	Messages     []Message
+	Temperature  float64
+	MaxTokens    int
+	SystemPrompt string
+	// Prompt is the message being answered
+	Prompt string
+}
+
+// webhookTemplateFuncs are available to request templates
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// IsWebhookProvider reports whether a provider name selects the webhook backend
+func IsWebhookProvider(provider string) bool {
+	return provider == ProviderWebhook || provider == ProviderCustom
+}
+
+// ValidateWebhook checks a webhook configuration, including that its request
+// template renders valid JSON
+func ValidateWebhook(config WebhookConfig) error {
+	target, err := url.Parse(config.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL, got %q", config.URL)
+	}
+
+	if _, err := parseResponsePath(config.ResponsePath); err != nil {
+		return err
+	}
+
+	tmpl, err := parseRequestTemplate(config.RequestTemplate)
+	if err != nil {
+		return err
+	}
+	sample := WebhookRequest{
+		Model:        "model",
+		Messages:     []Message{{Role: "user", Content: "Hello"}},
+		Temperature:  0.7,
+		SystemPrompt: "You are a helpful assistant.",
+		Prompt:       "Hello",
+	}
+	if _, err := renderWebhookRequest(tmpl, sample); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseRequestTemplate parses a request template. An empty template returns
+// nil, meaning an OpenAI-style request.
+func parseRequestTemplate(text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("request").Funcs(webhookTemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request_template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// renderWebhookRequest renders a request body, checking that it is valid JSON
+func renderWebhookRequest(tmpl *template.Template, data WebhookRequest) ([]byte, error) {
+	if tmpl == nil {
+		return json.Marshal(ChatRequest{
+			Model:       data.Model,
+			Messages:    data.Messages,
+			Temperature: data.Temperature,
+			MaxTokens:   data.MaxTokens,
+		})
+	}
+
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return nil, fmt.Errorf("error rendering request_template: %w", err)
+	}
+	if !json.Valid(body.Bytes()) {
+		return nil, fmt.Errorf("request_template did not render valid JSON: %s", body.Bytes())
+	}
+	return body.Bytes(), nil
+}
+
+// parseResponsePath splits a response path into its segments
+func parseResponsePath(path string) ([]string, error) {
+	if path == "" {
+		return nil, errors.New("response_path is required")
+	}
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("invalid response_path %q: empty segment", path)
+		}
+	}
+	return segments, nil
+}
+
+// extractResponsePath follows a response path through a decoded JSON document
+// to a string
+func extractResponsePath(doc interface{}, path []string) (string, error) {
+	for i, segment := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return "", fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+			}
+			doc = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return "", fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+			}
+			doc = node[index]
+		default:
+			return "", fmt.Errorf("response has no %q", strings.Join(path[:i+1], "."))
+		}
+	}
+
+	content, ok := doc.(string)
+	if !ok {
+		return "", fmt.Errorf("response %q is not a string", strings.Join(path, "."))
+	}
+	return content, nil
+}
+
+// webhookBody renders the request body for a webhook call
+func (s *Service) webhookBody(chatReq ChatRequest) ([]byte, error) {
+	data := WebhookRequest{
+		Model:        chatReq.Model,
+		Messages:     chatReq.Messages,
+		Temperature:  chatReq.Temperature,
+		MaxTokens:    chatReq.MaxTokens,
+		SystemPrompt: s.config.SystemPrompt,
+	}
+	if n := len(chatReq.Messages); n > 0 {
+		data.Prompt = chatReq.Messages[n-1].Content
+	}
+	return renderWebhookRequest(s.webhookTemplate, data)
+}
+
+// sendWebhookRequest makes a single webhook call, wrapping failures worth
+// retrying in retryableError the same way sendOpenAIRequest does
+func (s *Service) sendWebhookRequest(ctx context.Context, model string, reqBody []byte) (*ChatResponse, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.config.Webhook.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, 0, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if s.config.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.config.APIKey)
+	}
+	for name, value := range s.config.Webhook.Headers {
+		req.Header.Set(name, value)
+	}
+
+	start := time.Now()
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, 0, ctx.Err()
+		}
+		return nil, 0, &retryableError{err: fmt.Errorf("error sending request: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	log.Ctx(ctx).Debug().
+		Str("model", model).
+		Dur("duration", time.Since(start)).
+		Int("status_code", resp.StatusCode).
+		Msg("AI webhook call completed")
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, 0, ErrAIUnauthorized
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(resp.Body)
+		err := fmt.Errorf("webhook returned status code %d: %s", resp.StatusCode, body)
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			return nil, parseRetryAfter(resp.Header.Get("Retry-After")), &retryableError{err: err}
+		}
+		return nil, 0, err
+	}
+
+	var doc interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, 0, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	content, err := extractResponsePath(doc, s.webhookPath)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return &ChatResponse{
+		Model: model,
+		Choices: []Choice{{
+			Message:      Message{Role: "assistant", Content: content},
+			FinishReason: FinishReasonStop,
+		}},
+	}, 0, nil
+}
@@ -0,0 +1,200 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// gateway is a stub custom gateway. It keeps the last request it received
+// and answers with a fixed status and body.
+type gateway struct {
+	server *httptest.Server
+	status int
+	body   string
+
+	header http.Header
+	got    map[string]interface{}
+}
+
+func newGateway(t *testing.T, status int, body string) *gateway {
+	g := &gateway{status: status, body: body}
+	g.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g.header = r.Header.Clone()
+		if err := json.NewDecoder(r.Body).Decode(&g.got); err != nil {
+			t.Errorf("gateway got an invalid request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(g.status)
+		w.Write([]byte(g.body))
+	}))
+	t.Cleanup(g.server.Close)
+	return g
+}
+
+// sampleContract is a gateway contract unlike OpenAI's
+const sampleContract = `{
+	"model": {{json .Model}},
+	"input": {"text": {{json .Prompt}}, "history": {{json .Messages}}},
+	"params": {"temp": {{json .Temperature}}, "limit": {{json .MaxTokens}}}
+}`
+
+func TestWebhookRequestResponseMapping(t *testing.T) {
+	g := newGateway(t, http.StatusOK, `{"output": {"results": [{"text": "Hi there"}]}}`)
+	s := NewService(Config{
+		Provider:    ProviderWebhook,
+		Model:       "internal-llm",
+		Temperature: 0.3,
+		MaxTokens:   256,
+		Webhook: WebhookConfig{
+			URL:             g.server.URL,
+			Headers:         map[string]string{"X-Gateway-Key": "secret"},
+			RequestTemplate: sampleContract,
+			ResponsePath:    "output.results.0.text",
+		},
+	})
+
+	history := []Message{{Role: "user", Content: "earlier"}, {Role: "assistant", Content: "reply"}}
+	result, err := s.GenerateCompletion(context.Background(), "internal-llm", `say "hi"`, history)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	if result.Content != "Hi there" {
+		t.Errorf("Content = %q, want the text at the response path", result.Content)
+	}
+
+	if got := g.header.Get("X-Gateway-Key"); got != "secret" {
+		t.Errorf("X-Gateway-Key = %q, want the configured header", got)
+	}
+	// No key is configured, so none is sent
+	if got := g.header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization = %q, want none", got)
+	}
+
+	if g.got["model"] != "internal-llm" {
+		t.Errorf("model = %v, want internal-llm", g.got["model"])
+	}
+	input, _ := g.got["input"].(map[string]interface{})
+	// Quotes in the prompt are escaped by the json function
+	if input["text"] != `say "hi"` {
+		t.Errorf("input.text = %v, want the prompt", input["text"])
+	}
+	sent, _ := input["history"].([]interface{})
+	if len(sent) < len(history)+1 {
+		t.Errorf("input.history has %d messages, want the history and the prompt", len(sent))
+	}
+	params, _ := g.got["params"].(map[string]interface{})
+	if params["temp"] != 0.3 || params["limit"] != float64(256) {
+		t.Errorf("params = %v, want temp 0.3 and limit 256", params)
+	}
+}
+
+func TestWebhookDefaultsToOpenAIRequests(t *testing.T) {
+	g := newGateway(t, http.StatusOK, `{"choices": [{"message": {"content": "ok"}}]}`)
+	s := NewService(Config{
+		Provider: ProviderCustom,
+		APIKey:   "gateway-key",
+		Model:    "m",
+		Webhook:  WebhookConfig{URL: g.server.URL, ResponsePath: "choices.0.message.content"},
+	})
+
+	result, err := s.GenerateCompletion(context.Background(), "m", "hello", nil)
+	if err != nil {
+		t.Fatalf("GenerateCompletion: %v", err)
+	}
+	if result.Content != "ok" {
+		t.Errorf("Content = %q, want ok", result.Content)
+	}
+	if got := g.header.Get("Authorization"); got != "Bearer gateway-key" {
+		t.Errorf("Authorization = %q, want the API key", got)
+	}
+	if g.got["model"] != "m" {
+		t.Errorf("model = %v, want m", g.got["model"])
+	}
+	if messages, _ := g.got["messages"].([]interface{}); len(messages) == 0 {
+		t.Errorf("request %v has no messages", g.got)
+	}
+}
+
+func TestWebhookResponseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+		is      error
+	}{
+		{"missing key", http.StatusOK, `{"output": {}}`, `no "output.results"`, nil},
+		{"index out of range", http.StatusOK, `{"output": {"results": []}}`, `no "output.results.0"`, nil},
+		{"not a string", http.StatusOK, `{"output": {"results": [{"text": 42}]}}`, "not a string", nil},
+		{"unauthorized", http.StatusForbidden, `{}`, "", ErrAIUnauthorized},
+		{"client error", http.StatusBadRequest, `{"error": "bad"}`, "status code 400", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newGateway(t, tt.status, tt.body)
+			s := NewService(Config{
+				Provider: ProviderWebhook,
+				Model:    "m",
+				Webhook:  WebhookConfig{URL: g.server.URL, ResponsePath: "output.results.0.text"},
+			})
+
+			_, err := s.GenerateCompletion(context.Background(), "m", "hello", nil)
+			if err == nil {
+				t.Fatal("GenerateCompletion succeeded, want an error")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("error = %v, want %v", err, tt.is)
+			}
+			if tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one mentioning %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWebhook(t *testing.T) {
+	valid := WebhookConfig{URL: "https://llm.internal/v1/generate", RequestTemplate: sampleContract, ResponsePath: "output.text"}
+
+	tests := []struct {
+		name    string
+		change  func(*WebhookConfig)
+		wantErr string
+	}{
+		{"valid", func(*WebhookConfig) {}, ""},
+		{"default request", func(c *WebhookConfig) { c.RequestTemplate = "" }, ""},
+		{"no URL", func(c *WebhookConfig) { c.URL = "" }, "url"},
+		{"relative URL", func(c *WebhookConfig) { c.URL = "/v1/generate" }, "url"},
+		{"other scheme", func(c *WebhookConfig) { c.URL = "ftp://llm.internal" }, "url"},
+		{"no response path", func(c *WebhookConfig) { c.ResponsePath = "" }, "response_path"},
+		{"empty path segment", func(c *WebhookConfig) { c.ResponsePath = "output..text" }, "response_path"},
+		{"template syntax", func(c *WebhookConfig) { c.RequestTemplate = `{"prompt": {{json .Prompt}` }, "request_template"},
+		{"unknown field", func(c *WebhookConfig) { c.RequestTemplate = `{"prompt": {{json .Question}}}` }, "request_template"},
+		// Unquoted values break the JSON as soon as they hold a quote or
+		// aren't a number
+		{"renders invalid JSON", func(c *WebhookConfig) { c.RequestTemplate = `{"prompt": {{.Prompt}}}` }, "valid JSON"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := valid
+			tt.change(&config)
+
+			err := ValidateWebhook(config)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateWebhook: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateWebhook error = %v, want one about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
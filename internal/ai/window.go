@@ -0,0 +1,163 @@
+package ai
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrContextTooLong is returned when the system prompt and the user's
+// message alone don't fit in the model's context window
+var ErrContextTooLong = errors.New("message is too long for the model's context window")
+
+// Context window budgeting, in tokens
+const (
+	// defaultContextWindow is used for unknown models when none is configured
+	defaultContextWindow = 4096
+	// defaultReplyReserve is kept free for the reply when MaxTokens leaves
+	// its length to the provider
+	defaultReplyReserve = 512
+	// messageOverhead approximates the tokens each message costs beyond its
+	// content, for the role and separators
+	messageOverhead = 4
+	// summaryExcerptLength caps, in characters, how much of each dropped
+	// message the summary note quotes
+	summaryExcerptLength = 80
+	// summaryShare is the fraction, as 1/summaryShare, of the space left for
+	// history that is set aside for the summary note when history is trimmed
+	summaryShare = 5
+)
+
+// modelContextWindows are known context window sizes by model name prefix.
+// The longest matching prefix wins.
+var modelContextWindows = map[string]int{
+	"gpt-3.5-turbo": 16385,
+	"gpt-4":         8192,
+	"gpt-4-32k":     32768,
+	"gpt-4-turbo":   128000,
+	"gpt-4o":        128000,
+	"gpt-4.1":       1047576,
+}
+
+// ContextWindow returns the context window size for a model: the configured
+// one if set, or else a known size for the model, or defaultContextWindow
+func (s *Service) ContextWindow(model string) int {
+	if s.config.ContextWindow > 0 {
+		return s.config.ContextWindow
+	}
+
+	window, matched := defaultContextWindow, ""
+	for prefix, size := range modelContextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(matched) {
+			window, matched = size, prefix
+		}
+	}
+	return window
+}
+
+// estimateTokens roughly counts the tokens a message costs, at four
+// characters a token
+func estimateTokens(m Message) int {
+	return (utf8.RuneCountInString(m.Content)+3)/4 + messageOverhead
+}
+
+// historyTokens estimates the tokens a conversation history costs
+func historyTokens(history []Message) int {
+	total := 0
+	for _, m := range history {
+		total += estimateTokens(m)
+	}
+	return total
+}
+
+// buildMessages assembles the messages sent to the model: the system
+// prompt, as much of the history as fits in the model's context window,
+// newest turns kept first, and the user's message. Space for the reply is
+// reserved. If SummarizeDroppedContext is set, dropped turns are replaced by
+// a system note quoting as many of them as fit. It returns the number of
+// history messages dropped, or ErrContextTooLong if even the user's message
+// doesn't fit.
+func (s *Service) buildMessages(model, userMessage string, history []Message) ([]Message, int, error) {
+	budget := s.ContextWindow(model)
+	if s.config.MaxTokens > 0 {
+		budget -= s.config.MaxTokens
+	} else {
+		budget -= defaultReplyReserve
+	}
+
+	var system []Message
+	if s.config.SystemPrompt != "" {
+		system = append(system, Message{Role: "system", Content: s.config.SystemPrompt})
+		budget -= estimateTokens(system[0])
+	}
+	user := Message{Role: "user", Content: userMessage}
+	budget -= estimateTokens(user)
+	if budget < 0 {
+		return nil, 0, ErrContextTooLong
+	}
+
+	// When history has to go, part of the budget is set aside for the note
+	// summarizing it
+	var noteBudget int
+	if s.config.SummarizeDroppedContext && historyTokens(history) > budget {
+		noteBudget = budget / summaryShare
+		budget -= noteBudget
+	}
+
+	// Keep the newest turns that fit
+	kept := len(history)
+	for kept > 0 {
+		cost := estimateTokens(history[kept-1])
+		if cost > budget {
+			break
+		}
+		budget -= cost
+		kept--
+	}
+	dropped := history[:kept]
+
+	messages := make([]Message, 0, len(system)+2+len(history)-kept)
+	messages = append(messages, system...)
+	if len(dropped) > 0 && s.config.SummarizeDroppedContext {
+		if note, ok := summarizeDropped(dropped, budget+noteBudget); ok {
+			messages = append(messages, note)
+		}
+	}
+	messages = append(messages, history[kept:]...)
+	messages = append(messages, user)
+
+	return messages, len(dropped), nil
+}
+
+// summarizeDropped builds a system note standing in for turns left out of
+// the context, quoting the start of the most recent ones within budget
+// tokens. It returns false if not even the note's heading fits.
+func summarizeDropped(dropped []Message, budget int) (Message, bool) {
+	heading := fmt.Sprintf("%d earlier messages were left out to fit the context window.", len(dropped))
+	note := Message{Role: "system", Content: heading}
+	if estimateTokens(note) > budget {
+		return Message{}, false
+	}
+
+	var lines []string
+	for i := len(dropped) - 1; i >= 0; i-- {
+		excerpt := dropped[i].Content
+		if utf8.RuneCountInString(excerpt) > summaryExcerptLength {
+			excerpt = string([]rune(excerpt)[:summaryExcerptLength]) + "…"
+		}
+		line := fmt.Sprintf("- %s: %s", dropped[i].Role, strings.Join(strings.Fields(excerpt), " "))
+
+		candidate := Message{
+			Role:    "system",
+			Content: heading + " The most recent began:\n" + strings.Join(append([]string{line}, lines...), "\n"),
+		}
+		if estimateTokens(candidate) > budget {
+			break
+		}
+		lines = append([]string{line}, lines...)
+		note = candidate
+	}
+
+	return note, true
+}
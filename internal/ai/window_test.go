@@ -0,0 +1,146 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// turns builds a conversation of n messages, each costing the same number
+// of estimated tokens, numbered so tests can tell which were kept
+func turns(n int) []Message {
+	history := make([]Message, n)
+	for i := range history {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history[i] = Message{Role: role, Content: fmt.Sprintf("turn %03d %s", i, strings.Repeat("x", 91))}
+	}
+	return history
+}
+
+func TestContextWindow(t *testing.T) {
+	tests := []struct {
+		configured int
+		model      string
+		want       int
+	}{
+		{0, "gpt-4o-mini", 128000},
+		{0, "gpt-4-0613", 8192},
+		// The longest matching prefix wins
+		{0, "gpt-4-32k-0613", 32768},
+		{0, "gpt-4-turbo-preview", 128000},
+		{0, "llama3:8b", defaultContextWindow},
+		{2048, "gpt-4o", 2048},
+	}
+
+	for _, tt := range tests {
+		s := NewService(Config{APIKey: "k", ContextWindow: tt.configured})
+		if got := s.ContextWindow(tt.model); got != tt.want {
+			t.Errorf("ContextWindow(%q) with %d configured = %d, want %d", tt.model, tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestBuildMessagesDropsOldestTurnsFirst(t *testing.T) {
+	const window, reply = 600, 100
+	s := NewService(Config{APIKey: "k", ContextWindow: window, MaxTokens: reply, SystemPrompt: "Be brief."})
+	history := turns(30)
+
+	messages, dropped, err := s.buildMessages("m", "and now?", history)
+	if err != nil {
+		t.Fatalf("buildMessages: %v", err)
+	}
+
+	if messages[0].Role != "system" || messages[0].Content != "Be brief." {
+		t.Errorf("first message = %+v, want the system prompt", messages[0])
+	}
+	if last := messages[len(messages)-1]; last.Role != "user" || last.Content != "and now?" {
+		t.Errorf("last message = %+v, want the user's message", last)
+	}
+
+	kept := messages[1 : len(messages)-1]
+	if dropped == 0 || dropped+len(kept) != len(history) {
+		t.Fatalf("dropped %d and kept %d of %d turns", dropped, len(kept), len(history))
+	}
+	// What is kept is the newest turns, in order
+	for i, m := range kept {
+		if m != history[dropped+i] {
+			t.Fatalf("kept turn %d = %q, want %q", i, m.Content, history[dropped+i].Content)
+		}
+	}
+
+	// It all fits with the reply, and one more turn wouldn't have
+	used := historyTokens(messages)
+	if used > window-reply {
+		t.Errorf("messages use %d tokens, over the %d left for them", used, window-reply)
+	}
+	if used+estimateTokens(history[dropped-1]) <= window-reply {
+		t.Errorf("dropped turn %d would have fit", dropped-1)
+	}
+
+	// A conversation that fits is left whole
+	messages, dropped, err = s.buildMessages("m", "and now?", history[:3])
+	if err != nil || dropped != 0 || len(messages) != 5 {
+		t.Errorf("short history: %d messages, %d dropped, %v; want all kept", len(messages), dropped, err)
+	}
+}
+
+func TestBuildMessagesSummarizesDroppedTurns(t *testing.T) {
+	const window, reply = 600, 100
+	s := NewService(Config{APIKey: "k", ContextWindow: window, MaxTokens: reply, SystemPrompt: "Be brief.", SummarizeDroppedContext: true})
+	history := turns(30)
+
+	messages, dropped, err := s.buildMessages("m", "and now?", history)
+	if err != nil {
+		t.Fatalf("buildMessages: %v", err)
+	}
+	if dropped == 0 {
+		t.Fatal("nothing dropped")
+	}
+
+	note := messages[1]
+	if note.Role != "system" || !strings.HasPrefix(note.Content, fmt.Sprintf("%d earlier messages were left out", dropped)) {
+		t.Fatalf("second message = %+v, want the note on dropped turns", note)
+	}
+	// The note quotes the most recent dropped turn
+	if !strings.Contains(note.Content, fmt.Sprintf("turn %03d", dropped-1)) {
+		t.Errorf("note doesn't quote the last dropped turn: %q", note.Content)
+	}
+	if used := historyTokens(messages); used > window-reply {
+		t.Errorf("messages with the note use %d tokens, over the %d left for them", used, window-reply)
+	}
+}
+
+func TestBuildMessagesTooLong(t *testing.T) {
+	s := NewService(Config{APIKey: "k", ContextWindow: 600, MaxTokens: 100})
+
+	// History that can't fit at all is dropped without an error
+	messages, dropped, err := s.buildMessages("m", "hi", []Message{{Role: "user", Content: strings.Repeat("x", 4000)}})
+	if err != nil || dropped != 1 || len(messages) != 1 {
+		t.Errorf("oversized history: %d messages, %d dropped, %v; want just the user's message", len(messages), dropped, err)
+	}
+
+	// Only a message that can't fit on its own is an error
+	if _, _, err := s.buildMessages("m", strings.Repeat("x", 4000), nil); !errors.Is(err, ErrContextTooLong) {
+		t.Errorf("oversized message: error %v, want ErrContextTooLong", err)
+	}
+}
+
+func TestProcessMessageWithAITooLong(t *testing.T) {
+	provider := newFakeProvider(t, "unused", FinishReasonStop)
+	s := provider.service(Config{ContextWindow: 600, MaxTokens: 100})
+
+	handled, reply, err := s.ProcessMessageWithAI(context.Background(), uuid.New(), "", "@ai "+strings.Repeat("x", 4000), nil)
+	if err != nil || !handled || reply != tooLongNotice {
+		t.Errorf("handled %v, reply %q, err %v; want the too-long notice", handled, reply, err)
+	}
+	if n := len(provider.calls()); n != 0 {
+		t.Errorf("provider called %d times for a message that can't fit", n)
+	}
+}
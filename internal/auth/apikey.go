@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+var (
+	ErrInvalidAPIKey  = errors.New("invalid API key")
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// API key format
+const (
+	// apiKeyPrefix marks API keys, so leaked ones are easy to spot
+	apiKeyPrefix = "llc_"
+	// apiKeyBytes is the amount of randomness in an API key
+	apiKeyBytes = 32
+	// apiKeyDisplayLength is how much of a key is kept to identify it
+	apiKeyDisplayLength = 12
+)
+
+// CreateAPIKey creates an API key for a user and returns it. Only its hash
+// is stored, so this is the only time the key itself is available.
+func (s *Service) CreateAPIKey(ctx context.Context, userID uuid.UUID, name string) (string, error) {
+	buf := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating API key: %w", err)
+	}
+	plaintext := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf)
+
+	key := &models.APIKey{
+		ID:      uuid.New(),
+		UserID:  userID,
+		Name:    name,
+		Prefix:  plaintext[:apiKeyDisplayLength],
+		KeyHash: hashToken(plaintext),
+	}
+	if err := s.store.CreateAPIKey(ctx, key); err != nil {
+		return "", fmt.Errorf("error storing API key: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// ListAPIKeys lists a user's API keys
+func (s *Service) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	return s.store.ListAPIKeys(ctx, userID)
+}
+
+// RevokeAPIKey deletes one of a user's API keys. It fails with
+// ErrAPIKeyNotFound if the user has no such key.
+func (s *Service) RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	err := s.store.DeleteAPIKey(ctx, userID, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAPIKeyNotFound
+	}
+	return err
+}
+
+// ValidateAPIKey resolves an API key to the claims of the user it belongs to,
+// with their current roles and permissions. Unknown keys and keys of
+// deactivated users give ErrInvalidAPIKey.
+func (s *Service) ValidateAPIKey(ctx context.Context, plaintext string) (*Claims, error) {
+	key, err := s.store.GetAPIKeyByHash(ctx, hashToken(plaintext))
+	if err != nil {
+		log.Ctx(ctx).Debug().Err(err).Msg("API key not found")
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.store.GetUserByID(ctx, key.UserID)
+	if err != nil || !user.IsActive {
+		return nil, ErrInvalidAPIKey
+	}
+
+	roles, permissions, err := s.userRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		UserID:      user.ID,
+		Admin:       user.IsAdmin,
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
@@ -2,15 +2,18 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/llamasearch/llamachat/internal/models"
 )
@@ -19,8 +22,19 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotFound       = errors.New("user not found")
 	ErrInvalidToken       = errors.New("invalid or expired token")
+	ErrExpiredToken       = errors.New("token has expired")
+	ErrWeakPassword       = errors.New("password does not meet requirements")
+	ErrAccountLocked      = errors.New("account is temporarily locked after too many failed logins")
 )
 
+// blacklistCheckTimeout bounds the revocation lookup done for every request
+const blacklistCheckTimeout = 2 * time.Second
+
+// SpecialCharacters is the set of characters that satisfy
+// PasswordConfig.RequireSpecial: the OWASP password special characters, i.e.
+// space and printable ASCII punctuation.
+const SpecialCharacters = " !\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+
 // UserResponse represents a safe user response without sensitive data
 type UserResponse struct {
 	ID          string    `json:"id"`
@@ -31,6 +45,8 @@ type UserResponse struct {
 	Bio         string    `json:"bio"`
 	CreatedAt   time.Time `json:"created_at"`
 	IsAdmin     bool      `json:"is_admin"`
+	// Preferences are only filled in for the user's own profile
+	Preferences *models.UserPreferences `json:"preferences,omitempty"`
 }
 
 // ToUserResponse converts a user model to a user response
@@ -52,6 +68,9 @@ type JWTConfig struct {
 	Secret          string
 	ExpirationHours int
 	Issuer          string
+	// RefreshExpirationHours is the lifetime of refresh tokens. Defaults to
+	// 30 days.
+	RefreshExpirationHours int
 }
 
 // PasswordConfig holds password validation configuration
@@ -65,38 +84,112 @@ type PasswordConfig struct {
 
 // Config holds authentication configuration
 type Config struct {
-	JWT      JWTConfig
-	Password PasswordConfig
+	JWT           JWTConfig
+	Password      PasswordConfig
+	Hashing       HashingConfig
+	EmailThrottle EmailThrottleConfig
+	Lockout       LockoutConfig
+	// Mail selects how emails are delivered. Without a mailer, password
+	// resets are refused.
+	Mail MailConfig
+	// PasswordResetURL is the page that completes a password reset. Reset
+	// emails link to it with the token in the token query parameter; if it
+	// is empty they carry the bare token.
+	PasswordResetURL string
+	// AllowedRedirectURLs lists the URLs users may be sent to from emails.
+	// Entries ending in "*" match by prefix. When it is set,
+	// PasswordResetURL must match it too.
+	AllowedRedirectURLs []string
 }
 
 // UserStore defines the interface for user data operations
 type UserStore interface {
 	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUserPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) error
 	UpdateUser(ctx context.Context, user *models.User) error
+	IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error)
+	LockUser(ctx context.Context, id uuid.UUID, until time.Time) error
+	ResetFailedLogins(ctx context.Context, id uuid.UUID) error
+	ListUserRoles(ctx context.Context, userID uuid.UUID) ([]*models.Role, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	DeletePasswordResets(ctx context.Context, userID uuid.UUID) error
 }
 
 // Service provides authentication functionality
 type Service struct {
-	config Config
-	store  UserStore
+	config        Config
+	store         UserStore
+	hasher        Hasher
+	emailThrottle *EmailThrottle
+	blacklist     TokenBlacklist
+	mailer        Mailer
 }
 
-// Claims represents JWT claims
+// Claims represents JWT claims. Roles and their permissions are captured when
+// the token is issued, so changes to them apply from the next login or
+// refresh.
 type Claims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Admin  bool      `json:"admin"`
+	UserID      uuid.UUID `json:"user_id"`
+	Admin       bool      `json:"admin"`
+	Roles       []string  `json:"roles,omitempty"`
+	Permissions []string  `json:"permissions,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// NewService creates a new authentication service
-func NewService(config Config, store UserStore) *Service {
-	return &Service{
-		config: config,
-		store:  store,
+// NewService creates a new authentication service. rdb is optional; without
+// it, limits and revoked tokens are tracked per process.
+func NewService(config Config, store UserStore, rdb *redis.Client) (*Service, error) {
+	hasher, err := NewHasher(config.Hashing)
+	if err != nil {
+		return nil, fmt.Errorf("invalid password hashing config: %w", err)
+	}
+
+	if config.JWT.RefreshExpirationHours <= 0 {
+		config.JWT.RefreshExpirationHours = defaultRefreshExpirationHours
+	}
+	config.Lockout = config.Lockout.withDefaults()
+
+	if err := checkRedirectAllowlist(config.AllowedRedirectURLs); err != nil {
+		return nil, err
+	}
+
+	mailer, err := NewMailer(config.Mail)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail config: %w", err)
 	}
+
+	s := &Service{
+		config:        config,
+		store:         store,
+		hasher:        hasher,
+		emailThrottle: NewEmailThrottle(config.EmailThrottle, rdb),
+		blacklist:     NewTokenBlacklist(rdb),
+		mailer:        mailer,
+	}
+
+	if config.PasswordResetURL != "" && len(config.AllowedRedirectURLs) > 0 {
+		if err := s.ValidateRedirectURL(config.PasswordResetURL); err != nil {
+			return nil, fmt.Errorf("invalid password reset URL: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+// SetMailer replaces the mailer chosen by Config.Mail, for deliveries the
+// built-in drivers don't cover
+func (s *Service) SetMailer(mailer Mailer) {
+	s.mailer = mailer
 }
 
 // RegisterUser registers a new user
@@ -115,7 +208,7 @@ func (s *Service) RegisterUser(ctx context.Context, username, email, password, d
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.hasher.Hash(password)
 	if err != nil {
 		return nil, fmt.Errorf("error hashing password: %w", err)
 	}
@@ -125,7 +218,7 @@ func (s *Service) RegisterUser(ctx context.Context, username, email, password, d
 		ID:           uuid.New(),
 		Username:     username,
 		Email:        email,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		DisplayName:  displayName,
 		IsActive:     true,
 		IsAdmin:      false,
@@ -138,7 +231,9 @@ func (s *Service) RegisterUser(ctx context.Context, username, email, password, d
 	return user, nil
 }
 
-// LoginUser authenticates a user and returns a JWT token
+// LoginUser authenticates a user and returns a JWT token. Too many failed
+// attempts in a row lock the account, and while it is locked every attempt
+// fails with ErrAccountLocked without the password being checked.
 func (s *Service) LoginUser(ctx context.Context, username, password string) (string, *models.User, error) {
 	// Get user by username
 	user, err := s.store.GetUserByUsername(ctx, username)
@@ -146,13 +241,32 @@ func (s *Service) LoginUser(ctx context.Context, username, password string) (str
 		return "", nil, ErrInvalidCredentials
 	}
 
+	if isLocked(user, time.Now()) {
+		return "", nil, ErrAccountLocked
+	}
+
 	// Verify password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	ok, err := s.hasher.Verify(password, user.PasswordHash)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to verify password hash")
 		return "", nil, ErrInvalidCredentials
 	}
+	if !ok {
+		if s.recordFailedLogin(ctx, user) {
+			return "", nil, ErrAccountLocked
+		}
+		return "", nil, ErrInvalidCredentials
+	}
+
+	s.clearFailedLogins(ctx, user)
+
+	// Upgrade hashes made with older settings while we have the plaintext
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		s.rehashPassword(ctx, user, password)
+	}
 
 	// Generate JWT token
-	token, err := s.generateToken(user)
+	token, err := s.generateToken(ctx, user)
 	if err != nil {
 		return "", nil, fmt.Errorf("error generating token: %w", err)
 	}
@@ -160,35 +274,132 @@ func (s *Service) LoginUser(ctx context.Context, username, password string) (str
 	return token, user, nil
 }
 
-// ValidateToken validates a JWT token and returns the user ID
+// ValidateToken validates a JWT token and returns the user ID and whether the
+// user is an admin. Errors are as for ParseToken.
 func (s *Service) ValidateToken(tokenString string) (uuid.UUID, bool, error) {
+	claims, err := s.ParseToken(tokenString)
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	return claims.UserID, claims.Admin, nil
+}
+
+// ParseToken validates a JWT token and returns its claims. Tokens that are
+// merely past their expiry give ErrExpiredToken, so clients can be told to
+// refresh; anything else wrong with a token gives ErrInvalidToken.
+func (s *Service) ParseToken(tokenString string) (*Claims, error) {
 	// Parse token
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.config.JWT.Secret), nil
 	})
 	if err != nil {
-		return uuid.Nil, false, ErrInvalidToken
+		if isOnlyExpired(err) {
+			return nil, ErrExpiredToken
+		}
+		// Expiry is routine, but a token that doesn't parse or verify was
+		// corrupted or tampered with
+		log.Warn().Err(err).Msg("Rejected malformed or tampered token")
+		return nil, ErrInvalidToken
 	}
 
 	// Validate claims
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return uuid.Nil, false, ErrInvalidToken
+		return nil, ErrInvalidToken
 	}
 
-	return claims.UserID, claims.Admin, nil
+	// Reject tokens revoked by logout
+	if claims.ID != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), blacklistCheckTimeout)
+		defer cancel()
+
+		revoked, err := s.blacklist.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check token blacklist")
+			return nil, ErrInvalidToken
+		}
+		if revoked {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	return claims, nil
+}
+
+// isOnlyExpired reports whether a token failed validation only because it has
+// expired. The signature is checked before the claims, so an expired token
+// with a bad signature is reported as invalid rather than expired.
+func isOnlyExpired(err error) bool {
+	if !errors.Is(err, jwt.ErrTokenExpired) {
+		return false
+	}
+	return !errors.Is(err, jwt.ErrTokenMalformed) &&
+		!errors.Is(err, jwt.ErrTokenSignatureInvalid) &&
+		!errors.Is(err, jwt.ErrTokenUnverifiable)
+}
+
+// RevokeToken blacklists an access token for the rest of its lifetime.
+// Invalid or already expired tokens are ignored.
+func (s *Service) RevokeToken(ctx context.Context, tokenString string) error {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWT.Secret), nil
+	})
+	if err != nil {
+		return nil
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || !token.Valid || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+
+	ttl := time.Until(claims.ExpiresAt.Time)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return s.blacklist.Revoke(ctx, claims.ID, ttl)
 }
 
 // GetUserByID retrieves a user by ID
 func (s *Service) GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error) {
 	user, err := s.store.GetUserByID(ctx, id)
 	if err != nil {
-		log.Debug().Err(err).Str("user_id", id.String()).Msg("User not found")
+		log.Ctx(ctx).Debug().Err(err).Str("user_id", id.String()).Msg("User not found")
 		return nil, ErrUserNotFound
 	}
 	return user, nil
 }
 
+// GetMe implements the handler AuthService interface, returning the profile
+// and preferences of the user a token was issued to. A deleted or
+// deactivated user is ErrUserNotFound.
+func (s *Service) GetMe(ctx *gin.Context, userID uuid.UUID) (*UserResponse, error) {
+	user, err := s.store.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive {
+		return nil, ErrUserNotFound
+	}
+
+	response := ToUserResponse(user)
+
+	// Users who never changed a setting have no preferences row
+	prefs, err := s.store.GetUserPreferences(ctx, userID)
+	switch {
+	case err == nil:
+		response.Preferences = prefs
+	case !errors.Is(err, sql.ErrNoRows):
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", userID.String()).Msg("Failed to get user preferences")
+	}
+
+	return response, nil
+}
+
 // Register implements the handler AuthService interface
 func (s *Service) Register(ctx *gin.Context, username, email, password, displayName string) (*UserResponse, error) {
 	user, err := s.RegisterUser(ctx, username, email, password, displayName)
@@ -198,40 +409,107 @@ func (s *Service) Register(ctx *gin.Context, username, email, password, displayN
 	return ToUserResponse(user), nil
 }
 
-// Login implements the handler AuthService interface
-func (s *Service) Login(ctx *gin.Context, username, password string) (string, *UserResponse, error) {
+// Login implements the handler AuthService interface. Alongside the access
+// token it issues a refresh token for obtaining new ones.
+func (s *Service) Login(ctx *gin.Context, username, password string) (string, string, *UserResponse, error) {
 	token, user, err := s.LoginUser(ctx, username, password)
 	if err != nil {
-		return "", nil, err
+		return "", "", nil, err
 	}
-	return token, ToUserResponse(user), nil
+
+	refreshToken, err := s.issueRefreshToken(ctx, user.ID)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return token, refreshToken, ToUserResponse(user), nil
 }
 
-// validatePassword validates a password against the configured requirements
+// validatePassword validates a password against the configured requirements.
+// Every unmet requirement is reported in a single error.
 func (s *Service) validatePassword(password string) error {
-	if len(password) < s.config.Password.MinLength {
-		return fmt.Errorf("password must be at least %d characters long", s.config.Password.MinLength)
+	config := s.config.Password
+
+	var hasUpper, hasLower, hasNumber, hasSpecial bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasNumber = true
+		case strings.ContainsRune(SpecialCharacters, r):
+			hasSpecial = true
+		}
 	}
 
-	// Additional password validation logic would check for uppercase, lowercase, numbers, special chars, etc.
-	// based on the configuration
+	var unmet []string
+	if len(password) < config.MinLength {
+		unmet = append(unmet, fmt.Sprintf("be at least %d characters long", config.MinLength))
+	}
+	if config.RequireUppercase && !hasUpper {
+		unmet = append(unmet, "contain an uppercase letter")
+	}
+	if config.RequireLowercase && !hasLower {
+		unmet = append(unmet, "contain a lowercase letter")
+	}
+	if config.RequireNumber && !hasNumber {
+		unmet = append(unmet, "contain a number")
+	}
+	if config.RequireSpecial && !hasSpecial {
+		unmet = append(unmet, "contain a special character")
+	}
+
+	if len(unmet) > 0 {
+		return fmt.Errorf("%w: password must %s", ErrWeakPassword, strings.Join(unmet, ", "))
+	}
 
 	return nil
 }
 
-// generateToken generates a new JWT token for a user
-func (s *Service) generateToken(user *models.User) (string, error) {
+// rehashPassword re-hashes a user's password with the current settings. Failures
+// are logged rather than returned so they never block a successful login.
+func (s *Service) rehashPassword(ctx context.Context, user *models.User, password string) {
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to rehash password")
+		return
+	}
+
+	previous := user.PasswordHash
+	user.PasswordHash = hash
+	if err := s.store.UpdateUser(ctx, user); err != nil {
+		user.PasswordHash = previous
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to store rehashed password")
+		return
+	}
+
+	log.Ctx(ctx).Info().Str("user_id", user.ID.String()).Msg("Upgraded password hash")
+}
+
+// generateToken generates a new JWT token for a user, carrying their roles
+// and permissions
+func (s *Service) generateToken(ctx context.Context, user *models.User) (string, error) {
 	expirationTime := time.Now().Add(time.Duration(s.config.JWT.ExpirationHours) * time.Hour)
 
+	roles, permissions, err := s.userRoles(ctx, user.ID)
+	if err != nil {
+		return "", err
+	}
+
 	claims := &Claims{
-		UserID: user.ID,
-		Admin:  user.IsAdmin,
+		UserID:      user.ID,
+		Admin:       user.IsAdmin,
+		Roles:       roles,
+		Permissions: permissions,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    s.config.JWT.Issuer,
 			Subject:   user.ID.String(),
+			ID:        uuid.New().String(),
 		},
 	}
 
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// testPassword satisfies the default password rules
+const testPassword = "correct horse battery"
+
+// fastArgon2 keeps argon2id hashing cheap in tests
+var fastArgon2 = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 8, KeyLength: 16}
+
+// newTestService creates a Service backed by a SQLite store in a temporary
+// directory, without Redis. Unset hashing config uses bcrypt's minimum cost
+// so tests stay fast.
+func newTestService(t *testing.T, config Config) (*Service, *database.SQLiteStore) {
+	t.Helper()
+
+	store, err := database.NewSQLiteStore(database.Config{Driver: database.DriverSQLite, Name: filepath.Join(t.TempDir(), "auth.db")})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if config.JWT.Secret == "" {
+		config.JWT.Secret = "test-secret"
+	}
+	if config.JWT.ExpirationHours == 0 {
+		config.JWT.ExpirationHours = 1
+	}
+	if config.Hashing.Algorithm == "" && config.Hashing.BcryptCost == 0 {
+		config.Hashing.BcryptCost = bcrypt.MinCost
+	}
+
+	s, err := NewService(config, store, nil)
+	if err != nil {
+		t.Fatalf("NewService: %v", err)
+	}
+	return s, store
+}
+
+// register creates a user through the service with testPassword
+func register(t *testing.T, s *Service, username string) *models.User {
+	t.Helper()
+
+	user, err := s.RegisterUser(context.Background(), username, username+"@example.com", testPassword, "")
+	if err != nil {
+		t.Fatalf("RegisterUser(%s): %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBlacklist records access tokens that were revoked before they expired,
+// keyed by their jti claim
+type TokenBlacklist interface {
+	// Revoke blacklists a token ID for ttl, which should be the token's
+	// remaining lifetime
+	Revoke(ctx context.Context, jti string, ttl time.Duration) error
+	// IsRevoked reports whether a token ID is blacklisted
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// NewTokenBlacklist creates a blacklist backed by Redis, so revocations apply
+// across instances, or by process memory when rdb is nil
+func NewTokenBlacklist(rdb *redis.Client) TokenBlacklist {
+	if rdb != nil {
+		return &redisBlacklist{redis: rdb}
+	}
+	return &memoryBlacklist{revoked: make(map[string]time.Time)}
+}
+
+// redisBlacklist stores revoked token IDs as Redis keys that expire along
+// with the token
+type redisBlacklist struct {
+	redis *redis.Client
+}
+
+func (b *redisBlacklist) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	if err := b.redis.Set(ctx, blacklistKey(jti), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to blacklist token: %w", err)
+	}
+	return nil
+}
+
+func (b *redisBlacklist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	n, err := b.redis.Exists(ctx, blacklistKey(jti)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token blacklist: %w", err)
+	}
+	return n > 0, nil
+}
+
+// memoryBlacklist is the process-local fallback used without Redis
+type memoryBlacklist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func (b *memoryBlacklist) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.revoked[jti] = now.Add(ttl)
+
+	// Drop expired entries so the map doesn't grow without bound
+	for id, until := range b.revoked {
+		if now.After(until) {
+			delete(b.revoked, id)
+		}
+	}
+
+	return nil
+}
+
+func (b *memoryBlacklist) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.revoked[jti]
+	return ok && time.Now().Before(until), nil
+}
+
+// blacklistKey returns the Redis key for a revoked token ID
+func blacklistKey(jti string) string {
+	return "token_blacklist:" + jti
+}
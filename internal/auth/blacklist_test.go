@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRevokedTokenIsRejected(t *testing.T) {
+	s, _ := newTestService(t, Config{})
+	ctx := context.Background()
+	register(t, s, "ada")
+
+	token, _, err := s.LoginUser(ctx, "ada", testPassword)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	other, _, err := s.LoginUser(ctx, "ada", testPassword)
+	if err != nil {
+		t.Fatalf("second LoginUser: %v", err)
+	}
+
+	claims, err := s.ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken before logout: %v", err)
+	}
+	otherClaims, err := s.ParseToken(other)
+	if err != nil {
+		t.Fatalf("ParseToken(other): %v", err)
+	}
+	if claims.ID == "" || claims.ID == otherClaims.ID {
+		t.Fatalf("jti = %q and %q, want distinct non-empty IDs", claims.ID, otherClaims.ID)
+	}
+
+	if err := s.RevokeToken(ctx, token); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if _, err := s.ParseToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ParseToken after logout = %v, want ErrInvalidToken", err)
+	}
+
+	// Logging out one session leaves the user's others alone
+	if _, err := s.ParseToken(other); err != nil {
+		t.Errorf("other session's token rejected: %v", err)
+	}
+}
+
+func TestRevokeTokenIgnoresInvalidTokens(t *testing.T) {
+	s, _ := newTestService(t, Config{})
+	foreign, _ := newTestService(t, Config{JWT: JWTConfig{Secret: "another-secret"}})
+	ctx := context.Background()
+	register(t, foreign, "ada")
+
+	token, _, err := foreign.LoginUser(ctx, "ada", testPassword)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+
+	for name, tokenString := range map[string]string{"garbage": "not.a.jwt", "wrong secret": token} {
+		if err := s.RevokeToken(ctx, tokenString); err != nil {
+			t.Errorf("RevokeToken(%s) = %v, want nil", name, err)
+		}
+	}
+
+	// A token signed elsewhere can't be used to revoke a real one
+	if _, err := foreign.ParseToken(token); err != nil {
+		t.Errorf("token was revoked by a service that can't verify it: %v", err)
+	}
+}
+
+func TestMemoryBlacklistExpires(t *testing.T) {
+	b := NewTokenBlacklist(nil).(*memoryBlacklist)
+	ctx := context.Background()
+
+	if err := b.Revoke(ctx, "short", 10*time.Millisecond); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := b.Revoke(ctx, "long", time.Hour); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if revoked, _ := b.IsRevoked(ctx, "short"); !revoked {
+		t.Error("token not revoked before its TTL")
+	}
+	if revoked, _ := b.IsRevoked(ctx, "unknown"); revoked {
+		t.Error("a token that was never revoked is reported revoked")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	if revoked, _ := b.IsRevoked(ctx, "short"); revoked {
+		t.Error("token still revoked after its TTL")
+	}
+	if revoked, _ := b.IsRevoked(ctx, "long"); !revoked {
+		t.Error("token with time left is no longer revoked")
+	}
+
+	// The next revocation prunes entries that have expired
+	if err := b.Revoke(ctx, "another", time.Hour); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, ok := b.revoked["short"]; ok {
+		t.Error("expired entry was not pruned")
+	}
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// ErrUnknownHashFormat is returned when a stored hash wasn't produced by a supported algorithm
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Argon2Params holds argon2id tuning parameters
+type Argon2Params struct {
+	// Memory is the amount of memory used in KiB
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// HashingConfig selects the algorithm and parameters used for new password hashes
+type HashingConfig struct {
+	Algorithm  string
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+// Hasher hashes and verifies passwords. Hashes are self-describing, so a
+// Hasher can verify hashes made by any supported algorithm regardless of the
+// one it uses for new hashes.
+type Hasher interface {
+	// Hash hashes a password with the configured algorithm
+	Hash(password string) (string, error)
+	// Verify reports whether a password matches a stored hash
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether a stored hash was made with a different
+	// algorithm or parameters than the current configuration
+	NeedsRehash(encoded string) bool
+}
+
+// passwordHasher is the Hasher implementation for bcrypt and argon2id
+type passwordHasher struct {
+	config HashingConfig
+}
+
+// NewHasher creates a new password hasher, filling in defaults for unset parameters
+func NewHasher(config HashingConfig) (Hasher, error) {
+	if config.Algorithm == "" {
+		config.Algorithm = AlgorithmBcrypt
+	}
+	if config.BcryptCost == 0 {
+		config.BcryptCost = bcrypt.DefaultCost
+	}
+	if config.Argon2.Memory == 0 {
+		config.Argon2.Memory = 64 * 1024
+	}
+	if config.Argon2.Iterations == 0 {
+		config.Argon2.Iterations = 3
+	}
+	if config.Argon2.Parallelism == 0 {
+		config.Argon2.Parallelism = 2
+	}
+	if config.Argon2.SaltLength == 0 {
+		config.Argon2.SaltLength = 16
+	}
+	if config.Argon2.KeyLength == 0 {
+		config.Argon2.KeyLength = 32
+	}
+
+	switch config.Algorithm {
+	case AlgorithmBcrypt:
+		if config.BcryptCost < bcrypt.MinCost || config.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case AlgorithmArgon2id:
+	default:
+		return nil, fmt.Errorf("unsupported password hashing algorithm: %q", config.Algorithm)
+	}
+
+	return &passwordHasher{config: config}, nil
+}
+
+// Hash hashes a password with the configured algorithm
+func (h *passwordHasher) Hash(password string) (string, error) {
+	if h.config.Algorithm == AlgorithmArgon2id {
+		return h.hashArgon2id(password)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.config.BcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether a password matches a stored hash
+func (h *passwordHasher) Verify(password, encoded string) (bool, error) {
+	if strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$") {
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	}
+
+	if _, err := bcrypt.Cost([]byte(encoded)); err != nil {
+		return false, ErrUnknownHashFormat
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// NeedsRehash reports whether a stored hash differs from the current configuration
+func (h *passwordHasher) NeedsRehash(encoded string) bool {
+	if strings.HasPrefix(encoded, "$"+AlgorithmArgon2id+"$") {
+		if h.config.Algorithm != AlgorithmArgon2id {
+			return true
+		}
+		params, _, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+		current := h.config.Argon2
+		return params.Memory != current.Memory ||
+			params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism ||
+			uint32(len(key)) != current.KeyLength
+	}
+
+	if h.config.Algorithm != AlgorithmBcrypt {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.config.BcryptCost
+}
+
+// hashArgon2id hashes a password with argon2id, encoding it in the PHC string
+// format: $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>
+func (h *passwordHasher) hashArgon2id(password string) (string, error) {
+	params := h.config.Argon2
+
+	salt := make([]byte, params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+
+	return fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id,
+		argon2.Version,
+		params.Memory,
+		params.Iterations,
+		params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// decodeArgon2id parses an argon2id hash in PHC string format
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %d", version)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+
+	return params, salt, key, nil
+}
@@ -0,0 +1,167 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HashingConfig
+		prefix string
+	}{
+		{"bcrypt", HashingConfig{Algorithm: AlgorithmBcrypt, BcryptCost: bcrypt.MinCost}, "$2a$04$"},
+		{"argon2id", HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2}, "$argon2id$v=19$m=1024,t=1,p=1$"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, err := NewHasher(tt.config)
+			if err != nil {
+				t.Fatalf("NewHasher: %v", err)
+			}
+
+			hash, err := h.Hash(testPassword)
+			if err != nil {
+				t.Fatalf("Hash: %v", err)
+			}
+			if !strings.HasPrefix(hash, tt.prefix) {
+				t.Errorf("hash = %q, want prefix %q", hash, tt.prefix)
+			}
+
+			if ok, err := h.Verify(testPassword, hash); !ok || err != nil {
+				t.Errorf("Verify(correct) = %v, %v; want true", ok, err)
+			}
+			if ok, err := h.Verify("wrong password", hash); ok || err != nil {
+				t.Errorf("Verify(wrong) = %v, %v; want false", ok, err)
+			}
+			if h.NeedsRehash(hash) {
+				t.Error("fresh hash needs rehash")
+			}
+
+			again, _ := h.Hash(testPassword)
+			if again == hash {
+				t.Error("hashing twice gave the same hash; salt isn't random")
+			}
+		})
+	}
+}
+
+func TestHasherVerifiesOtherAlgorithms(t *testing.T) {
+	bcryptHasher, _ := NewHasher(HashingConfig{BcryptCost: bcrypt.MinCost})
+	argonHasher, _ := NewHasher(HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2})
+
+	bcryptHash, _ := bcryptHasher.Hash(testPassword)
+	argonHash, _ := argonHasher.Hash(testPassword)
+
+	if ok, err := argonHasher.Verify(testPassword, bcryptHash); !ok || err != nil {
+		t.Errorf("argon2id hasher verifying a bcrypt hash = %v, %v; want true", ok, err)
+	}
+	if ok, err := bcryptHasher.Verify(testPassword, argonHash); !ok || err != nil {
+		t.Errorf("bcrypt hasher verifying an argon2id hash = %v, %v; want true", ok, err)
+	}
+}
+
+func TestHasherRejectsUnknownFormats(t *testing.T) {
+	h, _ := NewHasher(HashingConfig{BcryptCost: bcrypt.MinCost})
+
+	for _, encoded := range []string{"", "plaintext", "$argon2id$v=19$broken", "$argon2id$v=19$m=x,t=1,p=1$c2FsdA$a2V5"} {
+		if ok, err := h.Verify(testPassword, encoded); ok || !errors.Is(err, ErrUnknownHashFormat) {
+			t.Errorf("Verify(%q) = %v, %v; want ErrUnknownHashFormat", encoded, ok, err)
+		}
+	}
+}
+
+func TestNeedsRehash(t *testing.T) {
+	oldBcrypt, _ := NewHasher(HashingConfig{BcryptCost: bcrypt.MinCost})
+	oldArgon, _ := NewHasher(HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2})
+	bcryptHash, _ := oldBcrypt.Hash(testPassword)
+	argonHash, _ := oldArgon.Hash(testPassword)
+
+	stronger := fastArgon2
+	stronger.Iterations = 2
+
+	tests := []struct {
+		name    string
+		current HashingConfig
+		hash    string
+		want    bool
+	}{
+		{"same bcrypt cost", HashingConfig{BcryptCost: bcrypt.MinCost}, bcryptHash, false},
+		{"higher bcrypt cost", HashingConfig{BcryptCost: bcrypt.MinCost + 1}, bcryptHash, true},
+		{"bcrypt to argon2id", HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2}, bcryptHash, true},
+		{"argon2id to bcrypt", HashingConfig{BcryptCost: bcrypt.MinCost}, argonHash, true},
+		{"same argon2id params", HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2}, argonHash, false},
+		{"more argon2id iterations", HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: stronger}, argonHash, true},
+		{"unparseable hash", HashingConfig{BcryptCost: bcrypt.MinCost}, "garbage", true},
+	}
+
+	for _, tt := range tests {
+		h, err := NewHasher(tt.current)
+		if err != nil {
+			t.Fatalf("%s: NewHasher: %v", tt.name, err)
+		}
+		if got := h.NeedsRehash(tt.hash); got != tt.want {
+			t.Errorf("%s: NeedsRehash = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewHasherValidatesConfig(t *testing.T) {
+	for _, config := range []HashingConfig{
+		{Algorithm: "md5"},
+		{BcryptCost: bcrypt.MaxCost + 1},
+		{BcryptCost: 1},
+	} {
+		if _, err := NewHasher(config); err == nil {
+			t.Errorf("NewHasher(%+v) succeeded", config)
+		}
+	}
+}
+
+func TestLoginUpgradesOutdatedHash(t *testing.T) {
+	ctx := context.Background()
+	s, store := newTestService(t, Config{})
+	user := register(t, s, "ada")
+	if !strings.HasPrefix(user.PasswordHash, "$2a$") {
+		t.Fatalf("registered hash = %q, want bcrypt", user.PasswordHash)
+	}
+
+	// The deployment switches to argon2id after the user registered
+	hasher, err := NewHasher(HashingConfig{Algorithm: AlgorithmArgon2id, Argon2: fastArgon2})
+	if err != nil {
+		t.Fatalf("NewHasher: %v", err)
+	}
+	s.hasher = hasher
+
+	if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with the wrong password: err = %v", err)
+	}
+	stored, _ := store.GetUserByID(ctx, user.ID)
+	if stored.PasswordHash != user.PasswordHash {
+		t.Fatal("failed login rehashed the password")
+	}
+
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	stored, _ = store.GetUserByID(ctx, user.ID)
+	if !strings.HasPrefix(stored.PasswordHash, "$argon2id$") {
+		t.Fatalf("hash after login = %q, want argon2id", stored.PasswordHash)
+	}
+
+	// The upgraded hash still logs in, and isn't rewritten again
+	upgraded := stored.PasswordHash
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); err != nil {
+		t.Fatalf("LoginUser after upgrade: %v", err)
+	}
+	stored, _ = store.GetUserByID(ctx, user.ID)
+	if stored.PasswordHash != upgraded {
+		t.Error("up-to-date hash was rewritten on login")
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// Lockout defaults
+const (
+	defaultLockoutThreshold   = 5
+	defaultLockoutDuration    = time.Minute
+	defaultMaxLockoutDuration = time.Hour
+)
+
+// LockoutConfig holds account lockout configuration. Lockouts are per
+// account rather than per client, so spreading attempts across addresses
+// doesn't get around them.
+type LockoutConfig struct {
+	// Threshold is how many failed logins in a row lock the account
+	Threshold int
+	// Duration is how long the first lockout lasts. Each further failure
+	// after the lock expires doubles it.
+	Duration time.Duration
+	// MaxDuration caps how long a single lockout lasts
+	MaxDuration time.Duration
+}
+
+// withDefaults fills in defaults for unset values
+func (c LockoutConfig) withDefaults() LockoutConfig {
+	if c.Threshold <= 0 {
+		c.Threshold = defaultLockoutThreshold
+	}
+	if c.Duration <= 0 {
+		c.Duration = defaultLockoutDuration
+	}
+	if c.MaxDuration <= 0 {
+		c.MaxDuration = defaultMaxLockoutDuration
+	}
+	if c.MaxDuration < c.Duration {
+		c.MaxDuration = c.Duration
+	}
+	return c
+}
+
+// lockoutDuration returns how long to lock an account after the given number
+// of failed logins in a row, or zero if it shouldn't be locked yet
+func (c LockoutConfig) lockoutDuration(attempts int) time.Duration {
+	if attempts < c.Threshold {
+		return 0
+	}
+
+	duration := c.Duration
+	for i := c.Threshold; i < attempts && duration < c.MaxDuration; i++ {
+		duration *= 2
+	}
+	return min(duration, c.MaxDuration)
+}
+
+// isLocked reports whether a user is locked out at the given time
+func isLocked(user *models.User, now time.Time) bool {
+	return user.LockedUntil != nil && now.Before(*user.LockedUntil)
+}
+
+// recordFailedLogin counts a failed login against a user, locking the account
+// once the threshold is reached. It reports whether the account is now locked.
+func (s *Service) recordFailedLogin(ctx context.Context, user *models.User) bool {
+	attempts, err := s.store.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to record failed login")
+		return false
+	}
+
+	duration := s.config.Lockout.lockoutDuration(attempts)
+	if duration == 0 {
+		return false
+	}
+
+	if err := s.store.LockUser(ctx, user.ID, time.Now().Add(duration)); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to lock account")
+		return false
+	}
+
+	log.Ctx(ctx).Warn().
+		Str("user_id", user.ID.String()).
+		Int("failed_attempts", attempts).
+		Dur("duration", duration).
+		Msg("Account locked after repeated failed logins")
+	return true
+}
+
+// clearFailedLogins resets a user's failed login count after a successful
+// login or password reset
+func (s *Service) clearFailedLogins(ctx context.Context, user *models.User) {
+	if user.FailedLoginAttempts == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := s.store.ResetFailedLogins(ctx, user.ID); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to reset failed logins")
+		return
+	}
+	user.FailedLoginAttempts = 0
+	user.LockedUntil = nil
+}
@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	c := LockoutConfig{Threshold: 3, Duration: time.Minute, MaxDuration: 10 * time.Minute}.withDefaults()
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 0},
+		{2, 0},
+		{3, time.Minute},
+		{4, 2 * time.Minute},
+		{5, 4 * time.Minute},
+		{6, 8 * time.Minute},
+		{7, 10 * time.Minute},
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := c.lockoutDuration(tt.attempts); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+
+	// A cap below the first lockout is raised to it
+	if c := (LockoutConfig{Duration: time.Hour, MaxDuration: time.Minute}).withDefaults(); c.MaxDuration != time.Hour {
+		t.Errorf("MaxDuration = %v, want it raised to Duration", c.MaxDuration)
+	}
+}
+
+func TestLoginLocksAccountAtThreshold(t *testing.T) {
+	s, store := newTestService(t, Config{Lockout: LockoutConfig{Threshold: 3, Duration: 50 * time.Millisecond}})
+	ctx := context.Background()
+	ada := register(t, s, "ada")
+	register(t, s, "grace")
+
+	for i := 1; i <= 2; i++ {
+		if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failure %d: %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+	if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure at the threshold: %v, want ErrAccountLocked", err)
+	}
+
+	// While locked, even the right password is refused
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("right password while locked: %v, want ErrAccountLocked", err)
+	}
+	// The lock is on the account, not on everyone
+	if _, _, err := s.LoginUser(ctx, "grace", testPassword); err != nil {
+		t.Errorf("another account was locked too: %v", err)
+	}
+
+	// The lock lifts on its own
+	time.Sleep(60 * time.Millisecond)
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); err != nil {
+		t.Fatalf("login after the lock expired: %v", err)
+	}
+
+	// A successful login starts the count over
+	user, err := store.GetUserByID(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if user.FailedLoginAttempts != 0 || user.LockedUntil != nil {
+		t.Errorf("after a successful login: attempts = %d, locked until %v; want a clean slate", user.FailedLoginAttempts, user.LockedUntil)
+	}
+	for i := 1; i <= 2; i++ {
+		if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("failure %d after reset: %v, want ErrInvalidCredentials", i, err)
+		}
+	}
+}
+
+func TestLockoutGrowsWithRepeatedFailures(t *testing.T) {
+	s, store := newTestService(t, Config{Lockout: LockoutConfig{Threshold: 2, Duration: 40 * time.Millisecond, MaxDuration: time.Hour}})
+	ctx := context.Background()
+	ada := register(t, s, "ada")
+
+	lockedFor := func() time.Duration {
+		t.Helper()
+		user, err := store.GetUserByID(ctx, ada.ID)
+		if err != nil {
+			t.Fatalf("GetUserByID: %v", err)
+		}
+		if user.LockedUntil == nil {
+			t.Fatal("account isn't locked")
+		}
+		return time.Until(*user.LockedUntil)
+	}
+
+	s.LoginUser(ctx, "ada", "wrong password")
+	if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure at the threshold: %v, want ErrAccountLocked", err)
+	}
+	first := lockedFor()
+
+	// Failing again once the lock expires locks for twice as long
+	time.Sleep(50 * time.Millisecond)
+	if _, _, err := s.LoginUser(ctx, "ada", "wrong password"); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("failure after the lock expired: %v, want ErrAccountLocked", err)
+	}
+	second := lockedFor()
+
+	if first > 40*time.Millisecond || second <= 40*time.Millisecond || second > 80*time.Millisecond {
+		t.Errorf("lockouts last %v then %v, want about 40ms then 80ms", first, second)
+	}
+}
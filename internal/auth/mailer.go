@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Supported mail drivers
+const (
+	// MailDriverNone sends no email, so flows that depend on it are refused
+	MailDriverNone = ""
+	// MailDriverSMTP delivers through an SMTP server
+	MailDriverSMTP = "smtp"
+	// MailDriverLog only records that an email would have been sent
+	MailDriverLog = "log"
+)
+
+// defaultSMTPPort is the mail submission port, which takes STARTTLS
+const defaultSMTPPort = 587
+
+// ErrMailerNotConfigured is returned by flows that need to email the user
+// when there is no way to send email
+var ErrMailerNotConfigured = errors.New("no mailer is configured")
+
+// Mailer delivers email to users. Implementations wrap an SMTP server or a
+// mail provider's API.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// MailConfig selects how emails are delivered
+type MailConfig struct {
+	// Driver is MailDriverNone, MailDriverSMTP or MailDriverLog
+	Driver string
+	// From is the sender address
+	From     string
+	SMTPHost string
+	// SMTPPort defaults to 587
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// NewMailer creates the Mailer a config selects. It returns nil for
+// MailDriverNone.
+func NewMailer(config MailConfig) (Mailer, error) {
+	switch config.Driver {
+	case MailDriverNone:
+		return nil, nil
+	case MailDriverLog:
+		return LogMailer{}, nil
+	case MailDriverSMTP:
+		if config.SMTPHost == "" {
+			return nil, errors.New("smtp mailer needs a host")
+		}
+		if config.From == "" {
+			return nil, errors.New("smtp mailer needs a from address")
+		}
+		if config.SMTPPort == 0 {
+			config.SMTPPort = defaultSMTPPort
+		}
+		return &SMTPMailer{config: config}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %q", config.Driver)
+	}
+}
+
+// LogMailer is a Mailer that only logs the recipient and subject of each
+// message. It is meant for development: bodies can hold password reset
+// links, so they are never logged.
+type LogMailer struct{}
+
+// Send logs the message's recipient and subject
+func (LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	log.Ctx(ctx).Info().Str("to", to).Str("subject", subject).Msg("Email not sent: log mailer configured")
+	return nil
+}
+
+// SMTPMailer sends plain text email through an SMTP server. The connection
+// is upgraded with STARTTLS when the server offers it.
+type SMTPMailer struct {
+	config MailConfig
+}
+
+// Send delivers a message
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	// Header values can't be allowed to start new headers
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return errors.New("invalid email header value")
+	}
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.config.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", m.config.SMTPUsername, m.config.SMTPPassword, m.config.SMTPHost)
+	}
+
+	addr := net.JoinHostPort(m.config.SMTPHost, strconv.Itoa(m.config.SMTPPort))
+	if err := smtp.SendMail(addr, auth, m.config.From, []string{to}, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Ctx(ctx).Debug().Str("to", to).Str("subject", subject).Msg("Email sent")
+	return nil
+}
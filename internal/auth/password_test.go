@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidatePassword(t *testing.T) {
+	all := PasswordConfig{MinLength: 8, RequireUppercase: true, RequireLowercase: true, RequireNumber: true, RequireSpecial: true}
+
+	tests := []struct {
+		name     string
+		config   PasswordConfig
+		password string
+		// unmet lists the requirements the error must name; empty means the
+		// password is accepted
+		unmet []string
+	}{
+		{"length only", PasswordConfig{MinLength: 8}, "aaaaaaaa", nil},
+		{"too short", PasswordConfig{MinLength: 8}, "aaaaaaa", []string{"at least 8 characters"}},
+		{"uppercase present", PasswordConfig{RequireUppercase: true}, "abcD", nil},
+		{"uppercase missing", PasswordConfig{RequireUppercase: true}, "abcd", []string{"uppercase"}},
+		{"lowercase present", PasswordConfig{RequireLowercase: true}, "ABCd", nil},
+		{"lowercase missing", PasswordConfig{RequireLowercase: true}, "ABCD", []string{"lowercase"}},
+		{"number present", PasswordConfig{RequireNumber: true}, "abc1", nil},
+		{"number missing", PasswordConfig{RequireNumber: true}, "abcd", []string{"number"}},
+		{"special present", PasswordConfig{RequireSpecial: true}, "abc~", nil},
+		{"space is special", PasswordConfig{RequireSpecial: true}, "ab cd", nil},
+		{"special missing", PasswordConfig{RequireSpecial: true}, "abcd", []string{"special"}},
+		{"non-ASCII symbol is not special", PasswordConfig{RequireSpecial: true}, "abc€", []string{"special"}},
+		{"non-ASCII letters count", PasswordConfig{RequireUppercase: true, RequireLowercase: true}, "Ñandú", nil},
+		{"all met", all, "Tr0ub4dor&3", nil},
+		{"every requirement unmet", all, "", []string{"at least 8 characters", "uppercase", "lowercase", "number", "special"}},
+		{"some requirements unmet", all, "troubadour", []string{"uppercase", "number", "special"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: Config{Password: tt.config}}
+
+			err := s.validatePassword(tt.password)
+			if len(tt.unmet) == 0 {
+				if err != nil {
+					t.Fatalf("validatePassword(%q) = %v, want nil", tt.password, err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrWeakPassword) {
+				t.Fatalf("validatePassword(%q) = %v, want ErrWeakPassword", tt.password, err)
+			}
+			for _, want := range tt.unmet {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+			if n := strings.Count(err.Error(), ", ") + 1; n != len(tt.unmet) {
+				t.Errorf("error %q names %d requirements, want %d", err, n, len(tt.unmet))
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ErrRedirectNotAllowed is returned for a redirect or link target that isn't
+// in the allowlist
+var ErrRedirectNotAllowed = errors.New("redirect URL is not allowed")
+
+// ValidateRedirectURL checks a URL that users will be sent to, such as the
+// page a password reset email links to, against the configured allowlist. An
+// allowlist entry matches exactly, or, if it ends in "*", matches every URL
+// starting with the rest of it. Only absolute http and https URLs are
+// accepted, and with an empty allowlist none are.
+func (s *Service) ValidateRedirectURL(raw string) error {
+	target, err := url.Parse(raw)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" || target.User != nil {
+		return fmt.Errorf("%w: %q", ErrRedirectNotAllowed, raw)
+	}
+
+	for _, allowed := range s.config.AllowedRedirectURLs {
+		if prefix, ok := strings.CutSuffix(allowed, "*"); ok {
+			if strings.HasPrefix(raw, prefix) {
+				return nil
+			}
+		} else if raw == allowed {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrRedirectNotAllowed, raw)
+}
+
+// checkRedirectAllowlist rejects allowlist entries that would match more than
+// intended. A prefix entry has to cover a whole path on a fixed host, so
+// "https://example.com/app/*" is accepted but "https://example.com*", which
+// also matches example.com.evil.net, is not.
+func checkRedirectAllowlist(allowlist []string) error {
+	for _, allowed := range allowlist {
+		entry, isPrefix := strings.CutSuffix(allowed, "*")
+		parsed, err := url.Parse(entry)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" ||
+			strings.Contains(entry, "*") || (isPrefix && !strings.HasSuffix(parsed.Path, "/")) {
+			return fmt.Errorf("invalid allowed redirect URL %q", allowed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateRedirectURL(t *testing.T) {
+	s, _ := newTestService(t, Config{AllowedRedirectURLs: []string{
+		"https://chat.example.com/reset",
+		"https://app.example.com/auth/*",
+	}})
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://chat.example.com/reset", true},
+		{"https://app.example.com/auth/callback", true},
+		{"https://app.example.com/auth/deep/link?x=1", true},
+
+		// Exact entries match only themselves
+		{"https://chat.example.com/reset/other", false},
+		{"https://chat.example.com/reset?next=https://evil.example.net", false},
+		{"http://chat.example.com/reset", false},
+		// Prefix entries stay on their host and path
+		{"https://app.example.com/authz", false},
+		{"https://app.example.com.evil.net/auth/callback", false},
+		{"https://app.example.com/", false},
+		// Not absolute web URLs, or trying to smuggle a host
+		{"/auth/callback", false},
+		{"javascript:alert(1)", false},
+		{"https://user@app.example.com/auth/callback", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		err := s.ValidateRedirectURL(tt.url)
+		if tt.allowed && err != nil {
+			t.Errorf("ValidateRedirectURL(%q) = %v, want it allowed", tt.url, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrRedirectNotAllowed) {
+			t.Errorf("ValidateRedirectURL(%q) = %v, want ErrRedirectNotAllowed", tt.url, err)
+		}
+	}
+}
+
+func TestValidateRedirectURLEmptyAllowlist(t *testing.T) {
+	s, _ := newTestService(t, Config{})
+
+	if err := s.ValidateRedirectURL("https://chat.example.com/reset"); !errors.Is(err, ErrRedirectNotAllowed) {
+		t.Errorf("with no allowlist: %v, want ErrRedirectNotAllowed", err)
+	}
+}
+
+func TestNewServiceChecksRedirectConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  []string
+		resetURL string
+		wantErr  bool
+	}{
+		{"exact and prefix entries", []string{"https://chat.example.com/reset", "https://app.example.com/auth/*"}, "", false},
+		{"prefix without a path", []string{"https://app.example.com*"}, "", true},
+		{"prefix mid-path", []string{"https://app.example.com/auth*"}, "", true},
+		{"wildcard in the host", []string{"https://*.example.com/"}, "", true},
+		{"relative entry", []string{"/reset"}, "", true},
+		{"reset page in the allowlist", []string{"https://chat.example.com/*"}, "https://chat.example.com/reset", false},
+		{"reset page outside the allowlist", []string{"https://chat.example.com/*"}, "https://other.example.com/reset", true},
+		{"reset page with no allowlist", nil, "https://other.example.com/reset", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewService(Config{
+				JWT:                 JWTConfig{Secret: "test-secret"},
+				AllowedRedirectURLs: tt.allowed,
+				PasswordResetURL:    tt.resetURL,
+			}, nil, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewService error = %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
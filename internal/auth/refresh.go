@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// defaultRefreshExpirationHours is used when no refresh token lifetime is
+// configured
+const defaultRefreshExpirationHours = 30 * 24
+
+// refreshTokenBytes is the amount of randomness in a refresh token
+const refreshTokenBytes = 32
+
+// Refresh exchanges a refresh token for a new access token. The refresh token
+// is rotated: the one presented is revoked and a replacement is returned, so
+// a stolen token can be replayed at most once.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, string, error) {
+	stored, err := s.store.ConsumeRefreshToken(ctx, hashToken(refreshToken))
+	if err != nil {
+		log.Ctx(ctx).Debug().Err(err).Msg("Refresh token not found")
+		return "", "", ErrInvalidToken
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		return "", "", ErrInvalidToken
+	}
+
+	user, err := s.store.GetUserByID(ctx, stored.UserID)
+	if err != nil || !user.IsActive {
+		return "", "", ErrInvalidToken
+	}
+
+	accessToken, err := s.generateToken(ctx, user)
+	if err != nil {
+		return "", "", fmt.Errorf("error generating token: %w", err)
+	}
+
+	newRefreshToken, err := s.issueRefreshToken(ctx, user.ID)
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, newRefreshToken, nil
+}
+
+// RevokeRefreshToken revokes a refresh token. Unknown tokens are ignored.
+func (s *Service) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	if _, err := s.store.ConsumeRefreshToken(ctx, hashToken(refreshToken)); err != nil {
+		log.Ctx(ctx).Debug().Err(err).Msg("Refresh token not found")
+	}
+	return nil
+}
+
+// issueRefreshToken creates and stores a new refresh token for a user
+func (s *Service) issueRefreshToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating refresh token: %w", err)
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(buf)
+
+	stored := &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(time.Duration(s.config.JWT.RefreshExpirationHours) * time.Hour),
+	}
+	if err := s.store.CreateRefreshToken(ctx, stored); err != nil {
+		return "", fmt.Errorf("error storing refresh token: %w", err)
+	}
+
+	return refreshToken, nil
+}
+
+// hashToken returns the form a refresh token, reset token or API key is
+// stored in. They are random rather than user-chosen, so a fast hash is
+// sufficient.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,157 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// login signs a user in with testPassword and returns the refresh token
+func login(t *testing.T, s *Service, username string) string {
+	t.Helper()
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/", nil)
+	_, refreshToken, _, err := s.Login(c, username, testPassword)
+	if err != nil {
+		t.Fatalf("Login(%s): %v", username, err)
+	}
+	if refreshToken == "" {
+		t.Fatal("Login issued no refresh token")
+	}
+	return refreshToken
+}
+
+func TestRefreshRotatesTokens(t *testing.T) {
+	s, _ := newTestService(t, Config{})
+	ctx := context.Background()
+	user := register(t, s, "ada")
+	first := login(t, s, "ada")
+
+	access, second, err := s.Refresh(ctx, first)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	if userID, _, err := s.ValidateToken(access); err != nil || userID != user.ID {
+		t.Errorf("refreshed access token is for %s (%v), want %s", userID, err, user.ID)
+	}
+	if second == "" || second == first {
+		t.Fatalf("refresh token wasn't rotated: %q", second)
+	}
+
+	// The token just used is spent
+	if _, _, err := s.Refresh(ctx, first); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("replaying a used refresh token: error %v, want ErrInvalidToken", err)
+	}
+
+	// Its replacement works, once
+	_, third, err := s.Refresh(ctx, second)
+	if err != nil {
+		t.Fatalf("Refresh with the rotated token: %v", err)
+	}
+	if third == second {
+		t.Error("refresh token wasn't rotated on second use")
+	}
+	if _, _, err := s.Refresh(ctx, second); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("replaying the rotated token: error %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRefreshTokensStoredHashed(t *testing.T) {
+	s, store := newTestService(t, Config{})
+	ctx := context.Background()
+	register(t, s, "ada")
+	token := login(t, s, "ada")
+
+	// Looking the raw token up as a hash finds nothing
+	if _, err := store.ConsumeRefreshToken(ctx, token); err == nil {
+		t.Error("refresh token stored as issued")
+	}
+	if stored, err := store.ConsumeRefreshToken(ctx, hashToken(token)); err != nil || stored.TokenHash == token {
+		t.Errorf("hashed token lookup: %+v, %v", stored, err)
+	}
+}
+
+func TestRefreshRejects(t *testing.T) {
+	s, store := newTestService(t, Config{})
+	ctx := context.Background()
+	user := register(t, s, "ada")
+
+	expired := "expired-token"
+	err := store.CreateRefreshToken(ctx, &models.RefreshToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hashToken(expired),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken: %v", err)
+	}
+	if _, _, err := s.Refresh(ctx, expired); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expired token: error %v, want ErrInvalidToken", err)
+	}
+
+	if _, _, err := s.Refresh(ctx, "never-issued"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("unknown token: error %v, want ErrInvalidToken", err)
+	}
+
+	// Revoked on logout
+	revoked := login(t, s, "ada")
+	if err := s.RevokeRefreshToken(ctx, revoked); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	if _, _, err := s.Refresh(ctx, revoked); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("revoked token: error %v, want ErrInvalidToken", err)
+	}
+	if err := s.RevokeRefreshToken(ctx, "never-issued"); err != nil {
+		t.Errorf("revoking an unknown token: %v", err)
+	}
+
+	// A deactivated account can't mint new tokens
+	live := login(t, s, "ada")
+	user.IsActive = false
+	if err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if _, _, err := s.Refresh(ctx, live); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("deactivated user: error %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRefreshTokenUsableOnceUnderConcurrency(t *testing.T) {
+	s, _ := newTestService(t, Config{})
+	register(t, s, "ada")
+	token := login(t, s, "ada")
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	results := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := s.Refresh(context.Background(), token)
+			results <- err
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d concurrent refreshes succeeded, want exactly 1", succeeded, attempts)
+	}
+}
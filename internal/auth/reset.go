@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// passwordResetSubject is the subject line of password reset emails
+const passwordResetSubject = "Reset your password"
+
+// resetTokenBytes is the amount of randomness in a password reset token
+const resetTokenBytes = 32
+
+// RequestPasswordReset emails a password reset token to the account with the
+// given address. Like every RequestEmail flow it reports nothing about
+// whether the account exists. Tokens expire after the email throttle's token
+// TTL. The email links to resetURL if given, which must be in the redirect
+// allowlist, and otherwise to the configured reset page. Without a mailer it
+// returns ErrMailerNotConfigured, for every address alike.
+func (s *Service) RequestPasswordReset(ctx context.Context, email, resetURL string) error {
+	if s.mailer == nil {
+		return ErrMailerNotConfigured
+	}
+
+	if resetURL == "" {
+		resetURL = s.config.PasswordResetURL
+	} else if err := s.ValidateRedirectURL(resetURL); err != nil {
+		return err
+	}
+
+	return s.RequestEmail(ctx, email, func(ctx context.Context, user *models.User) error {
+		token, err := s.issuePasswordReset(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		return s.mailer.Send(ctx, user.Email, passwordResetSubject, passwordResetBody(token, resetURL, s.emailThrottle.config.TokenTTL))
+	})
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset.
+// The token is used up, and the user's other reset tokens are invalidated
+// along with it. The password is checked first, so a weak one doesn't waste
+// the token.
+func (s *Service) ResetPassword(ctx context.Context, token, password string) error {
+	if err := s.validatePassword(password); err != nil {
+		return err
+	}
+
+	reset, err := s.store.ConsumePasswordReset(ctx, hashToken(token))
+	if err != nil {
+		log.Ctx(ctx).Debug().Err(err).Msg("Password reset token not found")
+		return ErrInvalidToken
+	}
+	if err := s.emailThrottle.ReleaseToken(ctx, reset.UserID); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to release email token")
+	}
+	if time.Now().After(reset.ExpiresAt) {
+		return ErrInvalidToken
+	}
+
+	user, err := s.store.GetUserByID(ctx, reset.UserID)
+	if err != nil || !user.IsActive {
+		return ErrInvalidToken
+	}
+
+	hash, err := s.hasher.Hash(password)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	user.PasswordHash = hash
+	if err := s.store.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+
+	// Guesses at the old password no longer count against the account
+	s.clearFailedLogins(ctx, user)
+
+	// Any other reset link sent before the change is now stale
+	if err := s.store.DeletePasswordResets(ctx, user.ID); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("user_id", user.ID.String()).Msg("Failed to invalidate password reset tokens")
+	}
+
+	log.Ctx(ctx).Info().Str("user_id", user.ID.String()).Msg("Password reset")
+	return nil
+}
+
+// issuePasswordReset creates and stores a new password reset token for a user
+func (s *Service) issuePasswordReset(ctx context.Context, userID uuid.UUID) (string, error) {
+	buf := make([]byte, resetTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating password reset token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	reset := &models.PasswordReset{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.emailThrottle.config.TokenTTL),
+	}
+	if err := s.store.CreatePasswordReset(ctx, reset); err != nil {
+		return "", fmt.Errorf("error storing password reset token: %w", err)
+	}
+
+	return token, nil
+}
+
+// passwordResetBody returns the text of a password reset email: a link to the
+// reset page if there is one, otherwise the bare token
+func passwordResetBody(token, resetURL string, ttl time.Duration) string {
+	instructions := "Use this code to reset your password: " + token
+	if resetURL != "" {
+		if link, err := url.Parse(resetURL); err != nil {
+			log.Error().Err(err).Msg("Invalid password reset URL; sending the bare token")
+		} else {
+			query := link.Query()
+			query.Set("token", token)
+			link.RawQuery = query.Encode()
+			instructions = "Follow this link to reset your password: " + link.String()
+		}
+	}
+
+	return fmt.Sprintf("%s\n\nIt expires in %d minutes. If you didn't ask to reset your password, you can ignore this email.",
+		instructions, int(ttl.Minutes()))
+}
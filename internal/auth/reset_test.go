@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// sentMail is one email handed to a mailer
+type sentMail struct {
+	to, subject, body string
+}
+
+// outbox is a Mailer that keeps what it is asked to send
+type outbox struct {
+	mu   sync.Mutex
+	sent []sentMail
+}
+
+func (o *outbox) Send(ctx context.Context, to, subject, body string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sent = append(o.sent, sentMail{to, subject, body})
+	return nil
+}
+
+// lastToken returns the reset token from the most recent email, which carries
+// the bare token when no reset page is configured
+func (o *outbox) lastToken(t *testing.T) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.sent) == 0 {
+		t.Fatal("no email sent")
+	}
+	body := o.sent[len(o.sent)-1].body
+	const prefix = "Use this code to reset your password: "
+	if !strings.HasPrefix(body, prefix) {
+		t.Fatalf("email body %q has no reset code", body)
+	}
+	token, _, _ := strings.Cut(strings.TrimPrefix(body, prefix), "\n")
+	return token
+}
+
+// newResetService creates a service that mails reset tokens to an outbox,
+// with no cooldown or response padding to slow tests down
+func newResetService(t *testing.T, tokenTTL time.Duration) (*Service, *outbox) {
+	t.Helper()
+
+	s, _ := newTestService(t, Config{
+		Password: PasswordConfig{MinLength: 12},
+		EmailThrottle: EmailThrottleConfig{
+			Cooldown:        time.Nanosecond,
+			MinResponseTime: time.Nanosecond,
+			TokenTTL:        tokenTTL,
+		},
+	})
+	mail := &outbox{}
+	s.SetMailer(mail)
+	return s, mail
+}
+
+const newPassword = "staple battery horse"
+
+func TestResetPassword(t *testing.T) {
+	s, mail := newResetService(t, time.Hour)
+	ctx := context.Background()
+	ada := register(t, s, "ada")
+
+	if err := s.RequestPasswordReset(ctx, "ada@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if len(mail.sent) != 1 || mail.sent[0].to != ada.Email || mail.sent[0].subject != passwordResetSubject {
+		t.Fatalf("sent %+v, want one reset email to %s", mail.sent, ada.Email)
+	}
+	token := mail.lastToken(t)
+
+	if err := s.ResetPassword(ctx, token, newPassword); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "ada", newPassword); err != nil {
+		t.Errorf("login with the new password: %v", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("login with the old password: %v, want ErrInvalidCredentials", err)
+	}
+
+	// Tokens are single use
+	if err := s.ResetPassword(ctx, token, "another good password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("reusing the token: %v, want ErrInvalidToken", err)
+	}
+	if err := s.ResetPassword(ctx, "not-a-token", newPassword); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("made-up token: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestResetPasswordInvalidatesOtherTokens(t *testing.T) {
+	s, mail := newResetService(t, time.Hour)
+	ctx := context.Background()
+	register(t, s, "ada")
+
+	var tokens []string
+	for i := 0; i < 2; i++ {
+		if err := s.RequestPasswordReset(ctx, "ada@example.com", ""); err != nil {
+			t.Fatalf("RequestPasswordReset: %v", err)
+		}
+		tokens = append(tokens, mail.lastToken(t))
+	}
+
+	if err := s.ResetPassword(ctx, tokens[1], newPassword); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+	// The earlier link was sent before the password changed
+	if err := s.ResetPassword(ctx, tokens[0], "another good password"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("older token after a reset: %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestResetPasswordExpiredToken(t *testing.T) {
+	s, mail := newResetService(t, 20*time.Millisecond)
+	ctx := context.Background()
+	register(t, s, "ada")
+
+	if err := s.RequestPasswordReset(ctx, "ada@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := mail.lastToken(t)
+
+	time.Sleep(30 * time.Millisecond)
+	if err := s.ResetPassword(ctx, token, newPassword); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expired token: %v, want ErrInvalidToken", err)
+	}
+	if _, _, err := s.LoginUser(ctx, "ada", testPassword); err != nil {
+		t.Errorf("password changed by an expired token: %v", err)
+	}
+}
+
+func TestResetPasswordWeakPasswordKeepsToken(t *testing.T) {
+	s, mail := newResetService(t, time.Hour)
+	ctx := context.Background()
+	register(t, s, "ada")
+
+	if err := s.RequestPasswordReset(ctx, "ada@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	token := mail.lastToken(t)
+
+	if err := s.ResetPassword(ctx, token, "short"); !errors.Is(err, ErrWeakPassword) {
+		t.Fatalf("weak password: %v, want ErrWeakPassword", err)
+	}
+	if err := s.ResetPassword(ctx, token, newPassword); err != nil {
+		t.Errorf("token unusable after a weak password was refused: %v", err)
+	}
+}
+
+func TestRequestPasswordResetUnknownEmail(t *testing.T) {
+	s, mail := newResetService(t, time.Hour)
+	register(t, s, "ada")
+
+	if err := s.RequestPasswordReset(context.Background(), "nobody@example.com", ""); err != nil {
+		t.Errorf("unknown email: %v, want the same success as a known one", err)
+	}
+	if len(mail.sent) != 0 {
+		t.Errorf("sent %+v for an unknown email", mail.sent)
+	}
+}
+
+func TestRequestPasswordResetWithoutMailer(t *testing.T) {
+	s, _ := newTestService(t, Config{EmailThrottle: EmailThrottleConfig{MinResponseTime: time.Nanosecond}})
+	register(t, s, "ada")
+
+	// Refused for every address alike, so it reveals nothing either
+	for _, email := range []string{"ada@example.com", "nobody@example.com"} {
+		if err := s.RequestPasswordReset(context.Background(), email, ""); !errors.Is(err, ErrMailerNotConfigured) {
+			t.Errorf("%s: %v, want ErrMailerNotConfigured", email, err)
+		}
+	}
+}
+
+func TestPasswordResetLinksToResetPage(t *testing.T) {
+	s, _ := newTestService(t, Config{
+		EmailThrottle:       EmailThrottleConfig{MinResponseTime: time.Nanosecond},
+		PasswordResetURL:    "https://chat.example.com/reset",
+		AllowedRedirectURLs: []string{"https://chat.example.com/*"},
+	})
+	mail := &outbox{}
+	s.SetMailer(mail)
+	register(t, s, "ada")
+	register(t, s, "grace")
+
+	if err := s.RequestPasswordReset(context.Background(), "ada@example.com", ""); err != nil {
+		t.Fatalf("RequestPasswordReset: %v", err)
+	}
+	if body := mail.sent[0].body; !strings.Contains(body, "https://chat.example.com/reset?token=") {
+		t.Errorf("body %q doesn't link to the configured reset page", body)
+	}
+
+	if err := s.RequestPasswordReset(context.Background(), "grace@example.com", "https://chat.example.com/mobile/reset"); err != nil {
+		t.Fatalf("RequestPasswordReset with an allowed URL: %v", err)
+	}
+	if body := mail.sent[1].body; !strings.Contains(body, "https://chat.example.com/mobile/reset?token=") {
+		t.Errorf("body %q doesn't link to the requested reset page", body)
+	}
+
+	if err := s.RequestPasswordReset(context.Background(), "ada@example.com", "https://evil.example.net/reset"); err == nil {
+		t.Error("reset link to a URL outside the allowlist was accepted")
+	}
+	if len(mail.sent) != 2 {
+		t.Errorf("sent %d emails, want none for the refused URL", len(mail.sent))
+	}
+}
+
+func TestLogMailerOmitsBody(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+
+	if err := (LogMailer{}).Send(ctx, "ada@example.com", passwordResetSubject, "secret-reset-token"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "secret-reset-token") {
+		t.Errorf("log %q contains the email body", logged)
+	}
+	if !strings.Contains(logged, "ada@example.com") || !strings.Contains(logged, passwordResetSubject) {
+		t.Errorf("log %q is missing the recipient or subject", logged)
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  MailConfig
+		wantNil bool
+		wantErr bool
+	}{
+		{"none", MailConfig{Driver: MailDriverNone}, true, false},
+		{"log", MailConfig{Driver: MailDriverLog}, false, false},
+		{"smtp", MailConfig{Driver: MailDriverSMTP, SMTPHost: "smtp.example.com", From: "chat@example.com"}, false, false},
+		{"smtp without host", MailConfig{Driver: MailDriverSMTP, From: "chat@example.com"}, true, true},
+		{"smtp without sender", MailConfig{Driver: MailDriverSMTP, SMTPHost: "smtp.example.com"}, true, true},
+		{"unknown driver", MailConfig{Driver: "carrier-pigeon"}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mailer, err := NewMailer(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if (mailer == nil) != tt.wantNil {
+				t.Errorf("mailer = %v, want nil: %v", mailer, tt.wantNil)
+			}
+		})
+	}
+
+	mailer, _ := NewMailer(MailConfig{Driver: MailDriverSMTP, SMTPHost: "smtp.example.com", From: "chat@example.com"})
+	if port := mailer.(*SMTPMailer).config.SMTPPort; port != defaultSMTPPort {
+		t.Errorf("SMTP port = %d, want the default %d", port, defaultSMTPPort)
+	}
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// HasPermission reports whether the token's holder has a permission. Admins
+// have every permission.
+func (c *Claims) HasPermission(permission string) bool {
+	if c.Admin {
+		return true
+	}
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// userRoles returns the names of a user's roles and the union of their
+// permissions, both sorted
+func (s *Service) userRoles(ctx context.Context, userID uuid.UUID) ([]string, []string, error) {
+	roles, err := s.store.ListUserRoles(ctx, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load roles: %w", err)
+	}
+	names, permissions := aggregateRoles(roles)
+	return names, permissions, nil
+}
+
+// aggregateRoles returns the names of roles and the union of their
+// permissions, both sorted
+func aggregateRoles(roles []*models.Role) ([]string, []string) {
+	names := make([]string, 0, len(roles))
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		names = append(names, role.Name)
+		for _, p := range role.Permissions {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(permissions)
+	return names, permissions
+}
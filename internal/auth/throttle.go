@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// ErrEmailCooldown is returned when an email was requested for the same address too recently
+var ErrEmailCooldown = errors.New("please wait before requesting another email")
+
+// EmailThrottleConfig holds limits for endpoints that send verification or reset emails
+type EmailThrottleConfig struct {
+	// Cooldown is the minimum time between emails to the same address
+	Cooldown time.Duration
+	// MaxOutstandingTokens caps the unused tokens a user can have at once
+	MaxOutstandingTokens int
+	// TokenTTL is how long an issued token stays outstanding
+	TokenTTL time.Duration
+	// MinResponseTime pads every request to at least this long so timing
+	// doesn't reveal whether the account exists
+	MinResponseTime time.Duration
+}
+
+// EmailThrottle enforces per-address cooldowns and per-user token caps. It uses
+// Redis when available so limits hold across instances, and falls back to
+// process-local state otherwise.
+type EmailThrottle struct {
+	config EmailThrottleConfig
+	redis  *redis.Client
+
+	mu          sync.Mutex
+	cooldowns   map[string]time.Time
+	outstanding map[uuid.UUID][]time.Time
+}
+
+// NewEmailThrottle creates a new email throttle. rdb may be nil.
+func NewEmailThrottle(config EmailThrottleConfig, rdb *redis.Client) *EmailThrottle {
+	if config.Cooldown <= 0 {
+		config.Cooldown = time.Minute
+	}
+	if config.MaxOutstandingTokens <= 0 {
+		config.MaxOutstandingTokens = 3
+	}
+	if config.TokenTTL <= 0 {
+		config.TokenTTL = time.Hour
+	}
+	if config.MinResponseTime <= 0 {
+		config.MinResponseTime = 500 * time.Millisecond
+	}
+
+	return &EmailThrottle{
+		config:      config,
+		redis:       rdb,
+		cooldowns:   make(map[string]time.Time),
+		outstanding: make(map[uuid.UUID][]time.Time),
+	}
+}
+
+// AllowEmail reports whether an email may be sent to an address now, starting
+// the cooldown if so
+func (t *EmailThrottle) AllowEmail(ctx context.Context, email string) (bool, error) {
+	key := "email_cooldown:" + hashEmail(email)
+
+	if t.redis != nil {
+		ok, err := t.redis.SetNX(ctx, key, 1, t.config.Cooldown).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to check email cooldown: %w", err)
+		}
+		return ok, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	if until, ok := t.cooldowns[key]; ok && now.Before(until) {
+		return false, nil
+	}
+	t.cooldowns[key] = now.Add(t.config.Cooldown)
+
+	// Drop expired entries so the map doesn't grow without bound
+	for k, until := range t.cooldowns {
+		if now.After(until) {
+			delete(t.cooldowns, k)
+		}
+	}
+
+	return true, nil
+}
+
+// ReserveToken records a newly issued token for a user, reporting false if the
+// user already has the maximum number outstanding
+func (t *EmailThrottle) ReserveToken(ctx context.Context, userID uuid.UUID) (bool, error) {
+	key := "outstanding_tokens:" + userID.String()
+
+	if t.redis != nil {
+		count, err := t.redis.Incr(ctx, key).Result()
+		if err != nil {
+			return false, fmt.Errorf("failed to reserve token: %w", err)
+		}
+		// Each new token pushes out the expiry so the counter lives as long as the newest token
+		if err := t.redis.Expire(ctx, key, t.config.TokenTTL).Err(); err != nil {
+			return false, fmt.Errorf("failed to reserve token: %w", err)
+		}
+		if count > int64(t.config.MaxOutstandingTokens) {
+			t.redis.Decr(ctx, key)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	var live []time.Time
+	for _, expires := range t.outstanding[userID] {
+		if now.Before(expires) {
+			live = append(live, expires)
+		}
+	}
+	if len(live) >= t.config.MaxOutstandingTokens {
+		t.outstanding[userID] = live
+		return false, nil
+	}
+	t.outstanding[userID] = append(live, now.Add(t.config.TokenTTL))
+
+	return true, nil
+}
+
+// ReleaseToken frees one of a user's outstanding token slots once a token is used
+func (t *EmailThrottle) ReleaseToken(ctx context.Context, userID uuid.UUID) error {
+	key := "outstanding_tokens:" + userID.String()
+
+	if t.redis != nil {
+		count, err := t.redis.Decr(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to release token: %w", err)
+		}
+		if count <= 0 {
+			t.redis.Del(ctx, key)
+		}
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if tokens := t.outstanding[userID]; len(tokens) > 0 {
+		t.outstanding[userID] = tokens[1:]
+	}
+	if len(t.outstanding[userID]) == 0 {
+		delete(t.outstanding, userID)
+	}
+
+	return nil
+}
+
+// RequestEmail runs the shared flow behind "send me an email" endpoints such
+// as verification and password reset. The cooldown is checked before looking
+// up the account, send is only called for existing users with a free token
+// slot, and the call always takes at least MinResponseTime. Apart from
+// ErrEmailCooldown, which doesn't depend on the account, the result is the
+// same whether or not the address is registered.
+func (s *Service) RequestEmail(ctx context.Context, email string, send func(ctx context.Context, user *models.User) error) error {
+	start := time.Now()
+	defer func() {
+		if wait := s.emailThrottle.config.MinResponseTime - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+	}()
+
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	allowed, err := s.emailThrottle.AllowEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrEmailCooldown
+	}
+
+	user, err := s.store.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	reserved, err := s.emailThrottle.ReserveToken(ctx, user.ID)
+	if err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to reserve email token")
+		return nil
+	}
+	if !reserved {
+		log.Ctx(ctx).Warn().Str("user_id", user.ID.String()).Msg("Too many outstanding email tokens")
+		return nil
+	}
+
+	if err := send(ctx, user); err != nil {
+		log.Ctx(ctx).Error().Err(err).Str("user_id", user.ID.String()).Msg("Failed to send email")
+		if err := s.emailThrottle.ReleaseToken(ctx, user.ID); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Msg("Failed to release email token")
+		}
+	}
+
+	return nil
+}
+
+// hashEmail keys limits by a digest so addresses aren't stored in Redis
+func hashEmail(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
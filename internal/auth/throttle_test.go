@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestAllowEmailCooldown(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewEmailThrottle(EmailThrottleConfig{Cooldown: 50 * time.Millisecond}, nil)
+
+	if ok, _ := throttle.AllowEmail(ctx, "ada@example.com"); !ok {
+		t.Fatal("first email was blocked")
+	}
+	if ok, _ := throttle.AllowEmail(ctx, " ADA@example.com "); ok {
+		t.Error("repeat with different case and spacing got past the cooldown")
+	}
+	if ok, _ := throttle.AllowEmail(ctx, "grace@example.com"); !ok {
+		t.Error("cooldown for one address blocked another")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := throttle.AllowEmail(ctx, "ada@example.com"); !ok {
+		t.Error("email still blocked after the cooldown passed")
+	}
+}
+
+func TestReserveTokenCap(t *testing.T) {
+	ctx := context.Background()
+	throttle := NewEmailThrottle(EmailThrottleConfig{MaxOutstandingTokens: 2, TokenTTL: 50 * time.Millisecond}, nil)
+	user, other := uuid.New(), uuid.New()
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := throttle.ReserveToken(ctx, user); !ok {
+			t.Fatalf("reservation %d was refused", i+1)
+		}
+	}
+	if ok, _ := throttle.ReserveToken(ctx, user); ok {
+		t.Error("reserved a token past the cap")
+	}
+	if ok, _ := throttle.ReserveToken(ctx, other); !ok {
+		t.Error("one user's cap blocked another user")
+	}
+
+	if err := throttle.ReleaseToken(ctx, user); err != nil {
+		t.Fatalf("ReleaseToken: %v", err)
+	}
+	if ok, _ := throttle.ReserveToken(ctx, user); !ok {
+		t.Error("released slot couldn't be reserved")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if ok, _ := throttle.ReserveToken(ctx, user); !ok {
+		t.Error("expired tokens still count against the cap")
+	}
+}
+
+func TestRequestEmailDoesNotRevealAccounts(t *testing.T) {
+	const minResponse = 40 * time.Millisecond
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{EmailThrottle: EmailThrottleConfig{MinResponseTime: minResponse}})
+	register(t, s, "ada")
+
+	var sent []string
+	send := func(ctx context.Context, user *models.User) error {
+		sent = append(sent, user.Email)
+		return nil
+	}
+
+	for _, email := range []string{"ada@example.com", "nobody@example.com"} {
+		start := time.Now()
+		err := s.RequestEmail(ctx, email, send)
+		elapsed := time.Since(start)
+
+		if err != nil {
+			t.Errorf("%s: err = %v, want nil", email, err)
+		}
+		if elapsed < minResponse {
+			t.Errorf("%s: returned after %v, want at least %v", email, elapsed, minResponse)
+		}
+
+		// A rapid repeat is refused the same way whether or not the account exists
+		if err := s.RequestEmail(ctx, email, send); !errors.Is(err, ErrEmailCooldown) {
+			t.Errorf("%s: repeat err = %v, want ErrEmailCooldown", email, err)
+		}
+	}
+
+	if len(sent) != 1 || sent[0] != "ada@example.com" {
+		t.Errorf("sent = %v, want one email to ada", sent)
+	}
+}
+
+func TestRequestEmailCapsOutstandingTokens(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{EmailThrottle: EmailThrottleConfig{
+		Cooldown:             time.Millisecond,
+		MaxOutstandingTokens: 2,
+		MinResponseTime:      time.Millisecond,
+	}})
+	register(t, s, "ada")
+
+	sent := 0
+	send := func(ctx context.Context, user *models.User) error {
+		sent++
+		return nil
+	}
+	for i := 0; i < 4; i++ {
+		time.Sleep(2 * time.Millisecond)
+		if err := s.RequestEmail(ctx, "ada@example.com", send); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if sent != 2 {
+		t.Errorf("sent %d emails, want the cap of 2", sent)
+	}
+}
+
+func TestRequestEmailReleasesTokenWhenSendFails(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t, Config{EmailThrottle: EmailThrottleConfig{
+		Cooldown:             time.Millisecond,
+		MaxOutstandingTokens: 1,
+		MinResponseTime:      time.Millisecond,
+	}})
+	register(t, s, "ada")
+
+	failing := func(ctx context.Context, user *models.User) error { return errors.New("smtp down") }
+	if err := s.RequestEmail(ctx, "ada@example.com", failing); err != nil {
+		t.Fatalf("RequestEmail: %v", err)
+	}
+
+	time.Sleep(2 * time.Millisecond)
+	sent := false
+	if err := s.RequestEmail(ctx, "ada@example.com", func(ctx context.Context, user *models.User) error {
+		sent = true
+		return nil
+	}); err != nil {
+		t.Fatalf("RequestEmail: %v", err)
+	}
+	if !sent {
+		t.Error("failed send kept its token slot, blocking the retry")
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// signToken signs claims for userID that expire at expires
+func signToken(t *testing.T, secret string, method jwt.SigningMethod, userID uuid.UUID, expires time.Time) string {
+	t.Helper()
+
+	claims := &Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expires),
+			IssuedAt:  jwt.NewNumericDate(expires.Add(-time.Hour)),
+		},
+	}
+	key := interface{}([]byte(secret))
+	if method == jwt.SigningMethodNone {
+		key = jwt.UnsafeAllowNoneSignatureType
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+func TestParseTokenErrors(t *testing.T) {
+	s, _ := newTestService(t, Config{JWT: JWTConfig{Secret: "server-secret"}})
+	userID := uuid.New()
+	later, earlier := time.Now().Add(time.Hour), time.Now().Add(-time.Minute)
+
+	valid := signToken(t, "server-secret", jwt.SigningMethodHS256, userID, later)
+	parts := strings.Split(valid, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		// warned is set for tokens worth a security warning
+		warned bool
+	}{
+		{"valid", valid, nil, false},
+		{"expired", signToken(t, "server-secret", jwt.SigningMethodHS256, userID, earlier), ErrExpiredToken, false},
+		{"not a JWT", "not-a-token", ErrInvalidToken, true},
+		{"bad base64 segment", parts[0] + ".%%%." + parts[2], ErrInvalidToken, true},
+		{"wrong signature", signToken(t, "attacker-secret", jwt.SigningMethodHS256, userID, later), ErrInvalidToken, true},
+		// Expiry doesn't excuse a bad signature
+		{"expired with wrong signature", signToken(t, "attacker-secret", jwt.SigningMethodHS256, userID, earlier), ErrInvalidToken, true},
+		{"unsigned", signToken(t, "", jwt.SigningMethodNone, userID, later), ErrInvalidToken, true},
+		{"tampered payload", parts[0] + "." + strings.TrimSuffix(parts[1], parts[1][len(parts[1])-2:]) + "AA." + parts[2], ErrInvalidToken, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			previous := log.Logger
+			log.Logger = zerolog.New(&buf)
+			defer func() { log.Logger = previous }()
+
+			claims, err := s.ParseToken(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseToken = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && claims.UserID != userID {
+				t.Errorf("UserID = %s, want %s", claims.UserID, userID)
+			}
+			if warned := strings.Contains(buf.String(), `"level":"warn"`); warned != tt.warned {
+				t.Errorf("warning logged = %v, want %v (log %q)", warned, tt.warned, buf.String())
+			}
+
+			// ValidateToken reports the same error
+			if _, _, err := s.ValidateToken(tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("ValidateToken = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	id := uuid.MustParse("6f1c2a9e-4b53-4c1e-9a0d-1b2c3d4e5f60")
+
+	for _, style := range []string{StyleInitials, StyleIdenticon} {
+		first := NewGenerator(Config{Style: style}).Generate(id, "Ada Lovelace")
+		second := NewGenerator(Config{Style: style}).Generate(id, "Ada Lovelace")
+		if !bytes.Equal(first, second) {
+			t.Errorf("%s: separate generators rendered different avatars for the same user", style)
+		}
+
+		other := NewGenerator(Config{Style: style}).Generate(uuid.New(), "Ada Lovelace")
+		if bytes.Equal(first, other) {
+			t.Errorf("%s: different users rendered the same avatar", style)
+		}
+	}
+}
+
+func TestGenerateCachesImages(t *testing.T) {
+	g := NewGenerator(Config{})
+	id := uuid.New()
+
+	first := g.Generate(id, "Ada")
+	second := g.Generate(id, "Ada")
+	if &first[0] != &second[0] {
+		t.Error("second Generate call rendered the avatar again instead of using the cache")
+	}
+	if len(g.cache) != 1 {
+		t.Errorf("cache holds %d entries, want 1", len(g.cache))
+	}
+
+	// Renaming changes the initials, so it can't be served from the old entry
+	if renamed := g.Generate(id, "Grace"); !strings.Contains(string(renamed), ">G</text>") {
+		t.Errorf("renamed avatar = %s, want initial G", renamed)
+	}
+}
+
+func TestInitials(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ada lovelace", "AL"},
+		{"Grace Brewster Hopper", "GB"},
+		{"linus", "L"},
+		{"  _bob  (smith) ", "BS"},
+		{"", "?"},
+		{"!!!", "?"},
+		{"élodie", "É"},
+	}
+
+	for _, tt := range tests {
+		if got := initials(tt.name); got != tt.want {
+			t.Errorf("initials(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewGeneratorDefaults(t *testing.T) {
+	g := NewGenerator(Config{Style: "unknown"})
+	if g.config.Style != StyleInitials {
+		t.Errorf("style = %q, want %q", g.config.Style, StyleInitials)
+	}
+	if g.config.Size != 128 {
+		t.Errorf("size = %d, want 128", g.config.Size)
+	}
+
+	img := string(NewGenerator(Config{Size: 64}).Generate(uuid.New(), "Ada"))
+	if !strings.Contains(img, `width="64" height="64"`) {
+		t.Errorf("avatar = %s, want a 64px image", img)
+	}
+}
+
+func TestIdenticonIsSymmetric(t *testing.T) {
+	g := NewGenerator(Config{Style: StyleIdenticon})
+
+	for i := 0; i < 20; i++ {
+		img := string(g.Generate(uuid.New(), "ignored"))
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 2; col++ {
+				left := strings.Contains(img, cell(col, row))
+				right := strings.Contains(img, cell(4-col, row))
+				if left != right {
+					t.Fatalf("cell (%d,%d) and its mirror differ in %s", col, row, img)
+				}
+			}
+		}
+	}
+}
+
+func cell(x, y int) string {
+	return fmt.Sprintf(`<rect x="%d" y="%d"`, x, y)
+}
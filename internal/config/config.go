@@ -1,14 +1,22 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/rs/zerolog/log"
+	"gopkg.in/yaml.v3"
 
+	"github.com/llamasearch/llamachat/internal/ai"
 	"github.com/llamasearch/llamachat/internal/middleware"
 )
 
@@ -20,6 +28,57 @@ type Server struct {
 	CORS      CORS                         `json:"cors"`
 	RateLimit middleware.RateLimiterConfig `json:"rate_limit"`
 	WebDir    string                       `json:"web_dir"`
+
+	// Concurrency caps the number of requests handled at once
+	Concurrency Concurrency `json:"concurrency"`
+	// SecurityHeaders configures the security headers added to responses
+	SecurityHeaders SecurityHeaders `json:"security_headers"`
+	// TLS serves HTTPS instead of plain HTTP
+	TLS TLS `json:"tls"`
+	// Compression configures gzip and deflate compression of responses
+	Compression Compression `json:"compression"`
+}
+
+// Compression holds response compression configuration
+type Compression struct {
+	Disabled bool `json:"disabled"`
+	// MinSizeBytes is the smallest body worth compressing
+	MinSizeBytes int `json:"min_size_bytes"`
+	// Level is 1 (fastest) to 9 (smallest), or 0 for the default
+	Level int `json:"level"`
+}
+
+// TLS holds HTTPS configuration
+type TLS struct {
+	Enabled  bool   `json:"enabled"`
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// AutocertDomains gets certificates from Let's Encrypt for these
+	// domains instead of using CertFile and KeyFile
+	AutocertDomains  []string `json:"autocert_domains"`
+	AutocertCacheDir string   `json:"autocert_cache_dir"`
+	AutocertEmail    string   `json:"autocert_email"`
+	// RedirectAddr runs an HTTP listener redirecting to HTTPS, e.g. ":80"
+	RedirectAddr string `json:"redirect_addr"`
+}
+
+// SecurityHeaders holds response security header settings. Empty values use
+// secure defaults.
+type SecurityHeaders struct {
+	// Disabled turns the headers off, for local development
+	Disabled              bool   `json:"disabled"`
+	FrameOptions          string `json:"frame_options"`
+	ContentSecurityPolicy string `json:"content_security_policy"`
+	ReferrerPolicy        string `json:"referrer_policy"`
+	// HSTSMaxAgeSeconds is sent in Strict-Transport-Security over TLS
+	HSTSMaxAgeSeconds     int  `json:"hsts_max_age_seconds"`
+	HSTSIncludeSubdomains bool `json:"hsts_include_subdomains"`
+}
+
+// Concurrency holds request concurrency limits
+type Concurrency struct {
+	MaxInFlight       int `json:"max_in_flight"`
+	RetryAfterSeconds int `json:"retry_after_seconds"`
 }
 
 // CORS holds CORS configuration
@@ -27,6 +86,8 @@ type CORS struct {
 	AllowedOrigins []string `json:"allowed_origins"`
 	AllowedMethods []string `json:"allowed_methods"`
 	AllowedHeaders []string `json:"allowed_headers"`
+	MaxAgeSeconds  int      `json:"max_age_seconds"`
+	DisabledPaths  []string `json:"disabled_paths"`
 }
 
 // Database holds database configuration
@@ -40,6 +101,13 @@ type Database struct {
 	SSLMode            string `json:"ssl_mode"`
 	MaxConnections     int    `json:"max_connections"`
 	ConnectionLifetime int    `json:"connection_lifetime"`
+	// Cache is an in-memory cache for user and chat lookups. Entries changed
+	// on another instance can be served stale for up to TTLSeconds.
+	Cache struct {
+		Enabled    bool `json:"enabled"`
+		TTLSeconds int  `json:"ttl_seconds"`
+		MaxEntries int  `json:"max_entries"`
+	} `json:"cache"`
 }
 
 // Redis holds Redis configuration
@@ -57,6 +125,8 @@ type Auth struct {
 		Secret          string `json:"secret"`
 		ExpirationHours int    `json:"expiration_hours"`
 		Issuer          string `json:"issuer"`
+		// RefreshExpirationHours is the lifetime of refresh tokens
+		RefreshExpirationHours int `json:"refresh_expiration_hours"`
 	} `json:"jwt"`
 	Password struct {
 		MinLength        int  `json:"min_length"`
@@ -65,6 +135,46 @@ type Auth struct {
 		RequireNumber    bool `json:"require_number"`
 		RequireSpecial   bool `json:"require_special"`
 	} `json:"password"`
+	Hashing struct {
+		Algorithm  string `json:"algorithm"`
+		BcryptCost int    `json:"bcrypt_cost"`
+		Argon2     struct {
+			MemoryKB    uint32 `json:"memory_kb"`
+			Iterations  uint32 `json:"iterations"`
+			Parallelism uint8  `json:"parallelism"`
+			SaltLength  uint32 `json:"salt_length"`
+			KeyLength   uint32 `json:"key_length"`
+		} `json:"argon2"`
+	} `json:"hashing"`
+	EmailThrottle struct {
+		CooldownSeconds      int `json:"cooldown_seconds"`
+		MaxOutstandingTokens int `json:"max_outstanding_tokens"`
+		TokenTTLMinutes      int `json:"token_ttl_minutes"`
+		MinResponseMillis    int `json:"min_response_ms"`
+	} `json:"email_throttle"`
+	Lockout struct {
+		// Threshold is how many failed logins in a row lock an account
+		Threshold int `json:"threshold"`
+		// DurationSeconds is the first lockout's length; it doubles with
+		// each further failure
+		DurationSeconds    int `json:"duration_seconds"`
+		MaxDurationSeconds int `json:"max_duration_seconds"`
+	} `json:"lockout"`
+	Mail struct {
+		// Driver is "smtp", "log" (development only: records recipient and
+		// subject) or empty to send no email, which disables password reset
+		Driver       string `json:"driver"`
+		From         string `json:"from"`
+		SMTPHost     string `json:"smtp_host"`
+		SMTPPort     int    `json:"smtp_port"`
+		SMTPUsername string `json:"smtp_username"`
+		SMTPPassword string `json:"smtp_password"`
+	} `json:"mail"`
+	// PasswordResetURL is the page password reset emails link to
+	PasswordResetURL string `json:"password_reset_url"`
+	// AllowedRedirectURLs lists the URLs emails may link to. Entries ending
+	// in "*" match by prefix.
+	AllowedRedirectURLs []string `json:"allowed_redirect_urls"`
 }
 
 // Chat holds chat configuration
@@ -76,6 +186,39 @@ type Chat struct {
 		Enabled   bool   `json:"enabled"`
 		Algorithm string `json:"algorithm"`
 	} `json:"message_encryption"`
+	// MessagesPerMinute limits the messages each WebSocket connection can send
+	MessagesPerMinute int `json:"messages_per_minute"`
+	// TypingPerMinute limits each WebSocket connection's typing events
+	TypingPerMinute int `json:"typing_per_minute"`
+	// MaxReplyDepth limits reply nesting. Zero means no limit.
+	MaxReplyDepth int `json:"max_reply_depth"`
+	// ReplyDepthMode is "reject" or "flatten" for replies beyond MaxReplyDepth
+	ReplyDepthMode string `json:"reply_depth_mode"`
+	// DeletedUserAttribution is "deleted", "username" or "anonymous"
+	DeletedUserAttribution string `json:"deleted_user_attribution"`
+	// DeletedMessages is "placeholder" (deleted messages stay in listings as
+	// "[message deleted]") or "hide" (they are left out)
+	DeletedMessages string `json:"deleted_messages"`
+	// AllowedReactions lists the emoji users may react with. Empty uses the
+	// built-in default set.
+	AllowedReactions []string `json:"allowed_reactions"`
+	// MaxFavorites caps how many chats a user can mark as favorites
+	MaxFavorites int `json:"max_favorites"`
+	// MaxForwardTargets caps how many chats a message can be forwarded to at once
+	MaxForwardTargets int `json:"max_forward_targets"`
+	// ForwardsPerMinute limits forward requests per client
+	ForwardsPerMinute int `json:"forwards_per_minute"`
+	// MaxSeenBy caps how many readers a message's seen-by list returns
+	MaxSeenBy int `json:"max_seen_by"`
+	// BulkMode is "strict" (all or nothing) or "best_effort" for bulk
+	// operations that don't choose with the mode query parameter
+	BulkMode string `json:"bulk_mode"`
+	// DeleteWhenEmpty deletes a chat, with its messages and attachments,
+	// once its last member is removed
+	DeleteWhenEmpty bool `json:"delete_when_empty"`
+	// EditGraceSeconds is how long after sending a message can be edited
+	// without showing as edited
+	EditGraceSeconds int `json:"edit_grace_seconds"`
 }
 
 // AI holds AI configuration
@@ -86,6 +229,258 @@ type AI struct {
 	Temperature  float64 `json:"temperature"`
 	MaxTokens    int     `json:"max_tokens"`
 	SystemPrompt string  `json:"system_prompt"`
+	// AllowedModels restricts which models may be used. Empty means no restriction.
+	AllowedModels []string `json:"allowed_models"`
+	// ContextMessages is the number of prior messages sent to the model
+	ContextMessages int `json:"context_messages"`
+	// ThreadContext builds context from the reply thread when replying to a message
+	ThreadContext bool `json:"thread_context"`
+	// MaxConcurrentPerUser caps how many replies to one user's messages the
+	// assistant generates at once
+	MaxConcurrentPerUser int `json:"max_concurrent_per_user"`
+	// MaxRetries is how many times a rate-limited or failed request is
+	// retried. Zero disables retries; left out, the AI service's default is
+	// used.
+	MaxRetries int `json:"max_retries"`
+	// MaxTokensLimit is the largest accepted MaxTokens. Defaults to 4096.
+	MaxTokensLimit int `json:"max_tokens_limit"`
+	// ClampOutOfRange clamps an out-of-range Temperature or MaxTokens into
+	// range instead of failing to load the configuration
+	ClampOutOfRange bool `json:"clamp_out_of_range"`
+	// MinTriggerLength is the fewest characters a message addressed to the
+	// assistant needs to be answered. Zero disables the check.
+	MinTriggerLength int `json:"min_trigger_length"`
+	// ShortTriggerReply is posted in response to shorter messages. Empty
+	// ignores them.
+	ShortTriggerReply string `json:"short_trigger_reply"`
+	// Triggers address a message to the assistant: mentions such as
+	// "@assistant" anywhere in it, or commands such as "/ai" at its start.
+	// Defaults to "@ai".
+	Triggers []string `json:"triggers"`
+	// ContextWindowTokens is the model's context size, which the history
+	// sent with a message is trimmed to fit. Zero uses a size known for the
+	// model.
+	ContextWindowTokens int `json:"context_window_tokens"`
+	// SummarizeDroppedContext replaces trimmed history with a note quoting
+	// the start of the dropped messages
+	SummarizeDroppedContext bool `json:"summarize_dropped_context"`
+	// Cache serves identical requests from a cache for TTLSeconds, in Redis
+	// when it is configured and in memory otherwise. Requests hotter than
+	// MaxTemperature are never cached.
+	Cache struct {
+		Enabled        bool    `json:"enabled"`
+		TTLSeconds     int     `json:"ttl_seconds"`
+		MaxEntries     int     `json:"max_entries"`
+		MaxTemperature float64 `json:"max_temperature"`
+	} `json:"cache"`
+	// Moderation screens messages with an OpenAI-compatible moderation
+	// endpoint before they are sent to the model, answering flagged ones
+	// with a policy notice. URL defaults to OpenAI's.
+	Moderation struct {
+		Enabled bool   `json:"enabled"`
+		URL     string `json:"url"`
+		Model   string `json:"model"`
+	} `json:"moderation"`
+	// SemanticSearch embeds messages as they are written so they can be
+	// searched by meaning. On PostgreSQL it needs the pgvector extension and
+	// schema_embeddings.sql.
+	SemanticSearch bool `json:"semantic_search"`
+	// Embeddings is the OpenAI-compatible endpoint and model used for
+	// semantic search. URL defaults to OpenAI's.
+	Embeddings struct {
+		URL       string `json:"url"`
+		Model     string `json:"model"`
+		BatchSize int    `json:"batch_size"`
+	} `json:"embeddings"`
+	// MonthlyTokenQuota caps the tokens each user's assistant requests may
+	// use per calendar month. Zero means no limit.
+	MonthlyTokenQuota int `json:"monthly_token_quota"`
+	// PostProcess rewrites responses before they are posted
+	PostProcess struct {
+		// StripPatterns are regular expressions removed from responses
+		StripPatterns []string `json:"strip_patterns"`
+		// MaxLength caps responses in characters. Zero disables the cap.
+		MaxLength int `json:"max_length"`
+		// Disclaimer is appended to every response
+		Disclaimer string `json:"disclaimer"`
+	} `json:"post_process"`
+	// Webhook describes the custom gateway used by the "webhook" provider
+	Webhook struct {
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		// RequestTemplate is a Go template rendering the JSON request body
+		RequestTemplate string `json:"request_template"`
+		// ResponsePath is the dotted path to the completion in the response
+		ResponsePath string `json:"response_path"`
+	} `json:"webhook"`
+}
+
+// generatedJWTSecretBytes is the size of the secret generated in debug mode
+const generatedJWTSecretBytes = 32
+
+// EnsureJWTSecret checks that tokens have a signing secret. Without one,
+// release mode is an error, while debug mode gets a random secret that lasts
+// until the process exits. It must run after Server.Debug is final.
+func (c *Config) EnsureJWTSecret() error {
+	if strings.TrimSpace(c.Auth.JWT.Secret) != "" {
+		return nil
+	}
+
+	if !c.Server.Debug {
+		return errors.New("auth.jwt.secret is empty; set it or JWT_SECRET before starting in release mode")
+	}
+
+	secret := make([]byte, generatedJWTSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate JWT secret: %w", err)
+	}
+	c.Auth.JWT.Secret = hex.EncodeToString(secret)
+
+	log.Warn().Msg("auth.jwt.secret is empty; signing tokens with a random secret. Tokens will not survive a restart.")
+	return nil
+}
+
+// AI sampling limits
+const (
+	MinTemperature        = 0.0
+	MaxTemperature        = 2.0
+	DefaultMaxTokensLimit = 4096
+)
+
+// validate checks the AI sampling settings, clamping them into range when
+// ClampOutOfRange is set. A zero MaxTokens leaves the limit to the provider.
+func (a *AI) validate() error {
+	if a.MaxTokensLimit <= 0 {
+		a.MaxTokensLimit = DefaultMaxTokensLimit
+	}
+
+	if a.Temperature < MinTemperature || a.Temperature > MaxTemperature {
+		if !a.ClampOutOfRange {
+			return fmt.Errorf("ai.temperature must be between %g and %g, got %g", MinTemperature, MaxTemperature, a.Temperature)
+		}
+		clamped := math.Min(math.Max(a.Temperature, MinTemperature), MaxTemperature)
+		log.Warn().Float64("temperature", a.Temperature).Float64("clamped", clamped).Msg("AI temperature out of range")
+		a.Temperature = clamped
+	}
+
+	if ai.IsWebhookProvider(a.Provider) {
+		err := ai.ValidateWebhook(ai.WebhookConfig{
+			URL:             a.Webhook.URL,
+			Headers:         a.Webhook.Headers,
+			RequestTemplate: a.Webhook.RequestTemplate,
+			ResponsePath:    a.Webhook.ResponsePath,
+		})
+		if err != nil {
+			return fmt.Errorf("ai.webhook: %w", err)
+		}
+	}
+
+	if err := ai.ValidateTriggers(a.Triggers); err != nil {
+		return fmt.Errorf("ai.triggers: %w", err)
+	}
+
+	if a.MonthlyTokenQuota < 0 {
+		return fmt.Errorf("ai.monthly_token_quota must not be negative, got %d", a.MonthlyTokenQuota)
+	}
+
+	for _, pattern := range a.PostProcess.StripPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("ai.post_process.strip_patterns: invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	if a.MaxTokens < 0 || a.MaxTokens > a.MaxTokensLimit {
+		if !a.ClampOutOfRange {
+			return fmt.Errorf("ai.max_tokens must be between 0 (provider default) and %d, got %d", a.MaxTokensLimit, a.MaxTokens)
+		}
+		clamped := a.MaxTokensLimit
+		if a.MaxTokens < 0 {
+			clamped = 0
+		}
+		log.Warn().Int("max_tokens", a.MaxTokens).Int("clamped", clamped).Msg("AI max tokens out of range")
+		a.MaxTokens = clamped
+	}
+
+	if a.ContextWindowTokens < 0 || a.ContextWindowTokens > 0 && a.ContextWindowTokens <= a.MaxTokens {
+		return fmt.Errorf("ai.context_window_tokens must be 0 (model default) or more than max_tokens, got %d", a.ContextWindowTokens)
+	}
+
+	return nil
+}
+
+// Avatar holds default avatar configuration
+type Avatar struct {
+	Style string `json:"style"`
+	Size  int    `json:"size"`
+}
+
+// Profile holds user profile field limits, counted in characters. The
+// username and display name limits can't exceed their column sizes.
+type Profile struct {
+	MaxUsernameLength    int `json:"max_username_length"`
+	MaxDisplayNameLength int `json:"max_display_name_length"`
+	MaxBioLength         int `json:"max_bio_length"`
+}
+
+// Attachments holds attachment configuration
+type Attachments struct {
+	// ThumbnailCacheMB bounds the memory used by cached thumbnails
+	ThumbnailCacheMB int `json:"thumbnail_cache_mb"`
+	// Dir is the directory attachment files are stored in
+	Dir string `json:"dir"`
+	// MaxFileMB is the largest file that can be uploaded
+	MaxFileMB int `json:"max_file_mb"`
+	// AllowedTypes lists the MIME types that can be uploaded, e.g. "image/*"
+	AllowedTypes []string `json:"allowed_types"`
+}
+
+// Storage selects where attachment files are kept
+type Storage struct {
+	// Backend is "local" (the default, using Attachments.Dir) or "s3"
+	Backend string `json:"backend"`
+	// Endpoint is the S3-compatible service URL; empty means AWS
+	Endpoint        string `json:"endpoint"`
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	// UsePathStyle addresses the bucket in the URL path, as MinIO expects
+	UsePathStyle bool `json:"use_path_style"`
+	// PresignExpirySeconds is how long direct download URLs stay valid
+	PresignExpirySeconds int `json:"presign_expiry_seconds"`
+}
+
+// WebSocket holds WebSocket configuration
+type WebSocket struct {
+	// PresenceIdleSeconds is how long a connection can go without a presence
+	// heartbeat before the user is shown as away
+	PresenceIdleSeconds int `json:"presence_idle_seconds"`
+	// FanoutWorkers is the number of goroutines delivering chat events,
+	// including those sent over WebSocket connections
+	FanoutWorkers int `json:"fanout_workers"`
+	// FanoutQueueSize is the number of pending events buffered per worker
+	FanoutQueueSize int `json:"fanout_queue_size"`
+	// FanoutEnqueueTimeoutMillis is how long to wait for space in a full queue
+	FanoutEnqueueTimeoutMillis int `json:"fanout_enqueue_timeout_ms"`
+	// WriteBatchSize is the most queued events a connection flushes at once
+	WriteBatchSize int `json:"write_batch_size"`
+	// ReadReceiptWindowMillis is how long read receipts are collected before
+	// being broadcast together
+	ReadReceiptWindowMillis int `json:"read_receipt_window_ms"`
+	// MissedBufferSize is how many undelivered events are kept per user
+	// until they reconnect
+	MissedBufferSize int `json:"missed_buffer_size"`
+	// MissedBufferTTLSeconds is how long undelivered events are kept
+	MissedBufferTTLSeconds int `json:"missed_buffer_ttl_seconds"`
+	// MaxReplayMessages is the most missed messages replayed on reconnect
+	// before the client is told to reload instead
+	MaxReplayMessages int `json:"max_replay_messages"`
+	// PingIntervalSeconds is how often connections are pinged; clients are
+	// told it in the hello event
+	PingIntervalSeconds int `json:"ping_interval_seconds"`
+	// TypingTTLSeconds is how long a typing indicator lasts without another
+	// typing event
+	TypingTTLSeconds int `json:"typing_ttl_seconds"`
 }
 
 // Logging holds logging configuration
@@ -95,6 +490,16 @@ type Logging struct {
 	Output string `json:"output"`
 }
 
+// Metrics holds Prometheus metrics configuration
+type Metrics struct {
+	Enabled bool `json:"enabled"`
+	// Path is where metrics are served. Defaults to /metrics.
+	Path string `json:"path"`
+	// ListenAddr serves metrics on a separate admin port, e.g. ":9090".
+	// Empty serves them on the main port.
+	ListenAddr string `json:"listen_addr"`
+}
+
 // Plugins holds plugin configuration
 type Plugins struct {
 	Enabled        bool     `json:"enabled"`
@@ -104,14 +509,20 @@ type Plugins struct {
 
 // Config holds all application configuration
 type Config struct {
-	Server   Server   `json:"server"`
-	Database Database `json:"database"`
-	Redis    Redis    `json:"redis"`
-	Auth     Auth     `json:"auth"`
-	Chat     Chat     `json:"chat"`
-	AI       AI       `json:"ai"`
-	Logging  Logging  `json:"logging"`
-	Plugins  Plugins  `json:"plugins"`
+	Server      Server      `json:"server"`
+	Database    Database    `json:"database"`
+	Redis       Redis       `json:"redis"`
+	Auth        Auth        `json:"auth"`
+	Chat        Chat        `json:"chat"`
+	AI          AI          `json:"ai"`
+	Avatar      Avatar      `json:"avatar"`
+	Profile     Profile     `json:"profile"`
+	Attachments Attachments `json:"attachments"`
+	Storage     Storage     `json:"storage"`
+	WebSocket   WebSocket   `json:"websocket"`
+	Logging     Logging     `json:"logging"`
+	Metrics     Metrics     `json:"metrics"`
+	Plugins     Plugins     `json:"plugins"`
 }
 
 // LoadConfig loads configuration from file and overrides with environment variables
@@ -123,98 +534,243 @@ func LoadConfig(path string) (*Config, error) {
 	}
 
 	// Read config file
-	file, err := os.Open(absPath)
+	data, err := os.ReadFile(absPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open config file: %w", err)
 	}
-	defer file.Close()
 
-	// Parse config file
-	var config Config
-	if err := json.NewDecoder(file).Decode(&config); err != nil {
+	// YAML files are converted to JSON so both formats share the json tags
+	if ext := strings.ToLower(filepath.Ext(absPath)); ext == ".yaml" || ext == ".yml" {
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+
+	// Parse config file. MaxRetries starts unset, so an explicit zero can
+	// turn retries off.
+	config := Config{AI: AI{MaxRetries: -1}}
+	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
 	// Override with environment variables
 	overrideWithEnv(&config)
 
+	if err := config.AI.validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
 	log.Info().Msg("Configuration loaded successfully")
 	return &config, nil
 }
 
-// overrideWithEnv overrides configuration with environment variables
-func overrideWithEnv(config *Config) {
-	// Server config
-	if port := os.Getenv("SERVER_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			config.Server.Port = p
+// yamlToJSON re-encodes a YAML document as JSON
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	doc, err := jsonCompatible(doc)
+	if err != nil {
+		return nil, fmt.Errorf("yaml: %w", err)
+	}
+
+	return json.Marshal(doc)
+}
+
+// jsonCompatible rejects YAML mappings whose keys aren't strings, which JSON
+// can't represent, and walks into nested mappings and sequences
+func jsonCompatible(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			converted, err := jsonCompatible(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			v[key] = converted
+		}
+	case map[interface{}]interface{}:
+		for key := range v {
+			return nil, fmt.Errorf("mapping key %v is not a string", key)
+		}
+	case []interface{}:
+		for i, item := range v {
+			converted, err := jsonCompatible(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			v[i] = converted
 		}
 	}
+	return value, nil
+}
+
+// overrideWithEnv overrides configuration with environment variables. Each
+// variable is named after its section, such as CHAT_MAX_MESSAGE_LENGTH for
+// chat.max_message_length. Unset, empty and unparseable values leave the
+// configured value alone.
+func overrideWithEnv(config *Config) {
+	// Server config
+	envInt("SERVER_PORT", &config.Server.Port)
 	if debug := os.Getenv("SERVER_DEBUG"); debug != "" {
 		config.Server.Debug = debug == "true"
 	}
-	if webDir := os.Getenv("SERVER_WEB_DIR"); webDir != "" {
-		config.Server.WebDir = webDir
-	}
+	envString("SERVER_WEB_DIR", &config.Server.WebDir)
 
 	// Database config
-	if host := os.Getenv("DB_HOST"); host != "" {
-		config.Database.Host = host
-	}
-	if port := os.Getenv("DB_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			config.Database.Port = p
-		}
-	}
-	if user := os.Getenv("DB_USER"); user != "" {
-		config.Database.User = user
-	}
-	if password := os.Getenv("DB_PASSWORD"); password != "" {
-		config.Database.Password = password
-	}
-	if name := os.Getenv("DB_NAME"); name != "" {
-		config.Database.Name = name
-	}
+	envString("DB_HOST", &config.Database.Host)
+	envInt("DB_PORT", &config.Database.Port)
+	envString("DB_USER", &config.Database.User)
+	envString("DB_PASSWORD", &config.Database.Password)
+	envString("DB_NAME", &config.Database.Name)
 
 	// Redis config
-	if host := os.Getenv("REDIS_HOST"); host != "" {
-		config.Redis.Host = host
-	}
-	if port := os.Getenv("REDIS_PORT"); port != "" {
-		if p, err := strconv.Atoi(port); err == nil {
-			config.Redis.Port = p
-		}
-	}
-	if password := os.Getenv("REDIS_PASSWORD"); password != "" {
-		config.Redis.Password = password
-	}
+	envString("REDIS_HOST", &config.Redis.Host)
+	envInt("REDIS_PORT", &config.Redis.Port)
+	envString("REDIS_PASSWORD", &config.Redis.Password)
 
 	// Auth config
-	if secret := os.Getenv("JWT_SECRET"); secret != "" {
-		config.Auth.JWT.Secret = secret
+	envString("JWT_SECRET", &config.Auth.JWT.Secret)
+	envInt("JWT_EXPIRATION_HOURS", &config.Auth.JWT.ExpirationHours)
+	envInt("PASSWORD_MIN_LENGTH", &config.Auth.Password.MinLength)
+	envBool("PASSWORD_REQUIRE_UPPERCASE", &config.Auth.Password.RequireUppercase)
+	envBool("PASSWORD_REQUIRE_LOWERCASE", &config.Auth.Password.RequireLowercase)
+	envBool("PASSWORD_REQUIRE_NUMBER", &config.Auth.Password.RequireNumber)
+	envBool("PASSWORD_REQUIRE_SPECIAL", &config.Auth.Password.RequireSpecial)
+	envString("MAIL_DRIVER", &config.Auth.Mail.Driver)
+	envString("MAIL_FROM", &config.Auth.Mail.From)
+	envString("SMTP_HOST", &config.Auth.Mail.SMTPHost)
+	envInt("SMTP_PORT", &config.Auth.Mail.SMTPPort)
+	envString("SMTP_USERNAME", &config.Auth.Mail.SMTPUsername)
+	envString("SMTP_PASSWORD", &config.Auth.Mail.SMTPPassword)
+
+	// Chat config
+	envInt("CHAT_MAX_MESSAGE_LENGTH", &config.Chat.MaxMessageLength)
+	envInt("CHAT_HISTORY_LIMIT", &config.Chat.HistoryLimit)
+	envList("CHAT_BANNED_WORDS", &config.Chat.BannedWords)
+	envBool("CHAT_MESSAGE_ENCRYPTION_ENABLED", &config.Chat.MessageEncryption.Enabled)
+	envInt("CHAT_MESSAGES_PER_MINUTE", &config.Chat.MessagesPerMinute)
+	envInt("CHAT_TYPING_PER_MINUTE", &config.Chat.TypingPerMinute)
+	envInt("CHAT_MAX_REPLY_DEPTH", &config.Chat.MaxReplyDepth)
+	envString("CHAT_REPLY_DEPTH_MODE", &config.Chat.ReplyDepthMode)
+	envString("CHAT_DELETED_USER_ATTRIBUTION", &config.Chat.DeletedUserAttribution)
+	envString("CHAT_DELETED_MESSAGES", &config.Chat.DeletedMessages)
+	envList("CHAT_ALLOWED_REACTIONS", &config.Chat.AllowedReactions)
+	envInt("CHAT_MAX_FAVORITES", &config.Chat.MaxFavorites)
+	envInt("CHAT_MAX_FORWARD_TARGETS", &config.Chat.MaxForwardTargets)
+	envInt("CHAT_FORWARDS_PER_MINUTE", &config.Chat.ForwardsPerMinute)
+	envInt("CHAT_MAX_SEEN_BY", &config.Chat.MaxSeenBy)
+	envString("CHAT_BULK_MODE", &config.Chat.BulkMode)
+	envBool("CHAT_DELETE_WHEN_EMPTY", &config.Chat.DeleteWhenEmpty)
+	envInt("CHAT_EDIT_GRACE_SECONDS", &config.Chat.EditGraceSeconds)
+
+	// AI config
+	envString("AI_PROVIDER", &config.AI.Provider)
+	envString("AI_API_KEY", &config.AI.APIKey)
+	envString("AI_MODEL", &config.AI.Model)
+	envFloat("AI_TEMPERATURE", &config.AI.Temperature)
+	envInt("AI_MAX_TOKENS", &config.AI.MaxTokens)
+	envString("AI_SYSTEM_PROMPT", &config.AI.SystemPrompt)
+	envList("AI_ALLOWED_MODELS", &config.AI.AllowedModels)
+	envInt("AI_CONTEXT_MESSAGES", &config.AI.ContextMessages)
+	envBool("AI_THREAD_CONTEXT", &config.AI.ThreadContext)
+	envInt("AI_MAX_CONCURRENT_PER_USER", &config.AI.MaxConcurrentPerUser)
+	envInt("AI_MAX_RETRIES", &config.AI.MaxRetries)
+	envInt("AI_MAX_TOKENS_LIMIT", &config.AI.MaxTokensLimit)
+	envBool("AI_CLAMP_OUT_OF_RANGE", &config.AI.ClampOutOfRange)
+	envInt("AI_MIN_TRIGGER_LENGTH", &config.AI.MinTriggerLength)
+	envString("AI_SHORT_TRIGGER_REPLY", &config.AI.ShortTriggerReply)
+	envList("AI_TRIGGERS", &config.AI.Triggers)
+	envInt("AI_CONTEXT_WINDOW_TOKENS", &config.AI.ContextWindowTokens)
+	envBool("AI_SUMMARIZE_DROPPED_CONTEXT", &config.AI.SummarizeDroppedContext)
+	envInt("AI_MONTHLY_TOKEN_QUOTA", &config.AI.MonthlyTokenQuota)
+	envBool("AI_MODERATION_ENABLED", &config.AI.Moderation.Enabled)
+	envString("AI_MODERATION_URL", &config.AI.Moderation.URL)
+	envBool("AI_SEMANTIC_SEARCH", &config.AI.SemanticSearch)
+	envString("AI_EMBEDDINGS_URL", &config.AI.Embeddings.URL)
+	envString("AI_EMBEDDINGS_MODEL", &config.AI.Embeddings.Model)
+	envString("AI_WEBHOOK_URL", &config.AI.Webhook.URL)
+
+	// Storage config
+	envString("STORAGE_BACKEND", &config.Storage.Backend)
+	envString("STORAGE_ENDPOINT", &config.Storage.Endpoint)
+	envString("STORAGE_BUCKET", &config.Storage.Bucket)
+	envString("STORAGE_ACCESS_KEY_ID", &config.Storage.AccessKeyID)
+	envString("STORAGE_SECRET_ACCESS_KEY", &config.Storage.SecretAccessKey)
+
+	// Logging config
+	envString("LOG_LEVEL", &config.Logging.Level)
+
+	// Plugins config
+	envBool("PLUGINS_ENABLED", &config.Plugins.Enabled)
+	envString("PLUGINS_DIRECTORY", &config.Plugins.Directory)
+	envList("PLUGINS_ALLOWED", &config.Plugins.AllowedPlugins)
+}
+
+// envString sets target from an environment variable if it is non-empty
+func envString(name string, target *string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
 	}
-	if expiration := os.Getenv("JWT_EXPIRATION_HOURS"); expiration != "" {
-		if e, err := strconv.Atoi(expiration); err == nil {
-			config.Auth.JWT.ExpirationHours = e
-		}
+}
+
+// envInt sets target from an environment variable holding an integer
+func envInt(name string, target *int) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Warn().Str("variable", name).Str("value", value).Msg("Ignoring environment variable that is not an integer")
+		return
 	}
+	*target = n
+}
 
-	// AI config
-	if provider := os.Getenv("AI_PROVIDER"); provider != "" {
-		config.AI.Provider = provider
+// envFloat sets target from an environment variable holding a number
+func envFloat(name string, target *float64) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
 	}
-	if apiKey := os.Getenv("AI_API_KEY"); apiKey != "" {
-		config.AI.APIKey = apiKey
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		log.Warn().Str("variable", name).Str("value", value).Msg("Ignoring environment variable that is not a number")
+		return
 	}
-	if model := os.Getenv("AI_MODEL"); model != "" {
-		config.AI.Model = model
+	*target = f
+}
+
+// envBool sets target from an environment variable holding a boolean, as
+// accepted by strconv.ParseBool
+func envBool(name string, target *bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
 	}
-	if systemPrompt := os.Getenv("AI_SYSTEM_PROMPT"); systemPrompt != "" {
-		config.AI.SystemPrompt = systemPrompt
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Warn().Str("variable", name).Str("value", value).Msg("Ignoring environment variable that is not a boolean")
+		return
 	}
+	*target = b
+}
 
-	// Logging config
-	if level := os.Getenv("LOG_LEVEL"); level != "" {
-		config.Logging.Level = level
+// envList sets target from a comma-separated environment variable, trimming
+// spaces and dropping empty items
+func envList(name string, target *[]string) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	*target = items
 }
@@ -0,0 +1,182 @@
+package config
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// writeConfig writes a JSON config file with the given "ai" section to a
+// temporary directory and returns its path
+func writeConfig(t *testing.T, ai string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"ai": `+ai+`}`), 0o600); err != nil {
+		t.Fatalf("writing config: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfigValidatesAISampling(t *testing.T) {
+	tests := []struct {
+		name    string
+		ai      string
+		wantErr string
+		// wantTemperature and wantMaxTokens are checked when loading succeeds
+		wantTemperature float64
+		wantMaxTokens   int
+	}{
+		{"in range", `{"temperature": 0.7, "max_tokens": 1000}`, "", 0.7, 1000},
+		{"bounds are inclusive", `{"temperature": 2, "max_tokens": 4096}`, "", 2, 4096},
+		{"zero leaves max tokens to the provider", `{"temperature": 0, "max_tokens": 0}`, "", 0, 0},
+		{"temperature too high", `{"temperature": 5}`, "ai.temperature", 0, 0},
+		{"temperature negative", `{"temperature": -0.1}`, "ai.temperature", 0, 0},
+		{"max tokens negative", `{"max_tokens": -1}`, "ai.max_tokens", 0, 0},
+		{"max tokens over default limit", `{"max_tokens": 4097}`, "ai.max_tokens", 0, 0},
+		{"max tokens within raised limit", `{"max_tokens": 8000, "max_tokens_limit": 8192}`, "", 0, 8000},
+		{"max tokens over configured limit", `{"max_tokens": 600, "max_tokens_limit": 512}`, "ai.max_tokens", 0, 0},
+		{"clamp temperature", `{"temperature": 5, "clamp_out_of_range": true}`, "", 2, 0},
+		{"clamp negative temperature", `{"temperature": -1, "clamp_out_of_range": true}`, "", 0, 0},
+		{"clamp max tokens to limit", `{"max_tokens": 100000, "max_tokens_limit": 2048, "clamp_out_of_range": true}`, "", 0, 2048},
+		{"clamp negative max tokens", `{"max_tokens": -5, "clamp_out_of_range": true}`, "", 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfig(writeConfig(t, tt.ai))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig error = %v, want one about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if config.AI.Temperature != tt.wantTemperature || config.AI.MaxTokens != tt.wantMaxTokens {
+				t.Errorf("temperature, max tokens = %g, %d; want %g, %d",
+					config.AI.Temperature, config.AI.MaxTokens, tt.wantTemperature, tt.wantMaxTokens)
+			}
+		})
+	}
+}
+
+func TestLoadConfigValidatesEnvironmentOverrides(t *testing.T) {
+	path := writeConfig(t, `{"temperature": 0.7}`)
+	t.Setenv("AI_TEMPERATURE", "3")
+
+	if _, err := LoadConfig(path); err == nil || !strings.Contains(err.Error(), "ai.temperature") {
+		t.Errorf("LoadConfig error = %v, want the overridden temperature rejected", err)
+	}
+}
+
+func TestLoadConfigMaxRetries(t *testing.T) {
+	for _, tt := range []struct {
+		ai   string
+		want int
+	}{
+		{`{}`, -1},
+		{`{"max_retries": 0}`, 0},
+		{`{"max_retries": 5}`, 5},
+	} {
+		config, err := LoadConfig(writeConfig(t, tt.ai))
+		if err != nil {
+			t.Fatalf("LoadConfig(%s): %v", tt.ai, err)
+		}
+		if config.AI.MaxRetries != tt.want {
+			t.Errorf("LoadConfig(%s): max retries = %d, want %d", tt.ai, config.AI.MaxRetries, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigValidatesAIWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		ai      string
+		wantErr bool
+	}{
+		{"valid", `{"provider": "webhook", "webhook": {"url": "https://llm.internal/generate", "response_path": "output.text"}}`, false},
+		{"custom alias", `{"provider": "custom", "webhook": {"url": "https://llm.internal/generate"}}`, true},
+		{"bad template", `{"provider": "webhook", "webhook": {"url": "https://llm.internal/generate", "response_path": "text", "request_template": "{{.Nope}}"}}`, true},
+		// Webhook settings are only checked when the provider uses them
+		{"other provider", `{"provider": "openai", "webhook": {"url": "not a url"}}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadConfig(writeConfig(t, tt.ai))
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "ai.webhook") {
+					t.Errorf("LoadConfig error = %v, want one about ai.webhook", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("LoadConfig: %v", err)
+			}
+		})
+	}
+}
+
+func TestEnsureJWTSecret(t *testing.T) {
+	var buf bytes.Buffer
+	previous := log.Logger
+	log.Logger = zerolog.New(&buf)
+	t.Cleanup(func() { log.Logger = previous })
+
+	t.Run("release mode refuses an empty secret", func(t *testing.T) {
+		for _, secret := range []string{"", "   "} {
+			c := &Config{}
+			c.Auth.JWT.Secret = secret
+			if err := c.EnsureJWTSecret(); err == nil || !strings.Contains(err.Error(), "auth.jwt.secret") {
+				t.Errorf("secret %q: error = %v, want one about auth.jwt.secret", secret, err)
+			}
+		}
+	})
+
+	t.Run("debug mode generates a random secret", func(t *testing.T) {
+		buf.Reset()
+		var secrets []string
+		for i := 0; i < 2; i++ {
+			c := &Config{}
+			c.Server.Debug = true
+			if err := c.EnsureJWTSecret(); err != nil {
+				t.Fatalf("EnsureJWTSecret: %v", err)
+			}
+			raw, err := hex.DecodeString(c.Auth.JWT.Secret)
+			if err != nil || len(raw) != 32 {
+				t.Fatalf("secret %q is not 32 hex-encoded bytes", c.Auth.JWT.Secret)
+			}
+			secrets = append(secrets, c.Auth.JWT.Secret)
+		}
+		if secrets[0] == secrets[1] {
+			t.Error("two generated secrets were the same")
+		}
+		if !strings.Contains(buf.String(), "will not survive a restart") {
+			t.Errorf("no warning logged, got %q", buf.String())
+		}
+		// The secret itself is never logged
+		if strings.Contains(buf.String(), secrets[0]) {
+			t.Error("generated secret was logged")
+		}
+	})
+
+	t.Run("configured secrets are kept", func(t *testing.T) {
+		for _, debug := range []bool{false, true} {
+			c := &Config{}
+			c.Server.Debug = debug
+			c.Auth.JWT.Secret = "configured"
+			if err := c.EnsureJWTSecret(); err != nil || c.Auth.JWT.Secret != "configured" {
+				t.Errorf("debug %v: secret %q, error %v; want it kept", debug, c.Auth.JWT.Secret, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestOverrideWithEnv(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		get   func(*Config) interface{}
+		want  interface{}
+	}{
+		{"SERVER_PORT", "9090", func(c *Config) interface{} { return c.Server.Port }, 9090},
+		{"SERVER_DEBUG", "true", func(c *Config) interface{} { return c.Server.Debug }, true},
+		{"DB_PORT", "6543", func(c *Config) interface{} { return c.Database.Port }, 6543},
+		{"REDIS_HOST", "cache", func(c *Config) interface{} { return c.Redis.Host }, "cache"},
+		{"JWT_EXPIRATION_HOURS", "48", func(c *Config) interface{} { return c.Auth.JWT.ExpirationHours }, 48},
+		{"PASSWORD_MIN_LENGTH", "14", func(c *Config) interface{} { return c.Auth.Password.MinLength }, 14},
+		{"PASSWORD_REQUIRE_UPPERCASE", "true", func(c *Config) interface{} { return c.Auth.Password.RequireUppercase }, true},
+		{"PASSWORD_REQUIRE_LOWERCASE", "1", func(c *Config) interface{} { return c.Auth.Password.RequireLowercase }, true},
+		{"PASSWORD_REQUIRE_NUMBER", "T", func(c *Config) interface{} { return c.Auth.Password.RequireNumber }, true},
+		{"PASSWORD_REQUIRE_SPECIAL", "TRUE", func(c *Config) interface{} { return c.Auth.Password.RequireSpecial }, true},
+		{"CHAT_MAX_MESSAGE_LENGTH", "2000", func(c *Config) interface{} { return c.Chat.MaxMessageLength }, 2000},
+		{"CHAT_HISTORY_LIMIT", "75", func(c *Config) interface{} { return c.Chat.HistoryLimit }, 75},
+		{"CHAT_BANNED_WORDS", " spam, , scam ", func(c *Config) interface{} { return c.Chat.BannedWords }, []string{"spam", "scam"}},
+		{"CHAT_MESSAGE_ENCRYPTION_ENABLED", "true", func(c *Config) interface{} { return c.Chat.MessageEncryption.Enabled }, true},
+		{"CHAT_MESSAGES_PER_MINUTE", "30", func(c *Config) interface{} { return c.Chat.MessagesPerMinute }, 30},
+		{"CHAT_TYPING_PER_MINUTE", "120", func(c *Config) interface{} { return c.Chat.TypingPerMinute }, 120},
+		{"CHAT_MAX_REPLY_DEPTH", "4", func(c *Config) interface{} { return c.Chat.MaxReplyDepth }, 4},
+		{"CHAT_REPLY_DEPTH_MODE", "flatten", func(c *Config) interface{} { return c.Chat.ReplyDepthMode }, "flatten"},
+		{"CHAT_DELETED_USER_ATTRIBUTION", "anonymous", func(c *Config) interface{} { return c.Chat.DeletedUserAttribution }, "anonymous"},
+		{"CHAT_ALLOWED_REACTIONS", "👍,🎉", func(c *Config) interface{} { return c.Chat.AllowedReactions }, []string{"👍", "🎉"}},
+		{"CHAT_MAX_FAVORITES", "10", func(c *Config) interface{} { return c.Chat.MaxFavorites }, 10},
+		{"CHAT_MAX_FORWARD_TARGETS", "3", func(c *Config) interface{} { return c.Chat.MaxForwardTargets }, 3},
+		{"CHAT_FORWARDS_PER_MINUTE", "6", func(c *Config) interface{} { return c.Chat.ForwardsPerMinute }, 6},
+		{"CHAT_MAX_SEEN_BY", "50", func(c *Config) interface{} { return c.Chat.MaxSeenBy }, 50},
+		{"CHAT_BULK_MODE", "best_effort", func(c *Config) interface{} { return c.Chat.BulkMode }, "best_effort"},
+		{"CHAT_DELETE_WHEN_EMPTY", "true", func(c *Config) interface{} { return c.Chat.DeleteWhenEmpty }, true},
+		{"CHAT_EDIT_GRACE_SECONDS", "30", func(c *Config) interface{} { return c.Chat.EditGraceSeconds }, 30},
+		{"AI_TEMPERATURE", "0.25", func(c *Config) interface{} { return c.AI.Temperature }, 0.25},
+		{"AI_MAX_TOKENS", "512", func(c *Config) interface{} { return c.AI.MaxTokens }, 512},
+		{"AI_ALLOWED_MODELS", "gpt-4o,gpt-4o-mini", func(c *Config) interface{} { return c.AI.AllowedModels }, []string{"gpt-4o", "gpt-4o-mini"}},
+		{"AI_CONTEXT_MESSAGES", "12", func(c *Config) interface{} { return c.AI.ContextMessages }, 12},
+		{"AI_THREAD_CONTEXT", "true", func(c *Config) interface{} { return c.AI.ThreadContext }, true},
+		{"AI_MAX_CONCURRENT_PER_USER", "2", func(c *Config) interface{} { return c.AI.MaxConcurrentPerUser }, 2},
+		{"AI_MAX_RETRIES", "5", func(c *Config) interface{} { return c.AI.MaxRetries }, 5},
+		{"AI_MAX_TOKENS_LIMIT", "8192", func(c *Config) interface{} { return c.AI.MaxTokensLimit }, 8192},
+		{"AI_CLAMP_OUT_OF_RANGE", "true", func(c *Config) interface{} { return c.AI.ClampOutOfRange }, true},
+		{"AI_MIN_TRIGGER_LENGTH", "3", func(c *Config) interface{} { return c.AI.MinTriggerLength }, 3},
+		{"AI_SHORT_TRIGGER_REPLY", "Say more?", func(c *Config) interface{} { return c.AI.ShortTriggerReply }, "Say more?"},
+		{"AI_WEBHOOK_URL", "https://llm.internal", func(c *Config) interface{} { return c.AI.Webhook.URL }, "https://llm.internal"},
+		{"LOG_LEVEL", "debug", func(c *Config) interface{} { return c.Logging.Level }, "debug"},
+		{"PLUGINS_ENABLED", "true", func(c *Config) interface{} { return c.Plugins.Enabled }, true},
+		{"PLUGINS_DIRECTORY", "/opt/plugins", func(c *Config) interface{} { return c.Plugins.Directory }, "/opt/plugins"},
+		{"PLUGINS_ALLOWED", "echo", func(c *Config) interface{} { return c.Plugins.AllowedPlugins }, []string{"echo"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+
+			var config Config
+			overrideWithEnv(&config)
+
+			if got := tt.get(&config); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("%s=%q gave %v, want %v", tt.name, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOverrideWithEnvKeepsValueOnBadInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"CHAT_MAX_MESSAGE_LENGTH", "lots"},
+		{"CHAT_MAX_MESSAGE_LENGTH", "12.5"},
+		{"AI_TEMPERATURE", "warm"},
+		{"AI_TEMPERATURE", "NaN"},
+		{"AI_TEMPERATURE", "+Inf"},
+		{"PASSWORD_REQUIRE_NUMBER", "yes"},
+		{"PLUGINS_ENABLED", "on"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"="+tt.value, func(t *testing.T) {
+			t.Setenv(tt.name, tt.value)
+
+			var config Config
+			config.Chat.MaxMessageLength = 4000
+			config.AI.Temperature = 0.7
+			config.Auth.Password.RequireNumber = true
+			config.Plugins.Enabled = true
+			overrideWithEnv(&config)
+
+			if config.Chat.MaxMessageLength != 4000 || config.AI.Temperature != 0.7 ||
+				!config.Auth.Password.RequireNumber || !config.Plugins.Enabled {
+				t.Errorf("config changed: max length %d, temperature %g, require number %v, plugins %v",
+					config.Chat.MaxMessageLength, config.AI.Temperature, config.Auth.Password.RequireNumber, config.Plugins.Enabled)
+			}
+		})
+	}
+}
+
+func TestOverrideWithEnvIgnoresUnsetAndEmpty(t *testing.T) {
+	t.Setenv("CHAT_BANNED_WORDS", "")
+	t.Setenv("AI_MODEL", "")
+
+	var config Config
+	config.Chat.BannedWords = []string{"spam"}
+	config.AI.Model = "gpt-4o"
+	config.AI.MaxTokens = 1000
+	overrideWithEnv(&config)
+
+	if strings.Join(config.Chat.BannedWords, ",") != "spam" || config.AI.Model != "gpt-4o" || config.AI.MaxTokens != 1000 {
+		t.Errorf("config changed: banned words %v, model %q, max tokens %d",
+			config.Chat.BannedWords, config.AI.Model, config.AI.MaxTokens)
+	}
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestCountMessagesByUserInChat(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, bob, carol := addUser(t, s, "ada"), addUser(t, s, "bob"), addUser(t, s, "carol")
+	chat := addChat(t, s, ada, bob, carol)
+	other := addChat(t, s, bob)
+
+	for i := 0; i < 3; i++ {
+		addMessage(t, s, chat, ada, "hi")
+	}
+	addMessage(t, s, chat, bob, "hello")
+	deleted := addMessage(t, s, chat, bob, "oops")
+	if err := s.DeleteMessage(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	// Messages elsewhere and the assistant's own messages don't count
+	addMessage(t, s, other, bob, "elsewhere")
+	if err := s.CreateMessage(ctx, &models.Message{ID: uuid.New(), ChatID: chat.ID, Content: "beep", IsAIGenerated: true}); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+
+	counts, err := s.CountMessagesByUserInChat(ctx, chat.ID)
+	if err != nil {
+		t.Fatalf("CountMessagesByUserInChat: %v", err)
+	}
+	want := map[uuid.UUID]int{ada.ID: 3, bob.ID: 1}
+	if len(counts) != len(want) {
+		t.Errorf("counts = %v, want %v (carol, with no messages, left out)", counts, want)
+	}
+	for id, n := range want {
+		if counts[id] != n {
+			t.Errorf("count for %s = %d, want %d", id, counts[id], n)
+		}
+	}
+
+	empty, err := s.CountMessagesByUserInChat(ctx, uuid.New())
+	if err != nil {
+		t.Fatalf("CountMessagesByUserInChat(unknown chat): %v", err)
+	}
+	if len(empty) != 0 {
+		t.Errorf("unknown chat counts = %v, want none", empty)
+	}
+}
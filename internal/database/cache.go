@@ -0,0 +1,286 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/lru"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// Cache defaults
+const (
+	defaultCacheTTL     = 5 * time.Second
+	defaultCacheEntries = 10000
+)
+
+// CacheConfig holds read cache configuration
+type CacheConfig struct {
+	// Enabled turns on the read cache
+	Enabled bool
+	// TTL is how long an entry is served before it is read again
+	TTL time.Duration
+	// MaxEntries bounds the number of cached users and of cached chats
+	MaxEntries int
+}
+
+// CachedStore is a Store that serves GetUserByID and GetChatByID from a
+// short-lived in-memory cache. Entries are dropped when the store updates or
+// deletes them; changes made by other instances, or racing with a read that
+// is about to fill the cache, show up once the TTL passes.
+type CachedStore struct {
+	Store
+	users *lru.Cache[uuid.UUID, *models.User]
+	chats *lru.Cache[uuid.UUID, *models.Chat]
+}
+
+// NewCachedStore wraps store with a read cache. With the cache disabled,
+// store is returned unchanged.
+func NewCachedStore(store Store, config CacheConfig) Store {
+	if !config.Enabled {
+		return store
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaultCacheTTL
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultCacheEntries
+	}
+
+	return &CachedStore{
+		Store: store,
+		users: lru.New[uuid.UUID](lru.Config[*models.User]{TTL: config.TTL, MaxEntries: config.MaxEntries}),
+		chats: lru.New[uuid.UUID](lru.Config[*models.Chat]{TTL: config.TTL, MaxEntries: config.MaxEntries}),
+	}
+}
+
+// Begin starts a transaction whose writes invalidate the cache when it
+// commits. Reads inside the transaction bypass the cache.
+func (s *CachedStore) Begin() (Transaction, error) {
+	tx, err := s.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &cachedTransaction{Transaction: tx, cache: s}, nil
+}
+
+// GetUserByID retrieves a user by ID, from the cache when possible
+func (s *CachedStore) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	if user, ok := s.users.Get(id); ok {
+		return copyUser(user), nil
+	}
+
+	user, err := s.Store.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.users.Add(id, copyUser(user))
+	return user, nil
+}
+
+// UpdateUser updates an existing user and drops it from the cache
+func (s *CachedStore) UpdateUser(ctx context.Context, user *models.User) error {
+	defer s.users.Remove(user.ID)
+	return s.Store.UpdateUser(ctx, user)
+}
+
+// DeleteUser deletes a user and drops it from the cache
+func (s *CachedStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	defer s.users.Remove(id)
+	return s.Store.DeleteUser(ctx, id)
+}
+
+// IncrementFailedLogins counts a failed login and drops the user from the
+// cache
+func (s *CachedStore) IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error) {
+	defer s.users.Remove(id)
+	return s.Store.IncrementFailedLogins(ctx, id)
+}
+
+// LockUser locks a user out and drops it from the cache
+func (s *CachedStore) LockUser(ctx context.Context, id uuid.UUID, until time.Time) error {
+	defer s.users.Remove(id)
+	return s.Store.LockUser(ctx, id, until)
+}
+
+// ResetFailedLogins clears a user's failed logins and drops it from the cache
+func (s *CachedStore) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	defer s.users.Remove(id)
+	return s.Store.ResetFailedLogins(ctx, id)
+}
+
+// GetChatByID retrieves a chat by ID, from the cache when possible
+func (s *CachedStore) GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	if chat, ok := s.chats.Get(id); ok {
+		return copyChat(chat), nil
+	}
+
+	chat, err := s.Store.GetChatByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.chats.Add(id, copyChat(chat))
+	return chat, nil
+}
+
+// UpdateChat updates an existing chat and drops it from the cache
+func (s *CachedStore) UpdateChat(ctx context.Context, chat *models.Chat) error {
+	defer s.chats.Remove(chat.ID)
+	return s.Store.UpdateChat(ctx, chat)
+}
+
+// DeleteChat deletes a chat and drops it from the cache
+func (s *CachedStore) DeleteChat(ctx context.Context, id uuid.UUID) error {
+	defer s.chats.Remove(id)
+	return s.Store.DeleteChat(ctx, id)
+}
+
+// CreateMessage creates a message and drops its chat from the cache, since
+// the cached chat carries its last message
+func (s *CachedStore) CreateMessage(ctx context.Context, message *models.Message) error {
+	defer s.chats.Remove(message.ChatID)
+	return s.Store.CreateMessage(ctx, message)
+}
+
+// UpdateMessage updates a message and drops its chat from the cache
+func (s *CachedStore) UpdateMessage(ctx context.Context, message *models.Message) error {
+	defer s.chats.Remove(message.ChatID)
+	return s.Store.UpdateMessage(ctx, message)
+}
+
+// DeleteMessage deletes a message and drops its chat from the cache
+func (s *CachedStore) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	if message, err := s.Store.GetMessageByID(ctx, id); err == nil {
+		defer s.chats.Remove(message.ChatID)
+	}
+	return s.Store.DeleteMessage(ctx, id)
+}
+
+// AddUserToChat adds a member and drops the chat from the cache, since the
+// cached chat carries its member list
+func (s *CachedStore) AddUserToChat(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	defer s.chats.Remove(chatID)
+	return s.Store.AddUserToChat(ctx, chatID, userID, isAdmin)
+}
+
+// RemoveUserFromChat removes a member and drops the chat from the cache
+func (s *CachedStore) RemoveUserFromChat(ctx context.Context, chatID, userID uuid.UUID) error {
+	defer s.chats.Remove(chatID)
+	return s.Store.RemoveUserFromChat(ctx, chatID, userID)
+}
+
+// SetChatMemberAdmin changes a member's admin flag and drops the chat from
+// the cache
+func (s *CachedStore) SetChatMemberAdmin(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	defer s.chats.Remove(chatID)
+	return s.Store.SetChatMemberAdmin(ctx, chatID, userID, isAdmin)
+}
+
+// cachedTransaction records the entries its writes touch and drops them from
+// the cache once it commits, so no other reader can cache the old values
+// after the change is visible
+type cachedTransaction struct {
+	Transaction
+	cache *CachedStore
+	users []uuid.UUID
+	chats []uuid.UUID
+}
+
+func (t *cachedTransaction) UpdateUser(ctx context.Context, user *models.User) error {
+	t.users = append(t.users, user.ID)
+	return t.Transaction.UpdateUser(ctx, user)
+}
+
+func (t *cachedTransaction) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	t.users = append(t.users, id)
+	return t.Transaction.DeleteUser(ctx, id)
+}
+
+func (t *cachedTransaction) IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error) {
+	t.users = append(t.users, id)
+	return t.Transaction.IncrementFailedLogins(ctx, id)
+}
+
+func (t *cachedTransaction) LockUser(ctx context.Context, id uuid.UUID, until time.Time) error {
+	t.users = append(t.users, id)
+	return t.Transaction.LockUser(ctx, id, until)
+}
+
+func (t *cachedTransaction) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	t.users = append(t.users, id)
+	return t.Transaction.ResetFailedLogins(ctx, id)
+}
+
+func (t *cachedTransaction) UpdateChat(ctx context.Context, chat *models.Chat) error {
+	t.chats = append(t.chats, chat.ID)
+	return t.Transaction.UpdateChat(ctx, chat)
+}
+
+func (t *cachedTransaction) DeleteChat(ctx context.Context, id uuid.UUID) error {
+	t.chats = append(t.chats, id)
+	return t.Transaction.DeleteChat(ctx, id)
+}
+
+func (t *cachedTransaction) CreateMessage(ctx context.Context, message *models.Message) error {
+	t.chats = append(t.chats, message.ChatID)
+	return t.Transaction.CreateMessage(ctx, message)
+}
+
+func (t *cachedTransaction) UpdateMessage(ctx context.Context, message *models.Message) error {
+	t.chats = append(t.chats, message.ChatID)
+	return t.Transaction.UpdateMessage(ctx, message)
+}
+
+func (t *cachedTransaction) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	if message, err := t.Transaction.GetMessageByID(ctx, id); err == nil {
+		t.chats = append(t.chats, message.ChatID)
+	}
+	return t.Transaction.DeleteMessage(ctx, id)
+}
+
+func (t *cachedTransaction) AddUserToChat(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	t.chats = append(t.chats, chatID)
+	return t.Transaction.AddUserToChat(ctx, chatID, userID, isAdmin)
+}
+
+func (t *cachedTransaction) RemoveUserFromChat(ctx context.Context, chatID, userID uuid.UUID) error {
+	t.chats = append(t.chats, chatID)
+	return t.Transaction.RemoveUserFromChat(ctx, chatID, userID)
+}
+
+func (t *cachedTransaction) SetChatMemberAdmin(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	t.chats = append(t.chats, chatID)
+	return t.Transaction.SetChatMemberAdmin(ctx, chatID, userID, isAdmin)
+}
+
+// Commit commits the transaction and invalidates the entries it wrote
+func (t *cachedTransaction) Commit() error {
+	err := t.Transaction.Commit()
+	for _, id := range t.users {
+		t.cache.users.Remove(id)
+	}
+	for _, id := range t.chats {
+		t.cache.chats.Remove(id)
+	}
+	return err
+}
+
+// copyUser returns a copy of a user, so callers can't modify cached entries
+func copyUser(user *models.User) *models.User {
+	c := *user
+	return &c
+}
+
+// copyChat returns a copy of a chat and its member list, so callers can't
+// modify cached entries
+func copyChat(chat *models.Chat) *models.Chat {
+	c := *chat
+	if chat.Members != nil {
+		c.Members = append([]*models.ChatMember(nil), chat.Members...)
+	}
+	return &c
+}
@@ -0,0 +1,274 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// countingReads counts the lookups that reach the underlying store
+type countingReads struct {
+	Store
+	userReads atomic.Int32
+	chatReads atomic.Int32
+}
+
+func (s *countingReads) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	s.userReads.Add(1)
+	return s.Store.GetUserByID(ctx, id)
+}
+
+func (s *countingReads) GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	s.chatReads.Add(1)
+	return s.Store.GetChatByID(ctx, id)
+}
+
+// newCachedTestStore wraps a test store in a read cache, returning both the
+// cache and the counter beneath it
+func newCachedTestStore(t *testing.T, config CacheConfig) (Store, *countingReads) {
+	t.Helper()
+
+	config.Enabled = true
+	counter := &countingReads{Store: newTestStore(t)}
+	return NewCachedStore(counter, config), counter
+}
+
+func TestCachedStoreServesRepeatReads(t *testing.T) {
+	s, db := newCachedTestStore(t, CacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	chat := addChat(t, s, ada)
+
+	for i := 0; i < 3; i++ {
+		user, err := s.GetUserByID(ctx, ada.ID)
+		if err != nil || user.Username != "ada" {
+			t.Fatalf("GetUserByID = %+v, %v", user, err)
+		}
+		// Callers get copies they can't corrupt the cache through
+		user.Username = "mallory"
+
+		if _, err := s.GetChatByID(ctx, chat.ID); err != nil {
+			t.Fatalf("GetChatByID: %v", err)
+		}
+	}
+
+	if n := db.userReads.Load(); n != 1 {
+		t.Errorf("user read from the database %d times, want 1", n)
+	}
+	if n := db.chatReads.Load(); n != 1 {
+		t.Errorf("chat read from the database %d times, want 1", n)
+	}
+	if user, _ := s.GetUserByID(ctx, ada.ID); user.Username != "ada" {
+		t.Errorf("cached username = %q, want it unaffected by callers", user.Username)
+	}
+
+	// Misses aren't cached
+	missing := uuid.New()
+	s.GetUserByID(ctx, missing)
+	s.GetUserByID(ctx, missing)
+	if n := db.userReads.Load(); n != 3 {
+		t.Errorf("user reads after two misses = %d, want 3", n)
+	}
+}
+
+func TestCachedStoreInvalidatesOnWrite(t *testing.T) {
+	s, db := newCachedTestStore(t, CacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	chat := addChat(t, s, ada)
+
+	user, _ := s.GetUserByID(ctx, ada.ID)
+	user.DisplayName = "Ada Lovelace"
+	if err := s.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if got, _ := s.GetUserByID(ctx, ada.ID); got.DisplayName != "Ada Lovelace" {
+		t.Errorf("display name after update = %q, want the new one", got.DisplayName)
+	}
+
+	got, _ := s.GetChatByID(ctx, chat.ID)
+	got.Name = "renamed"
+	if err := s.UpdateChat(ctx, got); err != nil {
+		t.Fatalf("UpdateChat: %v", err)
+	}
+	if got, _ := s.GetChatByID(ctx, chat.ID); got.Name != "renamed" {
+		t.Errorf("chat name after update = %q, want the new one", got.Name)
+	}
+
+	// A new message changes the chat's last message, so it is read again
+	reads := db.chatReads.Load()
+	addMessage(t, s, chat, ada, "hello")
+	s.GetChatByID(ctx, chat.ID)
+	if db.chatReads.Load() != reads+1 {
+		t.Error("chat served from the cache after a new message")
+	}
+
+	if err := s.DeleteChat(ctx, chat.ID); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if _, err := s.GetChatByID(ctx, chat.ID); err == nil {
+		t.Error("deleted chat still served from the cache")
+	}
+}
+
+func TestCachedStoreInvalidatesOnMemberAndMessageChanges(t *testing.T) {
+	s, _ := newCachedTestStore(t, CacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	bob := addUser(t, s, "bob")
+	chat := addChat(t, s, ada)
+	first := addMessage(t, s, chat, ada, "first")
+	second := addMessage(t, s, chat, ada, "second")
+
+	members := func() int {
+		got, err := s.GetChatByID(ctx, chat.ID)
+		if err != nil {
+			t.Fatalf("GetChatByID: %v", err)
+		}
+		return len(got.Members)
+	}
+	lastMessage := func() string {
+		got, err := s.GetChatByID(ctx, chat.ID)
+		if err != nil {
+			t.Fatalf("GetChatByID: %v", err)
+		}
+		return got.LastMessage.Content
+	}
+
+	members()
+	if err := s.AddUserToChat(ctx, chat.ID, bob.ID, false); err != nil {
+		t.Fatalf("AddUserToChat: %v", err)
+	}
+	if n := members(); n != 2 {
+		t.Errorf("members after add = %d, want 2", n)
+	}
+
+	if err := s.SetChatMemberAdmin(ctx, chat.ID, bob.ID, true); err != nil {
+		t.Fatalf("SetChatMemberAdmin: %v", err)
+	}
+	got, _ := s.GetChatByID(ctx, chat.ID)
+	for _, m := range got.Members {
+		if m.UserID == bob.ID && !m.IsAdmin {
+			t.Error("admin change served stale from the cache")
+		}
+	}
+
+	if err := s.RemoveUserFromChat(ctx, chat.ID, bob.ID); err != nil {
+		t.Fatalf("RemoveUserFromChat: %v", err)
+	}
+	if n := members(); n != 1 {
+		t.Errorf("members after remove = %d, want 1", n)
+	}
+
+	second.Content = "edited"
+	if err := s.UpdateMessage(ctx, second); err != nil {
+		t.Fatalf("UpdateMessage: %v", err)
+	}
+	if content := lastMessage(); content != "edited" {
+		t.Errorf("last message after edit = %q, want the edited one", content)
+	}
+
+	if err := s.DeleteMessage(ctx, second.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if content := lastMessage(); content != first.Content {
+		t.Errorf("last message after delete = %q, want %q", content, first.Content)
+	}
+
+	// The same writes made in a transaction invalidate the chat on commit
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	if err := tx.AddUserToChat(ctx, chat.ID, bob.ID, false); err != nil {
+		t.Fatalf("AddUserToChat in transaction: %v", err)
+	}
+	if err := tx.DeleteMessage(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteMessage in transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	got, _ = s.GetChatByID(ctx, chat.ID)
+	if len(got.Members) != 2 {
+		t.Errorf("members after committed add = %d, want 2", len(got.Members))
+	}
+	if got.LastMessage != nil {
+		t.Errorf("last message after committed delete = %q, want none", got.LastMessage.Content)
+	}
+}
+
+func TestCachedStoreInvalidatesOnCommit(t *testing.T) {
+	s, _ := newCachedTestStore(t, CacheConfig{TTL: time.Minute})
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	s.GetUserByID(ctx, ada.ID)
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	user := *ada
+	user.Bio = "Analyst"
+	if err := tx.UpdateUser(ctx, &user); err != nil {
+		t.Fatalf("UpdateUser in transaction: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	if got, _ := s.GetUserByID(ctx, ada.ID); got.Bio != "Analyst" {
+		t.Errorf("bio after commit = %q, want the committed one", got.Bio)
+	}
+}
+
+func TestCachedStoreExpiresEntries(t *testing.T) {
+	s, db := newCachedTestStore(t, CacheConfig{TTL: 20 * time.Millisecond})
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+
+	s.GetUserByID(ctx, ada.ID)
+	s.GetUserByID(ctx, ada.ID)
+	time.Sleep(30 * time.Millisecond)
+	s.GetUserByID(ctx, ada.ID)
+
+	if n := db.userReads.Load(); n != 2 {
+		t.Errorf("user reads = %d, want 2: one to fill the cache and one after expiry", n)
+	}
+}
+
+func TestCachedStoreConcurrentUse(t *testing.T) {
+	s, _ := newCachedTestStore(t, CacheConfig{TTL: time.Minute, MaxEntries: 2})
+	ctx := context.Background()
+	users := []*models.User{addUser(t, s, "ada"), addUser(t, s, "grace"), addUser(t, s, "linus")}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				user := users[(i+j)%len(users)]
+				if j%10 == 0 {
+					s.UpdateUser(ctx, copyUser(user))
+					continue
+				}
+				s.GetUserByID(ctx, user.ID)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestNewCachedStoreDisabled(t *testing.T) {
+	db := newTestStore(t)
+	if s := NewCachedStore(db, CacheConfig{}); s != Store(db) {
+		t.Errorf("disabled cache = %T, want the store unwrapped", s)
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestListChatsFiltered(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, bob := addUser(t, s, "ada"), addUser(t, s, "bob")
+
+	// name, private, and minutes since it was created and last active, so
+	// the created and recent orders differ
+	setup := []struct {
+		name    string
+		private bool
+		created int
+		updated int
+	}{
+		{"Design Team", false, 40, 30},
+		{"design-private", true, 30, 10},
+		{"Ops", false, 20, 40},
+		{"Random", false, 10, 20},
+	}
+	chats := make(map[string]*models.Chat)
+	for _, c := range setup {
+		chat := addChat(t, s, ada, bob)
+		chats[c.name] = chat
+		if c.name == "Random" {
+			addMessage(t, s, chat, bob, "unread by ada")
+		}
+		if c.name == "Ops" {
+			addMessage(t, s, chat, ada, "ada's own message")
+		}
+		if c.name == "Design Team" {
+			addMessage(t, s, chat, bob, "read by ada")
+			if err := s.MarkChatRead(ctx, chat.ID, ada.ID, time.Now().Add(time.Second)); err != nil {
+				t.Fatalf("MarkChatRead: %v", err)
+			}
+		}
+		_, err := s.conn.Exec(`UPDATE chats SET name = ?, is_private = ?, created_at = datetime('now', ?), updated_at = datetime('now', ?) WHERE id = ?`,
+			c.name, c.private, fmt.Sprintf("-%d minutes", c.created), fmt.Sprintf("-%d minutes", c.updated), chat.ID)
+		if err != nil {
+			t.Fatalf("updating chat: %v", err)
+		}
+	}
+	// Bob's chat with a matching name that ada isn't in
+	secret := addChat(t, s, bob)
+	if _, err := s.conn.Exec(`UPDATE chats SET name = 'Design secret' WHERE id = ?`, secret.ID); err != nil {
+		t.Fatalf("updating chat: %v", err)
+	}
+
+	if err := s.SetChatFavorite(ctx, chats["Design Team"].ID, ada.ID, true); err != nil {
+		t.Fatalf("SetChatFavorite: %v", err)
+	}
+	if err := s.SetChatArchived(ctx, chats["Ops"].ID, ada.ID, true); err != nil {
+		t.Fatalf("SetChatArchived: %v", err)
+	}
+
+	yes, no := true, false
+	tests := []struct {
+		name   string
+		filter models.ChatFilter
+		want   []string
+	}{
+		{"unfiltered, favorites then recent", models.ChatFilter{}, []string{"Design Team*", "design-private", "Random", "Ops"}},
+		{"search ignores case", models.ChatFilter{Search: "DESIGN"}, []string{"Design Team*", "design-private"}},
+		{"search is trimmed", models.ChatFilter{Search: "  ops "}, []string{"Ops"}},
+		{"private", models.ChatFilter{Private: &yes}, []string{"design-private"}},
+		{"public", models.ChatFilter{Private: &no}, []string{"Design Team*", "Random", "Ops"}},
+		{"favorites", models.ChatFilter{Favorite: &yes}, []string{"Design Team*"}},
+		{"not favorites", models.ChatFilter{Favorite: &no}, []string{"design-private", "Random", "Ops"}},
+		{"archived", models.ChatFilter{Archived: &yes}, []string{"Ops"}},
+		{"not archived", models.ChatFilter{Archived: &no}, []string{"Design Team*", "design-private", "Random"}},
+		// Read chats and chats with only the user's own messages are left out
+		{"unread only", models.ChatFilter{UnreadOnly: true}, []string{"Random"}},
+		{"search and private", models.ChatFilter{Search: "design", Private: &no}, []string{"Design Team*"}},
+		{"public, not archived, by name", models.ChatFilter{Private: &no, Archived: &no, Sort: models.ChatSortName}, []string{"Design Team*", "Random"}},
+		{"unread and favorite", models.ChatFilter{UnreadOnly: true, Favorite: &yes}, nil},
+		{"by name", models.ChatFilter{Sort: models.ChatSortName}, []string{"Design Team*", "design-private", "Ops", "Random"}},
+		{"newest first", models.ChatFilter{Sort: models.ChatSortCreated}, []string{"Random", "Ops", "design-private", "Design Team*"}},
+		{"paged", models.ChatFilter{Sort: models.ChatSortName, Limit: 2, Offset: 1}, []string{"design-private", "Ops"}},
+		// Search terms are values, never SQL or patterns
+		{"quote in search", models.ChatFilter{Search: "' OR 1=1 --"}, nil},
+		{"wildcard in search", models.ChatFilter{Search: "%"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.filter.Limit == 0 {
+				tt.filter.Limit = 50
+			}
+			got, err := s.ListChatsFiltered(ctx, ada.ID, tt.filter)
+			if err != nil {
+				t.Fatalf("ListChatsFiltered: %v", err)
+			}
+			if names := chatNames(got); !equal(names, tt.want) {
+				t.Errorf("chats = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestListChatsFilteredRejectsUnknownSort(t *testing.T) {
+	s := newTestStore(t)
+	ada := addUser(t, s, "ada")
+	addChat(t, s, ada)
+
+	for _, sort := range []string{"updated_at", "c.name; DROP TABLE chats", "name DESC"} {
+		_, err := s.ListChatsFiltered(context.Background(), ada.ID, models.ChatFilter{Sort: sort, Limit: 10})
+		if !errors.Is(err, ErrInvalidChatSort) {
+			t.Errorf("sort %q: error %v, want ErrInvalidChatSort", sort, err)
+		}
+	}
+
+	// The table is still there
+	got, err := s.ListChatsFiltered(context.Background(), ada.ID, models.ChatFilter{Limit: 10})
+	if err != nil || len(got) != 1 {
+		t.Errorf("after rejected sorts: %d chats, %v; want 1", len(got), err)
+	}
+}
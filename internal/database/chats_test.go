@@ -0,0 +1,118 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestCreateChatAddsCreatorAsAdmin(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+
+	chat := &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: ada.ID}
+	if err := s.CreateChat(ctx, chat); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	member, err := s.GetChatMember(ctx, chat.ID, ada.ID)
+	if err != nil {
+		t.Fatalf("creator isn't a member: %v", err)
+	}
+	if !member.IsAdmin {
+		t.Error("creator isn't an admin of their chat")
+	}
+}
+
+func TestCreateChatIsAtomic(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+
+	// Make adding the creator's membership fail after the chat row is in
+	_, err := s.conn.Exec(`
+		CREATE TRIGGER fail_membership BEFORE INSERT ON chat_members
+		BEGIN SELECT RAISE(ABORT, 'membership rejected'); END
+	`)
+	if err != nil {
+		t.Fatalf("creating trigger: %v", err)
+	}
+
+	chat := &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: ada.ID}
+	if err := s.CreateChat(ctx, chat); err == nil {
+		t.Fatal("CreateChat succeeded though the membership insert failed")
+	}
+
+	if exists, err := s.ChatExists(ctx, chat.ID); err != nil || exists {
+		t.Errorf("ChatExists = %v, %v; want the chat rolled back with its membership", exists, err)
+	}
+}
+
+func TestCreateChatInTransactionRollsBack(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+
+	tx, err := s.Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	chat := &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: ada.ID}
+	if err := tx.CreateChat(ctx, chat); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+
+	if exists, _ := s.ChatExists(ctx, chat.ID); exists {
+		t.Error("chat survived the rollback of the transaction it was created in")
+	}
+	if _, err := s.GetChatMember(ctx, chat.ID, ada.ID); err == nil {
+		t.Error("membership survived the rollback")
+	}
+}
+
+func TestGetChatByIDPopulatesMembersAndLastMessage(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, grace := addUser(t, s, "ada"), addUser(t, s, "grace")
+	chat := addChat(t, s, ada, grace)
+
+	got, err := s.GetChatByID(ctx, chat.ID)
+	if err != nil {
+		t.Fatalf("GetChatByID: %v", err)
+	}
+	if got.Name != chat.Name || got.CreatedBy != ada.ID {
+		t.Errorf("chat = %q by %s, want %q by %s", got.Name, got.CreatedBy, chat.Name, ada.ID)
+	}
+	if len(got.Members) != 2 {
+		t.Errorf("got %d members, want 2", len(got.Members))
+	}
+	if got.LastMessage != nil {
+		t.Errorf("LastMessage = %+v for an empty chat, want nil", got.LastMessage)
+	}
+
+	addMessage(t, s, chat, ada, "first")
+	last := addMessage(t, s, chat, grace, "second")
+	deleted := addMessage(t, s, chat, ada, "oops")
+	if err := s.DeleteMessage(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	got, err = s.GetChatByID(ctx, chat.ID)
+	if err != nil {
+		t.Fatalf("GetChatByID: %v", err)
+	}
+	if got.LastMessage == nil || got.LastMessage.ID != last.ID {
+		t.Errorf("LastMessage = %+v, want the latest message that isn't deleted", got.LastMessage)
+	}
+
+	if _, err := s.GetChatByID(ctx, uuid.New()); err == nil {
+		t.Error("GetChatByID found a chat that doesn't exist")
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func sendDM(t *testing.T, s Store, from, to *models.User) {
+	t.Helper()
+
+	dm := &models.DirectMessage{ID: uuid.New(), SenderID: from.ID, RecipientID: to.ID, Content: "hi"}
+	if err := s.CreateDirectMessage(context.Background(), dm); err != nil {
+		t.Fatalf("CreateDirectMessage: %v", err)
+	}
+}
+
+// block records that blocker has blocked blocked. The store has no write
+// method for blocks, so the row is inserted directly.
+func block(t *testing.T, s *SQLiteStore, blocker, blocked *models.User) {
+	t.Helper()
+
+	_, err := s.conn.Exec(`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)`, blocker.ID, blocked.ID)
+	if err != nil {
+		t.Fatalf("blocking user: %v", err)
+	}
+}
+
+func usernames(contacts []*models.RecentContact) []string {
+	names := make([]string, len(contacts))
+	for i, c := range contacts {
+		names[i] = c.Username
+	}
+	return names
+}
+
+func TestListRecentContactsOrdersByRecency(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	me := addUser(t, s, "me")
+	alice, carol, dave := addUser(t, s, "alice"), addUser(t, s, "carol"), addUser(t, s, "dave")
+
+	chat := addChat(t, s, me, alice)
+	addMessage(t, s, chat, alice, "hello")
+	sendDM(t, s, me, carol)
+	sendDM(t, s, dave, me)
+
+	contacts, err := s.ListRecentContacts(ctx, me.ID, 10)
+	if err != nil {
+		t.Fatalf("ListRecentContacts: %v", err)
+	}
+	want := []string{"dave", "carol", "alice"}
+	if got := usernames(contacts); !equal(got, want) {
+		t.Errorf("contacts = %v, want %v", got, want)
+	}
+	for i := 1; i < len(contacts); i++ {
+		if contacts[i].LastInteractionAt.After(contacts[i-1].LastInteractionAt) {
+			t.Errorf("%s interacted after %s but is ranked below", contacts[i].Username, contacts[i-1].Username)
+		}
+	}
+
+	// A newer DM moves a chat co-member ahead, counted once
+	sendDM(t, s, alice, me)
+	contacts, err = s.ListRecentContacts(ctx, me.ID, 2)
+	if err != nil {
+		t.Fatalf("ListRecentContacts: %v", err)
+	}
+	want = []string{"alice", "dave"}
+	if got := usernames(contacts); !equal(got, want) {
+		t.Errorf("contacts = %v, want %v", got, want)
+	}
+}
+
+func TestListRecentContactsExcludesBlockedAndInactive(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	me := addUser(t, s, "me")
+	friend, blockedByMe, blockingMe, gone := addUser(t, s, "friend"), addUser(t, s, "spammer"), addUser(t, s, "grumpy"), addUser(t, s, "gone")
+
+	addChat(t, s, me, friend, blockedByMe, blockingMe)
+	sendDM(t, s, blockedByMe, me)
+	sendDM(t, s, me, blockingMe)
+	sendDM(t, s, gone, me)
+
+	block(t, s, me, blockedByMe)
+	block(t, s, blockingMe, me)
+	gone.IsActive = false
+	if err := s.UpdateUser(ctx, gone); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	contacts, err := s.ListRecentContacts(ctx, me.ID, 10)
+	if err != nil {
+		t.Fatalf("ListRecentContacts: %v", err)
+	}
+	if got := usernames(contacts); !equal(got, []string{"friend"}) {
+		t.Errorf("contacts = %v, want [friend]", got)
+	}
+
+	// Blocking is per pair, so the blocked users still see each other
+	contacts, err = s.ListRecentContacts(ctx, blockedByMe.ID, 10)
+	if err != nil {
+		t.Fatalf("ListRecentContacts: %v", err)
+	}
+	for _, c := range contacts {
+		if c.ID == me.ID {
+			t.Error("blocked user still sees the user who blocked them")
+		}
+	}
+	if len(contacts) != 2 {
+		t.Errorf("contacts = %v, want friend and grumpy", usernames(contacts))
+	}
+}
+
+func TestListRecentContactsWithoutInteractions(t *testing.T) {
+	s := newTestStore(t)
+	me := addUser(t, s, "me")
+	addUser(t, s, "stranger")
+
+	contacts, err := s.ListRecentContacts(context.Background(), me.ID, 10)
+	if err != nil {
+		t.Fatalf("ListRecentContacts: %v", err)
+	}
+	if len(contacts) != 0 {
+		t.Errorf("contacts = %v, want none", usernames(contacts))
+	}
+}
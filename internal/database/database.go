@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // PostgreSQL driver
+	_ "github.com/lib/pq"           // PostgreSQL driver
+	_ "github.com/mattn/go-sqlite3" // SQLite driver
 	"github.com/rs/zerolog/log"
+)
 
-	"github.com/llamasearch/llamachat/internal/models"
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
 )
 
+// defaultSQLitePath is used when no SQLite database file is configured
+const defaultSQLitePath = "llamachat.db"
+
 // Config holds database configuration
 type Config struct {
 	Driver             string
@@ -25,54 +32,33 @@ type Config struct {
 	SSLMode            string
 	MaxConnections     int
 	ConnectionLifetime int
+	// Cache configures the optional read cache in front of the store
+	Cache CacheConfig
 }
 
-// Store defines the interface for database operations
-type Store interface {
-	// User methods
-	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
-	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
-	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
-	CreateUser(ctx context.Context, user *models.User) error
-	UpdateUser(ctx context.Context, user *models.User) error
-	DeleteUser(ctx context.Context, id uuid.UUID) error
-	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
-
-	// Chat methods
-	GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error)
-	CreateChat(ctx context.Context, chat *models.Chat) error
-	UpdateChat(ctx context.Context, chat *models.Chat) error
-	DeleteChat(ctx context.Context, id uuid.UUID) error
-	ListChats(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.Chat, error)
-	AddUserToChat(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error
-	RemoveUserFromChat(ctx context.Context, chatID, userID uuid.UUID) error
-	ListChatMembers(ctx context.Context, chatID uuid.UUID) ([]*models.ChatMember, error)
-
-	// Message methods
-	GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
-	CreateMessage(ctx context.Context, message *models.Message) error
-	UpdateMessage(ctx context.Context, message *models.Message) error
-	DeleteMessage(ctx context.Context, id uuid.UUID) error
-	ListChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]*models.Message, error)
-
-	// Direct message methods
-	GetDirectMessageByID(ctx context.Context, id uuid.UUID) (*models.DirectMessage, error)
-	CreateDirectMessage(ctx context.Context, message *models.DirectMessage) error
-	UpdateDirectMessage(ctx context.Context, message *models.DirectMessage) error
-	DeleteDirectMessage(ctx context.Context, id uuid.UUID) error
-	ListDirectMessages(ctx context.Context, userID uuid.UUID, otherUserID uuid.UUID, limit, offset int) ([]*models.DirectMessage, error)
-
-	// Close the database connection
-	Close() error
-}
-
-// PostgresStore implements Store with PostgreSQL
-type PostgresStore struct {
-	db *sqlx.DB
+// NewStore creates the store for the configured driver. An empty driver means
+// PostgreSQL.
+func NewStore(config Config) (Store, error) {
+	switch config.Driver {
+	case "", DriverPostgres:
+		store, err := NewPostgresStore(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewCachedStore(store, config.Cache), nil
+	case DriverSQLite:
+		store, err := NewSQLiteStore(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewCachedStore(store, config.Cache), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", config.Driver)
+	}
 }
 
 // NewPostgresStore creates a new PostgreSQL store
-func NewPostgresStore(config Config) (Store, error) {
+func NewPostgresStore(config Config) (*PostgresStore, error) {
 	connStr := fmt.Sprintf(
 		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
 		config.Host, config.Port, config.User, config.Password, config.Name, config.SSLMode,
@@ -100,89 +86,92 @@ func NewPostgresStore(config Config) (Store, error) {
 		Int("max_connections", config.MaxConnections).
 		Msg("Connected to PostgreSQL database")
 
-	return &PostgresStore{db: db}, nil
+	return &PostgresStore{db: timed(db, DriverPostgres), conn: db}, nil
 }
 
-// Close closes the database connection
-func (s *PostgresStore) Close() error {
-	return s.db.Close()
+// Ping checks that the database is reachable. Stores bound to a transaction
+// are reachable by definition.
+func (s *PostgresStore) Ping(ctx context.Context) error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.PingContext(ctx)
 }
 
-// GetUserByID fetches a user by ID
-func (s *PostgresStore) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE id = $1 AND is_active = true`
-	if err := s.db.GetContext(ctx, &user, query, id); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found: %w", err)
-		}
-		return nil, fmt.Errorf("error fetching user: %w", err)
+// Stats reports connection pool statistics. Stores bound to a transaction
+// have no pool of their own and report zeros.
+func (s *PostgresStore) Stats() sql.DBStats {
+	if s.conn == nil {
+		return sql.DBStats{}
 	}
-	return &user, nil
+	return s.conn.Stats()
 }
 
-// Placeholder implementations for the other Store methods
-// In a real implementation, these would be fully implemented with proper SQL queries
-
-func (s *PostgresStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE username = $1 AND is_active = true`
-	if err := s.db.GetContext(ctx, &user, query, username); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found: %w", err)
-		}
-		return nil, fmt.Errorf("error fetching user: %w", err)
+// Close closes the database connection. Stores bound to a transaction don't
+// own the connection, so closing them does nothing.
+func (s *PostgresStore) Close() error {
+	if s.conn == nil {
+		return nil
 	}
-	return &user, nil
+	return s.conn.Close()
 }
 
-func (s *PostgresStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	var user models.User
-	query := `SELECT * FROM users WHERE email = $1 AND is_active = true`
-	if err := s.db.GetContext(ctx, &user, query, email); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found: %w", err)
-		}
-		return nil, fmt.Errorf("error fetching user: %w", err)
+// NewSQLiteStore opens the SQLite database file named by config.Name, creating
+// it and its tables if they don't exist yet
+func NewSQLiteStore(config Config) (*SQLiteStore, error) {
+	path := config.Name
+	if path == "" {
+		path = defaultSQLitePath
 	}
-	return &user, nil
-}
 
-func (s *PostgresStore) CreateUser(ctx context.Context, user *models.User) error {
-	query := `
-		INSERT INTO users (
-			id, username, email, password_hash, display_name, avatar_url, bio, 
-			is_active, is_admin
-		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9
-		) RETURNING id, created_at, updated_at
-	`
-	// If no ID is provided, generate one
-	if user.ID == uuid.Nil {
-		user.ID = uuid.New()
+	// Foreign keys are off by default in SQLite, and chat deletion relies on
+	// them cascading
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL", path)
+
+	db, err := sqlx.Connect("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	row := s.db.QueryRowContext(
-		ctx, query,
-		user.ID, user.Username, user.Email, user.PasswordHash, user.DisplayName,
-		user.AvatarURL, user.Bio, user.IsActive, user.IsAdmin,
-	)
+	if config.MaxConnections > 0 {
+		db.SetMaxOpenConns(config.MaxConnections)
+	}
 
-	return row.Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
-}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create database schema: %w", err)
+	}
 
-// Additional method implementations would go here
+	log.Info().
+		Str("path", path).
+		Msg("Opened SQLite database")
 
-// GetChatByID fetches a chat by ID
-func (s *PostgresStore) GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
-	// Implementation would fetch chat and populate members and last message
-	return nil, fmt.Errorf("not implemented")
+	return &SQLiteStore{db: timed(db, DriverSQLite), conn: db}, nil
 }
 
-// CreateChat creates a new chat
-func (s *PostgresStore) CreateChat(ctx context.Context, chat *models.Chat) error {
-	// Implementation would insert chat record and add creator as member
-	return fmt.Errorf("not implemented")
+// Ping checks that the database is reachable. Stores bound to a transaction
+// are reachable by definition.
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.PingContext(ctx)
 }
 
-// For brevity, other method implementations are omitted but would follow similar patterns
+// Stats reports connection pool statistics. Stores bound to a transaction
+// have no pool of their own and report zeros.
+func (s *SQLiteStore) Stats() sql.DBStats {
+	if s.conn == nil {
+		return sql.DBStats{}
+	}
+	return s.conn.Stats()
+}
+
+// Close closes the database connection. Stores bound to a transaction don't
+// own the connection, so closing them does nothing.
+func (s *SQLiteStore) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	return s.conn.Close()
+}
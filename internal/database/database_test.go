@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewStoreSelectsDriver(t *testing.T) {
+	store, err := NewStore(Config{Driver: DriverSQLite, Name: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("NewStore(sqlite): %v", err)
+	}
+	defer store.Close()
+	if _, ok := store.(*SQLiteStore); !ok {
+		t.Errorf("NewStore(sqlite) = %T, want *SQLiteStore", store)
+	}
+
+	if _, err := NewStore(Config{Driver: "mysql"}); err == nil {
+		t.Error("NewStore accepted an unsupported driver")
+	}
+}
+
+func TestSQLiteSchemaBootstrap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fresh.db")
+	ctx := context.Background()
+
+	// A fresh file gets its tables created
+	store, err := NewSQLiteStore(Config{Driver: DriverSQLite, Name: path})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore on a fresh file: %v", err)
+	}
+	ada := addUser(t, store, "ada")
+	chat := addChat(t, store, ada)
+	addMessage(t, store, chat, ada, "persisted")
+	store.Close()
+
+	// Opening it again keeps the data rather than failing or recreating
+	store, err = NewSQLiteStore(Config{Driver: DriverSQLite, Name: path})
+	if err != nil {
+		t.Fatalf("reopening NewSQLiteStore: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.GetUserByUsername(ctx, "ada"); err != nil {
+		t.Errorf("user lost on reopen: %v", err)
+	}
+	messages, err := store.ListChatMessages(ctx, chat.ID, 10, 0, false)
+	if err != nil || len(messages) != 1 || messages[0].Content != "persisted" {
+		t.Errorf("messages after reopen = %v, %v; want the one written before", messages, err)
+	}
+}
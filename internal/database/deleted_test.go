@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestListingsLeaveOutDeletedMessages(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, bob := addUser(t, s, "ada"), addUser(t, s, "bob")
+	chat := addChat(t, s, ada, bob)
+
+	gone := addMessage(t, s, chat, ada, "gone")
+	addMessage(t, s, chat, bob, "kept")
+	if err := s.DeleteMessage(ctx, gone.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	dm := &models.DirectMessage{ID: uuid.New(), SenderID: ada.ID, RecipientID: bob.ID, Content: "gone"}
+	if err := s.CreateDirectMessage(ctx, dm); err != nil {
+		t.Fatalf("CreateDirectMessage: %v", err)
+	}
+	kept := &models.DirectMessage{ID: uuid.New(), SenderID: bob.ID, RecipientID: ada.ID, Content: "kept"}
+	if err := s.CreateDirectMessage(ctx, kept); err != nil {
+		t.Fatalf("CreateDirectMessage: %v", err)
+	}
+	if err := s.DeleteDirectMessage(ctx, dm.ID); err != nil {
+		t.Fatalf("DeleteDirectMessage: %v", err)
+	}
+
+	for _, includeDeleted := range []bool{false, true} {
+		messages, err := s.ListChatMessages(ctx, chat.ID, 10, 0, includeDeleted)
+		if err != nil {
+			t.Fatalf("ListChatMessages: %v", err)
+		}
+		dms, err := s.ListDirectMessages(ctx, ada.ID, bob.ID, 10, 0, includeDeleted)
+		if err != nil {
+			t.Fatalf("ListDirectMessages: %v", err)
+		}
+
+		want := 1
+		if includeDeleted {
+			want = 2
+		}
+		if len(messages) != want {
+			t.Errorf("includeDeleted %v: %d chat messages, want %d", includeDeleted, len(messages), want)
+		}
+		if len(dms) != want {
+			t.Errorf("includeDeleted %v: %d direct messages, want %d", includeDeleted, len(dms), want)
+		}
+		for _, m := range messages {
+			if m.Content == "gone" && !m.IsDeleted {
+				t.Error("deleted chat message listed as not deleted")
+			}
+		}
+		for _, m := range dms {
+			if m.Content == "gone" && !m.IsDeleted {
+				t.Error("deleted direct message listed as not deleted")
+			}
+		}
+	}
+}
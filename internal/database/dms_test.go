@@ -0,0 +1,75 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestGetDMConversationIsSymmetric(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, grace, linus := addUser(t, s, "ada"), addUser(t, s, "grace"), addUser(t, s, "linus")
+
+	send := func(from, to *models.User, content string) *models.DirectMessage {
+		t.Helper()
+		dm := &models.DirectMessage{ID: uuid.New(), SenderID: from.ID, RecipientID: to.ID, Content: content}
+		if err := s.CreateDirectMessage(ctx, dm); err != nil {
+			t.Fatalf("CreateDirectMessage: %v", err)
+		}
+		return dm
+	}
+	send(ada, grace, "one")
+	send(grace, ada, "two")
+	send(grace, ada, "three")
+	last := send(ada, grace, "four")
+	send(linus, ada, "not in this conversation")
+
+	fromAda, err := s.GetDMConversation(ctx, ada.ID, grace.ID)
+	if err != nil {
+		t.Fatalf("GetDMConversation(ada, grace): %v", err)
+	}
+	fromGrace, err := s.GetDMConversation(ctx, grace.ID, ada.ID)
+	if err != nil {
+		t.Fatalf("GetDMConversation(grace, ada): %v", err)
+	}
+
+	if fromAda.ID != fromGrace.ID || fromAda.UserA != fromGrace.UserA || fromAda.UserB != fromGrace.UserB {
+		t.Errorf("ada sees %s (%s, %s) but grace sees %s (%s, %s)",
+			fromAda.ID, fromAda.UserA, fromAda.UserB, fromGrace.ID, fromGrace.UserA, fromGrace.UserB)
+	}
+	for name, conversation := range map[string]*models.DMConversation{"ada": fromAda, "grace": fromGrace} {
+		if conversation.LastMessage == nil || conversation.LastMessage.ID != last.ID {
+			t.Errorf("%s's last message = %+v, want %q", name, conversation.LastMessage, last.Content)
+		}
+	}
+
+	// Unread counts are from each viewer's side
+	if fromAda.UnreadCount != 2 {
+		t.Errorf("ada's unread = %d, want grace's 2 messages", fromAda.UnreadCount)
+	}
+	if fromGrace.UnreadCount != 2 {
+		t.Errorf("grace's unread = %d, want ada's 2 messages", fromGrace.UnreadCount)
+	}
+	if err := s.MarkDirectMessagesRead(ctx, ada.ID, grace.ID); err != nil {
+		t.Fatalf("MarkDirectMessagesRead: %v", err)
+	}
+	if c, _ := s.GetDMConversation(ctx, ada.ID, grace.ID); c.UnreadCount != 0 {
+		t.Errorf("ada's unread after reading = %d, want 0", c.UnreadCount)
+	}
+	if c, _ := s.GetDMConversation(ctx, grace.ID, ada.ID); c.UnreadCount != 2 {
+		t.Errorf("grace's unread after ada read = %d, want it unchanged at 2", c.UnreadCount)
+	}
+
+	// A pair that never talked still has its conversation identity
+	empty, err := s.GetDMConversation(ctx, grace.ID, linus.ID)
+	if err != nil {
+		t.Fatalf("GetDMConversation(grace, linus): %v", err)
+	}
+	if empty.LastMessage != nil || empty.UnreadCount != 0 || empty.ID != models.NewDMConversation(linus.ID, grace.ID).ID {
+		t.Errorf("empty conversation = %+v, want no messages and the pair's ID", empty)
+	}
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestSaveDraftUpserts(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	chat := addChat(t, s, ada)
+
+	first := &models.MessageDraft{UserID: ada.ID, ChatID: chat.ID, Content: "Hel"}
+	if err := s.SaveDraft(ctx, first); err != nil {
+		t.Fatalf("SaveDraft: %v", err)
+	}
+	second := &models.MessageDraft{UserID: ada.ID, ChatID: chat.ID, Content: "Hello there"}
+	if err := s.SaveDraft(ctx, second); err != nil {
+		t.Fatalf("SaveDraft again: %v", err)
+	}
+
+	draft, err := s.GetDraft(ctx, ada.ID, chat.ID)
+	if err != nil {
+		t.Fatalf("GetDraft: %v", err)
+	}
+	if draft.Content != "Hello there" {
+		t.Errorf("content = %q, want the latest save", draft.Content)
+	}
+	if draft.UpdatedAt.Before(first.UpdatedAt) {
+		t.Errorf("updated_at = %v, want it moved forward from %v", draft.UpdatedAt, first.UpdatedAt)
+	}
+
+	drafts, err := s.ListDrafts(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("ListDrafts: %v", err)
+	}
+	if len(drafts) != 1 {
+		t.Errorf("got %d drafts, want the one replaced in place", len(drafts))
+	}
+}
+
+func TestDraftsArePerUser(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, grace := addUser(t, s, "ada"), addUser(t, s, "grace")
+	chat := addChat(t, s, ada, grace)
+	other := addChat(t, s, ada)
+
+	for _, draft := range []*models.MessageDraft{
+		{UserID: ada.ID, ChatID: chat.ID, Content: "ada in general"},
+		{UserID: ada.ID, ChatID: other.ID, Content: "ada elsewhere"},
+		{UserID: grace.ID, ChatID: chat.ID, Content: "grace in general"},
+	} {
+		if err := s.SaveDraft(ctx, draft); err != nil {
+			t.Fatalf("SaveDraft: %v", err)
+		}
+	}
+
+	draft, err := s.GetDraft(ctx, grace.ID, chat.ID)
+	if err != nil || draft.Content != "grace in general" {
+		t.Errorf("grace's draft = %+v, %v; want her own", draft, err)
+	}
+	if _, err := s.GetDraft(ctx, grace.ID, other.ID); err == nil {
+		t.Error("grace can read a draft she never wrote")
+	}
+
+	drafts, err := s.ListDrafts(ctx, ada.ID)
+	if err != nil {
+		t.Fatalf("ListDrafts: %v", err)
+	}
+	if len(drafts) != 2 {
+		t.Fatalf("ada has %d drafts, want 2", len(drafts))
+	}
+	for _, d := range drafts {
+		if d.UserID != ada.ID {
+			t.Errorf("ada's list includes %s's draft", d.UserID)
+		}
+	}
+
+	// Discarding one user's draft leaves the others alone
+	if err := s.DeleteDraft(ctx, ada.ID, chat.ID); err != nil {
+		t.Fatalf("DeleteDraft: %v", err)
+	}
+	if _, err := s.GetDraft(ctx, ada.ID, chat.ID); err == nil {
+		t.Error("deleted draft is still there")
+	}
+	if _, err := s.GetDraft(ctx, grace.ID, chat.ID); err != nil {
+		t.Errorf("deleting ada's draft removed grace's: %v", err)
+	}
+	if err := s.DeleteDraft(ctx, ada.ID, chat.ID); err != nil {
+		t.Errorf("deleting a missing draft: %v", err)
+	}
+}
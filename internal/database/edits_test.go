@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestUpdateMessageLeavesEditedFlagToCaller(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada := addUser(t, s, "ada")
+	chat := addChat(t, s, ada)
+	message := addMessage(t, s, chat, ada, "teh")
+
+	// A quick fix inside the grace window: stored, but not marked edited
+	message.Content = "the"
+	if err := s.UpdateMessage(ctx, message); err != nil {
+		t.Fatalf("UpdateMessage: %v", err)
+	}
+	got, err := s.GetMessageByID(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if got.Content != "the" || got.IsEdited {
+		t.Errorf("after silent edit: content %q, edited %v; want %q, false", got.Content, got.IsEdited, "the")
+	}
+
+	message.Content = "the end"
+	message.IsEdited = true
+	if err := s.UpdateMessage(ctx, message); err != nil {
+		t.Fatalf("UpdateMessage: %v", err)
+	}
+	if got, err = s.GetMessageByID(ctx, message.ID); err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if !got.IsEdited {
+		t.Error("marked edit wasn't stored")
+	}
+
+	// History is kept either way
+	edits, err := s.ListMessageEdits(ctx, message.ID)
+	if err != nil {
+		t.Fatalf("ListMessageEdits: %v", err)
+	}
+	var previous []string
+	for _, e := range edits {
+		previous = append(previous, e.Content)
+	}
+	if want := []string{"teh", "the"}; !equal(previous, want) {
+		t.Errorf("edit history = %q, want %q", previous, want)
+	}
+}
@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestExistenceChecks(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, bob, carol := addUser(t, s, "ada"), addUser(t, s, "bob"), addUser(t, s, "carol")
+	chat := addChat(t, s, ada, bob)
+	missing := uuid.New()
+
+	check := func(name string, got bool, err error, want bool) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+
+	exists, err := s.UserExists(ctx, ada.ID)
+	check("UserExists(ada)", exists, err, true)
+	exists, err = s.UserExists(ctx, missing)
+	check("UserExists(missing)", exists, err, false)
+
+	exists, err = s.ChatExists(ctx, chat.ID)
+	check("ChatExists(chat)", exists, err, true)
+	// IDs of one kind don't match rows of another
+	exists, err = s.ChatExists(ctx, ada.ID)
+	check("ChatExists(user ID)", exists, err, false)
+
+	exists, err = s.IsChatMember(ctx, chat.ID, ada.ID)
+	check("IsChatMember(creator)", exists, err, true)
+	exists, err = s.IsChatMember(ctx, chat.ID, bob.ID)
+	check("IsChatMember(bob)", exists, err, true)
+	exists, err = s.IsChatMember(ctx, chat.ID, carol.ID)
+	check("IsChatMember(carol)", exists, err, false)
+	exists, err = s.IsChatMember(ctx, missing, ada.ID)
+	check("IsChatMember(missing chat)", exists, err, false)
+
+	// Membership and chats go as they are removed
+	if err := s.RemoveUserFromChat(ctx, chat.ID, bob.ID); err != nil {
+		t.Fatalf("RemoveUserFromChat: %v", err)
+	}
+	exists, err = s.IsChatMember(ctx, chat.ID, bob.ID)
+	check("IsChatMember(bob) after removal", exists, err, false)
+
+	if err := s.DeleteChat(ctx, chat.ID); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	exists, err = s.ChatExists(ctx, chat.ID)
+	check("ChatExists(chat) after deletion", exists, err, false)
+}
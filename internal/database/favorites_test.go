@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// chatNames returns the names of chats in order, marking favorites with a
+// trailing star
+func chatNames(chats []*models.Chat) []string {
+	names := make([]string, len(chats))
+	for i, chat := range chats {
+		names[i] = chat.Name
+		if chat.IsFavorite {
+			names[i] += "*"
+		}
+	}
+	return names
+}
+
+func TestFavoriteChatsListFirstPerUser(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, grace := addUser(t, s, "ada"), addUser(t, s, "grace")
+
+	var chats []*models.Chat
+	for i, name := range []string{"oldest", "middle", "newest"} {
+		chat := addChat(t, s, ada, grace)
+		// Space the chats' activity out so recency order is unambiguous
+		_, err := s.conn.Exec(`UPDATE chats SET name = ?, updated_at = datetime('now', ?) WHERE id = ?`,
+			name, fmt.Sprintf("-%d minutes", 3-i), chat.ID)
+		if err != nil {
+			t.Fatalf("updating chat: %v", err)
+		}
+		chats = append(chats, chat)
+	}
+
+	if err := s.SetChatFavorite(ctx, chats[0].ID, ada.ID, true); err != nil {
+		t.Fatalf("SetChatFavorite: %v", err)
+	}
+
+	list := func(user *models.User) []string {
+		t.Helper()
+		got, err := s.ListChats(ctx, user.ID, 10, 0)
+		if err != nil {
+			t.Fatalf("ListChats: %v", err)
+		}
+		return chatNames(got)
+	}
+
+	if got, want := list(ada), []string{"oldest*", "newest", "middle"}; !equal(got, want) {
+		t.Errorf("ada's chats = %v, want %v", got, want)
+	}
+	// Favorites are personal
+	if got, want := list(grace), []string{"newest", "middle", "oldest"}; !equal(got, want) {
+		t.Errorf("grace's chats = %v, want %v", got, want)
+	}
+
+	for user, want := range map[*models.User]int{ada: 1, grace: 0} {
+		if n, err := s.CountFavoriteChats(ctx, user.ID); err != nil || n != want {
+			t.Errorf("CountFavoriteChats(%s) = %d, %v; want %d", user.Username, n, err, want)
+		}
+	}
+
+	if err := s.SetChatFavorite(ctx, chats[0].ID, ada.ID, false); err != nil {
+		t.Fatalf("SetChatFavorite(false): %v", err)
+	}
+	if got, want := list(ada), []string{"newest", "middle", "oldest"}; !equal(got, want) {
+		t.Errorf("ada's chats after unfavoriting = %v, want %v", got, want)
+	}
+}
+
+func TestFavoriteChatEnforcesLimit(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, grace := addUser(t, s, "ada"), addUser(t, s, "grace")
+	first, second, third := addChat(t, s, ada, grace), addChat(t, s, ada, grace), addChat(t, s, ada, grace)
+
+	for _, chat := range []*models.Chat{first, second} {
+		if err := s.FavoriteChat(ctx, chat.ID, ada.ID, 2); err != nil {
+			t.Fatalf("FavoriteChat within the limit: %v", err)
+		}
+	}
+	if err := s.FavoriteChat(ctx, third.ID, ada.ID, 2); !errors.Is(err, ErrFavoriteLimit) {
+		t.Errorf("FavoriteChat over the limit = %v, want ErrFavoriteLimit", err)
+	}
+	// A chat that already is a favorite can be favorited again at the limit
+	if err := s.FavoriteChat(ctx, second.ID, ada.ID, 2); err != nil {
+		t.Errorf("refavoriting at the limit: %v", err)
+	}
+	// The limit is per user
+	if err := s.FavoriteChat(ctx, third.ID, grace.ID, 2); err != nil {
+		t.Errorf("FavoriteChat for another user: %v", err)
+	}
+
+	if n, err := s.CountFavoriteChats(ctx, ada.ID); err != nil || n != 2 {
+		t.Errorf("CountFavoriteChats = %d, %v; want 2", n, err)
+	}
+}
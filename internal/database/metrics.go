@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/llamasearch/llamachat/internal/metrics"
+)
+
+// timedQueryer records how long each query made through it takes
+type timedQueryer struct {
+	q      queryer
+	driver string
+}
+
+// timed wraps q so its queries are recorded under driver
+func timed(q queryer, driver string) queryer {
+	return &timedQueryer{q: q, driver: driver}
+}
+
+// observe records a query that started at start
+func (t *timedQueryer) observe(operation string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(t.driver, operation).Observe(time.Since(start).Seconds())
+}
+
+func (t *timedQueryer) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer t.observe("get", time.Now())
+	return t.q.GetContext(ctx, dest, query, args...)
+}
+
+func (t *timedQueryer) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer t.observe("select", time.Now())
+	return t.q.SelectContext(ctx, dest, query, args...)
+}
+
+func (t *timedQueryer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer t.observe("exec", time.Now())
+	return t.q.ExecContext(ctx, query, args...)
+}
+
+func (t *timedQueryer) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	defer t.observe("named_exec", time.Now())
+	return t.q.NamedExecContext(ctx, query, arg)
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestListMessageReaders(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	ada, bob, carol, dave, erin := addUser(t, s, "ada"), addUser(t, s, "bob"), addUser(t, s, "carol"), addUser(t, s, "dave"), addUser(t, s, "erin")
+	chat := addChat(t, s, ada, bob, carol, dave, erin)
+	message := addMessage(t, s, chat, ada, "did everyone see this?")
+
+	markers := map[*models.User]time.Time{
+		ada:   message.CreatedAt.Add(time.Minute),
+		bob:   message.CreatedAt, // read exactly up to the message
+		carol: message.CreatedAt.Add(time.Minute),
+		dave:  message.CreatedAt.Add(-time.Second),
+		erin:  message.CreatedAt.Add(2 * time.Minute),
+	}
+	for user, upTo := range markers {
+		if err := s.MarkChatRead(ctx, chat.ID, user.ID, upTo); err != nil {
+			t.Fatalf("MarkChatRead(%s): %v", user.Username, err)
+		}
+	}
+
+	// carol has read it but doesn't share her status
+	if _, err := s.conn.Exec(`INSERT INTO user_preferences (user_id, display_online_status) VALUES (?, false)`, carol.ID); err != nil {
+		t.Fatalf("setting preferences: %v", err)
+	}
+
+	readerNames := func(limit int) []string {
+		t.Helper()
+		readers, err := s.ListMessageReaders(ctx, message.ID, limit)
+		if err != nil {
+			t.Fatalf("ListMessageReaders: %v", err)
+		}
+		names := make([]string, len(readers))
+		for i, user := range readers {
+			names[i] = user.Username
+		}
+		return names
+	}
+
+	// The author isn't listed, and readers are in the order they read it
+	if got, want := readerNames(10), []string{"bob", "erin"}; !equal(got, want) {
+		t.Errorf("readers = %v, want %v", got, want)
+	}
+	if got, want := readerNames(1), []string{"bob"}; !equal(got, want) {
+		t.Errorf("readers with limit 1 = %v, want %v", got, want)
+	}
+
+	// Opting back in shows carol again
+	if _, err := s.conn.Exec(`UPDATE user_preferences SET display_online_status = true WHERE user_id = ?`, carol.ID); err != nil {
+		t.Fatalf("updating preferences: %v", err)
+	}
+	if got, want := readerNames(10), []string{"bob", "carol", "erin"}; !equal(got, want) {
+		t.Errorf("readers after carol opted in = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,2012 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// SQLiteStore implements the Store interface using SQLite, for local and
+// development deployments. Queries follow PostgresStore; where PostgreSQL
+// features are missing (arrays, RETURNING, full-text search) they are written
+// out longhand.
+type SQLiteStore struct {
+	db queryer
+	// conn is the connection pool. It is nil when the store is bound to a
+	// transaction.
+	conn *sqlx.DB
+}
+
+// Begin starts a new transaction
+func (s *SQLiteStore) Begin() (Transaction, error) {
+	if s.conn == nil {
+		return nil, fmt.Errorf("nested transactions are not supported")
+	}
+
+	tx, err := s.conn.Beginx()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	return &SQLiteTransaction{
+		SQLiteStore: SQLiteStore{db: timed(tx, DriverSQLite)},
+		tx:          tx,
+	}, nil
+}
+
+// inTx runs fn in a transaction. A store that is already bound to a
+// transaction runs fn in it directly and leaves committing to its owner.
+func (s *SQLiteStore) inTx(ctx context.Context, fn func(q queryer) error) error {
+	if s.conn == nil {
+		return fn(s.db)
+	}
+
+	tx, err := s.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(timed(tx, DriverSQLite)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// in expands a query with an IN (?) list over ids
+func in(query string, ids []uuid.UUID, args ...interface{}) (string, []interface{}, error) {
+	return sqlx.In(query, append(args, ids)...)
+}
+
+// GetUserByID retrieves a user by ID
+func (s *SQLiteStore) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	var user models.User
+	err := s.db.GetContext(ctx, &user, `
+		SELECT * FROM users
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserPreferences retrieves a user's preference settings
+func (s *SQLiteStore) GetUserPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error) {
+	var prefs models.UserPreferences
+	err := s.db.GetContext(ctx, &prefs, `
+		SELECT * FROM user_preferences
+		WHERE user_id = ?
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
+	}
+
+	return &prefs, nil
+}
+
+// GetUsersByIDs retrieves several users in one query, keyed by ID. IDs with no
+// matching user are left out of the map.
+func (s *SQLiteStore) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	usersByID := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return usersByID, nil
+	}
+
+	query, args, err := in(`
+		SELECT * FROM users
+		WHERE id IN (?)
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users by IDs: %w", err)
+	}
+
+	var users []*models.User
+	if err := s.db.SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get users by IDs: %w", err)
+	}
+
+	for _, user := range users {
+		usersByID[user.ID] = user
+	}
+
+	return usersByID, nil
+}
+
+// UserExists reports whether a user exists, without loading it
+func (s *SQLiteStore) UserExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.GetContext(ctx, &exists, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)
+	`, id)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check user exists: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetUserByUsername retrieves a user by username
+func (s *SQLiteStore) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	var user models.User
+	err := s.db.GetContext(ctx, &user, `
+		SELECT * FROM users
+		WHERE username = ?
+	`, username)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by username: %w", err)
+	}
+
+	return &user, nil
+}
+
+// GetUserByEmail retrieves a user by email, ignoring case
+func (s *SQLiteStore) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	var user models.User
+	err := s.db.GetContext(ctx, &user, `
+		SELECT * FROM users
+		WHERE LOWER(email) = LOWER(?)
+	`, email)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
+	}
+
+	return &user, nil
+}
+
+// CreateUser creates a new user
+func (s *SQLiteStore) CreateUser(ctx context.Context, user *models.User) error {
+	now := time.Now()
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO users (
+			id, username, email, password_hash, display_name, avatar_url, bio,
+			created_at, updated_at, last_login, is_active, is_admin
+		) VALUES (
+			:id, :username, :email, :password_hash, :display_name, :avatar_url, :bio,
+			:created_at, :updated_at, :last_login, :is_active, :is_admin
+		)
+	`, user)
+
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateUser updates an existing user
+func (s *SQLiteStore) UpdateUser(ctx context.Context, user *models.User) error {
+	user.UpdatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		UPDATE users
+		SET username = :username,
+			email = :email,
+			password_hash = :password_hash,
+			display_name = :display_name,
+			avatar_url = :avatar_url,
+			bio = :bio,
+			updated_at = :updated_at,
+			last_login = :last_login,
+			is_active = :is_active,
+			is_admin = :is_admin
+		WHERE id = :id
+	`, user)
+
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return nil
+}
+
+// IncrementFailedLogins counts a failed login against a user and returns the
+// number of failures since the last successful login
+func (s *SQLiteStore) IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error) {
+	var attempts int
+	err := s.inTx(ctx, func(tx queryer) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE users
+			SET failed_login_attempts = failed_login_attempts + 1
+			WHERE id = ?
+		`, id)
+		if err != nil {
+			return err
+		}
+
+		return tx.GetContext(ctx, &attempts, `
+			SELECT failed_login_attempts FROM users
+			WHERE id = ?
+		`, id)
+	})
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment failed logins: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// LockUser stops a user from logging in until the given time
+func (s *SQLiteStore) LockUser(ctx context.Context, id uuid.UUID, until time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET locked_until = ?
+		WHERE id = ?
+	`, until, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	return nil
+}
+
+// ResetFailedLogins clears a user's failed login count and any lock
+func (s *SQLiteStore) ResetFailedLogins(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE users
+		SET failed_login_attempts = 0,
+			locked_until = NULL
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to reset failed logins: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes a user
+func (s *SQLiteStore) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM users
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return nil
+}
+
+// ListUsers lists users with pagination
+func (s *SQLiteStore) ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error) {
+	var users []*models.User
+	err := s.db.SelectContext(ctx, &users, `
+		SELECT * FROM users
+		ORDER BY username
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListRecentContacts lists the users someone has most recently interacted with,
+// combining DM counterparts and members of shared chats, most recent first.
+// Users blocked in either direction and deactivated users are excluded.
+func (s *SQLiteStore) ListRecentContacts(ctx context.Context, userID uuid.UUID, limit int) ([]*models.RecentContact, error) {
+	// MAX() loses the column type, so the time comes back as text
+	var rows []struct {
+		ID                uuid.UUID `db:"id"`
+		Username          string    `db:"username"`
+		DisplayName       string    `db:"display_name"`
+		AvatarURL         string    `db:"avatar_url"`
+		LastInteractionAt string    `db:"last_interaction_at"`
+	}
+	err := s.db.SelectContext(ctx, &rows, `
+		WITH interactions AS (
+			SELECT CASE WHEN sender_id = ?1 THEN recipient_id ELSE sender_id END AS contact_id,
+			       MAX(created_at) AS last_interaction_at
+			FROM direct_messages
+			WHERE (sender_id = ?1 OR recipient_id = ?1) AND is_deleted = false
+			GROUP BY 1
+			UNION ALL
+			SELECT other.user_id AS contact_id,
+			       MAX(c.updated_at) AS last_interaction_at
+			FROM chat_members me
+			JOIN chat_members other ON other.chat_id = me.chat_id AND other.user_id <> ?1
+			JOIN chats c ON c.id = me.chat_id
+			WHERE me.user_id = ?1
+			GROUP BY other.user_id
+		)
+		SELECT u.id, u.username,
+		       COALESCE(u.display_name, '') AS display_name,
+		       COALESCE(u.avatar_url, '') AS avatar_url,
+		       MAX(i.last_interaction_at) AS last_interaction_at
+		FROM interactions i
+		JOIN users u ON u.id = i.contact_id
+		WHERE u.id <> ?1
+		  AND u.is_active = true
+		  AND NOT EXISTS (
+			SELECT 1 FROM user_blocks b
+			WHERE (b.blocker_id = ?1 AND b.blocked_id = u.id)
+			   OR (b.blocker_id = u.id AND b.blocked_id = ?1)
+		  )
+		GROUP BY u.id, u.username, u.display_name, u.avatar_url
+		ORDER BY last_interaction_at DESC
+		LIMIT ?2
+	`, userID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recent contacts: %w", err)
+	}
+
+	contacts := make([]*models.RecentContact, len(rows))
+	for i, row := range rows {
+		contacts[i] = &models.RecentContact{
+			ID:                row.ID,
+			Username:          row.Username,
+			DisplayName:       row.DisplayName,
+			AvatarURL:         row.AvatarURL,
+			LastInteractionAt: parseSQLiteTime(row.LastInteractionAt),
+		}
+	}
+
+	return contacts, nil
+}
+
+// ListUsersShowingOnlineStatus returns the active users among ids who allow
+// others to see that they are online, ordered by username. Users without
+// saved preferences show their status by default.
+func (s *SQLiteStore) ListUsersShowingOnlineStatus(ctx context.Context, ids []uuid.UUID) ([]*models.User, error) {
+	users := []*models.User{}
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	query, args, err := in(`
+		SELECT u.* FROM users u
+		LEFT JOIN user_preferences p ON p.user_id = u.id
+		WHERE u.id IN (?)
+		  AND u.is_active
+		  AND COALESCE(p.display_online_status, TRUE)
+		ORDER BY u.username
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list online users: %w", err)
+	}
+
+	if err := s.db.SelectContext(ctx, &users, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list online users: %w", err)
+	}
+
+	return users, nil
+}
+
+// CreateRefreshToken stores a new refresh token
+func (s *SQLiteStore) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	token.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, created_at)
+		VALUES (:id, :user_id, :token_hash, :expires_at, :created_at)
+	`, token)
+
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeRefreshToken deletes a refresh token and returns it, so each token
+// can be used at most once even under concurrent requests. Only the request
+// whose delete removed the row gets the token back.
+func (s *SQLiteStore) ConsumeRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	var token models.RefreshToken
+	err := s.inTx(ctx, func(tx queryer) error {
+		err := tx.GetContext(ctx, &token, `
+			SELECT * FROM refresh_tokens
+			WHERE token_hash = ?
+		`, tokenHash)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM refresh_tokens
+			WHERE id = ?
+		`, token.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// CreatePasswordReset stores a new password reset token
+func (s *SQLiteStore) CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error {
+	reset.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO password_resets (id, user_id, token_hash, expires_at, created_at)
+		VALUES (:id, :user_id, :token_hash, :expires_at, :created_at)
+	`, reset)
+
+	if err != nil {
+		return fmt.Errorf("failed to create password reset: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumePasswordReset deletes a password reset token and returns it, so each
+// token can be used at most once. Only the request whose delete removed the
+// row gets the token back.
+func (s *SQLiteStore) ConsumePasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error) {
+	var reset models.PasswordReset
+	err := s.inTx(ctx, func(tx queryer) error {
+		err := tx.GetContext(ctx, &reset, `
+			SELECT * FROM password_resets
+			WHERE token_hash = ?
+		`, tokenHash)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.ExecContext(ctx, `
+			DELETE FROM password_resets
+			WHERE id = ?
+		`, reset.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			return sql.ErrNoRows
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume password reset: %w", err)
+	}
+
+	return &reset, nil
+}
+
+// DeletePasswordResets invalidates all of a user's password reset tokens
+func (s *SQLiteStore) DeletePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM password_resets
+		WHERE user_id = ?
+	`, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete password resets: %w", err)
+	}
+
+	return nil
+}
+
+// CreateAPIKey stores a new API key
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	key.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO api_keys (id, user_id, name, prefix, key_hash, created_at)
+		VALUES (:id, :user_id, :name, :prefix, :key_hash, :created_at)
+	`, key)
+
+	if err != nil {
+		return fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKeyByHash retrieves an API key by the hash of its value
+func (s *SQLiteStore) GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	var key models.APIKey
+	err := s.db.GetContext(ctx, &key, `
+		SELECT * FROM api_keys
+		WHERE key_hash = ?
+	`, keyHash)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys lists a user's API keys, oldest first
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	var keys []*models.APIKey
+	err := s.db.SelectContext(ctx, &keys, `
+		SELECT * FROM api_keys
+		WHERE user_id = ?
+		ORDER BY created_at
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes one of a user's API keys. It fails with sql.ErrNoRows
+// if the user has no such key.
+func (s *SQLiteStore) DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM api_keys
+		WHERE id = ? AND user_id = ?
+	`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete API key: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return fmt.Errorf("failed to delete API key: %w", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+// ListRoles lists every role with its permissions
+func (s *SQLiteStore) ListRoles(ctx context.Context) ([]*models.Role, error) {
+	var roles []*models.Role
+	err := s.db.SelectContext(ctx, &roles, `
+		SELECT name, description FROM roles
+		ORDER BY name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	if err := loadRolePermissions(ctx, s.db, roles); err != nil {
+		return nil, fmt.Errorf("failed to list role permissions: %w", err)
+	}
+
+	return roles, nil
+}
+
+// ListUserRoles lists the roles granted to a user, with their permissions
+func (s *SQLiteStore) ListUserRoles(ctx context.Context, userID uuid.UUID) ([]*models.Role, error) {
+	var roles []*models.Role
+	err := s.db.SelectContext(ctx, &roles, `
+		SELECT r.name, r.description FROM roles r
+		JOIN user_roles ur ON ur.role_name = r.name
+		WHERE ur.user_id = ?
+		ORDER BY r.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user roles: %w", err)
+	}
+
+	if err := loadRolePermissions(ctx, s.db, roles); err != nil {
+		return nil, fmt.Errorf("failed to list role permissions: %w", err)
+	}
+
+	return roles, nil
+}
+
+// GrantRole grants a role to a user. Granting a role the user already holds
+// does nothing.
+func (s *SQLiteStore) GrantRole(ctx context.Context, userID uuid.UUID, role string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT OR IGNORE INTO user_roles (user_id, role_name, granted_at)
+		VALUES (?, ?, ?)
+	`, userID, role, time.Now())
+
+	if err != nil {
+		return fmt.Errorf("failed to grant role: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRole takes a role away from a user
+func (s *SQLiteStore) RevokeRole(ctx context.Context, userID uuid.UUID, role string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM user_roles
+		WHERE user_id = ? AND role_name = ?
+	`, userID, role)
+
+	if err != nil {
+		return fmt.Errorf("failed to revoke role: %w", err)
+	}
+
+	return nil
+}
+
+// GetChatByID retrieves a chat by ID along with its members and most recent
+// message
+func (s *SQLiteStore) GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	var chat models.Chat
+	err := s.db.GetContext(ctx, &chat, `
+		SELECT * FROM chats
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat by ID: %w", err)
+	}
+
+	members, err := s.ListChatMembers(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	chat.Members = members
+
+	var lastMessage models.Message
+	err = s.db.GetContext(ctx, &lastMessage, `
+		SELECT * FROM messages
+		WHERE chat_id = ? AND is_deleted = false
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, id)
+
+	switch {
+	case err == nil:
+		chat.LastMessage = &lastMessage
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("failed to get last chat message: %w", err)
+	}
+
+	return &chat, nil
+}
+
+// ChatExists reports whether a chat exists, without loading it
+func (s *SQLiteStore) ChatExists(ctx context.Context, id uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.GetContext(ctx, &exists, `
+		SELECT EXISTS(SELECT 1 FROM chats WHERE id = ?)
+	`, id)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check chat exists: %w", err)
+	}
+
+	return exists, nil
+}
+
+// CreateChat creates a new chat and adds its creator as an admin member in a
+// single transaction
+func (s *SQLiteStore) CreateChat(ctx context.Context, chat *models.Chat) error {
+	now := time.Now()
+	chat.CreatedAt = now
+	chat.UpdatedAt = now
+
+	return s.inTx(ctx, func(tx queryer) error {
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO chats (
+				id, name, description, created_by, created_at, updated_at, is_private, is_encrypted, ai_model
+			) VALUES (
+				:id, :name, :description, :created_by, :created_at, :updated_at, :is_private, :is_encrypted, :ai_model
+			)
+		`, chat)
+
+		if err != nil {
+			return fmt.Errorf("failed to create chat: %w", err)
+		}
+
+		// Add creator as admin member
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO chat_members (chat_id, user_id, joined_at, is_admin)
+			VALUES (?, ?, ?, true)
+		`, chat.ID, chat.CreatedBy, now)
+
+		if err != nil {
+			return fmt.Errorf("failed to add creator to chat: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UpdateChat updates an existing chat
+func (s *SQLiteStore) UpdateChat(ctx context.Context, chat *models.Chat) error {
+	chat.UpdatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		UPDATE chats
+		SET name = :name,
+			description = :description,
+			updated_at = :updated_at,
+			is_private = :is_private,
+			is_encrypted = :is_encrypted,
+			ai_model = :ai_model
+		WHERE id = :id
+	`, chat)
+
+	if err != nil {
+		return fmt.Errorf("failed to update chat: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteChat deletes a chat
+func (s *SQLiteStore) DeleteChat(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM chats
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+
+	return nil
+}
+
+// ListChats lists chats for a user with pagination, the user's favorites
+// first and then by most recent activity
+func (s *SQLiteStore) ListChats(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.Chat, error) {
+	var chats []*models.Chat
+	err := s.db.SelectContext(ctx, &chats, `
+		SELECT c.*, cm.is_favorite, cm.is_archived FROM chats c
+		INNER JOIN chat_members cm ON c.id = cm.chat_id
+		WHERE cm.user_id = ?
+		ORDER BY cm.is_favorite DESC, c.updated_at DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chats: %w", err)
+	}
+
+	return chats, nil
+}
+
+// ListChatsFiltered lists a user's chats narrowed down and ordered by filter
+func (s *SQLiteStore) ListChatsFiltered(ctx context.Context, userID uuid.UUID, filter models.ChatFilter) ([]*models.Chat, error) {
+	query, args, err := chatListQuery(chatListDialect{
+		placeholder:  func(int) string { return "?" },
+		nameContains: "instr(lower(c.name), lower(%s)) > 0",
+		notSentBy:    "m.user_id IS NOT cm.user_id",
+	}, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	chats := []*models.Chat{}
+	if err := s.db.SelectContext(ctx, &chats, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list chats: %w", err)
+	}
+
+	return chats, nil
+}
+
+// ListUserChatIDs returns the IDs of every chat a user belongs to
+func (s *SQLiteStore) ListUserChatIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var chatIDs []uuid.UUID
+	err := s.db.SelectContext(ctx, &chatIDs, `
+		SELECT chat_id FROM chat_members
+		WHERE user_id = ?
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user chat IDs: %w", err)
+	}
+
+	return chatIDs, nil
+}
+
+// AddUserToChat adds a user to a chat
+func (s *SQLiteStore) AddUserToChat(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO chat_members (chat_id, user_id, joined_at, is_admin)
+		VALUES (?, ?, ?, ?)
+	`, chatID, userID, time.Now(), isAdmin)
+
+	if err != nil {
+		return fmt.Errorf("failed to add user to chat: %w", err)
+	}
+
+	return nil
+}
+
+// SetChatFavorite marks or unmarks a chat as one of a user's favorites
+func (s *SQLiteStore) SetChatFavorite(ctx context.Context, chatID, userID uuid.UUID, favorite bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE chat_members
+		SET is_favorite = ?
+		WHERE chat_id = ? AND user_id = ?
+	`, favorite, chatID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to set chat favorite: %w", err)
+	}
+
+	return nil
+}
+
+// FavoriteChat marks a chat as one of a user's favorites, unless the user
+// already has limit other favorites. The limit is checked in the same
+// statement that sets the flag, so concurrent requests can't go over it.
+// Favoriting a chat that already is one always succeeds.
+func (s *SQLiteStore) FavoriteChat(ctx context.Context, chatID, userID uuid.UUID, limit int) error {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE chat_members
+		SET is_favorite = true
+		WHERE chat_id = ?1 AND user_id = ?2
+		AND (is_favorite OR (
+			SELECT COUNT(*) FROM chat_members
+			WHERE user_id = ?2 AND is_favorite = true
+		) < ?3)
+	`, chatID, userID, limit)
+
+	if err != nil {
+		return fmt.Errorf("failed to favorite chat: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return ErrFavoriteLimit
+	}
+
+	return nil
+}
+
+// SetChatMemberAdmin grants or revokes a member's admin rights in a chat
+func (s *SQLiteStore) SetChatMemberAdmin(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE chat_members
+		SET is_admin = ?
+		WHERE chat_id = ? AND user_id = ?
+	`, isAdmin, chatID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to set chat member admin: %w", err)
+	}
+
+	return nil
+}
+
+// SetChatArchived archives or unarchives a chat in a user's list
+func (s *SQLiteStore) SetChatArchived(ctx context.Context, chatID, userID uuid.UUID, archived bool) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE chat_members
+		SET is_archived = ?
+		WHERE chat_id = ? AND user_id = ?
+	`, archived, chatID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to set chat archived: %w", err)
+	}
+
+	return nil
+}
+
+// CountFavoriteChats returns how many chats a user has marked as favorites
+func (s *SQLiteStore) CountFavoriteChats(ctx context.Context, userID uuid.UUID) (int, error) {
+	var count int
+	err := s.db.GetContext(ctx, &count, `
+		SELECT COUNT(*) FROM chat_members
+		WHERE user_id = ? AND is_favorite = true
+	`, userID)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count favorite chats: %w", err)
+	}
+
+	return count, nil
+}
+
+// RemoveUserFromChat removes a user from a chat
+func (s *SQLiteStore) RemoveUserFromChat(ctx context.Context, chatID, userID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM chat_members
+		WHERE chat_id = ? AND user_id = ?
+	`, chatID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to remove user from chat: %w", err)
+	}
+
+	return nil
+}
+
+// ListChatMembers lists all members of a chat
+func (s *SQLiteStore) ListChatMembers(ctx context.Context, chatID uuid.UUID) ([]*models.ChatMember, error) {
+	var members []*models.ChatMember
+	err := s.db.SelectContext(ctx, &members, `
+		SELECT * FROM chat_members
+		WHERE chat_id = ?
+	`, chatID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat members: %w", err)
+	}
+
+	return members, nil
+}
+
+// IsChatMember reports whether a user belongs to a chat, without loading
+// the membership
+func (s *SQLiteStore) IsChatMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.db.GetContext(ctx, &exists, `
+		SELECT EXISTS(SELECT 1 FROM chat_members WHERE chat_id = ? AND user_id = ?)
+	`, chatID, userID)
+
+	if err != nil {
+		return false, fmt.Errorf("failed to check chat membership: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetChatMember retrieves a user's membership in a chat, including whether
+// they own it
+func (s *SQLiteStore) GetChatMember(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMember, error) {
+	var member models.ChatMember
+	err := s.db.GetContext(ctx, &member, `
+		SELECT cm.*, c.created_by = cm.user_id AS is_owner
+		FROM chat_members cm
+		INNER JOIN chats c ON c.id = cm.chat_id
+		WHERE cm.chat_id = ? AND cm.user_id = ?
+	`, chatID, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat member: %w", err)
+	}
+
+	return &member, nil
+}
+
+// GetUnreadCounts returns the unread message count for every chat the user
+// belongs to from the per-member counters. Counters that disagree with the
+// member's read marker (the user has read past the chat's last activity) are
+// reset to zero.
+func (s *SQLiteStore) GetUnreadCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		ChatID      uuid.UUID `db:"chat_id"`
+		UnreadCount int       `db:"unread_count"`
+		CaughtUp    bool      `db:"caught_up"`
+	}
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT cm.chat_id, cm.unread_count,
+			(cm.last_read_at IS NOT NULL AND cm.last_read_at >= c.updated_at) AS caught_up
+		FROM chat_members cm
+		INNER JOIN chats c ON c.id = cm.chat_id
+		WHERE cm.user_id = ?
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unread counts: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int, len(rows))
+	var stale []uuid.UUID
+	for _, row := range rows {
+		if row.UnreadCount != 0 && (row.CaughtUp || row.UnreadCount < 0) {
+			stale = append(stale, row.ChatID)
+			counts[row.ChatID] = 0
+			continue
+		}
+		counts[row.ChatID] = row.UnreadCount
+	}
+
+	if len(stale) > 0 {
+		query, args, err := in(`
+			UPDATE chat_members
+			SET unread_count = 0
+			WHERE user_id = ? AND chat_id IN (?)
+		`, stale, userID)
+		if err == nil {
+			_, err = s.db.ExecContext(ctx, query, args...)
+		}
+
+		if err != nil {
+			log.Warn().Err(err).Msg("Failed to reconcile unread counts")
+		}
+	}
+
+	return counts, nil
+}
+
+// MarkChatRead moves a member's read marker forward to upTo and resets their
+// unread counter to the messages after it. A marker already past upTo is left
+// alone.
+func (s *SQLiteStore) MarkChatRead(ctx context.Context, chatID, userID uuid.UUID, upTo time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE chat_members
+		SET last_read_at = ?1,
+			unread_count = (
+				SELECT COUNT(*) FROM messages m
+				WHERE m.chat_id = chat_members.chat_id
+				  AND m.is_deleted = false
+				  AND m.user_id IS NOT chat_members.user_id
+				  AND m.created_at > ?1
+			)
+		WHERE chat_id = ?2 AND user_id = ?3
+		  AND (last_read_at IS NULL OR last_read_at < ?1)
+	`, upTo, chatID, userID)
+
+	if err != nil {
+		return fmt.Errorf("failed to mark chat read: %w", err)
+	}
+
+	return nil
+}
+
+// ListMessageReaders returns up to limit members of a message's chat whose
+// read marker is at or past it, earliest reader first. The author, inactive
+// users, and users who hide their online status are left out.
+func (s *SQLiteStore) ListMessageReaders(ctx context.Context, messageID uuid.UUID, limit int) ([]*models.User, error) {
+	users := []*models.User{}
+	err := s.db.SelectContext(ctx, &users, `
+		SELECT u.* FROM messages m
+		INNER JOIN chat_members cm ON cm.chat_id = m.chat_id
+		INNER JOIN users u ON u.id = cm.user_id
+		LEFT JOIN user_preferences p ON p.user_id = u.id
+		WHERE m.id = ?
+		  AND cm.last_read_at >= m.created_at
+		  AND cm.user_id IS NOT m.user_id
+		  AND u.is_active
+		  AND COALESCE(p.display_online_status, TRUE)
+		ORDER BY cm.last_read_at, u.username
+		LIMIT ?
+	`, messageID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message readers: %w", err)
+	}
+
+	return users, nil
+}
+
+// CountMessagesByUserInChat counts each user's messages in a chat, leaving
+// out deleted messages. Users with no messages are not in the map.
+func (s *SQLiteStore) CountMessagesByUserInChat(ctx context.Context, chatID uuid.UUID) (map[uuid.UUID]int, error) {
+	var rows []struct {
+		UserID       uuid.UUID `db:"user_id"`
+		MessageCount int       `db:"message_count"`
+	}
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT user_id, COUNT(*) AS message_count
+		FROM messages
+		WHERE chat_id = ? AND is_deleted = false AND user_id IS NOT NULL
+		GROUP BY user_id
+	`, chatID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages by user: %w", err)
+	}
+
+	counts := make(map[uuid.UUID]int, len(rows))
+	for _, row := range rows {
+		counts[row.UserID] = row.MessageCount
+	}
+
+	return counts, nil
+}
+
+// GetMessageByID retrieves a message by ID
+func (s *SQLiteStore) GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
+	var message models.Message
+	err := s.db.GetContext(ctx, &message, `
+		SELECT * FROM messages
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message by ID: %w", err)
+	}
+
+	return &message, nil
+}
+
+// GetMessagesByIDs retrieves several messages in one query, keyed by ID. IDs
+// with no matching message are left out of the map.
+func (s *SQLiteStore) GetMessagesByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Message, error) {
+	messagesByID := make(map[uuid.UUID]*models.Message, len(ids))
+	if len(ids) == 0 {
+		return messagesByID, nil
+	}
+
+	query, args, err := in(`
+		SELECT * FROM messages
+		WHERE id IN (?)
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages by IDs: %w", err)
+	}
+
+	var messages []*models.Message
+	if err := s.db.SelectContext(ctx, &messages, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get messages by IDs: %w", err)
+	}
+
+	for _, message := range messages {
+		messagesByID[message.ID] = message
+	}
+
+	return messagesByID, nil
+}
+
+// CreateMessage creates a new message, increments the unread count of every
+// chat member except the sender and bumps the chat's updated_at, all in one
+// transaction so no read marker can land between them
+func (s *SQLiteStore) CreateMessage(ctx context.Context, message *models.Message) error {
+	now := time.Now()
+	message.CreatedAt = now
+	message.UpdatedAt = now
+
+	return s.inTx(ctx, func(tx queryer) error {
+		// Replies sit one level below their target
+		message.Depth = 0
+		if message.ReplyTo != nil {
+			err := tx.GetContext(ctx, &message.Depth, `
+				SELECT depth + 1 FROM messages
+				WHERE id = ? AND chat_id = ?
+			`, *message.ReplyTo, message.ChatID)
+
+			if err != nil {
+				return fmt.Errorf("failed to get reply target depth: %w", err)
+			}
+		}
+
+		_, err := tx.NamedExecContext(ctx, `
+			INSERT INTO messages (
+				id, chat_id, user_id, content, content_encrypted, created_at, updated_at,
+				is_edited, is_deleted, reply_to, depth, is_ai_generated, forwarded_from
+			) VALUES (
+				:id, :chat_id, :user_id, :content, :content_encrypted, :created_at, :updated_at,
+				:is_edited, :is_deleted, :reply_to, :depth, :is_ai_generated, :forwarded_from
+			)
+		`, message)
+
+		if err != nil {
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE chat_members
+			SET unread_count = unread_count + 1
+			WHERE chat_id = ? AND user_id IS NOT ?
+		`, message.ChatID, message.UserID)
+
+		if err != nil {
+			return fmt.Errorf("failed to increment unread counts: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE chats
+			SET updated_at = ?
+			WHERE id = ?
+		`, now, message.ChatID)
+
+		if err != nil {
+			return fmt.Errorf("failed to update chat timestamp: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// UpdateMessage updates an existing message, recording the content it
+// replaces in the message's edit history. The caller decides whether the
+// edit marks the message as edited.
+func (s *SQLiteStore) UpdateMessage(ctx context.Context, message *models.Message) error {
+	message.UpdatedAt = time.Now()
+
+	return s.inTx(ctx, func(tx queryer) error {
+		// Keep the content being replaced, unless the edit leaves it as it is
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO message_edits (id, message_id, content, content_encrypted, edited_at)
+			SELECT ?1, id, content, content_encrypted, ?2 FROM messages
+			WHERE id = ?3 AND (content <> ?4 OR content_encrypted <> ?5)
+		`, uuid.New(), message.UpdatedAt, message.ID, message.Content, message.ContentEncrypted)
+
+		if err != nil {
+			return fmt.Errorf("failed to record message edit: %w", err)
+		}
+
+		_, err = tx.NamedExecContext(ctx, `
+			UPDATE messages
+			SET content = :content,
+				content_encrypted = :content_encrypted,
+				updated_at = :updated_at,
+				is_edited = :is_edited,
+				is_deleted = :is_deleted
+			WHERE id = :id
+		`, message)
+
+		if err != nil {
+			return fmt.Errorf("failed to update message: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ListMessageEdits returns the earlier versions of a message, oldest first
+func (s *SQLiteStore) ListMessageEdits(ctx context.Context, messageID uuid.UUID) ([]*models.MessageEdit, error) {
+	edits := []*models.MessageEdit{}
+	err := s.db.SelectContext(ctx, &edits, `
+		SELECT * FROM message_edits
+		WHERE message_id = ?
+		ORDER BY edited_at
+	`, messageID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message edits: %w", err)
+	}
+
+	return edits, nil
+}
+
+// DeleteMessage marks a message as deleted, taking it off the unread counts
+// of members who hadn't read it yet
+func (s *SQLiteStore) DeleteMessage(ctx context.Context, id uuid.UUID) error {
+	return s.inTx(ctx, func(tx queryer) error {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE chat_members
+			SET unread_count = unread_count - 1
+			WHERE unread_count > 0
+			  AND EXISTS (
+				SELECT 1 FROM messages m
+				WHERE m.id = ?
+				  AND m.is_deleted = false
+				  AND m.chat_id = chat_members.chat_id
+				  AND m.user_id IS NOT chat_members.user_id
+				  AND (chat_members.last_read_at IS NULL OR m.created_at > chat_members.last_read_at)
+			  )
+		`, id)
+
+		if err != nil {
+			return fmt.Errorf("failed to decrement unread counts: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE messages
+			SET is_deleted = true,
+				updated_at = ?
+			WHERE id = ?
+		`, time.Now(), id)
+
+		if err != nil {
+			return fmt.Errorf("failed to delete message: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// ListChatMessages lists messages for a chat with pagination, leaving out
+// deleted messages unless includeDeleted is set
+func (s *SQLiteStore) ListChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int, includeDeleted bool) ([]*models.Message, error) {
+	var messages []*models.Message
+	err := s.db.SelectContext(ctx, &messages, `
+		SELECT * FROM messages
+		WHERE chat_id = ? AND (? OR is_deleted = false)
+		ORDER BY created_at DESC
+		LIMIT ? OFFSET ?
+	`, chatID, includeDeleted, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chat messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// ListMessagesAfter lists messages in any of the given chats that come after
+// a cursor message, given by its creation time and ID, oldest first. It is
+// used to replay what a reconnecting client missed.
+func (s *SQLiteStore) ListMessagesAfter(ctx context.Context, chatIDs []uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]*models.Message, error) {
+	messages := []*models.Message{}
+	if len(chatIDs) == 0 {
+		return messages, nil
+	}
+
+	// The chat IDs come first here, so the in helper doesn't fit
+	query, args, err := sqlx.In(`
+		SELECT * FROM messages
+		WHERE chat_id IN (?)
+		  AND (created_at > ? OR (created_at = ? AND id > ?))
+		ORDER BY created_at, id
+		LIMIT ?
+	`, chatIDs, after, after, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages after cursor: %w", err)
+	}
+
+	if err := s.db.SelectContext(ctx, &messages, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list messages after cursor: %w", err)
+	}
+
+	return messages, nil
+}
+
+// SearchMessages searches the messages in chats the user belongs to, newest
+// first. SQLite has no built-in full-text ranking, so this is a
+// case-insensitive substring match. Deleted and encrypted messages are never
+// matched, and a blank query matches nothing.
+func (s *SQLiteStore) SearchMessages(ctx context.Context, userID uuid.UUID, query string, limit, offset int) ([]*models.Message, error) {
+	messages := []*models.Message{}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return messages, nil
+	}
+
+	err := s.db.SelectContext(ctx, &messages, `
+		SELECT m.* FROM messages m
+		INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ?
+		WHERE m.is_deleted = false
+		AND m.content_encrypted = false
+		AND instr(lower(m.content), lower(?)) > 0
+		ORDER BY m.created_at DESC
+		LIMIT ? OFFSET ?
+	`, userID, query, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// ListReplyChain returns a message and up to limit-1 of its reply ancestors in
+// chronological order. Deleted messages are skipped and the depth bound keeps
+// a malformed reply cycle from recursing forever.
+func (s *SQLiteStore) ListReplyChain(ctx context.Context, messageID uuid.UUID, limit int) ([]*models.Message, error) {
+	var messages []*models.Message
+	err := s.db.SelectContext(ctx, &messages, `
+		WITH RECURSIVE chain (id, reply_to, depth) AS (
+			SELECT id, reply_to, 1 FROM messages
+			WHERE id = ?
+			UNION ALL
+			SELECT m.id, m.reply_to, c.depth + 1 FROM messages m
+			INNER JOIN chain c ON m.id = c.reply_to
+			WHERE c.depth < ?
+		)
+		SELECT m.* FROM messages m
+		INNER JOIN chain c ON m.id = c.id
+		WHERE m.is_deleted = false
+		ORDER BY m.created_at
+	`, messageID, limit)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reply chain: %w", err)
+	}
+
+	return messages, nil
+}
+
+// ListThreadMessages returns a message and every message whose reply chain
+// leads back to it, in chronological order. Each branch tracks the messages it
+// has visited so a malformed reply cycle can't recurse forever.
+func (s *SQLiteStore) ListThreadMessages(ctx context.Context, rootMessageID uuid.UUID, limit, offset int) ([]*models.Message, error) {
+	var messages []*models.Message
+	err := s.db.SelectContext(ctx, &messages, `
+		WITH RECURSIVE thread (id, path) AS (
+			SELECT id, ',' || id || ',' FROM messages
+			WHERE id = ?
+			UNION ALL
+			SELECT m.id, t.path || m.id || ',' FROM messages m
+			INNER JOIN thread t ON m.reply_to = t.id
+			WHERE instr(t.path, ',' || m.id || ',') = 0
+		)
+		SELECT m.* FROM messages m
+		INNER JOIN thread t ON m.id = t.id
+		WHERE m.is_deleted = false
+		ORDER BY m.created_at
+		LIMIT ? OFFSET ?
+	`, rootMessageID, limit, offset)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list thread messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// GetDraft retrieves a user's draft for a chat
+func (s *SQLiteStore) GetDraft(ctx context.Context, userID, chatID uuid.UUID) (*models.MessageDraft, error) {
+	var draft models.MessageDraft
+	err := s.db.GetContext(ctx, &draft, `
+		SELECT * FROM message_drafts
+		WHERE user_id = ? AND chat_id = ?
+	`, userID, chatID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get draft: %w", err)
+	}
+
+	return &draft, nil
+}
+
+// SaveDraft creates or replaces a user's draft for a chat
+func (s *SQLiteStore) SaveDraft(ctx context.Context, draft *models.MessageDraft) error {
+	draft.UpdatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO message_drafts (user_id, chat_id, content, updated_at)
+		VALUES (:user_id, :chat_id, :content, :updated_at)
+		ON CONFLICT (user_id, chat_id) DO UPDATE
+		SET content = excluded.content,
+			updated_at = excluded.updated_at
+	`, draft)
+
+	if err != nil {
+		return fmt.Errorf("failed to save draft: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDraft deletes a user's draft for a chat
+func (s *SQLiteStore) DeleteDraft(ctx context.Context, userID, chatID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM message_drafts
+		WHERE user_id = ? AND chat_id = ?
+	`, userID, chatID)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete draft: %w", err)
+	}
+
+	return nil
+}
+
+// ListDrafts lists all of a user's drafts
+func (s *SQLiteStore) ListDrafts(ctx context.Context, userID uuid.UUID) ([]*models.MessageDraft, error) {
+	var drafts []*models.MessageDraft
+	err := s.db.SelectContext(ctx, &drafts, `
+		SELECT * FROM message_drafts
+		WHERE user_id = ?
+		ORDER BY updated_at DESC
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list drafts: %w", err)
+	}
+
+	return drafts, nil
+}
+
+// AddReaction adds a user's reaction to a message. Adding the same emoji
+// twice is a no-op.
+func (s *SQLiteStore) AddReaction(ctx context.Context, reaction *models.MessageReaction) error {
+	reaction.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO message_reactions (message_id, user_id, emoji, created_at)
+		VALUES (:message_id, :user_id, :emoji, :created_at)
+		ON CONFLICT (message_id, user_id, emoji) DO NOTHING
+	`, reaction)
+
+	if err != nil {
+		return fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveReaction removes a user's reaction from a message, if they left one
+func (s *SQLiteStore) RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM message_reactions
+		WHERE message_id = ? AND user_id = ? AND emoji = ?
+	`, messageID, userID, emoji)
+
+	if err != nil {
+		return fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListReactions lists the reactions on a message, oldest first
+func (s *SQLiteStore) ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error) {
+	var reactions []*models.MessageReaction
+	err := s.db.SelectContext(ctx, &reactions, `
+		SELECT * FROM message_reactions
+		WHERE message_id = ?
+		ORDER BY created_at
+	`, messageID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reactions: %w", err)
+	}
+
+	return reactions, nil
+}
+
+// CountReactions counts the reactions on several messages in one query,
+// grouped by emoji. Messages without reactions are left out of the map.
+func (s *SQLiteStore) CountReactions(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]*models.ReactionCount, error) {
+	counts := make(map[uuid.UUID][]*models.ReactionCount)
+	if len(messageIDs) == 0 {
+		return counts, nil
+	}
+
+	query, args, err := in(`
+		SELECT message_id, emoji, COUNT(*) AS count
+		FROM message_reactions
+		WHERE message_id IN (?)
+		GROUP BY message_id, emoji
+		ORDER BY message_id, MIN(created_at)
+	`, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+
+	var rows []struct {
+		MessageID uuid.UUID `db:"message_id"`
+		models.ReactionCount
+	}
+	if err := s.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+
+	for _, row := range rows {
+		count := row.ReactionCount
+		counts[row.MessageID] = append(counts[row.MessageID], &count)
+	}
+
+	return counts, nil
+}
+
+// GetDirectMessageByID retrieves a direct message by ID
+func (s *SQLiteStore) GetDirectMessageByID(ctx context.Context, id uuid.UUID) (*models.DirectMessage, error) {
+	var message models.DirectMessage
+	err := s.db.GetContext(ctx, &message, `
+		SELECT * FROM direct_messages
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get direct message by ID: %w", err)
+	}
+
+	return &message, nil
+}
+
+// CreateDirectMessage creates a new direct message
+func (s *SQLiteStore) CreateDirectMessage(ctx context.Context, message *models.DirectMessage) error {
+	now := time.Now()
+	message.CreatedAt = now
+	message.UpdatedAt = now
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO direct_messages (
+			id, sender_id, recipient_id, content, content_encrypted, created_at, updated_at,
+			is_edited, is_deleted, is_read, reply_to, is_ai_generated
+		) VALUES (
+			:id, :sender_id, :recipient_id, :content, :content_encrypted, :created_at, :updated_at,
+			:is_edited, :is_deleted, :is_read, :reply_to, :is_ai_generated
+		)
+	`, message)
+
+	if err != nil {
+		return fmt.Errorf("failed to create direct message: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateDirectMessage updates an existing direct message. The caller decides
+// whether the edit marks the message as edited.
+func (s *SQLiteStore) UpdateDirectMessage(ctx context.Context, message *models.DirectMessage) error {
+	message.UpdatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		UPDATE direct_messages
+		SET content = :content,
+			content_encrypted = :content_encrypted,
+			updated_at = :updated_at,
+			is_edited = :is_edited,
+			is_deleted = :is_deleted,
+			is_read = :is_read
+		WHERE id = :id
+	`, message)
+
+	if err != nil {
+		return fmt.Errorf("failed to update direct message: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDirectMessage marks a direct message as deleted
+func (s *SQLiteStore) DeleteDirectMessage(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE direct_messages
+		SET is_deleted = true,
+			updated_at = ?
+		WHERE id = ?
+	`, time.Now(), id)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete direct message: %w", err)
+	}
+
+	return nil
+}
+
+// ListDirectMessages lists direct messages between two users with pagination,
+// leaving out deleted messages unless includeDeleted is set
+func (s *SQLiteStore) ListDirectMessages(ctx context.Context, userID1, userID2 uuid.UUID, limit, offset int, includeDeleted bool) ([]*models.DirectMessage, error) {
+	var messages []*models.DirectMessage
+	err := s.db.SelectContext(ctx, &messages, `
+		SELECT * FROM direct_messages
+		WHERE ((sender_id = ?1 AND recipient_id = ?2)
+		    OR (sender_id = ?2 AND recipient_id = ?1))
+		  AND (?5 OR is_deleted = false)
+		ORDER BY created_at DESC
+		LIMIT ?3 OFFSET ?4
+	`, userID1, userID2, limit, offset, includeDeleted)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list direct messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// GetDMConversation returns the conversation between two users as seen by
+// userID: the latest message either way and how many messages from otherID
+// userID hasn't read
+func (s *SQLiteStore) GetDMConversation(ctx context.Context, userID, otherID uuid.UUID) (*models.DMConversation, error) {
+	conversation := models.NewDMConversation(userID, otherID)
+
+	var lastMessage models.DirectMessage
+	err := s.db.GetContext(ctx, &lastMessage, `
+		SELECT * FROM direct_messages
+		WHERE ((sender_id = ?1 AND recipient_id = ?2)
+		    OR (sender_id = ?2 AND recipient_id = ?1))
+		  AND is_deleted = false
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID, otherID)
+
+	switch {
+	case err == nil:
+		conversation.LastMessage = &lastMessage
+	case err != sql.ErrNoRows:
+		return nil, fmt.Errorf("failed to get last direct message: %w", err)
+	}
+
+	err = s.db.GetContext(ctx, &conversation.UnreadCount, `
+		SELECT COUNT(*) FROM direct_messages
+		WHERE sender_id = ?2 AND recipient_id = ?1
+		  AND is_read = false AND is_deleted = false
+	`, userID, otherID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to count unread direct messages: %w", err)
+	}
+
+	return conversation, nil
+}
+
+// MarkDirectMessagesRead marks every unread message from sender to recipient
+// as read
+func (s *SQLiteStore) MarkDirectMessagesRead(ctx context.Context, recipientID, senderID uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE direct_messages
+		SET is_read = true
+		WHERE recipient_id = ? AND sender_id = ? AND is_read = false
+	`, recipientID, senderID)
+
+	if err != nil {
+		return fmt.Errorf("failed to mark direct messages read: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDirectMessagesReadUpTo marks the unread messages from sender to
+// recipient sent at or before upTo as read
+func (s *SQLiteStore) MarkDirectMessagesReadUpTo(ctx context.Context, recipientID, senderID uuid.UUID, upTo time.Time) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE direct_messages
+		SET is_read = true
+		WHERE recipient_id = ? AND sender_id = ? AND is_read = false
+		  AND created_at <= ?
+	`, recipientID, senderID, upTo)
+
+	if err != nil {
+		return fmt.Errorf("failed to mark direct messages read: %w", err)
+	}
+
+	return nil
+}
+
+// GetAttachmentByID retrieves an attachment by ID
+func (s *SQLiteStore) GetAttachmentByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := s.db.GetContext(ctx, &attachment, `
+		SELECT * FROM attachments
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment by ID: %w", err)
+	}
+
+	return &attachment, nil
+}
+
+// CreateAttachment creates a new attachment
+func (s *SQLiteStore) CreateAttachment(ctx context.Context, attachment *models.Attachment) error {
+	attachment.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO attachments (
+			id, message_id, direct_message_id, file_name, file_path,
+			file_size, file_type, is_encrypted, created_at
+		) VALUES (
+			:id, :message_id, :direct_message_id, :file_name, :file_path,
+			:file_size, :file_type, :is_encrypted, :created_at
+		)
+	`, attachment)
+
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAttachment deletes an attachment
+func (s *SQLiteStore) DeleteAttachment(ctx context.Context, id uuid.UUID) error {
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM attachments
+		WHERE id = ?
+	`, id)
+
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment: %w", err)
+	}
+
+	return nil
+}
+
+// ListMessageAttachments lists attachments for a message
+func (s *SQLiteStore) ListMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	err := s.db.SelectContext(ctx, &attachments, `
+		SELECT * FROM attachments
+		WHERE message_id = ?
+		ORDER BY created_at
+	`, messageID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list message attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// ListAttachmentsByMessageIDs lists the attachments of several messages in
+// one query, keyed by message ID, oldest first
+func (s *SQLiteStore) ListAttachmentsByMessageIDs(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]*models.Attachment, error) {
+	byMessage := make(map[uuid.UUID][]*models.Attachment)
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	query, args, err := in(`
+		SELECT * FROM attachments
+		WHERE message_id IN (?)
+		ORDER BY created_at
+	`, messageIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list attachments by message IDs: %w", err)
+	}
+
+	var attachments []*models.Attachment
+	if err := s.db.SelectContext(ctx, &attachments, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list attachments by message IDs: %w", err)
+	}
+
+	for _, attachment := range attachments {
+		byMessage[*attachment.MessageID] = append(byMessage[*attachment.MessageID], attachment)
+	}
+
+	return byMessage, nil
+}
+
+// ListDirectMessageAttachments lists attachments for a direct message
+func (s *SQLiteStore) ListDirectMessageAttachments(ctx context.Context, directMessageID uuid.UUID) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	err := s.db.SelectContext(ctx, &attachments, `
+		SELECT * FROM attachments
+		WHERE direct_message_id = ?
+		ORDER BY created_at
+	`, directMessageID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list direct message attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// DeleteChatAttachments deletes the attachment rows for every message in a
+// chat and returns them, so their files can be removed from storage
+func (s *SQLiteStore) DeleteChatAttachments(ctx context.Context, chatID uuid.UUID) ([]*models.Attachment, error) {
+	var attachments []*models.Attachment
+	err := s.inTx(ctx, func(tx queryer) error {
+		err := tx.SelectContext(ctx, &attachments, `
+			SELECT a.* FROM attachments a
+			INNER JOIN messages m ON a.message_id = m.id
+			WHERE m.chat_id = ?
+		`, chatID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			DELETE FROM attachments
+			WHERE message_id IN (SELECT id FROM messages WHERE chat_id = ?)
+		`, chatID)
+		return err
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete chat attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// RecordAIUsage stores the tokens an AI request used
+func (s *SQLiteStore) RecordAIUsage(ctx context.Context, usage *models.AIUsage) error {
+	if usage.ID == uuid.Nil {
+		usage.ID = uuid.New()
+	}
+	usage.CreatedAt = time.Now()
+
+	_, err := s.db.NamedExecContext(ctx, `
+		INSERT INTO ai_usage (id, user_id, model, prompt_tokens, completion_tokens, total_tokens, created_at)
+		VALUES (:id, :user_id, :model, :prompt_tokens, :completion_tokens, :total_tokens, :created_at)
+	`, usage)
+
+	if err != nil {
+		return fmt.Errorf("failed to record AI usage: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserTokenUsage returns the total tokens a user's AI requests have used
+// since a time
+func (s *SQLiteStore) GetUserTokenUsage(ctx context.Context, userID uuid.UUID, since time.Time) (int, error) {
+	var total int
+	err := s.db.GetContext(ctx, &total, `
+		SELECT COALESCE(SUM(total_tokens), 0) FROM ai_usage
+		WHERE user_id = ? AND created_at >= ?
+	`, userID, since)
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user token usage: %w", err)
+	}
+
+	return total, nil
+}
+
+// SaveMessageEmbedding stores a message's embedding, replacing any earlier
+// one
+func (s *SQLiteStore) SaveMessageEmbedding(ctx context.Context, messageID uuid.UUID, model string, embedding []float32) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO message_embeddings (message_id, model, embedding, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (message_id) DO UPDATE
+		SET model = excluded.model, embedding = excluded.embedding, created_at = excluded.created_at
+	`, messageID, model, formatVector(embedding), time.Now())
+
+	if err != nil {
+		return fmt.Errorf("failed to save message embedding: %w", err)
+	}
+
+	return nil
+}
+
+// SemanticSearchMessages returns the messages in the user's chats closest in
+// meaning to a query embedding, nearest first by cosine distance. Without
+// pgvector every embedded message in the user's chats is compared in turn,
+// which is fine at development scale.
+func (s *SQLiteStore) SemanticSearchMessages(ctx context.Context, userID uuid.UUID, queryEmbedding []float32, limit int) ([]*models.Message, error) {
+	var rows []struct {
+		models.Message
+		Embedding string `db:"embedding"`
+	}
+	err := s.db.SelectContext(ctx, &rows, `
+		SELECT m.*, e.embedding FROM messages m
+		INNER JOIN chat_members cm ON cm.chat_id = m.chat_id AND cm.user_id = ?
+		INNER JOIN message_embeddings e ON e.message_id = m.id
+		WHERE m.is_deleted = false
+		AND m.content_encrypted = false
+	`, userID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages semantically: %w", err)
+	}
+
+	type ranked struct {
+		message  *models.Message
+		distance float64
+	}
+	results := make([]ranked, 0, len(rows))
+	for i := range rows {
+		embedding, err := parseVector(rows[i].Embedding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search messages semantically: %w", err)
+		}
+		results = append(results, ranked{&rows[i].Message, cosineDistance(queryEmbedding, embedding)})
+	}
+	sort.SliceStable(results, func(i, j int) bool { return results[i].distance < results[j].distance })
+
+	messages := make([]*models.Message, 0, min(limit, len(results)))
+	for _, r := range results[:min(limit, len(results))] {
+		messages = append(messages, r.message)
+	}
+
+	return messages, nil
+}
+
+// parseSQLiteTime parses a timestamp the driver returned as text, which
+// happens when an expression such as MAX() loses the column type
+func parseSQLiteTime(value string) time.Time {
+	value = strings.TrimSuffix(value, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SQLiteTransaction is a SQLiteStore bound to a transaction. Every Store
+// method runs inside the transaction until it is committed or rolled back.
+type SQLiteTransaction struct {
+	SQLiteStore
+	tx *sqlx.Tx
+}
+
+// Commit commits the transaction
+func (t *SQLiteTransaction) Commit() error {
+	return t.tx.Commit()
+}
+
+// Rollback rolls back the transaction
+func (t *SQLiteTransaction) Rollback() error {
+	return t.tx.Rollback()
+}
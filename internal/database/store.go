@@ -2,6 +2,11 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 
@@ -12,48 +17,131 @@ import (
 type Store interface {
 	// User operations
 	GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error)
+	GetUsersByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error)
+	GetUserPreferences(ctx context.Context, userID uuid.UUID) (*models.UserPreferences, error)
+	UserExists(ctx context.Context, id uuid.UUID) (bool, error)
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	CreateUser(ctx context.Context, user *models.User) error
 	UpdateUser(ctx context.Context, user *models.User) error
+	IncrementFailedLogins(ctx context.Context, id uuid.UUID) (int, error)
+	LockUser(ctx context.Context, id uuid.UUID, until time.Time) error
+	ResetFailedLogins(ctx context.Context, id uuid.UUID) error
 	DeleteUser(ctx context.Context, id uuid.UUID) error
 	ListUsers(ctx context.Context, limit, offset int) ([]*models.User, error)
+	ListRecentContacts(ctx context.Context, userID uuid.UUID, limit int) ([]*models.RecentContact, error)
+	ListUsersShowingOnlineStatus(ctx context.Context, ids []uuid.UUID) ([]*models.User, error)
+
+	// Refresh token operations
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	ConsumeRefreshToken(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	CreatePasswordReset(ctx context.Context, reset *models.PasswordReset) error
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (*models.PasswordReset, error)
+	DeletePasswordResets(ctx context.Context, userID uuid.UUID) error
+
+	// API key operations
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, error)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id uuid.UUID) error
+
+	// Role operations
+	ListRoles(ctx context.Context) ([]*models.Role, error)
+	ListUserRoles(ctx context.Context, userID uuid.UUID) ([]*models.Role, error)
+	GrantRole(ctx context.Context, userID uuid.UUID, role string) error
+	RevokeRole(ctx context.Context, userID uuid.UUID, role string) error
 
 	// Chat operations
 	GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error)
+	ChatExists(ctx context.Context, id uuid.UUID) (bool, error)
 	CreateChat(ctx context.Context, chat *models.Chat) error
 	UpdateChat(ctx context.Context, chat *models.Chat) error
 	DeleteChat(ctx context.Context, id uuid.UUID) error
 	ListChats(ctx context.Context, userID uuid.UUID, limit, offset int) ([]*models.Chat, error)
+	ListChatsFiltered(ctx context.Context, userID uuid.UUID, filter models.ChatFilter) ([]*models.Chat, error)
+	ListUserChatIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
 
 	// Chat member operations
 	AddUserToChat(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error
 	RemoveUserFromChat(ctx context.Context, chatID, userID uuid.UUID) error
 	ListChatMembers(ctx context.Context, chatID uuid.UUID) ([]*models.ChatMember, error)
+	IsChatMember(ctx context.Context, chatID, userID uuid.UUID) (bool, error)
+	GetChatMember(ctx context.Context, chatID, userID uuid.UUID) (*models.ChatMember, error)
+	SetChatFavorite(ctx context.Context, chatID, userID uuid.UUID, favorite bool) error
+	FavoriteChat(ctx context.Context, chatID, userID uuid.UUID, limit int) error
+	SetChatMemberAdmin(ctx context.Context, chatID, userID uuid.UUID, isAdmin bool) error
+	SetChatArchived(ctx context.Context, chatID, userID uuid.UUID, archived bool) error
+	CountFavoriteChats(ctx context.Context, userID uuid.UUID) (int, error)
+
+	// Unread count operations
+	GetUnreadCounts(ctx context.Context, userID uuid.UUID) (map[uuid.UUID]int, error)
+	MarkChatRead(ctx context.Context, chatID, userID uuid.UUID, upTo time.Time) error
+	ListMessageReaders(ctx context.Context, messageID uuid.UUID, limit int) ([]*models.User, error)
+	CountMessagesByUserInChat(ctx context.Context, chatID uuid.UUID) (map[uuid.UUID]int, error)
 
 	// Message operations
 	GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error)
+	GetMessagesByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Message, error)
 	CreateMessage(ctx context.Context, message *models.Message) error
 	UpdateMessage(ctx context.Context, message *models.Message) error
+	ListMessageEdits(ctx context.Context, messageID uuid.UUID) ([]*models.MessageEdit, error)
 	DeleteMessage(ctx context.Context, id uuid.UUID) error
-	ListChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int) ([]*models.Message, error)
+	ListChatMessages(ctx context.Context, chatID uuid.UUID, limit, offset int, includeDeleted bool) ([]*models.Message, error)
+	ListMessagesAfter(ctx context.Context, chatIDs []uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]*models.Message, error)
+	ListReplyChain(ctx context.Context, messageID uuid.UUID, limit int) ([]*models.Message, error)
+	ListThreadMessages(ctx context.Context, rootMessageID uuid.UUID, limit, offset int) ([]*models.Message, error)
+	SearchMessages(ctx context.Context, userID uuid.UUID, query string, limit, offset int) ([]*models.Message, error)
+
+	// Draft operations
+	GetDraft(ctx context.Context, userID, chatID uuid.UUID) (*models.MessageDraft, error)
+	SaveDraft(ctx context.Context, draft *models.MessageDraft) error
+	DeleteDraft(ctx context.Context, userID, chatID uuid.UUID) error
+	ListDrafts(ctx context.Context, userID uuid.UUID) ([]*models.MessageDraft, error)
+
+	// Reaction operations
+	AddReaction(ctx context.Context, reaction *models.MessageReaction) error
+	RemoveReaction(ctx context.Context, messageID, userID uuid.UUID, emoji string) error
+	ListReactions(ctx context.Context, messageID uuid.UUID) ([]*models.MessageReaction, error)
+	CountReactions(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]*models.ReactionCount, error)
 
 	// Direct message operations
 	GetDirectMessageByID(ctx context.Context, id uuid.UUID) (*models.DirectMessage, error)
 	CreateDirectMessage(ctx context.Context, message *models.DirectMessage) error
 	UpdateDirectMessage(ctx context.Context, message *models.DirectMessage) error
 	DeleteDirectMessage(ctx context.Context, id uuid.UUID) error
-	ListDirectMessages(ctx context.Context, userID1, userID2 uuid.UUID, limit, offset int) ([]*models.DirectMessage, error)
+	ListDirectMessages(ctx context.Context, userID1, userID2 uuid.UUID, limit, offset int, includeDeleted bool) ([]*models.DirectMessage, error)
+	GetDMConversation(ctx context.Context, userID, otherID uuid.UUID) (*models.DMConversation, error)
+	MarkDirectMessagesRead(ctx context.Context, recipientID, senderID uuid.UUID) error
+	MarkDirectMessagesReadUpTo(ctx context.Context, recipientID, senderID uuid.UUID, upTo time.Time) error
 
 	// Attachment operations
 	GetAttachmentByID(ctx context.Context, id uuid.UUID) (*models.Attachment, error)
 	CreateAttachment(ctx context.Context, attachment *models.Attachment) error
 	DeleteAttachment(ctx context.Context, id uuid.UUID) error
 	ListMessageAttachments(ctx context.Context, messageID uuid.UUID) ([]*models.Attachment, error)
+	ListAttachmentsByMessageIDs(ctx context.Context, messageIDs []uuid.UUID) (map[uuid.UUID][]*models.Attachment, error)
 	ListDirectMessageAttachments(ctx context.Context, directMessageID uuid.UUID) ([]*models.Attachment, error)
+	DeleteChatAttachments(ctx context.Context, chatID uuid.UUID) ([]*models.Attachment, error)
+
+	// AI usage operations
+	RecordAIUsage(ctx context.Context, usage *models.AIUsage) error
+	GetUserTokenUsage(ctx context.Context, userID uuid.UUID, since time.Time) (int, error)
+
+	// Message embedding operations
+	SaveMessageEmbedding(ctx context.Context, messageID uuid.UUID, model string, embedding []float32) error
+	SemanticSearchMessages(ctx context.Context, userID uuid.UUID, queryEmbedding []float32, limit int) ([]*models.Message, error)
 
 	// Transaction support
 	Begin() (Transaction, error)
+
+	// Ping checks that the database is reachable
+	Ping(ctx context.Context) error
+
+	// Stats reports connection pool statistics
+	Stats() sql.DBStats
+
+	// Close releases the database connection
+	Close() error
 }
 
 // Transaction represents a database transaction
@@ -62,3 +150,132 @@ type Transaction interface {
 	Commit() error
 	Rollback() error
 }
+
+// WithTx runs fn inside a transaction, committing if it returns nil and
+// rolling back if it returns an error or panics
+func WithTx(store Store, fn func(tx Transaction) error) error {
+	tx, err := store.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// loadRolePermissions fills in the permissions of roles. The permission table
+// is small, so it is read whole.
+func loadRolePermissions(ctx context.Context, q queryer, roles []*models.Role) error {
+	var rows []struct {
+		RoleName   string `db:"role_name"`
+		Permission string `db:"permission"`
+	}
+	err := q.SelectContext(ctx, &rows, `
+		SELECT role_name, permission FROM role_permissions
+		ORDER BY permission
+	`)
+	if err != nil {
+		return err
+	}
+
+	byName := make(map[string]*models.Role, len(roles))
+	for _, role := range roles {
+		role.Permissions = []string{}
+		byName[role.Name] = role
+	}
+	for _, row := range rows {
+		if role, ok := byName[row.RoleName]; ok {
+			role.Permissions = append(role.Permissions, row.Permission)
+		}
+	}
+
+	return nil
+}
+
+// ErrFavoriteLimit is returned by FavoriteChat when the user already has as
+// many favorite chats as allowed
+var ErrFavoriteLimit = errors.New("favorite chat limit reached")
+
+// ErrInvalidChatSort is returned when a chat list asks for an unknown sort
+var ErrInvalidChatSort = errors.New("invalid chat sort")
+
+// chatSortOrders maps chat list sorts to their ORDER BY clauses. Only sorts
+// listed here are accepted, so the sort never puts caller input in the query.
+var chatSortOrders = map[string]string{
+	"":                     "cm.is_favorite DESC, c.updated_at DESC",
+	models.ChatSortRecent:  "cm.is_favorite DESC, c.updated_at DESC",
+	models.ChatSortName:    "lower(c.name), c.id",
+	models.ChatSortCreated: "c.created_at DESC, c.id",
+}
+
+// chatListDialect is the SQL that differs between stores in a filtered chat
+// list query
+type chatListDialect struct {
+	// placeholder returns the bind parameter for the nth argument, from 1
+	placeholder func(n int) string
+	// nameContains is a condition format matching c.name against the bind
+	// parameter it is given, ignoring case
+	nameContains string
+	// notSentBy is the condition that message m wasn't sent by member cm
+	notSentBy string
+}
+
+// chatListQuery composes the query listing a user's chats through filter.
+// Every value from the filter is passed as a bind parameter.
+func chatListQuery(d chatListDialect, userID uuid.UUID, filter models.ChatFilter) (string, []interface{}, error) {
+	order, ok := chatSortOrders[filter.Sort]
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %q", ErrInvalidChatSort, filter.Sort)
+	}
+
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return d.placeholder(len(args))
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+		SELECT c.*, cm.is_favorite, cm.is_archived FROM chats c
+		INNER JOIN chat_members cm ON c.id = cm.chat_id
+		WHERE cm.user_id = ` + arg(userID))
+
+	if search := strings.TrimSpace(filter.Search); search != "" {
+		b.WriteString("\n\t\tAND " + fmt.Sprintf(d.nameContains, arg(search)))
+	}
+	if filter.Private != nil {
+		b.WriteString("\n\t\tAND c.is_private = " + arg(*filter.Private))
+	}
+	if filter.Favorite != nil {
+		b.WriteString("\n\t\tAND cm.is_favorite = " + arg(*filter.Favorite))
+	}
+	if filter.Archived != nil {
+		b.WriteString("\n\t\tAND cm.is_archived = " + arg(*filter.Archived))
+	}
+	if filter.UnreadOnly {
+		b.WriteString(`
+		AND EXISTS (
+			SELECT 1 FROM messages m
+			WHERE m.chat_id = c.id
+			AND m.is_deleted = false
+			AND ` + d.notSentBy + `
+			AND (cm.last_read_at IS NULL OR m.created_at > cm.last_read_at)
+		)`)
+	}
+
+	b.WriteString("\n\t\tORDER BY " + order)
+	b.WriteString("\n\t\tLIMIT " + arg(filter.Limit) + " OFFSET " + arg(filter.Offset))
+
+	return b.String(), args, nil
+}
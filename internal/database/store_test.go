@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// newTestStore opens a SQLite store in a temporary directory. The store is
+// closed when the test ends.
+func newTestStore(t *testing.T) *SQLiteStore {
+	t.Helper()
+
+	store, err := NewSQLiteStore(Config{Driver: DriverSQLite, Name: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// addUser creates an active user with the given username
+func addUser(t *testing.T, s Store, username string) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		ID:           uuid.New(),
+		Username:     username,
+		Email:        username + "@example.com",
+		PasswordHash: "x",
+		IsActive:     true,
+	}
+	if err := s.CreateUser(context.Background(), user); err != nil {
+		t.Fatalf("CreateUser(%s): %v", username, err)
+	}
+	return user
+}
+
+// addChat creates a chat owned by creator with the other users as members
+func addChat(t *testing.T, s Store, creator *models.User, members ...*models.User) *models.Chat {
+	t.Helper()
+	ctx := context.Background()
+
+	chat := &models.Chat{ID: uuid.New(), Name: "chat-" + creator.Username, CreatedBy: creator.ID}
+	if err := s.CreateChat(ctx, chat); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	for _, member := range members {
+		if err := s.AddUserToChat(ctx, chat.ID, member.ID, false); err != nil {
+			t.Fatalf("AddUserToChat(%s): %v", member.Username, err)
+		}
+	}
+	return chat
+}
+
+// addMessage posts a message to a chat as the given user
+func addMessage(t *testing.T, s Store, chat *models.Chat, author *models.User, content string) *models.Message {
+	t.Helper()
+
+	message := &models.Message{ID: uuid.New(), ChatID: chat.ID, UserID: &author.ID, Content: content}
+	if err := s.CreateMessage(context.Background(), message); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	return message
+}
+
+// equal reports whether two string slices hold the same values in order
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
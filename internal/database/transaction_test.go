@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// testPostgresStore connects to the migrated PostgreSQL database named by the
+// TEST_POSTGRES_* environment variables, skipping the test when
+// TEST_POSTGRES_HOST is unset
+func testPostgresStore(t *testing.T) *PostgresStore {
+	t.Helper()
+
+	host := os.Getenv("TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRES_HOST not set")
+	}
+	port, _ := strconv.Atoi(os.Getenv("TEST_POSTGRES_PORT"))
+	if port == 0 {
+		port = 5432
+	}
+
+	store, err := NewPostgresStore(Config{
+		Driver:         DriverPostgres,
+		Host:           host,
+		Port:           port,
+		User:           os.Getenv("TEST_POSTGRES_USER"),
+		Password:       os.Getenv("TEST_POSTGRES_PASSWORD"),
+		Name:           os.Getenv("TEST_POSTGRES_DB"),
+		SSLMode:        "disable",
+		MaxConnections: 2,
+	})
+	if err != nil {
+		t.Fatalf("NewPostgresStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testRollbackUndoesAllWrites creates a user and a chat in one transaction,
+// fails, and checks that neither write survived
+func testRollbackUndoesAllWrites(t *testing.T, store Store) {
+	ctx := context.Background()
+	name := "tx-" + uuid.NewString()[:8]
+	failed := errors.New("second step failed")
+
+	var userID, chatID uuid.UUID
+	err := WithTx(store, func(tx Transaction) error {
+		user := addUser(t, tx, name)
+		chat := addChat(t, tx, user)
+		userID, chatID = user.ID, chat.ID
+
+		// Reads inside the transaction see its own writes
+		if _, err := tx.GetChatByID(ctx, chat.ID); err != nil {
+			t.Errorf("chat not visible inside its transaction: %v", err)
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("WithTx = %v, want the callback's error", err)
+	}
+
+	if _, err := store.GetUserByID(ctx, userID); err == nil {
+		t.Error("user survived the rollback")
+	}
+	if _, err := store.GetChatByID(ctx, chatID); err == nil {
+		t.Error("chat survived the rollback")
+	}
+}
+
+// testCommitKeepsAllWrites is the committing counterpart of
+// testRollbackUndoesAllWrites
+func testCommitKeepsAllWrites(t *testing.T, store Store) {
+	ctx := context.Background()
+	name := "tx-" + uuid.NewString()[:8]
+
+	var userID, chatID uuid.UUID
+	err := WithTx(store, func(tx Transaction) error {
+		user := addUser(t, tx, name)
+		userID, chatID = user.ID, addChat(t, tx, user).ID
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if _, err := store.GetUserByID(ctx, userID); err != nil {
+		t.Errorf("committed user is missing: %v", err)
+	}
+	if _, err := store.GetChatByID(ctx, chatID); err != nil {
+		t.Errorf("committed chat is missing: %v", err)
+	}
+}
+
+func TestSQLiteTransaction(t *testing.T) {
+	t.Run("rollback", func(t *testing.T) { testRollbackUndoesAllWrites(t, newTestStore(t)) })
+	t.Run("commit", func(t *testing.T) { testCommitKeepsAllWrites(t, newTestStore(t)) })
+}
+
+func TestPostgresTransaction(t *testing.T) {
+	store := testPostgresStore(t)
+	t.Run("rollback", func(t *testing.T) { testRollbackUndoesAllWrites(t, store) })
+	t.Run("commit", func(t *testing.T) { testCommitKeepsAllWrites(t, store) })
+}
+
+func TestNestedTransactionIsRefused(t *testing.T) {
+	tx, err := newTestStore(t).Begin()
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Begin(); err == nil {
+		t.Error("Begin inside a transaction succeeded")
+	}
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestUnreadCountsIncrementForOtherMembers(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob := addUser(t, s, "alice"), addUser(t, s, "bob")
+	chat := addChat(t, s, alice, bob)
+
+	addMessage(t, s, chat, alice, "one")
+	addMessage(t, s, chat, alice, "two")
+	addMessage(t, s, chat, bob, "three")
+
+	bobCounts, err := s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := bobCounts[chat.ID]; got != 2 {
+		t.Errorf("bob's unread count = %d, want 2", got)
+	}
+
+	aliceCounts, err := s.GetUnreadCounts(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := aliceCounts[chat.ID]; got != 1 {
+		t.Errorf("alice's unread count = %d, want 1", got)
+	}
+
+	member, err := s.GetChatMember(ctx, chat.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("GetChatMember: %v", err)
+	}
+	if member.UnreadCount != 2 {
+		t.Errorf("bob's stored counter = %d, want 2", member.UnreadCount)
+	}
+}
+
+func TestUnreadCountsResetOnRead(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob := addUser(t, s, "alice"), addUser(t, s, "bob")
+	chat := addChat(t, s, alice, bob)
+
+	addMessage(t, s, chat, alice, "one")
+	read := addMessage(t, s, chat, alice, "two")
+
+	if err := s.MarkChatRead(ctx, chat.ID, bob.ID, read.CreatedAt); err != nil {
+		t.Fatalf("MarkChatRead: %v", err)
+	}
+
+	counts, err := s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := counts[chat.ID]; got != 0 {
+		t.Errorf("unread count after reading = %d, want 0", got)
+	}
+	member, err := s.GetChatMember(ctx, chat.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("GetChatMember: %v", err)
+	}
+	if member.UnreadCount != 0 {
+		t.Errorf("stored counter after reading = %d, want 0", member.UnreadCount)
+	}
+
+	// Messages after the read marker count again
+	addMessage(t, s, chat, alice, "three")
+	counts, err = s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := counts[chat.ID]; got != 1 {
+		t.Errorf("unread count after a new message = %d, want 1", got)
+	}
+}
+
+func TestMarkChatReadKeepsNewerMarker(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob := addUser(t, s, "alice"), addUser(t, s, "bob")
+	chat := addChat(t, s, alice, bob)
+
+	first := addMessage(t, s, chat, alice, "one")
+	second := addMessage(t, s, chat, alice, "two")
+
+	if err := s.MarkChatRead(ctx, chat.ID, bob.ID, second.CreatedAt); err != nil {
+		t.Fatalf("MarkChatRead: %v", err)
+	}
+	// A late receipt for an earlier message doesn't move the marker back
+	if err := s.MarkChatRead(ctx, chat.ID, bob.ID, first.CreatedAt); err != nil {
+		t.Fatalf("MarkChatRead: %v", err)
+	}
+
+	counts, err := s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := counts[chat.ID]; got != 0 {
+		t.Errorf("unread count = %d, want 0", got)
+	}
+}
+
+func TestUnreadCountsConcurrentMessages(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob, carol := addUser(t, s, "alice"), addUser(t, s, "bob"), addUser(t, s, "carol")
+	chat := addChat(t, s, alice, bob, carol)
+
+	const perSender = 20
+	var wg sync.WaitGroup
+	for _, author := range []*models.User{alice, carol} {
+		wg.Add(1)
+		go func(author *models.User) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				message := &models.Message{ID: uuid.New(), ChatID: chat.ID, UserID: &author.ID, Content: "hi"}
+				if err := s.CreateMessage(ctx, message); err != nil {
+					t.Errorf("CreateMessage: %v", err)
+					return
+				}
+			}
+		}(author)
+	}
+	wg.Wait()
+
+	counts, err := s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := counts[chat.ID]; got != 2*perSender {
+		t.Errorf("unread count = %d, want %d", got, 2*perSender)
+	}
+
+	member, err := s.GetChatMember(ctx, chat.ID, bob.ID)
+	if err != nil {
+		t.Fatalf("GetChatMember: %v", err)
+	}
+	if member.UnreadCount != 2*perSender {
+		t.Errorf("stored counter = %d, want %d", member.UnreadCount, 2*perSender)
+	}
+}
+
+func TestCreateMessageBumpsChatInSameTransaction(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice := addUser(t, s, "alice")
+	chat := addChat(t, s, alice)
+
+	message := addMessage(t, s, chat, alice, "hello")
+
+	got, err := s.GetChatByID(ctx, chat.ID)
+	if err != nil {
+		t.Fatalf("GetChatByID: %v", err)
+	}
+	if !got.UpdatedAt.Equal(message.CreatedAt) {
+		t.Errorf("chat updated_at = %v, want the message's created_at %v", got.UpdatedAt, message.CreatedAt)
+	}
+}
+
+func TestDeletingMessageDecrementsUnreadCount(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob, carol := addUser(t, s, "alice"), addUser(t, s, "bob"), addUser(t, s, "carol")
+	chat := addChat(t, s, alice, bob, carol)
+
+	read := addMessage(t, s, chat, alice, "one")
+	unread := addMessage(t, s, chat, alice, "two")
+	if err := s.MarkChatRead(ctx, chat.ID, bob.ID, read.CreatedAt); err != nil {
+		t.Fatalf("MarkChatRead: %v", err)
+	}
+
+	counters := func() (int, int) {
+		t.Helper()
+		var counts []int
+		for _, user := range []*models.User{bob, carol} {
+			member, err := s.GetChatMember(ctx, chat.ID, user.ID)
+			if err != nil {
+				t.Fatalf("GetChatMember: %v", err)
+			}
+			counts = append(counts, member.UnreadCount)
+		}
+		return counts[0], counts[1]
+	}
+
+	// Deleting twice only takes the message off once
+	for i := 0; i < 2; i++ {
+		if err := s.DeleteMessage(ctx, unread.ID); err != nil {
+			t.Fatalf("DeleteMessage: %v", err)
+		}
+	}
+	if b, c := counters(); b != 0 || c != 1 {
+		t.Errorf("counters after deleting an unread message = bob %d, carol %d; want 0, 1", b, c)
+	}
+
+	// Bob has already read this one, so only carol's count drops
+	if err := s.DeleteMessage(ctx, read.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+	if b, c := counters(); b != 0 || c != 0 {
+		t.Errorf("counters after deleting a read message = bob %d, carol %d; want 0, 0", b, c)
+	}
+}
+
+func TestMarkChatReadCountsMessagesAfterMarker(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	alice, bob := addUser(t, s, "alice"), addUser(t, s, "bob")
+	chat := addChat(t, s, alice, bob)
+
+	read := addMessage(t, s, chat, alice, "one")
+	addMessage(t, s, chat, alice, "two")
+	deleted := addMessage(t, s, chat, alice, "three")
+	addMessage(t, s, chat, alice, "four")
+	if err := s.DeleteMessage(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	// Reading part of the chat leaves the later, undeleted messages unread
+	if err := s.MarkChatRead(ctx, chat.ID, bob.ID, read.CreatedAt); err != nil {
+		t.Fatalf("MarkChatRead: %v", err)
+	}
+
+	counts, err := s.GetUnreadCounts(ctx, bob.ID)
+	if err != nil {
+		t.Fatalf("GetUnreadCounts: %v", err)
+	}
+	if got := counts[chat.ID]; got != 2 {
+		t.Errorf("unread count = %d, want 2", got)
+	}
+}
@@ -0,0 +1,54 @@
+package database
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetUsersByIDs(t *testing.T) {
+	s := newTestStore(t)
+	ada, grace := addUser(t, s, "ada"), addUser(t, s, "grace")
+	addUser(t, s, "linus")
+	missing := uuid.New()
+
+	users, err := s.GetUsersByIDs(context.Background(), []uuid.UUID{ada.ID, missing, grace.ID, ada.ID})
+	if err != nil {
+		t.Fatalf("GetUsersByIDs: %v", err)
+	}
+
+	if len(users) != 2 {
+		t.Errorf("got %d users, want ada and grace", len(users))
+	}
+	for _, want := range []struct {
+		id       uuid.UUID
+		username string
+	}{{ada.ID, "ada"}, {grace.ID, "grace"}} {
+		user, ok := users[want.id]
+		if !ok {
+			t.Errorf("%s is missing", want.username)
+			continue
+		}
+		if user.Username != want.username || user.Email != want.username+"@example.com" {
+			t.Errorf("user %s = %q <%s>, want %s's details", want.id, user.Username, user.Email, want.username)
+		}
+	}
+	if _, ok := users[missing]; ok {
+		t.Error("unknown ID is in the result")
+	}
+}
+
+func TestGetUsersByIDsEmpty(t *testing.T) {
+	s := newTestStore(t)
+
+	for _, ids := range [][]uuid.UUID{nil, {}, {uuid.New()}} {
+		users, err := s.GetUsersByIDs(context.Background(), ids)
+		if err != nil {
+			t.Fatalf("GetUsersByIDs(%v): %v", ids, err)
+		}
+		if users == nil || len(users) != 0 {
+			t.Errorf("GetUsersByIDs(%v) = %v, want an empty map", ids, users)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// formatVector encodes an embedding in pgvector's text format, which is
+// also how SQLite stores it
+func formatVector(v []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// parseVector decodes an embedding stored by formatVector
+func parseVector(s string) ([]float32, error) {
+	var v []float32
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("invalid vector: %w", err)
+	}
+	return v, nil
+}
+
+// cosineDistance returns 1 minus the cosine similarity of two vectors, as
+// pgvector's <=> operator does. Vectors of different lengths, or with no
+// magnitude, are as distant as possible.
+func cosineDistance(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 2
+	}
+
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 2
+	}
+	return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+}
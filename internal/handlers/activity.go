@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// GetMessageCounts handles counting each user's messages in a chat, so chat
+// admins can see who is most active. Deleted messages aren't counted.
+func (h *ChatHandler) GetMessageCounts(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	member, err := h.chatService.GetChatMember(c, chatID, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get chat member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+		return
+	}
+	if !isChatModerator(c, member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only chat admins can view message counts"})
+		return
+	}
+
+	counts, err := h.chatService.CountMessagesByUserInChat(c, chatID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to count messages by user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get message counts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"counts": counts})
+}
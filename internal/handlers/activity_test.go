@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// activityService has one chat, whose members may or may not be admins, and
+// records whether its message counts were loaded
+type activityService struct {
+	ChatService
+
+	admins  map[uuid.UUID]bool
+	counts  map[uuid.UUID]int
+	counted int
+}
+
+func (s *activityService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	_, ok := s.admins[userID]
+	return ok, nil
+}
+
+func (s *activityService) GetChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (*models.ChatMember, error) {
+	return &models.ChatMember{ChatID: chatID, UserID: userID, IsAdmin: s.admins[userID]}, nil
+}
+
+func (s *activityService) CountMessagesByUserInChat(ctx *gin.Context, chatID uuid.UUID) (map[uuid.UUID]int, error) {
+	s.counted++
+	return s.counts, nil
+}
+
+func TestGetMessageCountsIsForAdmins(t *testing.T) {
+	admin, member, stranger, moderator := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	chatID := uuid.New()
+	path := "/chats/" + chatID.String() + "/message-counts"
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		claims *auth.Claims
+		want   int
+	}{
+		{"admin", admin, nil, http.StatusOK},
+		{"member", member, nil, http.StatusForbidden},
+		{"non-member", stranger, nil, http.StatusForbidden},
+		{"site moderator who is a member", moderator, &auth.Claims{Permissions: []string{models.PermModerateChats}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &activityService{
+				admins: map[uuid.UUID]bool{admin: true, member: false, moderator: false},
+				counts: map[uuid.UUID]int{admin: 4, member: 7},
+			}
+			h := NewChatHandler(s, ChatConfig{})
+			handler := h.GetMessageCounts
+			if tt.claims != nil {
+				handler = func(c *gin.Context) {
+					c.Set("claims", tt.claims)
+					h.GetMessageCounts(c)
+				}
+			}
+
+			userID := tt.userID
+			w := serve(handler, http.MethodGet, "/chats/:id/message-counts", path, &userID, nil)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK {
+				if s.counted != 0 {
+					t.Error("counts were loaded for a caller who can't see them")
+				}
+				return
+			}
+
+			var body struct {
+				Counts map[uuid.UUID]int `json:"counts"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(body.Counts) != 2 || body.Counts[admin] != 4 || body.Counts[member] != 7 {
+				t.Errorf("counts = %v, want the store's per-user counts", body.Counts)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// maxAPIKeyNameLength is the longest name an API key can be given
+const maxAPIKeyNameLength = 100
+
+// CreateAPIKeyRequest holds the name of a new API key
+type CreateAPIKeyRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateAPIKey handles creating an API key. The key is in the response and
+// can't be retrieved again. Requests authenticated by API key can't create
+// more keys.
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	if middleware.IsAPIKeyAuth(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't be used to create API keys"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required", "field": "name"})
+		return
+	}
+	if !checkLength(c, "name", name, maxAPIKeyNameLength) {
+		return
+	}
+
+	key, err := h.authService.CreateAPIKey(c.Request.Context(), userID, name)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to create API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"name": name, "key": key})
+}
+
+// ListAPIKeys handles listing the caller's API keys. The keys themselves
+// aren't included.
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(c.Request.Context(), userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list API keys")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// RevokeAPIKey handles revoking one of the caller's API keys. It stops
+// working immediately.
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(c.Request.Context(), userID, keyID); err != nil {
+		if errors.Is(err, auth.ErrAPIKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+			return
+		}
+		log.Ctx(c).Error().Err(err).Msg("Failed to revoke API key")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/thumbnail"
+)
+
+// defaultThumbnailCacheBytes is used when no thumbnail cache size is configured
+const defaultThumbnailCacheBytes = 64 << 20
+
+// defaultMaxAttachmentBytes is used when no upload size limit is configured
+const defaultMaxAttachmentBytes = 10 << 20
+
+// defaultAttachmentTypes are the MIME types accepted when none are configured
+var defaultAttachmentTypes = []string{
+	"image/jpeg",
+	"image/png",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+}
+
+// errAttachmentTooLarge is returned while reading an upload that exceeds the
+// configured size limit
+var errAttachmentTooLarge = errors.New("attachment exceeds the maximum file size")
+
+// AttachmentConfig holds attachment handling configuration
+type AttachmentConfig struct {
+	// ThumbnailCacheBytes bounds the memory used by cached thumbnails
+	ThumbnailCacheBytes int64
+	// MaxFileBytes is the largest file that can be uploaded
+	MaxFileBytes int64
+	// AllowedTypes lists the MIME types that can be uploaded. A type ending in
+	// "/*" matches every subtype.
+	AllowedTypes []string
+}
+
+// AttachmentService defines the interface for attachment operations
+type AttachmentService interface {
+	GetAttachmentByID(ctx *gin.Context, id uuid.UUID) (*models.Attachment, error)
+	CanAccessAttachment(ctx *gin.Context, attachment *models.Attachment, userID uuid.UUID) (bool, error)
+	OpenAttachment(ctx *gin.Context, attachment *models.Attachment) (io.ReadCloser, error)
+	GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error)
+	IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error)
+	CreateAttachment(ctx *gin.Context, attachment *models.Attachment, file io.Reader) error
+	AttachmentURL(ctx *gin.Context, attachment *models.Attachment) (string, error)
+}
+
+// AttachmentHandler handles attachment-related API endpoints
+type AttachmentHandler struct {
+	attachmentService AttachmentService
+	thumbnails        *thumbnail.Cache
+	config            AttachmentConfig
+}
+
+// NewAttachmentHandler creates a new attachment handler
+func NewAttachmentHandler(config AttachmentConfig, attachmentService AttachmentService) *AttachmentHandler {
+	if config.ThumbnailCacheBytes <= 0 {
+		config.ThumbnailCacheBytes = defaultThumbnailCacheBytes
+	}
+	if config.MaxFileBytes <= 0 {
+		config.MaxFileBytes = defaultMaxAttachmentBytes
+	}
+	if len(config.AllowedTypes) == 0 {
+		config.AllowedTypes = defaultAttachmentTypes
+	}
+
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+		thumbnails:        thumbnail.NewCache(config.ThumbnailCacheBytes),
+		config:            config,
+	}
+}
+
+// UploadAttachment attaches a file to one of the caller's messages. The body
+// is multipart form data with the file in a "file" field; it is streamed to
+// storage rather than buffered.
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	isMember, err := h.attachmentService.IsChatMember(c, chatID, userID)
+	if err != nil || !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+		return
+	}
+
+	message, err := h.attachmentService.GetMessageByID(c, messageID)
+	if err != nil || message.ChatID != chatID || message.IsDeleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.UserID == nil || *message.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only attach files to your own messages"})
+		return
+	}
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected multipart form data"})
+		return
+	}
+
+	var part io.ReadCloser
+	var fileName string
+	for {
+		p, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid multipart form data"})
+			return
+		}
+		if p.FormName() == "file" && p.FileName() != "" {
+			part, fileName = p, filepath.Base(p.FileName())
+			break
+		}
+		p.Close()
+	}
+	if part == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	defer part.Close()
+
+	// Sniff the type from the content rather than trusting the client
+	body := bufio.NewReaderSize(&limitedReader{r: part, remaining: h.config.MaxFileBytes}, 512)
+	head, err := body.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		if errors.Is(err, errAttachmentTooLarge) {
+			h.rejectTooLarge(c)
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	fileType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !h.allowedType(fileType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("Files of type %s are not allowed", fileType)})
+		return
+	}
+
+	attachment := &models.Attachment{
+		ID:          uuid.New(),
+		MessageID:   &message.ID,
+		FileName:    fileName,
+		FileType:    fileType,
+		IsEncrypted: message.ContentEncrypted,
+	}
+
+	if err := h.attachmentService.CreateAttachment(c, attachment, body); err != nil {
+		if errors.Is(err, errAttachmentTooLarge) {
+			h.rejectTooLarge(c)
+			return
+		}
+		log.Ctx(c).Error().Err(err).Msg("Failed to store attachment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+}
+
+// DownloadAttachment streams an attachment's file to a user who can see the
+// message it belongs to. When the store supports pre-signed URLs the user is
+// redirected to download straight from storage instead.
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	attachmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	attachment, err := h.attachmentService.GetAttachmentByID(c, attachmentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	allowed, err := h.attachmentService.CanAccessAttachment(c, attachment, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check attachment access")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this attachment"})
+		return
+	}
+
+	url, err := h.attachmentService.AttachmentURL(c, attachment)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Str("attachment_id", attachment.ID.String()).Msg("Failed to sign attachment URL")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment"})
+		return
+	}
+	if url != "" {
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(http.StatusFound, url)
+		return
+	}
+
+	file, err := h.attachmentService.OpenAttachment(c, attachment)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Str("attachment_id", attachment.ID.String()).Msg("Failed to open attachment")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment"})
+		return
+	}
+	defer file.Close()
+
+	contentType := attachment.FileType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	c.DataFromReader(http.StatusOK, attachment.FileSize, contentType, file, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=86400",
+	})
+}
+
+// allowedType reports whether files of the given MIME type can be uploaded
+func (h *AttachmentHandler) allowedType(fileType string) bool {
+	for _, allowed := range h.config.AllowedTypes {
+		if allowed == fileType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(fileType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectTooLarge responds to an upload over the size limit
+func (h *AttachmentHandler) rejectTooLarge(c *gin.Context) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Files can be at most %d bytes", h.config.MaxFileBytes)})
+}
+
+// limitedReader fails with errAttachmentTooLarge once more than remaining
+// bytes have been read from r
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errAttachmentTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, errAttachmentTooLarge
+	}
+	return n, err
+}
+
+// ThumbnailStats returns the thumbnail cache's hit/miss counters
+func (h *AttachmentHandler) ThumbnailStats() thumbnail.Stats {
+	return h.thumbnails.Stats()
+}
+
+// GetThumbnail serves a scaled-down preview of an image attachment,
+// generating it from the stored file on a cache miss
+func (h *AttachmentHandler) GetThumbnail(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	attachmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	size := thumbnail.DefaultSize
+	if s := c.Query("size"); s != "" {
+		size, err = strconv.Atoi(s)
+		if err != nil || size <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thumbnail size"})
+			return
+		}
+	}
+	size = thumbnail.NormalizeSize(size)
+
+	attachment, err := h.attachmentService.GetAttachmentByID(c, attachmentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	allowed, err := h.attachmentService.CanAccessAttachment(c, attachment, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check attachment access")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get attachment"})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have access to this attachment"})
+		return
+	}
+
+	if attachment.IsEncrypted || !strings.HasPrefix(attachment.FileType, "image/") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No thumbnail available for this attachment"})
+		return
+	}
+
+	thumb, err := h.thumbnails.GetOrGenerate(thumbnail.Key(attachment.ID, size), func() (*thumbnail.Thumbnail, error) {
+		file, err := h.attachmentService.OpenAttachment(c, attachment)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return thumbnail.Generate(file, size)
+	})
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Str("attachment_id", attachment.ID.String()).Msg("Failed to generate thumbnail")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate thumbnail"})
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Data(http.StatusOK, thumb.ContentType, thumb.Data)
+}
+
+// RegisterRoutes registers attachment routes
+func (h *AttachmentHandler) RegisterRoutes(router *gin.RouterGroup) {
+	attachments := router.Group("/attachments")
+	{
+		attachments.GET("/:id", h.DownloadAttachment)
+		attachments.GET("/:id/thumbnail", h.GetThumbnail)
+	}
+
+	router.POST("/chats/:id/messages/:messageID/attachments", h.UploadAttachment)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// stubAttachmentService serves one stored image and counts how often it is
+// read from storage
+type stubAttachmentService struct {
+	AttachmentService
+
+	attachment *models.Attachment
+	file       []byte
+	opens      int
+}
+
+func (s *stubAttachmentService) GetAttachmentByID(ctx *gin.Context, id uuid.UUID) (*models.Attachment, error) {
+	if id != s.attachment.ID {
+		return nil, errors.New("attachment not found")
+	}
+	return s.attachment, nil
+}
+
+func (s *stubAttachmentService) CanAccessAttachment(ctx *gin.Context, attachment *models.Attachment, userID uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (s *stubAttachmentService) OpenAttachment(ctx *gin.Context, attachment *models.Attachment) (io.ReadCloser, error) {
+	s.opens++
+	return io.NopCloser(bytes.NewReader(s.file)), nil
+}
+
+func newImageAttachment(t *testing.T) *stubAttachmentService {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+	return &stubAttachmentService{
+		attachment: &models.Attachment{ID: uuid.New(), FileName: "photo.png", FileType: "image/png"},
+		file:       buf.Bytes(),
+	}
+}
+
+func TestGetThumbnailServesRepeatsFromCache(t *testing.T) {
+	service := newImageAttachment(t)
+	h := NewAttachmentHandler(AttachmentConfig{}, service)
+	userID := uuid.New()
+	path := "/attachments/" + service.attachment.ID.String() + "/thumbnail?size=100"
+
+	first := serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", path, &userID, nil)
+	second := serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", path, &userID, nil)
+
+	for _, code := range []int{first.Code, second.Code} {
+		if code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", code, http.StatusOK)
+		}
+	}
+	if service.opens != 1 {
+		t.Errorf("read the original %d times, want 1", service.opens)
+	}
+	if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+		t.Error("cached thumbnail differs from the generated one")
+	}
+	if stats := h.ThumbnailStats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("stats = %+v, want 1 hit and 1 miss", stats)
+	}
+
+	// 100 rounds up to 128, so this is the same cached variant
+	serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", "/attachments/"+service.attachment.ID.String()+"/thumbnail?size=128", &userID, nil)
+	if service.opens != 1 {
+		t.Errorf("read the original %d times after an equivalent size, want 1", service.opens)
+	}
+
+	// A different size is a different cache entry
+	large := serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", "/attachments/"+service.attachment.ID.String()+"/thumbnail?size=512", &userID, nil)
+	if service.opens != 2 {
+		t.Errorf("read the original %d times after a new size, want 2", service.opens)
+	}
+	img, err := png.Decode(large.Body)
+	if err != nil {
+		t.Fatalf("decoding thumbnail: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 512 {
+		t.Errorf("thumbnail width = %d, want 512", b.Dx())
+	}
+}
+
+func TestGetThumbnailRejectsNonImages(t *testing.T) {
+	service := newImageAttachment(t)
+	service.attachment.FileType = "application/pdf"
+	h := NewAttachmentHandler(AttachmentConfig{}, service)
+	userID := uuid.New()
+
+	w := serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", "/attachments/"+service.attachment.ID.String()+"/thumbnail", &userID, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if service.opens != 0 {
+		t.Error("opened a non-image attachment to thumbnail it")
+	}
+
+	w = serve(h.GetThumbnail, http.MethodGet, "/attachments/:id/thumbnail", "/attachments/"+service.attachment.ID.String()+"/thumbnail?size=abc", &userID, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid size: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
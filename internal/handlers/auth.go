@@ -1,35 +1,52 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 
 	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
 )
 
 // AuthService defines the interface for authentication operations
 type AuthService interface {
 	Register(ctx *gin.Context, username, email, password, displayName string) (*auth.UserResponse, error)
-	Login(ctx *gin.Context, username, password string) (string, *auth.UserResponse, error)
+	GetMe(ctx *gin.Context, userID uuid.UUID) (*auth.UserResponse, error)
+	Login(ctx *gin.Context, username, password string) (string, string, *auth.UserResponse, error)
+	Refresh(ctx context.Context, refreshToken string) (string, string, error)
+	RevokeRefreshToken(ctx context.Context, refreshToken string) error
+	RevokeToken(ctx context.Context, tokenString string) error
+	RequestPasswordReset(ctx context.Context, email, resetURL string) error
+	ResetPassword(ctx context.Context, token, password string) error
+	CreateAPIKey(ctx context.Context, userID uuid.UUID, name string) (string, error)
+	ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error
 }
 
 // AuthHandler handles authentication API endpoints
 type AuthHandler struct {
 	authService AuthService
+	limits      ProfileLimits
 }
 
 // NewAuthHandler creates a new authentication handler
-func NewAuthHandler(authService AuthService) *AuthHandler {
+func NewAuthHandler(authService AuthService, limits ProfileLimits) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
+		limits:      limits.withDefaults(),
 	}
 }
 
 // RegisterRequest holds registration request data
 type RegisterRequest struct {
-	Username    string `json:"username" binding:"required,min=3,max=50"`
+	Username    string `json:"username" binding:"required,min=3"`
 	Email       string `json:"email" binding:"required,email"`
 	Password    string `json:"password" binding:"required,min=8"`
 	DisplayName string `json:"display_name"`
@@ -41,10 +58,30 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest holds a refresh token being exchanged or revoked
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ForgotPasswordRequest holds the address to send a password reset to
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	// ResetURL optionally overrides the page the email links to. It must be
+	// in the redirect allowlist.
+	ResetURL string `json:"reset_url"`
+}
+
+// ResetPasswordRequest holds a password reset token and the new password
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
 // AuthResponse holds authentication response data
 type AuthResponse struct {
-	Token string             `json:"token"`
-	User  *auth.UserResponse `json:"user"`
+	Token        string             `json:"token"`
+	RefreshToken string             `json:"refresh_token,omitempty"`
+	User         *auth.UserResponse `json:"user,omitempty"`
 }
 
 // Register handles user registration
@@ -55,9 +92,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
+	if !checkLength(c, "username", req.Username, h.limits.MaxUsernameLength) ||
+		!checkLength(c, "display_name", req.DisplayName, h.limits.MaxDisplayNameLength) {
+		return
+	}
+
 	user, err := h.authService.Register(c, req.Username, req.Email, req.Password, req.DisplayName)
 	if err != nil {
-		log.Error().Err(err).Msg("Registration failed")
+		log.Ctx(c).Error().Err(err).Msg("Registration failed")
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -73,42 +115,150 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, user, err := h.authService.Login(c, req.Username, req.Password)
+	token, refreshToken, user, err := h.authService.Login(c, req.Username, req.Password)
 	if err != nil {
 		if err == auth.ErrInvalidCredentials {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 			return
 		}
-		log.Error().Err(err).Msg("Login failed")
+		if err == auth.ErrAccountLocked {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed logins, the account is temporarily locked"})
+			return
+		}
+		log.Ctx(c).Error().Err(err).Msg("Login failed")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
 		return
 	}
 
 	c.JSON(http.StatusOK, AuthResponse{
-		Token: token,
-		User:  user,
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         user,
+	})
+}
+
+// Refresh exchanges a refresh token for a new access token and a replacement
+// refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	token, refreshToken, err := h.authService.Refresh(c.Request.Context(), req.RefreshToken)
+	if err != nil {
+		if err == auth.ErrInvalidToken {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+		log.Ctx(c).Error().Err(err).Msg("Token refresh failed")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token refresh failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
 	})
 }
 
 // Logout handles user logout
 func (h *AuthHandler) Logout(c *gin.Context) {
-	// In a stateless JWT-based auth system, the client simply discards the token
-	// For enhanced security, we could implement a token blacklist using Redis
+	// Blacklist the access token so it stops working before it expires
+	parts := strings.SplitN(c.GetHeader("Authorization"), " ", 2)
+	if len(parts) == 2 && parts[0] == "Bearer" {
+		if err := h.authService.RevokeToken(c.Request.Context(), parts[1]); err != nil {
+			log.Ctx(c).Error().Err(err).Msg("Failed to revoke token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Logout failed"})
+			return
+		}
+	}
+
+	// A refresh token sent along is revoked so it can't mint new access tokens
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err == nil {
+		if err := h.authService.RevokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+			log.Ctx(c).Warn().Err(err).Msg("Failed to revoke refresh token")
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Logout successful"})
 }
 
-// GetMe returns the current user's data
+// ForgotPassword handles requests for a password reset email. The response is
+// the same whether or not the address belongs to an account, and whether or
+// not an email was actually sent.
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email, req.ResetURL); err != nil {
+		// The allowlist doesn't depend on the account, so rejecting the
+		// link target reveals nothing about it
+		if errors.Is(err, auth.ErrRedirectNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "reset_url is not allowed"})
+			return
+		}
+		if errors.Is(err, auth.ErrMailerNotConfigured) {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Password reset by email is not available"})
+			return
+		}
+		log.Ctx(c).Warn().Err(err).Msg("Password reset email not sent")
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses that address, a password reset email is on its way"})
+}
+
+// ResetPassword handles setting a new password with a reset token
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		switch {
+		case errors.Is(err, auth.ErrWeakPassword):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, auth.ErrInvalidToken):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+		default:
+			log.Ctx(c).Error().Err(err).Msg("Password reset failed")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Password reset failed"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successful"})
+}
+
+// GetMe returns the current user's profile and preferences. A token for a
+// user who has since been deleted or deactivated is answered with 401, so
+// clients sign out.
 func (h *AuthHandler) GetMe(c *gin.Context) {
-	// The user ID was set in the auth middleware
-	userID, exists := c.Get("user_id")
+	userID, exists := middleware.GetUserID(c)
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 
-	// In a real implementation, we would fetch the user from the database
-	// For this example, we'll just return the user ID
-	c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	user, err := h.authService.GetMe(c, userID)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account no longer exists"})
+		return
+	}
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get current user")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user})
 }
 
 // RegisterRoutes registers authentication routes
@@ -117,7 +267,21 @@ func (h *AuthHandler) RegisterRoutes(router *gin.RouterGroup) {
 	{
 		auth.POST("/register", h.Register)
 		auth.POST("/login", h.Login)
+		auth.POST("/refresh", h.Refresh)
 		auth.POST("/logout", h.Logout)
+		auth.POST("/forgot-password", h.ForgotPassword)
+		auth.POST("/reset-password", h.ResetPassword)
+	}
+}
+
+// RegisterProtectedRoutes registers authentication routes that require
+// authentication
+func (h *AuthHandler) RegisterProtectedRoutes(router *gin.RouterGroup) {
+	auth := router.Group("/auth")
+	{
 		auth.GET("/me", h.GetMe)
+		auth.POST("/apikeys", h.CreateAPIKey)
+		auth.GET("/apikeys", h.ListAPIKeys)
+		auth.DELETE("/apikeys/:id", h.RevokeAPIKey)
 	}
 }
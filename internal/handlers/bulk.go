@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Bulk operation modes
+const (
+	// BulkStrict applies a bulk operation to every item or to none of them
+	BulkStrict = "strict"
+	// BulkBestEffort applies a bulk operation to every item it can and
+	// reports the rest as failed
+	BulkBestEffort = "best_effort"
+)
+
+// BulkItemResult reports the outcome of a bulk operation for one item
+type BulkItemResult struct {
+	ID      uuid.UUID   `json:"id"`
+	Success bool        `json:"success"`
+	Error   string      `json:"error,omitempty"`
+	Result  interface{} `json:"result,omitempty"`
+}
+
+// BulkResponse is returned by bulk operations run in best-effort mode
+type BulkResponse struct {
+	Results   []*BulkItemResult `json:"results"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// bulkResults collects per-item outcomes of a best-effort bulk operation
+type bulkResults struct {
+	response BulkResponse
+}
+
+// succeed records an item that went through
+func (b *bulkResults) succeed(id uuid.UUID, result interface{}) {
+	b.response.Results = append(b.response.Results, &BulkItemResult{ID: id, Success: true, Result: result})
+	b.response.Succeeded++
+}
+
+// fail records an item that didn't, and why
+func (b *bulkResults) fail(id uuid.UUID, reason string) {
+	b.response.Results = append(b.response.Results, &BulkItemResult{ID: id, Error: reason})
+	b.response.Failed++
+}
+
+// write responds with the collected results: successStatus if every item
+// succeeded, 207 if only some did, and 422 if none did
+func (b *bulkResults) write(c *gin.Context, successStatus int) {
+	status := successStatus
+	switch {
+	case b.response.Succeeded == 0 && b.response.Failed > 0:
+		status = http.StatusUnprocessableEntity
+	case b.response.Failed > 0:
+		status = http.StatusMultiStatus
+	}
+	c.JSON(status, b.response)
+}
+
+// bulkMode returns the mode a bulk request runs in: the "mode" query
+// parameter if given, otherwise the configured default. It responds with 400
+// and returns false for an unknown mode.
+func bulkMode(c *gin.Context, defaultMode string) (string, bool) {
+	mode := c.DefaultQuery("mode", defaultMode)
+	switch mode {
+	case BulkStrict, BulkBestEffort:
+		return mode, true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mode, must be strict or best_effort"})
+		return "", false
+	}
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// brokenTarget fails to forward into one chat, as if its write failed
+type brokenTarget struct {
+	*forwardService
+	broken uuid.UUID
+}
+
+func (s *brokenTarget) ForwardMessage(ctx *gin.Context, message *models.Message, userID uuid.UUID, chatIDs []uuid.UUID) ([]*models.Message, error) {
+	for _, chatID := range chatIDs {
+		if chatID == s.broken {
+			return nil, errors.New("disk full")
+		}
+	}
+	return s.forwardService.ForwardMessage(ctx, message, userID, chatIDs)
+}
+
+// forwardBulk sends a forward request for the service's message and decodes
+// a per-target response
+func forwardBulk(t *testing.T, h *ChatHandler, s *forwardService, userID uuid.UUID, query string, targets ...uuid.UUID) (int, BulkResponse) {
+	t.Helper()
+
+	path := "/chats/" + s.message.ChatID.String() + "/messages/" + s.message.ID.String() + "/forward" + query
+	w := serve(h.ForwardMessage, http.MethodPost, "/chats/:id/messages/:messageID/forward", path, &userID,
+		ForwardMessageRequest{ChatIDs: targets})
+
+	var resp BulkResponse
+	if w.Code == http.StatusCreated || w.Code == http.StatusMultiStatus || w.Code == http.StatusUnprocessableEntity {
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decoding response: %v (%s)", err, w.Body)
+		}
+	}
+	return w.Code, resp
+}
+
+func TestBulkModeFromConfigAndQuery(t *testing.T) {
+	userID := uuid.New()
+	stranger := uuid.New()
+
+	tests := []struct {
+		name      string
+		config    string
+		query     string
+		want      int
+		forwarded int
+	}{
+		{"strict by default", "", "", http.StatusForbidden, 0},
+		{"unknown config falls back to strict", "lenient", "", http.StatusForbidden, 0},
+		{"best effort from config", BulkBestEffort, "", http.StatusMultiStatus, 1},
+		{"query overrides config", BulkBestEffort, "?mode=strict", http.StatusForbidden, 0},
+		{"query picks best effort", BulkStrict, "?mode=best_effort", http.StatusMultiStatus, 1},
+		{"unknown query mode", "", "?mode=some", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, chats := newForwardService(2)
+			h := NewChatHandler(s, ChatConfig{BulkMode: tt.config})
+
+			if code := s.forward(h, userID, tt.query, chats[1], stranger); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+			if len(s.forwarded) != tt.forwarded {
+				t.Errorf("forwarded to %v, want %d targets", s.forwarded, tt.forwarded)
+			}
+		})
+	}
+}
+
+func TestForwardBestEffortReportsReasons(t *testing.T) {
+	userID := uuid.New()
+	s, chats := newForwardService(3)
+	stranger := uuid.New()
+	h := NewChatHandler(&brokenTarget{forwardService: s, broken: chats[2]}, ChatConfig{BulkMode: BulkBestEffort})
+
+	code, resp := forwardBulk(t, h, s, userID, "", chats[1], stranger, chats[2])
+	if code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want 207", code)
+	}
+	if len(resp.Results) != 3 {
+		t.Fatalf("got %d results, want one per target", len(resp.Results))
+	}
+
+	// Results come back in request order, each with its own reason
+	want := []struct {
+		id      uuid.UUID
+		success bool
+		reason  string
+	}{
+		{chats[1], true, ""},
+		{stranger, false, "You are not a member of this chat"},
+		{chats[2], false, "Failed to forward message"},
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.ID != w.id || got.Success != w.success || got.Error != w.reason {
+			t.Errorf("result %d = %+v, want %s success=%v error=%q", i, got, w.id, w.success, w.reason)
+		}
+	}
+	if resp.Results[0].Result == nil {
+		t.Error("successful target has no forwarded message")
+	}
+
+	// Nothing going through is reported as a failure of the whole request
+	code, resp = forwardBulk(t, h, s, userID, "", stranger, chats[2])
+	if code != http.StatusUnprocessableEntity {
+		t.Errorf("every target failed: status = %d, want 422", code)
+	}
+	if resp.Succeeded != 0 || resp.Failed != 2 {
+		t.Errorf("succeeded, failed = %d, %d; want 0, 2", resp.Succeeded, resp.Failed)
+	}
+
+	// And everything going through keeps the usual status
+	if code, _ := forwardBulk(t, h, s, userID, "", chats[1]); code != http.StatusCreated {
+		t.Errorf("every target succeeded: status = %d, want 201", code)
+	}
+}
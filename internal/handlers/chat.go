@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -12,6 +16,39 @@ import (
 	"github.com/llamasearch/llamachat/internal/models"
 )
 
+// Errors returned by ChatService membership methods
+var (
+	ErrChatNotFound = errors.New("chat not found")
+	ErrUserNotFound = errors.New("user not found")
+	// ErrNotChatMember is returned when changing a membership that doesn't
+	// exist, or posting to a chat the author isn't in
+	ErrNotChatMember = errors.New("user is not a member of this chat")
+	// ErrLastChatAdmin is returned rather than leave a chat with members but
+	// no admin
+	ErrLastChatAdmin = errors.New("chat must keep at least one admin")
+	// ErrFavoriteLimit is returned when favoriting a chat would put the user
+	// over their favorite chat limit
+	ErrFavoriteLimit = errors.New("favorite chat limit reached")
+)
+
+// ErrSemanticSearchDisabled is returned by SemanticSearchMessages when
+// semantic search is not enabled
+var ErrSemanticSearchDisabled = errors.New("semantic search is not enabled")
+
+// ErrReplyTargetNotFound is returned by CreateMessage when the message being
+// replied to isn't in the chat
+var ErrReplyTargetNotFound = errors.New("reply target not found")
+
+// ReplyDepthError is returned by CreateMessage for a reply that would nest
+// deeper than MaxReplyDepth in ReplyDepthReject mode
+type ReplyDepthError struct {
+	MaxDepth int
+}
+
+func (e *ReplyDepthError) Error() string {
+	return fmt.Sprintf("replies cannot be nested more than %d levels deep", e.MaxDepth)
+}
+
 // ChatService defines the interface for chat operations
 type ChatService interface {
 	// Chat methods
@@ -19,27 +56,137 @@ type ChatService interface {
 	CreateChat(ctx *gin.Context, chat *models.Chat) error
 	UpdateChat(ctx *gin.Context, chat *models.Chat) error
 	DeleteChat(ctx *gin.Context, id uuid.UUID) error
-	ListChats(ctx *gin.Context, userID uuid.UUID, limit, offset int) ([]*models.Chat, error)
+	ListChats(ctx *gin.Context, userID uuid.UUID, filter models.ChatFilter) ([]*models.Chat, error)
 	AddUserToChat(ctx *gin.Context, chatID, userID uuid.UUID, isAdmin bool) error
 	RemoveUserFromChat(ctx *gin.Context, chatID, userID uuid.UUID) error
+	LeaveChat(ctx *gin.Context, chatID, userID uuid.UUID) (*uuid.UUID, error)
+	ListChatMembers(ctx *gin.Context, chatID uuid.UUID) ([]*models.ChatMember, error)
+	SetChatMemberAdmin(ctx *gin.Context, chatID, userID uuid.UUID, isAdmin bool) error
+	GetChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (*models.ChatMember, error)
+	IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error)
+	SetChatFavorite(ctx *gin.Context, chatID, userID uuid.UUID, favorite bool) error
+	SetChatArchived(ctx *gin.Context, chatID, userID uuid.UUID, archived bool) error
+	// FavoriteChat marks a chat as a favorite, failing with
+	// ErrFavoriteLimit if the user already has limit other favorites
+	FavoriteChat(ctx *gin.Context, chatID, userID uuid.UUID, limit int) error
+	// ValidateAIModel checks a chat's assistant model against the allowlist
+	ValidateAIModel(model string) error
+
+	// Unread count methods
+	GetUnreadCounts(ctx *gin.Context, userID uuid.UUID) (map[uuid.UUID]int, error)
+	MarkChatRead(ctx *gin.Context, chatID, userID uuid.UUID, upTo time.Time) error
+	ListMessageReaders(ctx *gin.Context, messageID uuid.UUID, limit int) ([]*models.User, error)
+	CountMessagesByUserInChat(ctx *gin.Context, chatID uuid.UUID) (map[uuid.UUID]int, error)
+
+	// Draft methods
+	GetDraft(ctx *gin.Context, userID, chatID uuid.UUID) (*models.MessageDraft, error)
+	SaveDraft(ctx *gin.Context, draft *models.MessageDraft) error
+	DeleteDraft(ctx *gin.Context, userID, chatID uuid.UUID) error
+	ListDrafts(ctx *gin.Context, userID uuid.UUID) ([]*models.MessageDraft, error)
 
 	// Chat message methods
 	GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error)
+	// CreateMessage checks that the author is a member of the chat and
+	// applies the reply depth limit, returning ErrNotChatMember,
+	// ErrReplyTargetNotFound or a *ReplyDepthError, before saving and
+	// delivering the message
 	CreateMessage(ctx *gin.Context, message *models.Message) error
 	UpdateMessage(ctx *gin.Context, message *models.Message) error
+	ListMessageEdits(ctx *gin.Context, messageID uuid.UUID) ([]*models.MessageEdit, error)
 	DeleteMessage(ctx *gin.Context, id uuid.UUID) error
 	ListChatMessages(ctx *gin.Context, chatID uuid.UUID, limit, offset int) ([]*models.Message, error)
+	SearchMessages(ctx *gin.Context, userID uuid.UUID, query string, limit, offset int) ([]*models.Message, error)
+	SemanticSearchMessages(ctx *gin.Context, userID uuid.UUID, query string, limit int) ([]*models.Message, error)
+	ListThreadMessages(ctx *gin.Context, rootMessageID uuid.UUID, limit, offset int) ([]*models.Message, error)
+	ForwardMessage(ctx *gin.Context, message *models.Message, userID uuid.UUID, chatIDs []uuid.UUID) ([]*models.Message, error)
+
+	// Reaction methods
+	AddReaction(ctx *gin.Context, reaction *models.MessageReaction) error
+	RemoveReaction(ctx *gin.Context, messageID, userID uuid.UUID, emoji string) error
+}
+
+// Reply depth modes
+const (
+	// ReplyDepthReject rejects replies that would nest deeper than the limit
+	ReplyDepthReject = "reject"
+	// ReplyDepthFlatten re-targets such replies at the deepest allowed ancestor
+	ReplyDepthFlatten = "flatten"
+)
+
+// ChatConfig holds chat handling configuration
+type ChatConfig struct {
+	// MaxReplyDepth limits how deeply replies may nest. Zero means no limit.
+	MaxReplyDepth int
+	// ReplyDepthMode is ReplyDepthReject or ReplyDepthFlatten
+	ReplyDepthMode string
+	// DeletedUserAttribution is one of the models.Attribution* modes
+	DeletedUserAttribution string
+	// DeletedMessages is how message listings show deleted messages, one of
+	// the models.DeletedMessages* modes
+	DeletedMessages string
+	// AllowedReactions lists the emoji users may react with. Empty uses
+	// DefaultAllowedReactions.
+	AllowedReactions []string
+	// MaxFavorites caps how many chats a user can mark as favorites
+	MaxFavorites int
+	// MaxForwardTargets caps how many chats a message can be forwarded to at once
+	MaxForwardTargets int
+	// ForwardsPerMinute limits forward requests per client, separately from
+	// the global rate limit
+	ForwardsPerMinute int
+	// MaxSeenBy caps how many readers the seen-by list returns
+	MaxSeenBy int
+	// BulkMode is the default mode, BulkStrict or BulkBestEffort, for bulk
+	// operations that don't ask for one
+	BulkMode string
+	// MaxMessageLength caps message content, in characters. Zero means no
+	// limit.
+	MaxMessageLength int
+	// DeleteWhenEmpty deletes a chat once its last member is removed,
+	// instead of keeping it around without members
+	DeleteWhenEmpty bool
+	// EditGrace is how long after sending a message can be edited without
+	// being marked as edited. Zero marks every edit.
+	EditGrace time.Duration
 }
 
 // ChatHandler handles chat-related API endpoints
 type ChatHandler struct {
-	chatService ChatService
+	chatService      ChatService
+	config           ChatConfig
+	allowedReactions map[string]bool
+	forwardLimiter   *middleware.RateLimiter
 }
 
 // NewChatHandler creates a new chat handler
-func NewChatHandler(chatService ChatService) *ChatHandler {
+func NewChatHandler(chatService ChatService, config ChatConfig) *ChatHandler {
+	if config.ReplyDepthMode == "" {
+		config.ReplyDepthMode = ReplyDepthReject
+	}
+	if config.MaxFavorites <= 0 {
+		config.MaxFavorites = 10
+	}
+	if config.MaxForwardTargets <= 0 {
+		config.MaxForwardTargets = defaultMaxForwardTargets
+	}
+	if config.ForwardsPerMinute <= 0 {
+		config.ForwardsPerMinute = defaultForwardsPerMinute
+	}
+	if config.MaxSeenBy <= 0 {
+		config.MaxSeenBy = defaultMaxSeenBy
+	}
+	if config.BulkMode != BulkBestEffort {
+		config.BulkMode = BulkStrict
+	}
+
 	return &ChatHandler{
-		chatService: chatService,
+		chatService:      chatService,
+		config:           config,
+		allowedReactions: newReactionAllowlist(config.AllowedReactions),
+		forwardLimiter: middleware.NewRateLimiter(middleware.RateLimiterConfig{
+			Enabled:           true,
+			RequestsPerMinute: config.ForwardsPerMinute,
+		}),
 	}
 }
 
@@ -49,6 +196,9 @@ type CreateChatRequest struct {
 	Description string `json:"description"`
 	IsPrivate   bool   `json:"is_private"`
 	IsEncrypted bool   `json:"is_encrypted"`
+	// AIModel picks the assistant's model for the chat; empty uses the
+	// configured one
+	AIModel string `json:"ai_model"`
 }
 
 // CreateMessageRequest holds create message request data
@@ -58,6 +208,30 @@ type CreateMessageRequest struct {
 	ReplyTo          *uuid.UUID `json:"reply_to"`
 }
 
+// checkMessageLength responds with 400 and returns false if content is longer
+// than max characters. A max of zero means no limit.
+func checkMessageLength(c *gin.Context, content string, max int) bool {
+	return max <= 0 || checkLength(c, "content", content, max)
+}
+
+// checkAIModel writes a 400 response and returns false if a requested
+// assistant model isn't allowed. An empty model always is.
+func (h *ChatHandler) checkAIModel(c *gin.Context, model string) bool {
+	if model == "" {
+		return true
+	}
+	if err := h.chatService.ValidateAIModel(model); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ai_model is not allowed"})
+		return false
+	}
+	return true
+}
+
+// SaveDraftRequest represents the request body for saving a message draft
+type SaveDraftRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
 // GetChats handles listing all chats for the current user
 func (h *ChatHandler) GetChats(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -66,32 +240,98 @@ func (h *ChatHandler) GetChats(c *gin.Context) {
 		return
 	}
 
-	// Parse query parameters
-	limit := 20
-	offset := 0
+	filter, ok := chatFilter(c)
+	if !ok {
+		return
+	}
 
-	if limitParam := c.Query("limit"); limitParam != "" {
-		if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil {
-			limit = 20
-		}
+	chats, err := h.chatService.ListChats(c, userID, filter)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list chats")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chats"})
+		return
 	}
 
-	if offsetParam := c.Query("offset"); offsetParam != "" {
-		if _, err := fmt.Sscanf(offsetParam, "%d", &offset); err != nil {
-			offset = 0
-		}
+	// Unread counts are best-effort; the chat list is still useful without them
+	counts, err := h.chatService.GetUnreadCounts(c, userID)
+	if err != nil {
+		log.Ctx(c).Warn().Err(err).Msg("Failed to get unread counts")
+	}
+	for _, chat := range chats {
+		chat.UnreadCount = counts[chat.ID]
 	}
 
-	chats, err := h.chatService.ListChats(c, userID, limit, offset)
+	// Drafts are attached the same way so clients can restore them
+	drafts, err := h.chatService.ListDrafts(c, userID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to list chats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve chats"})
-		return
+		log.Ctx(c).Warn().Err(err).Msg("Failed to list drafts")
+	}
+	draftsByChat := make(map[uuid.UUID]*models.MessageDraft, len(drafts))
+	for _, draft := range drafts {
+		draftsByChat[draft.ChatID] = draft
+	}
+	for _, chat := range chats {
+		chat.Draft = draftsByChat[chat.ID]
 	}
 
 	c.JSON(http.StatusOK, gin.H{"chats": chats})
 }
 
+// chatFilter reads the chat list filter from the query string: q searches
+// chat names; private, favorite and archived are booleans; unread=true keeps
+// only chats with unread messages; sort is recent, name or created. It
+// responds with 400 and returns false for invalid values.
+func chatFilter(c *gin.Context) (models.ChatFilter, bool) {
+	filter := models.ChatFilter{
+		Search: c.Query("q"),
+		Sort:   c.Query("sort"),
+	}
+
+	var ok bool
+	if filter.Limit, filter.Offset, ok = parsePagination(c, 20, 100); !ok {
+		return filter, false
+	}
+
+	switch filter.Sort {
+	case "", models.ChatSortRecent, models.ChatSortName, models.ChatSortCreated:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort, must be recent, name or created"})
+		return filter, false
+	}
+
+	flags := []struct {
+		name  string
+		value **bool
+	}{
+		{"private", &filter.Private},
+		{"favorite", &filter.Favorite},
+		{"archived", &filter.Archived},
+	}
+	for _, flag := range flags {
+		param := c.Query(flag.name)
+		if param == "" {
+			continue
+		}
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s, must be true or false", flag.name)})
+			return filter, false
+		}
+		*flag.value = &value
+	}
+
+	if unread := c.Query("unread"); unread != "" {
+		value, err := strconv.ParseBool(unread)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unread, must be true or false"})
+			return filter, false
+		}
+		filter.UnreadOnly = value
+	}
+
+	return filter, true
+}
+
 // CreateChat handles creating a new chat
 func (h *ChatHandler) CreateChat(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -105,6 +345,9 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+	if !h.checkAIModel(c, req.AIModel) {
+		return
+	}
 
 	chat := &models.Chat{
 		ID:          uuid.New(),
@@ -113,10 +356,11 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 		CreatedBy:   userID,
 		IsPrivate:   req.IsPrivate,
 		IsEncrypted: req.IsEncrypted,
+		AIModel:     req.AIModel,
 	}
 
 	if err := h.chatService.CreateChat(c, chat); err != nil {
-		log.Error().Err(err).Msg("Failed to create chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to create chat")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create chat"})
 		return
 	}
@@ -124,17 +368,38 @@ func (h *ChatHandler) CreateChat(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"chat": chat})
 }
 
-// GetChat handles retrieving a single chat by ID
+// GetChat handles retrieving a single chat by ID. The chat includes its
+// members and latest message, so only members and chat managers can read it.
 func (h *ChatHandler) GetChat(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
 	chatID, err := uuid.Parse(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
 		return
 	}
 
+	if !middleware.HasPermission(c, models.PermManageChats) {
+		isMember, err := h.chatService.IsChatMember(c, chatID, userID)
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+			return
+		}
+		// Non-members can't tell a private chat from a missing one
+		if !isMember {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+			return
+		}
+	}
+
 	chat, err := h.chatService.GetChatByID(c, chatID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to retrieve chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve chat")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
 		return
 	}
@@ -158,13 +423,13 @@ func (h *ChatHandler) UpdateChat(c *gin.Context) {
 
 	chat, err := h.chatService.GetChatByID(c, chatID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to retrieve chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve chat")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
 		return
 	}
 
-	// Check if user is the creator or an admin
-	if chat.CreatedBy != userID && !middleware.IsAdmin(c) {
+	// Check if user is the creator or may manage any chat
+	if chat.CreatedBy != userID && !middleware.HasPermission(c, models.PermManageChats) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to update this chat"})
 		return
 	}
@@ -174,14 +439,18 @@ func (h *ChatHandler) UpdateChat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+	if !h.checkAIModel(c, req.AIModel) {
+		return
+	}
 
 	chat.Name = req.Name
 	chat.Description = req.Description
 	chat.IsPrivate = req.IsPrivate
 	chat.IsEncrypted = req.IsEncrypted
+	chat.AIModel = req.AIModel
 
 	if err := h.chatService.UpdateChat(c, chat); err != nil {
-		log.Error().Err(err).Msg("Failed to update chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to update chat")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat"})
 		return
 	}
@@ -205,19 +474,19 @@ func (h *ChatHandler) DeleteChat(c *gin.Context) {
 
 	chat, err := h.chatService.GetChatByID(c, chatID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to retrieve chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve chat")
 		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
 		return
 	}
 
-	// Check if user is the creator or an admin
-	if chat.CreatedBy != userID && !middleware.IsAdmin(c) {
+	// Check if user is the creator or may manage any chat
+	if chat.CreatedBy != userID && !middleware.HasPermission(c, models.PermManageChats) {
 		c.JSON(http.StatusForbidden, gin.H{"error": "You don't have permission to delete this chat"})
 		return
 	}
 
 	if err := h.chatService.DeleteChat(c, chatID); err != nil {
-		log.Error().Err(err).Msg("Failed to delete chat")
+		log.Ctx(c).Error().Err(err).Msg("Failed to delete chat")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete chat"})
 		return
 	}
@@ -233,26 +502,123 @@ func (h *ChatHandler) GetChatMessages(c *gin.Context) {
 		return
 	}
 
-	// Parse query parameters
-	limit := 50
-	offset := 0
+	limit, offset, ok := parsePagination(c, 50, 200)
+	if !ok {
+		return
+	}
 
-	if limitParam := c.Query("limit"); limitParam != "" {
-		if _, err := fmt.Sscanf(limitParam, "%d", &limit); err != nil {
-			limit = 50
-		}
+	messages, err := h.chatService.ListChatMessages(c, chatID, limit, offset)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve chat messages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
 	}
 
-	if offsetParam := c.Query("offset"); offsetParam != "" {
-		if _, err := fmt.Sscanf(offsetParam, "%d", &offset); err != nil {
-			offset = 0
+	// Fetching the latest page counts as reading the chat up to its newest
+	// message
+	if userID, exists := middleware.GetUserID(c); exists && offset == 0 && len(messages) > 0 {
+		if err := h.chatService.MarkChatRead(c, chatID, userID, messages[0].CreatedAt); err != nil {
+			log.Ctx(c).Warn().Err(err).Msg("Failed to mark chat read")
 		}
 	}
 
-	messages, err := h.chatService.ListChatMessages(c, chatID, limit, offset)
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// GetUnreadCounts handles retrieving the number of unread messages in each
+// of the user's chats, keyed by chat ID
+func (h *ChatHandler) GetUnreadCounts(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	counts, err := h.chatService.GetUnreadCounts(c, userID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to retrieve chat messages")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		log.Ctx(c).Error().Err(err).Msg("Failed to get unread counts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get unread counts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unread": counts})
+}
+
+// GetThread handles retrieving a message and every reply that leads back to
+// it, oldest first
+func (h *ChatHandler) GetThread(c *gin.Context) {
+	_, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, ok := parsePagination(c, 50, 200)
+	if !ok {
+		return
+	}
+
+	messages, err := h.chatService.ListThreadMessages(c, messageID, limit, offset)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve thread")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve thread"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// SearchMessages handles full-text search across the caller's chats. Only
+// chats the caller is a member of are searched.
+func (h *ChatHandler) SearchMessages(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, offset, ok := parsePagination(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	messages, err := h.chatService.SearchMessages(c, userID, c.Query("q"), limit, offset)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to search messages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// SemanticSearchMessages handles finding messages by meaning rather than
+// wording across the caller's chats, most similar first
+func (h *ChatHandler) SemanticSearchMessages(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query is required"})
+		return
+	}
+
+	limit, _, ok := parsePagination(c, 20, 100)
+	if !ok {
+		return
+	}
+
+	messages, err := h.chatService.SemanticSearchMessages(c, userID, query, limit)
+	switch {
+	case errors.Is(err, ErrSemanticSearchDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Semantic search is not enabled"})
+		return
+	case err != nil:
+		log.Ctx(c).Error().Err(err).Msg("Failed to search messages semantically")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search messages"})
 		return
 	}
 
@@ -278,6 +644,9 @@ func (h *ChatHandler) CreateChatMessage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+	if !checkMessageLength(c, req.Content, h.config.MaxMessageLength) {
+		return
+	}
 
 	message := &models.Message{
 		ID:               uuid.New(),
@@ -289,8 +658,18 @@ func (h *ChatHandler) CreateChatMessage(c *gin.Context) {
 		IsAIGenerated:    false,
 	}
 
-	if err := h.chatService.CreateMessage(c, message); err != nil {
-		log.Error().Err(err).Msg("Failed to create message")
+	var depthErr *ReplyDepthError
+	err = h.chatService.CreateMessage(c, message)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotChatMember):
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+		return
+	case errors.Is(err, ErrReplyTargetNotFound), errors.As(err, &depthErr):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	default:
+		log.Ctx(c).Error().Err(err).Msg("Failed to create message")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
 		return
 	}
@@ -298,18 +677,254 @@ func (h *ChatHandler) CreateChatMessage(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"message": message})
 }
 
+// GetMyMembership handles retrieving the current user's membership and role
+// in a chat
+func (h *ChatHandler) GetMyMembership(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return
+	}
+
+	member, err := h.chatService.GetChatMember(c, chatID, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "You are not a member of this chat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"membership": member})
+}
+
+// FavoriteChat handles pinning a chat to the top of the current user's list
+func (h *ChatHandler) FavoriteChat(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	err := h.chatService.FavoriteChat(c, chatID, userID, h.config.MaxFavorites)
+	if errors.Is(err, ErrFavoriteLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can have at most %d favorite chats", h.config.MaxFavorites)})
+		return
+	}
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to favorite chat")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to favorite chat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "is_favorite": true})
+}
+
+// UnfavoriteChat handles unpinning a chat from the current user's list
+func (h *ChatHandler) UnfavoriteChat(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.chatService.SetChatFavorite(c, chatID, userID, false); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to unfavorite chat")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unfavorite chat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "is_favorite": false})
+}
+
+// ArchiveChat handles archiving a chat in the current user's list
+func (h *ChatHandler) ArchiveChat(c *gin.Context) {
+	h.setChatArchived(c, true)
+}
+
+// UnarchiveChat handles moving a chat out of the current user's archive
+func (h *ChatHandler) UnarchiveChat(c *gin.Context) {
+	h.setChatArchived(c, false)
+}
+
+// setChatArchived sets the archived flag on the caller's membership
+func (h *ChatHandler) setChatArchived(c *gin.Context, archived bool) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.chatService.SetChatArchived(c, chatID, userID, archived); err != nil {
+		log.Ctx(c).Error().Err(err).Bool("archived", archived).Msg("Failed to set chat archived")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update chat"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "is_archived": archived})
+}
+
+// GetDraft handles retrieving the current user's draft for a chat
+func (h *ChatHandler) GetDraft(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	draft, err := h.chatService.GetDraft(c, userID, chatID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// SaveDraft handles creating or replacing the current user's draft for a chat
+func (h *ChatHandler) SaveDraft(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	var req SaveDraftRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	draft := &models.MessageDraft{
+		UserID:  userID,
+		ChatID:  chatID,
+		Content: req.Content,
+	}
+
+	if err := h.chatService.SaveDraft(c, draft); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to save draft")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save draft"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"draft": draft})
+}
+
+// DeleteDraft handles discarding the current user's draft for a chat
+func (h *ChatHandler) DeleteDraft(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	if err := h.chatService.DeleteDraft(c, userID, chatID); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to delete draft")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete draft"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft deleted successfully"})
+}
+
+// memberTarget resolves the caller and chat for a request about the caller's
+// own state in a chat, writing an error response and returning false unless
+// the caller is a member of the chat
+func (h *ChatHandler) memberTarget(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	isMember, err := h.chatService.IsChatMember(c, chatID, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, chatID, true
+}
+
+// messageTarget resolves the caller and message for a request about a message,
+// writing an error response and returning false unless the caller is a member
+// of the chat the message belongs to
+func (h *ChatHandler) messageTarget(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	message, err := h.chatService.GetMessageByID(c, messageID)
+	if err != nil || message.ChatID != chatID || message.IsDeleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, messageID, true
+}
+
 // RegisterRoutes registers chat routes
 func (h *ChatHandler) RegisterRoutes(router *gin.RouterGroup) {
 	chats := router.Group("/chats")
 	{
 		chats.GET("", h.GetChats)
 		chats.POST("", h.CreateChat)
+		chats.GET("/unread", h.GetUnreadCounts)
 		chats.GET("/:id", h.GetChat)
 		chats.PUT("/:id", h.UpdateChat)
 		chats.DELETE("/:id", h.DeleteChat)
+		chats.GET("/:id/my-membership", h.GetMyMembership)
+		chats.GET("/:id/message-counts", h.GetMessageCounts)
+
+		// Members
+		chats.GET("/:id/members", h.GetChatMembers)
+		chats.POST("/:id/members", h.AddChatMember)
+		chats.PUT("/:id/members/:userID", h.UpdateChatMember)
+		chats.DELETE("/:id/members/:userID", h.RemoveChatMember)
+		chats.POST("/:id/leave", h.LeaveChat)
+
+		// Favorites
+		chats.PUT("/:id/favorite", h.FavoriteChat)
+		chats.DELETE("/:id/favorite", h.UnfavoriteChat)
+
+		// Archive
+		chats.PUT("/:id/archive", h.ArchiveChat)
+		chats.DELETE("/:id/archive", h.UnarchiveChat)
 
 		// Chat messages
 		chats.GET("/:id/messages", h.GetChatMessages)
 		chats.POST("/:id/messages", h.CreateChatMessage)
+		chats.PUT("/:id/messages/:messageID", h.UpdateChatMessage)
+		chats.GET("/:id/messages/:messageID/thread", h.GetThread)
+		chats.GET("/:id/messages/:messageID/history", h.GetMessageHistory)
+		chats.GET("/:id/messages/:messageID/seen-by", h.GetSeenBy)
+		chats.POST("/:id/messages/:messageID/forward", h.forwardLimiter.Middleware(), h.ForwardMessage)
+
+		// Message reactions
+		chats.POST("/:id/messages/:messageID/reactions", h.AddReaction)
+		chats.DELETE("/:id/messages/:messageID/reactions", h.RemoveReaction)
+
+		// Message drafts
+		chats.GET("/:id/draft", h.GetDraft)
+		chats.PUT("/:id/draft", h.SaveDraft)
+		chats.DELETE("/:id/draft", h.DeleteDraft)
 	}
+
+	router.GET("/messages/search", h.SearchMessages)
+	router.GET("/messages/semantic-search", h.SemanticSearchMessages)
 }
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve routes a single request to handler, registered at route, as the given
+// user. A nil userID sends the request unauthenticated.
+func serve(handler gin.HandlerFunc, method, route, path string, userID *uuid.UUID, body interface{}) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Handle(method, route, func(c *gin.Context) {
+		if userID != nil {
+			c.Set("user_id", *userID)
+		}
+		handler(c)
+	})
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, _ := json.Marshal(body)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// stubChatService implements the ChatService methods chat handler tests use.
+// Calling any other method panics.
+type stubChatService struct {
+	ChatService
+
+	chats         map[uuid.UUID]*models.Chat
+	members       map[uuid.UUID]bool
+	allowedModels map[string]bool
+	created       []*models.Chat
+	updated       []*models.Chat
+}
+
+func newStubChatService() *stubChatService {
+	return &stubChatService{chats: make(map[uuid.UUID]*models.Chat)}
+}
+
+func (s *stubChatService) ValidateAIModel(model string) error {
+	if s.allowedModels != nil && !s.allowedModels[model] {
+		return fmt.Errorf("model is not allowed: %q", model)
+	}
+	return nil
+}
+
+func (s *stubChatService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return s.members[userID], nil
+}
+
+func (s *stubChatService) CreateChat(ctx *gin.Context, chat *models.Chat) error {
+	s.chats[chat.ID] = chat
+	s.created = append(s.created, chat)
+	return nil
+}
+
+func (s *stubChatService) GetChatByID(ctx *gin.Context, id uuid.UUID) (*models.Chat, error) {
+	chat, ok := s.chats[id]
+	if !ok {
+		return nil, ErrChatNotFound
+	}
+	copied := *chat
+	return &copied, nil
+}
+
+func (s *stubChatService) UpdateChat(ctx *gin.Context, chat *models.Chat) error {
+	s.chats[chat.ID] = chat
+	s.updated = append(s.updated, chat)
+	return nil
+}
+
+func TestCreateChatAIModel(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		model      string
+		wantStatus int
+	}{
+		{"no override", "", http.StatusCreated},
+		{"allowed override", "gpt-4o-mini", http.StatusCreated},
+		{"disallowed override", "gpt-4-32k", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newStubChatService()
+			service.allowedModels = map[string]bool{"gpt-4o": true, "gpt-4o-mini": true}
+			h := NewChatHandler(service, ChatConfig{})
+
+			w := serve(h.CreateChat, http.MethodPost, "/chats", "/chats", &userID,
+				CreateChatRequest{Name: "general", AIModel: tt.model})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+
+			if tt.wantStatus != http.StatusCreated {
+				if len(service.created) != 0 {
+					t.Error("chat was created despite the rejected model")
+				}
+				return
+			}
+			if len(service.created) != 1 || service.created[0].AIModel != tt.model {
+				t.Errorf("created chats = %+v, want one with ai_model %q", service.created, tt.model)
+			}
+		})
+	}
+}
+
+func TestGetChatRequiresMembership(t *testing.T) {
+	member, stranger, manager := uuid.New(), uuid.New(), uuid.New()
+	chat := &models.Chat{
+		ID:          uuid.New(),
+		Name:        "private",
+		IsPrivate:   true,
+		Members:     []*models.ChatMember{{UserID: member}},
+		LastMessage: &models.Message{Content: "secret"},
+	}
+
+	tests := []struct {
+		name   string
+		userID uuid.UUID
+		claims *auth.Claims
+		want   int
+	}{
+		{"member", member, nil, http.StatusOK},
+		{"non-member", stranger, nil, http.StatusNotFound},
+		{"chat manager", manager, &auth.Claims{Permissions: []string{models.PermManageChats}}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := newStubChatService()
+			service.chats[chat.ID] = chat
+			service.members = map[uuid.UUID]bool{member: true}
+			h := NewChatHandler(service, ChatConfig{})
+			handler := h.GetChat
+			if tt.claims != nil {
+				handler = func(c *gin.Context) {
+					c.Set("claims", tt.claims)
+					h.GetChat(c)
+				}
+			}
+
+			userID := tt.userID
+			w := serve(handler, http.MethodGet, "/chats/:id", "/chats/"+chat.ID.String(), &userID, nil)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+			if tt.want != http.StatusOK && strings.Contains(w.Body.String(), "secret") {
+				t.Error("non-member was shown the chat's last message")
+			}
+		})
+	}
+}
+
+func TestUpdateChatRejectsDisallowedAIModel(t *testing.T) {
+	userID := uuid.New()
+	service := newStubChatService()
+	service.allowedModels = map[string]bool{"gpt-4o": true}
+	chat := &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: userID, AIModel: "gpt-4o"}
+	service.chats[chat.ID] = chat
+	h := NewChatHandler(service, ChatConfig{})
+
+	w := serve(h.UpdateChat, http.MethodPut, "/chats/:id", "/chats/"+chat.ID.String(), &userID,
+		CreateChatRequest{Name: "general", AIModel: "gpt-4-32k"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if len(service.updated) != 0 || service.chats[chat.ID].AIModel != "gpt-4o" {
+		t.Error("chat was updated despite the rejected model")
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// listedChats records the filters chat lists are requested with
+type listedChats struct {
+	ChatService
+	filters []models.ChatFilter
+}
+
+func (s *listedChats) ListChats(ctx *gin.Context, userID uuid.UUID, filter models.ChatFilter) ([]*models.Chat, error) {
+	s.filters = append(s.filters, filter)
+	return nil, nil
+}
+
+func (s *listedChats) GetUnreadCounts(ctx *gin.Context, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	return nil, nil
+}
+
+func (s *listedChats) ListDrafts(ctx *gin.Context, userID uuid.UUID) ([]*models.MessageDraft, error) {
+	return nil, nil
+}
+
+func TestGetChatsFilterParams(t *testing.T) {
+	userID := uuid.New()
+	yes, no := true, false
+
+	tests := []struct {
+		query string
+		want  models.ChatFilter
+	}{
+		{"", models.ChatFilter{Limit: 20}},
+		{"?q=design&sort=name", models.ChatFilter{Search: "design", Sort: models.ChatSortName, Limit: 20}},
+		{"?private=true&favorite=0&archived=false", models.ChatFilter{Private: &yes, Favorite: &no, Archived: &no, Limit: 20}},
+		{"?unread=true&sort=created", models.ChatFilter{UnreadOnly: true, Sort: models.ChatSortCreated, Limit: 20}},
+		{"?unread=false&sort=recent", models.ChatFilter{Sort: models.ChatSortRecent, Limit: 20}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			s := &listedChats{}
+			h := NewChatHandler(s, ChatConfig{})
+
+			w := serve(h.GetChats, http.MethodGet, "/chats", "/chats"+tt.query, &userID, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+			}
+			if len(s.filters) != 1 {
+				t.Fatalf("listed %d times, want 1", len(s.filters))
+			}
+			got := s.filters[0]
+			if got.Search != tt.want.Search || got.Sort != tt.want.Sort || got.UnreadOnly != tt.want.UnreadOnly ||
+				got.Limit != tt.want.Limit || got.Offset != tt.want.Offset {
+				t.Errorf("filter = %+v, want %+v", got, tt.want)
+			}
+			for name, flags := range map[string][2]*bool{
+				"private":  {got.Private, tt.want.Private},
+				"favorite": {got.Favorite, tt.want.Favorite},
+				"archived": {got.Archived, tt.want.Archived},
+			} {
+				if (flags[0] == nil) != (flags[1] == nil) || (flags[0] != nil && *flags[0] != *flags[1]) {
+					t.Errorf("%s = %v, want %v", name, flags[0], flags[1])
+				}
+			}
+		})
+	}
+}
+
+func TestGetChatsRejectsInvalidFilters(t *testing.T) {
+	userID := uuid.New()
+
+	for _, query := range []string{
+		"?sort=updated_at",
+		"?sort=name%3B%20DROP%20TABLE%20chats",
+		"?private=maybe",
+		"?favorite=yes",
+		"?archived=2",
+		"?unread=soon",
+	} {
+		t.Run(query, func(t *testing.T) {
+			s := &listedChats{}
+			h := NewChatHandler(s, ChatConfig{})
+
+			w := serve(h.GetChats, http.MethodGet, "/chats", "/chats"+query, &userID, nil)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want 400 (body %s)", w.Code, w.Body)
+			}
+			if len(s.filters) != 0 {
+				t.Errorf("chats were listed with %+v", s.filters[0])
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// DMService defines the interface for direct message operations
+type DMService interface {
+	GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error)
+	GetDMConversation(ctx *gin.Context, userID, otherID uuid.UUID) (*models.DMConversation, error)
+	GetDirectMessageByID(ctx *gin.Context, id uuid.UUID) (*models.DirectMessage, error)
+	ListDirectMessages(ctx *gin.Context, userID, otherID uuid.UUID, limit, offset int) ([]*models.DirectMessage, error)
+	CreateDirectMessage(ctx *gin.Context, message *models.DirectMessage) error
+	UpdateDirectMessage(ctx *gin.Context, message *models.DirectMessage) error
+	DeleteDirectMessage(ctx *gin.Context, id uuid.UUID) error
+	MarkDirectMessagesRead(ctx *gin.Context, recipientID, senderID uuid.UUID) error
+}
+
+// UpdateDirectMessageRequest represents the request body for editing a
+// direct message
+type UpdateDirectMessageRequest struct {
+	Content          string `json:"content" binding:"required"`
+	ContentEncrypted bool   `json:"content_encrypted"`
+}
+
+// DirectMessageHandler handles direct message API endpoints
+type DirectMessageHandler struct {
+	dmService        DMService
+	maxMessageLength int
+	editGrace        time.Duration
+}
+
+// NewDirectMessageHandler creates a new direct message handler. Messages
+// longer than maxMessageLength characters are rejected unless it is zero.
+// Edits within editGrace of sending don't mark a message as edited.
+func NewDirectMessageHandler(dmService DMService, maxMessageLength int, editGrace time.Duration) *DirectMessageHandler {
+	return &DirectMessageHandler{
+		dmService:        dmService,
+		maxMessageLength: maxMessageLength,
+		editGrace:        editGrace,
+	}
+}
+
+// peerTarget resolves the caller and the other user of a DM route, writing an
+// error response and returning ok=false if either is missing or they're the
+// same user
+func (h *DirectMessageHandler) peerTarget(c *gin.Context) (userID uuid.UUID, peer *models.User, ok bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, nil, false
+	}
+
+	peerID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, nil, false
+	}
+	if peerID == userID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't message yourself"})
+		return uuid.Nil, nil, false
+	}
+
+	peer, err = h.dmService.GetUserByID(c, peerID)
+	if err != nil || !peer.IsActive {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return uuid.Nil, nil, false
+	}
+
+	return userID, peer, true
+}
+
+// GetConversation returns the caller's conversation with another user. Every
+// pair of users has exactly one conversation, so this works whether or not
+// any messages have been sent yet, and both users get the same ID.
+func (h *DirectMessageHandler) GetConversation(c *gin.Context) {
+	userID, peer, ok := h.peerTarget(c)
+	if !ok {
+		return
+	}
+
+	conversation, err := h.dmService.GetDMConversation(c, userID, peer.ID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get DM conversation")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get conversation"})
+		return
+	}
+	conversation.Peer = peer.Public()
+
+	c.JSON(http.StatusOK, gin.H{"conversation": conversation})
+}
+
+// GetMessages handles listing the caller's direct messages with another
+// user, newest first. Fetching the latest page marks the other user's
+// messages as read.
+func (h *DirectMessageHandler) GetMessages(c *gin.Context) {
+	userID, peer, ok := h.peerTarget(c)
+	if !ok {
+		return
+	}
+
+	limit, offset, ok := parsePagination(c, 50, 200)
+	if !ok {
+		return
+	}
+
+	messages, err := h.dmService.ListDirectMessages(c, userID, peer.ID, limit, offset)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to retrieve direct messages")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
+		return
+	}
+
+	if offset == 0 {
+		if err := h.dmService.MarkDirectMessagesRead(c, userID, peer.ID); err != nil {
+			log.Ctx(c).Warn().Err(err).Msg("Failed to mark direct messages read")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+// CreateMessage handles sending a direct message to another user
+func (h *DirectMessageHandler) CreateMessage(c *gin.Context) {
+	userID, peer, ok := h.peerTarget(c)
+	if !ok {
+		return
+	}
+
+	var req CreateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !checkMessageLength(c, req.Content, h.maxMessageLength) {
+		return
+	}
+
+	// Replies must stay within the same conversation
+	if req.ReplyTo != nil {
+		parent, err := h.dmService.GetDirectMessageByID(c, *req.ReplyTo)
+		if err != nil || !inConversation(parent, userID, peer.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Reply target not found in this conversation"})
+			return
+		}
+	}
+
+	message := &models.DirectMessage{
+		ID:               uuid.New(),
+		SenderID:         userID,
+		RecipientID:      peer.ID,
+		Content:          req.Content,
+		ContentEncrypted: req.ContentEncrypted,
+		ReplyTo:          req.ReplyTo,
+	}
+
+	if err := h.dmService.CreateDirectMessage(c, message); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to create direct message")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": message})
+}
+
+// UpdateMessage handles editing a direct message. Only its sender can edit it.
+func (h *DirectMessageHandler) UpdateMessage(c *gin.Context) {
+	message, ok := h.ownMessage(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateDirectMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !checkMessageLength(c, req.Content, h.maxMessageLength) {
+		return
+	}
+
+	message.Content = req.Content
+	message.ContentEncrypted = req.ContentEncrypted
+	message.IsEdited = message.IsEdited || !withinEditGrace(message.CreatedAt, h.editGrace)
+
+	if err := h.dmService.UpdateDirectMessage(c, message); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to update direct message")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// DeleteMessage handles deleting a direct message. Only its sender can
+// delete it.
+func (h *DirectMessageHandler) DeleteMessage(c *gin.Context) {
+	message, ok := h.ownMessage(c)
+	if !ok {
+		return
+	}
+
+	if err := h.dmService.DeleteDirectMessage(c, message.ID); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to delete direct message")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message deleted successfully"})
+}
+
+// ownMessage resolves the message of a message route, writing an error
+// response and returning ok=false unless it belongs to the conversation and
+// was sent by the caller
+func (h *DirectMessageHandler) ownMessage(c *gin.Context) (*models.DirectMessage, bool) {
+	userID, peer, ok := h.peerTarget(c)
+	if !ok {
+		return nil, false
+	}
+
+	messageID, err := uuid.Parse(c.Param("messageID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return nil, false
+	}
+
+	message, err := h.dmService.GetDirectMessageByID(c, messageID)
+	if err != nil || message.IsDeleted || !inConversation(message, userID, peer.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, false
+	}
+	if message.SenderID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only change messages you sent"})
+		return nil, false
+	}
+
+	return message, true
+}
+
+// inConversation reports whether a message was sent between the two users,
+// in either direction
+func inConversation(message *models.DirectMessage, userID, otherID uuid.UUID) bool {
+	return (message.SenderID == userID && message.RecipientID == otherID) ||
+		(message.SenderID == otherID && message.RecipientID == userID)
+}
+
+// RegisterRoutes registers direct message routes
+func (h *DirectMessageHandler) RegisterRoutes(router *gin.RouterGroup) {
+	dms := router.Group("/dms")
+	{
+		dms.GET("/:userID", h.GetConversation)
+		dms.GET("/:userID/messages", h.GetMessages)
+		dms.POST("/:userID/messages", h.CreateMessage)
+		dms.PUT("/:userID/messages/:messageID", h.UpdateMessage)
+		dms.DELETE("/:userID/messages/:messageID", h.DeleteMessage)
+	}
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// editedMessage serves one chat message for editing and keeps what is saved
+type editedMessage struct {
+	ChatService
+	message *models.Message
+	saved   *models.Message
+}
+
+func (s *editedMessage) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (s *editedMessage) GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error) {
+	copied := *s.message
+	return &copied, nil
+}
+
+func (s *editedMessage) UpdateMessage(ctx *gin.Context, message *models.Message) error {
+	s.saved = message
+	return nil
+}
+
+// editedDM does the same for a direct message
+type editedDM struct {
+	DMService
+	peer    *models.User
+	message *models.DirectMessage
+	saved   *models.DirectMessage
+}
+
+func (s *editedDM) GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error) {
+	return s.peer, nil
+}
+
+func (s *editedDM) GetDirectMessageByID(ctx *gin.Context, id uuid.UUID) (*models.DirectMessage, error) {
+	copied := *s.message
+	return &copied, nil
+}
+
+func (s *editedDM) UpdateDirectMessage(ctx *gin.Context, message *models.DirectMessage) error {
+	s.saved = message
+	return nil
+}
+
+var editGraceTests = []struct {
+	name          string
+	grace         time.Duration
+	age           time.Duration
+	alreadyEdited bool
+	want          bool
+}{
+	{"inside the grace window", time.Minute, 10 * time.Second, false, false},
+	{"after the grace window", time.Minute, 2 * time.Minute, false, true},
+	{"no grace window", 0, time.Second, false, true},
+	// A message once marked edited stays marked
+	{"already edited", time.Minute, 10 * time.Second, true, true},
+}
+
+func TestEditChatMessageGraceWindow(t *testing.T) {
+	userID := uuid.New()
+	chatID := uuid.New()
+
+	for _, tt := range editGraceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &editedMessage{message: &models.Message{
+				ID:        uuid.New(),
+				ChatID:    chatID,
+				UserID:    &userID,
+				Content:   "teh",
+				CreatedAt: time.Now().Add(-tt.age),
+				IsEdited:  tt.alreadyEdited,
+			}}
+			h := NewChatHandler(s, ChatConfig{EditGrace: tt.grace})
+
+			path := "/chats/" + chatID.String() + "/messages/" + s.message.ID.String()
+			w := serve(h.UpdateChatMessage, http.MethodPut, "/chats/:id/messages/:messageID", path, &userID,
+				UpdateMessageRequest{Content: "the"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+			}
+			if s.saved == nil || s.saved.Content != "the" {
+				t.Fatalf("saved %+v, want the edited content", s.saved)
+			}
+			if s.saved.IsEdited != tt.want {
+				t.Errorf("IsEdited = %v, want %v", s.saved.IsEdited, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditDirectMessageGraceWindow(t *testing.T) {
+	userID := uuid.New()
+	peer := &models.User{ID: uuid.New(), IsActive: true}
+
+	for _, tt := range editGraceTests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &editedDM{peer: peer, message: &models.DirectMessage{
+				ID:          uuid.New(),
+				SenderID:    userID,
+				RecipientID: peer.ID,
+				Content:     "teh",
+				CreatedAt:   time.Now().Add(-tt.age),
+				IsEdited:    tt.alreadyEdited,
+			}}
+			h := NewDirectMessageHandler(s, 0, tt.grace)
+
+			path := "/dms/" + peer.ID.String() + "/messages/" + s.message.ID.String()
+			w := serve(h.UpdateMessage, http.MethodPut, "/dms/:userID/messages/:messageID", path, &userID,
+				UpdateDirectMessageRequest{Content: "the"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+			}
+			if s.saved == nil || s.saved.IsEdited != tt.want {
+				t.Errorf("saved %+v, want IsEdited %v", s.saved, tt.want)
+			}
+		})
+	}
+}
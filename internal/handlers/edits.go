@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// UpdateMessageRequest holds the new content of an edited chat message
+type UpdateMessageRequest struct {
+	Content          string `json:"content" binding:"required"`
+	ContentEncrypted bool   `json:"content_encrypted"`
+}
+
+// UpdateChatMessage handles editing a chat message. Only its author can edit
+// it, and deleted messages can't be edited. The replaced content is kept in
+// the message's edit history. Edits within the edit grace period after
+// sending don't mark the message as edited.
+func (h *ChatHandler) UpdateChatMessage(c *gin.Context) {
+	userID, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !checkMessageLength(c, req.Content, h.config.MaxMessageLength) {
+		return
+	}
+
+	message, err := h.chatService.GetMessageByID(c, messageID)
+	if err != nil || message.IsDeleted {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+	if message.UserID == nil || *message.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only edit your own messages"})
+		return
+	}
+
+	message.Content = req.Content
+	message.ContentEncrypted = req.ContentEncrypted
+	message.IsEdited = message.IsEdited || !withinEditGrace(message.CreatedAt, h.config.EditGrace)
+
+	if err := h.chatService.UpdateMessage(c, message); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to update message")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update message"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+// withinEditGrace reports whether an edit made now to a message sent at
+// createdAt is quick enough not to mark the message as edited
+func withinEditGrace(createdAt time.Time, grace time.Duration) bool {
+	return time.Since(createdAt) <= grace
+}
+
+// GetMessageHistory handles listing the earlier versions of a chat message,
+// oldest first. It is open to the message's author and to chat admins.
+func (h *ChatHandler) GetMessageHistory(c *gin.Context) {
+	userID, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	message, err := h.chatService.GetMessageByID(c, messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	if message.UserID == nil || *message.UserID != userID {
+		member, err := h.chatService.GetChatMember(c, message.ChatID, userID)
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Msg("Failed to get chat member")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+			return
+		}
+		if !isChatModerator(c, member) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the author and chat admins can view a message's history"})
+			return
+		}
+	}
+
+	edits, err := h.chatService.ListMessageEdits(c, messageID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list message edits")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get message history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"edits": edits})
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// favoriteService keeps one user's favorite chats in memory. The user is a
+// member of every chat.
+type favoriteService struct {
+	ChatService
+
+	favorites map[uuid.UUID]bool
+}
+
+func (s *favoriteService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return true, nil
+}
+
+func (s *favoriteService) FavoriteChat(ctx *gin.Context, chatID, userID uuid.UUID, limit int) error {
+	if !s.favorites[chatID] && len(s.favorites) >= limit {
+		return ErrFavoriteLimit
+	}
+	s.favorites[chatID] = true
+	return nil
+}
+
+func (s *favoriteService) SetChatFavorite(ctx *gin.Context, chatID, userID uuid.UUID, favorite bool) error {
+	if favorite {
+		s.favorites[chatID] = true
+	} else {
+		delete(s.favorites, chatID)
+	}
+	return nil
+}
+
+func TestFavoriteChatLimit(t *testing.T) {
+	userID := uuid.New()
+	service := &favoriteService{favorites: make(map[uuid.UUID]bool)}
+	h := NewChatHandler(service, ChatConfig{MaxFavorites: 2})
+
+	favorite := func(method string, chatID uuid.UUID) int {
+		handler := h.FavoriteChat
+		if method == http.MethodDelete {
+			handler = h.UnfavoriteChat
+		}
+		return serve(handler, method, "/chats/:id/favorite", "/chats/"+chatID.String()+"/favorite", &userID, nil).Code
+	}
+
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	for _, chatID := range []uuid.UUID{first, second} {
+		if code := favorite(http.MethodPut, chatID); code != http.StatusOK {
+			t.Fatalf("favoriting within the limit: status = %d, want 200", code)
+		}
+	}
+
+	if code := favorite(http.MethodPut, third); code != http.StatusBadRequest {
+		t.Errorf("favoriting over the limit: status = %d, want 400", code)
+	}
+	if service.favorites[third] {
+		t.Error("chat was favorited despite the limit")
+	}
+	// Favoriting a chat that already is one doesn't count against the limit
+	if code := favorite(http.MethodPut, second); code != http.StatusOK {
+		t.Errorf("refavoriting at the limit: status = %d, want 200", code)
+	}
+
+	// Unfavoriting frees a slot
+	if code := favorite(http.MethodDelete, first); code != http.StatusOK {
+		t.Fatalf("unfavoriting: status = %d, want 200", code)
+	}
+	if code := favorite(http.MethodPut, third); code != http.StatusOK {
+		t.Errorf("favoriting after freeing a slot: status = %d, want 200", code)
+	}
+	if len(service.favorites) != 2 || !service.favorites[second] || !service.favorites[third] {
+		t.Errorf("favorites = %v, want the second and third chats", service.favorites)
+	}
+}
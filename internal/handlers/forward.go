@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// Forwarding defaults
+const (
+	defaultMaxForwardTargets = 5
+	defaultForwardsPerMinute = 10
+)
+
+// ForwardMessageRequest represents the request body for forwarding a message
+type ForwardMessageRequest struct {
+	ChatIDs []uuid.UUID `json:"chat_ids" binding:"required"`
+}
+
+// ForwardMessage handles copying a message into one or more other chats. In
+// strict mode the caller must be a member of every target, and if any target
+// fails the check nothing is forwarded. In best-effort mode the message is
+// forwarded to each target it can be, with a result reported per target.
+func (h *ChatHandler) ForwardMessage(c *gin.Context) {
+	userID, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	var req ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	targets := make([]uuid.UUID, 0, len(req.ChatIDs))
+	seen := make(map[uuid.UUID]bool, len(req.ChatIDs))
+	for _, chatID := range req.ChatIDs {
+		if !seen[chatID] {
+			seen[chatID] = true
+			targets = append(targets, chatID)
+		}
+	}
+	if len(targets) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one target chat is required"})
+		return
+	}
+	if len(targets) > h.config.MaxForwardTargets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A message can be forwarded to at most %d chats at once", h.config.MaxForwardTargets)})
+		return
+	}
+
+	mode, ok := bulkMode(c, h.config.BulkMode)
+	if !ok {
+		return
+	}
+
+	message, err := h.chatService.GetMessageByID(c, messageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	if mode == BulkBestEffort {
+		h.forwardBestEffort(c, message, userID, targets)
+		return
+	}
+
+	for _, chatID := range targets {
+		isMember, err := h.chatService.IsChatMember(c, chatID, userID)
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+			return
+		}
+		if !isMember {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of every target chat", "chat_id": chatID})
+			return
+		}
+	}
+
+	forwarded, err := h.chatService.ForwardMessage(c, message, userID, targets)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to forward message")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to forward message"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"messages": forwarded})
+}
+
+// forwardBestEffort forwards a message to each target separately, so a
+// target the caller can't post to doesn't stop the others
+func (h *ChatHandler) forwardBestEffort(c *gin.Context, message *models.Message, userID uuid.UUID, targets []uuid.UUID) {
+	var results bulkResults
+	for _, chatID := range targets {
+		isMember, err := h.chatService.IsChatMember(c, chatID, userID)
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+			results.fail(chatID, "Failed to forward message")
+			continue
+		}
+		if !isMember {
+			results.fail(chatID, "You are not a member of this chat")
+			continue
+		}
+
+		forwarded, err := h.chatService.ForwardMessage(c, message, userID, []uuid.UUID{chatID})
+		if err != nil {
+			log.Ctx(c).Error().Err(err).Str("chat_id", chatID.String()).Msg("Failed to forward message")
+			results.fail(chatID, "Failed to forward message")
+			continue
+		}
+		results.succeed(chatID, forwarded[0])
+	}
+
+	results.write(c, http.StatusCreated)
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// forwardService holds one message and the chats the caller belongs to, and
+// records every chat a message is forwarded into
+type forwardService struct {
+	ChatService
+
+	message   *models.Message
+	member    map[uuid.UUID]bool
+	forwarded []uuid.UUID
+}
+
+func newForwardService(memberChats int) (*forwardService, []uuid.UUID) {
+	s := &forwardService{member: make(map[uuid.UUID]bool)}
+	chats := make([]uuid.UUID, memberChats)
+	for i := range chats {
+		chats[i] = uuid.New()
+		s.member[chats[i]] = true
+	}
+	s.message = &models.Message{ID: uuid.New(), ChatID: chats[0], Content: "worth sharing"}
+	return s, chats
+}
+
+func (s *forwardService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return s.member[chatID], nil
+}
+
+func (s *forwardService) GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error) {
+	if id != s.message.ID {
+		return nil, ErrChatNotFound
+	}
+	return s.message, nil
+}
+
+func (s *forwardService) ForwardMessage(ctx *gin.Context, message *models.Message, userID uuid.UUID, chatIDs []uuid.UUID) ([]*models.Message, error) {
+	var copies []*models.Message
+	for _, chatID := range chatIDs {
+		s.forwarded = append(s.forwarded, chatID)
+		copies = append(copies, &models.Message{ID: uuid.New(), ChatID: chatID, Content: message.Content})
+	}
+	return copies, nil
+}
+
+// forward sends a forward request for the service's message
+func (s *forwardService) forward(h *ChatHandler, userID uuid.UUID, query string, targets ...uuid.UUID) int {
+	path := "/chats/" + s.message.ChatID.String() + "/messages/" + s.message.ID.String() + "/forward" + query
+	return serve(h.ForwardMessage, http.MethodPost, "/chats/:id/messages/:messageID/forward", path, &userID,
+		ForwardMessageRequest{ChatIDs: targets}).Code
+}
+
+func TestForwardMessageFanOutCap(t *testing.T) {
+	userID := uuid.New()
+	s, chats := newForwardService(5)
+	h := NewChatHandler(s, ChatConfig{MaxForwardTargets: 3})
+
+	if code := s.forward(h, userID, "", chats[1:5]...); code != http.StatusBadRequest {
+		t.Errorf("4 targets with a cap of 3: status = %d, want 400", code)
+	}
+	if len(s.forwarded) != 0 {
+		t.Fatalf("forwarded to %v despite the cap", s.forwarded)
+	}
+
+	// Repeated targets count once
+	if code := s.forward(h, userID, "", chats[1], chats[2], chats[3], chats[1], chats[3]); code != http.StatusCreated {
+		t.Errorf("3 distinct targets: status = %d, want 201", code)
+	}
+	if len(s.forwarded) != 3 {
+		t.Errorf("forwarded to %v, want each target once", s.forwarded)
+	}
+
+	if code := s.forward(h, userID, ""); code != http.StatusBadRequest {
+		t.Errorf("no targets: status = %d, want 400", code)
+	}
+}
+
+func TestForwardMessageStrictIsAllOrNothing(t *testing.T) {
+	userID := uuid.New()
+	s, chats := newForwardService(3)
+	h := NewChatHandler(s, ChatConfig{})
+	stranger := uuid.New()
+
+	if code := s.forward(h, userID, "", chats[1], stranger, chats[2]); code != http.StatusForbidden {
+		t.Errorf("one target the caller isn't in: status = %d, want 403", code)
+	}
+	if len(s.forwarded) != 0 {
+		t.Errorf("forwarded to %v though one target was invalid", s.forwarded)
+	}
+
+	if code := s.forward(h, userID, "", chats[1], chats[2]); code != http.StatusCreated {
+		t.Errorf("all targets valid: status = %d, want 201", code)
+	}
+	if len(s.forwarded) != 2 {
+		t.Errorf("forwarded to %v, want both targets", s.forwarded)
+	}
+}
+
+func TestForwardMessageBestEffortSkipsInvalidTargets(t *testing.T) {
+	userID := uuid.New()
+	s, chats := newForwardService(3)
+	h := NewChatHandler(s, ChatConfig{})
+	stranger := uuid.New()
+
+	path := "/chats/" + s.message.ChatID.String() + "/messages/" + s.message.ID.String() + "/forward?mode=best_effort"
+	w := serve(h.ForwardMessage, http.MethodPost, "/chats/:id/messages/:messageID/forward", path, &userID,
+		ForwardMessageRequest{ChatIDs: []uuid.UUID{chats[1], stranger, chats[2]}})
+	// A partial success is reported per target
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("status = %d, want 207 (body %s)", w.Code, w.Body)
+	}
+
+	var resp BulkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decoding response: %v", err)
+	}
+	if resp.Succeeded != 2 || resp.Failed != 1 {
+		t.Errorf("succeeded, failed = %d, %d; want 2, 1", resp.Succeeded, resp.Failed)
+	}
+	for _, result := range resp.Results {
+		if result.Success == (result.ID == stranger) {
+			t.Errorf("result for %s: success = %v", result.ID, result.Success)
+		}
+	}
+	if len(s.forwarded) != 2 {
+		t.Errorf("forwarded to %v, want the two valid targets", s.forwarded)
+	}
+}
+
+func TestForwardMessageIsRateLimited(t *testing.T) {
+	userID := uuid.New()
+	s, chats := newForwardService(2)
+	h := NewChatHandler(s, ChatConfig{ForwardsPerMinute: 2})
+
+	router := gin.New()
+	api := router.Group("/api", func(c *gin.Context) { c.Set("user_id", userID) })
+	h.RegisterRoutes(api)
+
+	path := "/api/chats/" + s.message.ChatID.String() + "/messages/" + s.message.ID.String() + "/forward"
+	body, _ := json.Marshal(ForwardMessageRequest{ChatIDs: []uuid.UUID{chats[1]}})
+	var codes []int
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+		codes = append(codes, w.Code)
+	}
+
+	if codes[0] != http.StatusCreated || codes[1] != http.StatusCreated || codes[2] != http.StatusTooManyRequests {
+		t.Errorf("statuses = %v, want two forwards then 429", codes)
+	}
+	if len(s.forwarded) != 2 {
+		t.Errorf("forwarded %d times, want 2", len(s.forwarded))
+	}
+}
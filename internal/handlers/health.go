@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// Health check paths. They are exempt from authentication and rate limiting
+// so load balancers and orchestrators can always probe them.
+const (
+	LivenessPath  = "/healthz"
+	ReadinessPath = "/readyz"
+)
+
+// dependencyCheckTimeout bounds each readiness check
+const dependencyCheckTimeout = 2 * time.Second
+
+// Dependency statuses
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+)
+
+// BuildInfo identifies the running build
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+}
+
+// DependencyCheck probes something the service needs in order to serve
+// requests
+type DependencyCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// DependencyStatus is the outcome of a dependency check. Error is only
+// reported in verbose mode.
+type DependencyStatus struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PoolStats summarizes database connection pool usage
+type PoolStats struct {
+	MaxOpen        int   `json:"max_open"`
+	Open           int   `json:"open"`
+	InUse          int   `json:"in_use"`
+	Idle           int   `json:"idle"`
+	WaitCount      int64 `json:"wait_count"`
+	WaitDurationMS int64 `json:"wait_duration_ms"`
+}
+
+// HealthResponse is returned by the health endpoints
+type HealthResponse struct {
+	Status string `json:"status"`
+	BuildInfo
+	Checks map[string]DependencyStatus `json:"checks,omitempty"`
+	Pool   *PoolStats                  `json:"database_pool,omitempty"`
+}
+
+// HealthHandler reports whether the service is alive and ready for traffic
+type HealthHandler struct {
+	build     BuildInfo
+	checks    []DependencyCheck
+	poolStats func() sql.DBStats
+}
+
+// NewHealthHandler creates a new health handler. poolStats reports the
+// database connection pool for verbose readiness responses.
+func NewHealthHandler(build BuildInfo, checks []DependencyCheck, poolStats func() sql.DBStats) *HealthHandler {
+	return &HealthHandler{
+		build:     build,
+		checks:    checks,
+		poolStats: poolStats,
+	}
+}
+
+// Liveness reports that the process is up. It checks nothing else, so a
+// failing dependency doesn't get the process restarted.
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, HealthResponse{Status: StatusOK, BuildInfo: h.build})
+}
+
+// Readiness reports whether every dependency is reachable, responding with
+// 503 if any isn't. With ?verbose=true the response also carries check
+// errors and database connection pool statistics.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	verbose := c.Query("verbose") == "true"
+
+	response := HealthResponse{
+		Status:    StatusOK,
+		BuildInfo: h.build,
+		Checks:    make(map[string]DependencyStatus, len(h.checks)),
+	}
+
+	for _, check := range h.checks {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), dependencyCheckTimeout)
+		err := check.Check(ctx)
+		cancel()
+
+		if err == nil {
+			response.Checks[check.Name] = DependencyStatus{Status: StatusOK}
+			continue
+		}
+
+		log.Ctx(c).Warn().Err(err).Str("dependency", check.Name).Msg("Readiness check failed")
+		response.Status = StatusUnavailable
+		status := DependencyStatus{Status: StatusUnavailable}
+		if verbose {
+			status.Error = err.Error()
+		}
+		response.Checks[check.Name] = status
+	}
+
+	if verbose && h.poolStats != nil {
+		stats := h.poolStats()
+		response.Pool = &PoolStats{
+			MaxOpen:        stats.MaxOpenConnections,
+			Open:           stats.OpenConnections,
+			InUse:          stats.InUse,
+			Idle:           stats.Idle,
+			WaitCount:      stats.WaitCount,
+			WaitDurationMS: stats.WaitDuration.Milliseconds(),
+		}
+	}
+
+	status := http.StatusOK
+	if response.Status != StatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, response)
+}
+
+// RegisterRoutes registers the health routes at the top level of the router
+func (h *HealthHandler) RegisterRoutes(router gin.IRoutes) {
+	router.GET(LivenessPath, h.Liveness)
+	router.GET(ReadinessPath, h.Readiness)
+}
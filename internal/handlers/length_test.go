@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// postedMessages records the chat messages that pass validation
+type postedMessages struct {
+	ChatService
+	contents []string
+}
+
+func (s *postedMessages) CreateMessage(ctx *gin.Context, message *models.Message) error {
+	s.contents = append(s.contents, message.Content)
+	return nil
+}
+
+func TestCreateChatMessageLengthLimit(t *testing.T) {
+	userID := uuid.New()
+	chatID := uuid.New()
+
+	tests := []struct {
+		name    string
+		max     int
+		content string
+		want    int
+	}{
+		{"at the limit", 5, "hello", http.StatusCreated},
+		{"one over", 5, "hello!", http.StatusBadRequest},
+		// Limits count characters, so multibyte text isn't cut short
+		{"multibyte at the limit", 5, "héllo", http.StatusCreated},
+		{"wide characters at the limit", 5, "日本語です", http.StatusCreated},
+		{"multibyte one over", 5, "日本語ですね", http.StatusBadRequest},
+		{"emoji at the limit", 3, "👍👍👍", http.StatusCreated},
+		{"zero is unlimited", 0, strings.Repeat("a", 100000), http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &postedMessages{}
+			h := NewChatHandler(s, ChatConfig{MaxMessageLength: tt.max})
+
+			w := serve(h.CreateChatMessage, http.MethodPost, "/chats/:id/messages", "/chats/"+chatID.String()+"/messages", &userID,
+				CreateMessageRequest{Content: tt.content})
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+
+			if tt.want == http.StatusCreated {
+				if len(s.contents) != 1 {
+					t.Errorf("stored %d messages, want 1", len(s.contents))
+				}
+				return
+			}
+			if len(s.contents) != 0 {
+				t.Error("message was stored despite being too long")
+			}
+			var body struct{ Error string }
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if !strings.Contains(body.Error, "at most 5 characters") {
+				t.Errorf("error = %q, want it to name the limit", body.Error)
+			}
+		})
+	}
+}
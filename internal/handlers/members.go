@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// AddChatMemberRequest represents a request to add a user to a chat
+type AddChatMemberRequest struct {
+	UserID  uuid.UUID `json:"user_id" binding:"required"`
+	IsAdmin bool      `json:"is_admin"`
+}
+
+// UpdateChatMemberRequest represents a request to change a member's admin
+// rights
+type UpdateChatMemberRequest struct {
+	IsAdmin *bool `json:"is_admin" binding:"required"`
+}
+
+// GetChatMembers handles listing a chat's members with their user details
+func (h *ChatHandler) GetChatMembers(c *gin.Context) {
+	chatID, ok := h.membershipTarget(c, false)
+	if !ok {
+		return
+	}
+
+	members, err := h.chatService.ListChatMembers(c, chatID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list chat members")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+// AddChatMember handles adding a user to a chat (chat admins only)
+func (h *ChatHandler) AddChatMember(c *gin.Context) {
+	chatID, ok := h.membershipTarget(c, true)
+	if !ok {
+		return
+	}
+
+	var req AddChatMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.UserID == uuid.Nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	isMember, err := h.chatService.IsChatMember(c, chatID, req.UserID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+		return
+	}
+	if isMember {
+		c.JSON(http.StatusConflict, gin.H{"error": "User is already a member of this chat"})
+		return
+	}
+
+	err = h.chatService.AddUserToChat(c, chatID, req.UserID, req.IsAdmin)
+	switch {
+	case errors.Is(err, ErrChatNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+		return
+	case errors.Is(err, ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	case err != nil:
+		log.Ctx(c).Error().Err(err).Msg("Failed to add chat member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+		return
+	}
+
+	member, err := h.chatService.GetChatMember(c, chatID, req.UserID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get added chat member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve member"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"member": member})
+}
+
+// RemoveChatMember handles removing a user from a chat (chat admins only).
+// The chat's last admin can't be removed while others remain.
+func (h *ChatHandler) RemoveChatMember(c *gin.Context) {
+	chatID, ok := h.membershipTarget(c, true)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	err = h.chatService.RemoveUserFromChat(c, chatID, memberID)
+	if !h.membershipChanged(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// UpdateChatMember handles granting or revoking a member's admin rights
+// (chat admins only). The chat's last admin can't be demoted.
+func (h *ChatHandler) UpdateChatMember(c *gin.Context) {
+	chatID, ok := h.membershipTarget(c, true)
+	if !ok {
+		return
+	}
+
+	memberID, err := uuid.Parse(c.Param("userID"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req UpdateChatMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	err = h.chatService.SetChatMemberAdmin(c, chatID, memberID, *req.IsAdmin)
+	if !h.membershipChanged(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"chat_id": chatID, "user_id": memberID, "is_admin": *req.IsAdmin})
+}
+
+// LeaveChat handles the current user leaving a chat. If they were its only
+// admin, the longest-standing remaining member is made admin in their place.
+func (h *ChatHandler) LeaveChat(c *gin.Context) {
+	userID, chatID, ok := h.memberTarget(c)
+	if !ok {
+		return
+	}
+
+	promoted, err := h.chatService.LeaveChat(c, chatID, userID)
+	if !h.membershipChanged(c, err) {
+		return
+	}
+
+	response := gin.H{"message": "Left chat successfully"}
+	if promoted != nil {
+		response["promoted_user_id"] = promoted
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// membershipTarget resolves the chat for a request about its members,
+// writing an error response and returning false unless the caller may make
+// it. Members may list a chat's members, and chat admins may change them;
+// site admins may do both in any chat.
+func (h *ChatHandler) membershipTarget(c *gin.Context, manage bool) (uuid.UUID, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+
+	chatID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid chat ID"})
+		return uuid.Nil, false
+	}
+
+	if middleware.IsAdmin(c) {
+		if _, err := h.chatService.GetChatByID(c, chatID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Chat not found"})
+			return uuid.Nil, false
+		}
+		return chatID, true
+	}
+
+	isMember, err := h.chatService.IsChatMember(c, chatID, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check chat membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+		return uuid.Nil, false
+	}
+	if !isMember {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a member of this chat"})
+		return uuid.Nil, false
+	}
+	if !manage {
+		return chatID, true
+	}
+
+	member, err := h.chatService.GetChatMember(c, chatID, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get chat member")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check chat membership"})
+		return uuid.Nil, false
+	}
+	if !isChatModerator(c, member) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only chat admins can manage members"})
+		return uuid.Nil, false
+	}
+
+	return chatID, true
+}
+
+// membershipChanged writes the error response for a failed membership change
+// and returns false, or returns true if err is nil
+func (h *ChatHandler) membershipChanged(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, ErrNotChatMember):
+		c.JSON(http.StatusNotFound, gin.H{"error": "User is not a member of this chat"})
+	case errors.Is(err, ErrLastChatAdmin):
+		c.JSON(http.StatusConflict, gin.H{"error": "A chat must keep at least one admin"})
+	default:
+		log.Ctx(c).Error().Err(err).Msg("Failed to update chat membership")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update membership"})
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parsePagination reads the limit and offset query parameters. A missing
+// limit is defaultLimit; limits are clamped to [1, maxLimit] and offsets to
+// zero or more. It responds with 400 and returns false if either isn't an
+// integer.
+func parsePagination(c *gin.Context, defaultLimit, maxLimit int) (limit, offset int, ok bool) {
+	limit = defaultLimit
+	if limitParam := c.Query("limit"); limitParam != "" {
+		n, err := strconv.Atoi(limitParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be an integer"})
+			return 0, 0, false
+		}
+		limit = n
+	}
+	limit = min(max(limit, 1), maxLimit)
+
+	if offsetParam := c.Query("offset"); offsetParam != "" {
+		n, err := strconv.Atoi(offsetParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset, must be an integer"})
+			return 0, 0, false
+		}
+		offset = max(n, 0)
+	}
+
+	return limit, offset, true
+}
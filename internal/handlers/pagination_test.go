@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestParsePagination(t *testing.T) {
+	tests := []struct {
+		query      string
+		wantLimit  int
+		wantOffset int
+		wantStatus int
+	}{
+		{"", 20, 0, http.StatusOK},
+		{"?limit=1&offset=0", 1, 0, http.StatusOK},
+		{"?limit=100&offset=40", 100, 40, http.StatusOK},
+		// Out of range values are clamped
+		{"?limit=101", 100, 0, http.StatusOK},
+		{"?limit=1000000000", 100, 0, http.StatusOK},
+		{"?limit=0", 1, 0, http.StatusOK},
+		{"?limit=-5", 1, 0, http.StatusOK},
+		{"?offset=-1", 20, 0, http.StatusOK},
+		// Empty values are the same as missing ones
+		{"?limit=&offset=", 20, 0, http.StatusOK},
+		// Anything that isn't a whole integer is refused, not defaulted
+		{"?limit=abc", 0, 0, http.StatusBadRequest},
+		{"?limit=10abc", 0, 0, http.StatusBadRequest},
+		{"?limit=1.5", 0, 0, http.StatusBadRequest},
+		{"?limit=%2010", 0, 0, http.StatusBadRequest},
+		{"?limit=99999999999999999999", 0, 0, http.StatusBadRequest},
+		{"?offset=two", 0, 0, http.StatusBadRequest},
+		{"?limit=10&offset=0x10", 0, 0, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var limit, offset int
+			handler := func(c *gin.Context) {
+				var ok bool
+				if limit, offset, ok = parsePagination(c, 20, 100); ok {
+					c.Status(http.StatusOK)
+				}
+			}
+
+			w := serve(handler, http.MethodGet, "/items", "/items"+tt.query, nil, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				if !strings.Contains(w.Body.String(), "must be an integer") {
+					t.Errorf("body = %s, want it to say what was wrong", w.Body)
+				}
+				return
+			}
+			if limit != tt.wantLimit || offset != tt.wantOffset {
+				t.Errorf("limit, offset = %d, %d; want %d, %d", limit, offset, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
+
+// pagedMessages records the pages chat messages are listed with
+type pagedMessages struct {
+	ChatService
+	limits, offsets []int
+}
+
+func (s *pagedMessages) ListChatMessages(ctx *gin.Context, chatID uuid.UUID, limit, offset int) ([]*models.Message, error) {
+	s.limits = append(s.limits, limit)
+	s.offsets = append(s.offsets, offset)
+	return nil, nil
+}
+
+func TestGetChatMessagesPagination(t *testing.T) {
+	userID := uuid.New()
+	chatID := uuid.New()
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantLimit  int
+		wantOffset int
+	}{
+		{"?offset=50", http.StatusOK, 50, 50},
+		{"?limit=5000", http.StatusOK, 200, 0},
+		{"?limit=-1&offset=-1", http.StatusOK, 1, 0},
+		{"?limit=lots", http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			s := &pagedMessages{}
+			h := NewChatHandler(s, ChatConfig{})
+
+			w := serve(h.GetChatMessages, http.MethodGet, "/chats/:id/messages", "/chats/"+chatID.String()+"/messages"+tt.query, &userID, nil)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if len(s.limits) != 0 {
+					t.Error("messages listed despite a bad request")
+				}
+				return
+			}
+			if len(s.limits) != 1 || s.limits[0] != tt.wantLimit || s.offsets[0] != tt.wantOffset {
+				t.Errorf("listed with limits %v, offsets %v; want %d, %d", s.limits, s.offsets, tt.wantLimit, tt.wantOffset)
+			}
+		})
+	}
+}
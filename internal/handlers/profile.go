@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// Default profile field limits. The username and display name defaults match
+// their column sizes in schema.sql.
+const (
+	defaultMaxUsernameLength    = 50
+	defaultMaxDisplayNameLength = 100
+	defaultMaxBioLength         = 500
+)
+
+// ProfileLimits caps the length of user profile fields, counted in characters
+type ProfileLimits struct {
+	MaxUsernameLength    int
+	MaxDisplayNameLength int
+	MaxBioLength         int
+}
+
+// withDefaults fills in unset limits
+func (l ProfileLimits) withDefaults() ProfileLimits {
+	if l.MaxUsernameLength <= 0 {
+		l.MaxUsernameLength = defaultMaxUsernameLength
+	}
+	if l.MaxDisplayNameLength <= 0 {
+		l.MaxDisplayNameLength = defaultMaxDisplayNameLength
+	}
+	if l.MaxBioLength <= 0 {
+		l.MaxBioLength = defaultMaxBioLength
+	}
+	return l
+}
+
+// checkLength responds with 400 and returns false if value is longer than
+// max characters
+func checkLength(c *gin.Context, field, value string, max int) bool {
+	if utf8.RuneCountInString(value) > max {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("%s must be at most %d characters", field, max),
+			"field": field,
+		})
+		return false
+	}
+	return true
+}
+
+// UpdateProfileRequest holds the profile fields to change. Omitted fields are
+// left as they are.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+}
+
+// UpdateProfile updates the caller's display name and bio
+func (h *UserHandler) UpdateProfile(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	if req.DisplayName != nil && !checkLength(c, "display_name", *req.DisplayName, h.limits.MaxDisplayNameLength) {
+		return
+	}
+	if req.Bio != nil && !checkLength(c, "bio", *req.Bio, h.limits.MaxBioLength) {
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if req.DisplayName != nil {
+		user.DisplayName = *req.DisplayName
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+
+	if err := h.userService.UpdateUser(c, user); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to update profile")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user": user.SafeUser()})
+}
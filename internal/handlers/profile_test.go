@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// registrations records the users an AuthHandler registers
+type registrations struct {
+	AuthService
+
+	usernames []string
+}
+
+func (s *registrations) Register(ctx *gin.Context, username, email, password, displayName string) (*auth.UserResponse, error) {
+	s.usernames = append(s.usernames, username)
+	return &auth.UserResponse{ID: uuid.NewString(), Username: username, DisplayName: displayName}, nil
+}
+
+// profileUpdates serves users from a map and records profile updates
+type profileUpdates struct {
+	stubUserService
+
+	updated int
+}
+
+func (s *profileUpdates) UpdateUser(ctx *gin.Context, user *models.User) error {
+	s.updated++
+	return nil
+}
+
+// rejectedField returns the field a 400 response names
+func rejectedField(t *testing.T, body []byte) string {
+	t.Helper()
+
+	var resp struct {
+		Field string `json:"field"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		t.Fatalf("decoding error response: %v", err)
+	}
+	return resp.Field
+}
+
+// Limits are counted in characters, so the test values are multibyte
+var testProfileLimits = ProfileLimits{MaxUsernameLength: 5, MaxDisplayNameLength: 4, MaxBioLength: 6}
+
+func TestRegisterFieldLengths(t *testing.T) {
+	tests := []struct {
+		name        string
+		username    string
+		displayName string
+		wantField   string
+	}{
+		{"at the limits", "ñandú", "ÅÅÅÅ", ""},
+		{"username one over", "ñandús", "", "username"},
+		{"display name one over", "ñandú", "ÅÅÅÅÅ", "display_name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &registrations{}
+			h := NewAuthHandler(service, testProfileLimits)
+
+			w := serve(h.Register, http.MethodPost, "/register", "/register", nil, RegisterRequest{
+				Username: tt.username, Email: "ada@example.com", Password: "long enough", DisplayName: tt.displayName,
+			})
+
+			if tt.wantField == "" {
+				if w.Code != http.StatusCreated || len(service.usernames) != 1 {
+					t.Fatalf("status = %d, registered %v; want the user created (body %s)", w.Code, service.usernames, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			if field := rejectedField(t, w.Body.Bytes()); field != tt.wantField {
+				t.Errorf("rejected field = %q, want %q", field, tt.wantField)
+			}
+			if len(service.usernames) != 0 {
+				t.Error("user registered despite the over-long field")
+			}
+		})
+	}
+}
+
+func TestUpdateProfileFieldLengths(t *testing.T) {
+	bio := func(n int) *string { s := strings.Repeat("é", n); return &s }
+	name := func(s string) *string { return &s }
+
+	tests := []struct {
+		name      string
+		req       UpdateProfileRequest
+		wantField string
+	}{
+		{"at the limits", UpdateProfileRequest{DisplayName: name("ÅÅÅÅ"), Bio: bio(6)}, ""},
+		{"display name one over", UpdateProfileRequest{DisplayName: name("ÅÅÅÅÅ")}, "display_name"},
+		{"bio one over", UpdateProfileRequest{Bio: bio(7)}, "bio"},
+		{"omitted fields are unchecked", UpdateProfileRequest{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &models.User{ID: uuid.New(), Username: "ada", DisplayName: "Ada", Bio: "hi"}
+			service := &profileUpdates{stubUserService: stubUserService{users: map[uuid.UUID]*models.User{user.ID: user}}}
+			h := NewUserHandler(service, nil, testProfileLimits)
+
+			w := serve(h.UpdateProfile, http.MethodPut, "/users/me", "/users/me", &user.ID, tt.req)
+
+			if tt.wantField == "" {
+				if w.Code != http.StatusOK || service.updated != 1 {
+					t.Fatalf("status = %d, updates = %d; want the profile saved (body %s)", w.Code, service.updated, w.Body)
+				}
+				return
+			}
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want 400", w.Code)
+			}
+			if field := rejectedField(t, w.Body.Bytes()); field != tt.wantField {
+				t.Errorf("rejected field = %q, want %q", field, tt.wantField)
+			}
+			if service.updated != 0 || user.DisplayName != "Ada" || user.Bio != "hi" {
+				t.Error("profile changed despite the over-long field")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// RateLimitStatusPath is the route that reports rate limit status. It is
+// exempt from the limiter so checking the budget doesn't spend it.
+const RateLimitStatusPath = "/api/ratelimit"
+
+// RateLimitHandler reports clients' rate limit budgets
+type RateLimitHandler struct {
+	limiter *middleware.RateLimiter
+}
+
+// NewRateLimitHandler creates a new rate limit handler
+func NewRateLimitHandler(limiter *middleware.RateLimiter) *RateLimitHandler {
+	return &RateLimitHandler{
+		limiter: limiter,
+	}
+}
+
+// GetStatus returns the caller's remaining requests, limit and reset time
+func (h *RateLimitHandler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.limiter.Status(h.limiter.Key(c)))
+}
+
+// RegisterRoutes registers rate limit routes
+func (h *RateLimitHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/ratelimit", h.GetStatus)
+}
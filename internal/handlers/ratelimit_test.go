@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// newRateLimitedRouter serves /api/ping behind the limiter, plus the status
+// endpoint, the way the server wires them
+func newRateLimitedRouter(config middleware.RateLimiterConfig) *gin.Engine {
+	limiter := middleware.NewRateLimiter(config)
+	limiter.Exempt(RateLimitStatusPath)
+
+	router := gin.New()
+	api := router.Group("/api")
+	api.Use(limiter.Middleware())
+	api.GET("/ping", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	NewRateLimitHandler(limiter).RegisterRoutes(api)
+	return router
+}
+
+func request(router *gin.Engine, path, clientAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = clientAddr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func rateLimitStatus(t *testing.T, router *gin.Engine, clientAddr string) middleware.BucketStatus {
+	t.Helper()
+
+	w := request(router, RateLimitStatusPath, clientAddr)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status endpoint returned %d", w.Code)
+	}
+	var status middleware.BucketStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &status); err != nil {
+		t.Fatalf("invalid status response: %v", err)
+	}
+	return status
+}
+
+func TestRateLimitStatusTracksConsumption(t *testing.T) {
+	const limit = 5
+	router := newRateLimitedRouter(middleware.RateLimiterConfig{Enabled: true, RequestsPerMinute: limit})
+	const client = "192.0.2.1:1234"
+
+	status := rateLimitStatus(t, router, client)
+	if !status.Enabled || status.Limit != limit || status.Remaining != limit {
+		t.Fatalf("fresh client status = %+v, want %d of %d remaining", status, limit, limit)
+	}
+
+	for used := 1; used <= limit; used++ {
+		if w := request(router, "/api/ping", client); w.Code != http.StatusNoContent {
+			t.Fatalf("request %d: status %d", used, w.Code)
+		}
+		// Checking twice shows the same budget: the check itself is free
+		for i := 0; i < 2; i++ {
+			if got := rateLimitStatus(t, router, client).Remaining; got != limit-used {
+				t.Fatalf("after %d requests remaining = %d, want %d", used, got, limit-used)
+			}
+		}
+	}
+
+	if w := request(router, "/api/ping", client); w.Code != http.StatusTooManyRequests {
+		t.Errorf("request past the budget: status %d, want 429", w.Code)
+	}
+	status = rateLimitStatus(t, router, client)
+	if status.Remaining != 0 {
+		t.Errorf("remaining = %d once exhausted, want 0", status.Remaining)
+	}
+	if until := time.Until(status.Reset); until <= 0 || until > time.Minute {
+		t.Errorf("reset in %v, want the bucket to refill within a minute", until)
+	}
+
+	// Buckets are per client
+	if got := rateLimitStatus(t, router, "198.51.100.7:4321").Remaining; got != limit {
+		t.Errorf("another client's remaining = %d, want %d", got, limit)
+	}
+}
+
+func TestRateLimitStatusDisabled(t *testing.T) {
+	router := newRateLimitedRouter(middleware.RateLimiterConfig{Enabled: false, RequestsPerMinute: 1})
+
+	for i := 0; i < 3; i++ {
+		request(router, "/api/ping", "192.0.2.1:1234")
+	}
+	if status := rateLimitStatus(t, router, "192.0.2.1:1234"); status.Enabled {
+		t.Errorf("status = %+v, want disabled", status)
+	}
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// MaxReactionLength caps the size in bytes of a reaction, whatever the
+// allowlist says. Multi-codepoint emoji (skin tones, ZWJ sequences) fit
+// comfortably.
+const MaxReactionLength = 32
+
+// DefaultAllowedReactions is used when no reaction allowlist is configured
+var DefaultAllowedReactions = []string{"👍", "👎", "❤️", "😂", "😮", "😢", "🎉", "🙏", "🔥", "👀"}
+
+// newReactionAllowlist builds the set of permitted reactions
+func newReactionAllowlist(reactions []string) map[string]bool {
+	if len(reactions) == 0 {
+		reactions = DefaultAllowedReactions
+	}
+
+	allowed := make(map[string]bool, len(reactions))
+	for _, reaction := range reactions {
+		reaction = strings.TrimSpace(reaction)
+		if reaction != "" && len(reaction) <= MaxReactionLength {
+			allowed[reaction] = true
+		}
+	}
+
+	return allowed
+}
+
+// validReaction reports whether a reaction may be stored
+func (h *ChatHandler) validReaction(reaction string) bool {
+	if reaction == "" || len(reaction) > MaxReactionLength {
+		return false
+	}
+	return h.allowedReactions[reaction]
+}
+
+// ReactionRequest represents the request body for reacting to a message
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required"`
+}
+
+// AddReaction handles reacting to a message. Reacting twice with the same
+// emoji has no further effect.
+func (h *ChatHandler) AddReaction(c *gin.Context) {
+	userID, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+	if !h.validReaction(req.Emoji) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reaction is not allowed"})
+		return
+	}
+
+	reaction := &models.MessageReaction{
+		MessageID: messageID,
+		UserID:    userID,
+		Emoji:     req.Emoji,
+	}
+
+	if err := h.chatService.AddReaction(c, reaction); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to add reaction")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add reaction"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"reaction": reaction})
+}
+
+// RemoveReaction handles removing the current user's reaction from a message.
+// Removing a reaction that was never added succeeds.
+func (h *ChatHandler) RemoveReaction(c *gin.Context) {
+	userID, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	emoji := c.Query("emoji")
+	if emoji == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Emoji is required"})
+		return
+	}
+
+	if err := h.chatService.RemoveReaction(c, messageID, userID, emoji); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to remove reaction")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove reaction"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Reaction removed successfully"})
+}
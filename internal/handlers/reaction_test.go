@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// reactionService records the reactions a handler stores for one message in
+// one chat the caller belongs to
+type reactionService struct {
+	ChatService
+
+	message *models.Message
+	added   []*models.MessageReaction
+}
+
+func (s *reactionService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return chatID == s.message.ChatID, nil
+}
+
+func (s *reactionService) GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error) {
+	if id != s.message.ID {
+		return nil, ErrChatNotFound
+	}
+	return s.message, nil
+}
+
+func (s *reactionService) AddReaction(ctx *gin.Context, reaction *models.MessageReaction) error {
+	s.added = append(s.added, reaction)
+	return nil
+}
+
+func TestAddReactionAllowlist(t *testing.T) {
+	userID := uuid.New()
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		emoji      string
+		wantStatus int
+	}{
+		{"default list", nil, "👍", http.StatusCreated},
+		{"multi-codepoint default", nil, "❤️", http.StatusCreated},
+		{"not in default list", nil, "🍕", http.StatusBadRequest},
+		{"free text", nil, "lol", http.StatusBadRequest},
+		{"configured list", []string{"🍕", " :shipit: "}, "🍕", http.StatusCreated},
+		{"configured shortcode is trimmed", []string{"🍕", " :shipit: "}, ":shipit:", http.StatusCreated},
+		{"configured list replaces default", []string{"🍕"}, "👍", http.StatusBadRequest},
+		{"oversized entry is never allowed", []string{strings.Repeat("🍕", 10)}, strings.Repeat("🍕", 10), http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &models.Message{ID: uuid.New(), ChatID: uuid.New()}
+			service := &reactionService{message: message}
+			h := NewChatHandler(service, ChatConfig{AllowedReactions: tt.allowed})
+
+			path := "/chats/" + message.ChatID.String() + "/messages/" + message.ID.String() + "/reactions"
+			w := serve(h.AddReaction, http.MethodPost, "/chats/:id/messages/:messageID/reactions", path, &userID,
+				ReactionRequest{Emoji: tt.emoji})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+
+			if tt.wantStatus != http.StatusCreated {
+				if len(service.added) != 0 {
+					t.Errorf("rejected reaction %q was stored", tt.emoji)
+				}
+				return
+			}
+			if len(service.added) != 1 || service.added[0].Emoji != tt.emoji || service.added[0].UserID != userID {
+				t.Errorf("stored reactions = %+v, want one %q from the caller", service.added, tt.emoji)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// RoleService defines the interface for role operations
+type RoleService interface {
+	UserExists(ctx *gin.Context, id uuid.UUID) (bool, error)
+	ListRoles(ctx *gin.Context) ([]*models.Role, error)
+	ListUserRoles(ctx *gin.Context, userID uuid.UUID) ([]*models.Role, error)
+	GrantRole(ctx *gin.Context, userID uuid.UUID, role string) error
+	RevokeRole(ctx *gin.Context, userID uuid.UUID, role string) error
+}
+
+// RoleHandler handles granting and revoking roles
+type RoleHandler struct {
+	roleService RoleService
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roleService RoleService) *RoleHandler {
+	return &RoleHandler{
+		roleService: roleService,
+	}
+}
+
+// ListRoles lists every role with its permissions
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleService.ListRoles(c)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list roles")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GetUserRoles lists the roles granted to a user
+func (h *RoleHandler) GetUserRoles(c *gin.Context) {
+	userID, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	roles, err := h.roleService.ListUserRoles(c, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list user roles")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get roles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"roles": roles})
+}
+
+// GrantRole grants a role to a user. It takes effect from the user's next
+// login or token refresh.
+func (h *RoleHandler) GrantRole(c *gin.Context) {
+	userID, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	role := c.Param("role")
+	roles, err := h.roleService.ListRoles(c)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list roles")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role"})
+		return
+	}
+	if !hasRole(roles, role) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	if err := h.roleService.GrantRole(c, userID, role); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to grant role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant role"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// RevokeRole takes a role away from a user. It takes effect once the user's
+// current access token expires.
+func (h *RoleHandler) RevokeRole(c *gin.Context) {
+	userID, ok := h.targetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.roleService.RevokeRole(c, userID, c.Param("role")); err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to revoke role")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke role"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// targetUser resolves the user a role request is about, writing an error
+// response and returning false if there is no such user
+func (h *RoleHandler) targetUser(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return uuid.Nil, false
+	}
+
+	exists, err := h.roleService.UserExists(c, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to check user exists")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up user"})
+		return uuid.Nil, false
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return uuid.Nil, false
+	}
+
+	return userID, true
+}
+
+// RegisterRoutes registers role routes. They require the roles.manage
+// permission.
+func (h *RoleHandler) RegisterRoutes(router *gin.RouterGroup) {
+	manage := middleware.RequirePermission(models.PermManageRoles)
+
+	router.GET("/roles", manage, h.ListRoles)
+
+	users := router.Group("/users", manage)
+	{
+		users.GET("/:id/roles", h.GetUserRoles)
+		users.PUT("/:id/roles/:role", h.GrantRole)
+		users.DELETE("/:id/roles/:role", h.RevokeRole)
+	}
+}
+
+// hasRole reports whether roles contains a role with the given name
+func hasRole(roles []*models.Role, name string) bool {
+	for _, role := range roles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isChatModerator reports whether a chat member has admin rights in their
+// chat: chat admins do, and so does anyone granted chats.moderate globally
+func isChatModerator(c *gin.Context, member *models.ChatMember) bool {
+	return member.IsAdmin || middleware.HasPermission(c, models.PermModerateChats)
+}
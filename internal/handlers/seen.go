@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultMaxSeenBy is used when no seen-by cap is configured
+const defaultMaxSeenBy = 100
+
+// GetSeenBy lists the members who have read a message, according to their
+// read markers. Members who hide their online status are left out, and in
+// large chats the list is cut off at the configured cap.
+func (h *ChatHandler) GetSeenBy(c *gin.Context) {
+	_, messageID, ok := h.messageTarget(c)
+	if !ok {
+		return
+	}
+
+	// Ask for one more than the cap to tell whether the list was cut off
+	readers, err := h.chatService.ListMessageReaders(c, messageID, h.config.MaxSeenBy+1)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list message readers")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get seen-by list"})
+		return
+	}
+
+	truncated := len(readers) > h.config.MaxSeenBy
+	if truncated {
+		readers = readers[:h.config.MaxSeenBy]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"seen_by":   readers,
+		"truncated": truncated,
+	})
+}
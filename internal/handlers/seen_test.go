@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// readerService reports a fixed list of readers for its one message
+type readerService struct {
+	reactionService
+
+	readers []*models.User
+}
+
+func (s *readerService) ListMessageReaders(ctx *gin.Context, messageID uuid.UUID, limit int) ([]*models.User, error) {
+	if len(s.readers) > limit {
+		return s.readers[:limit], nil
+	}
+	return s.readers, nil
+}
+
+func TestGetSeenByCap(t *testing.T) {
+	tests := []struct {
+		name          string
+		readers       int
+		maxSeenBy     int
+		wantListed    int
+		wantTruncated bool
+	}{
+		{"under the cap", 2, 3, 2, false},
+		{"at the cap", 3, 3, 3, false},
+		{"over the cap", 5, 3, 3, true},
+		{"nobody yet", 0, 3, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := uuid.New()
+			message := &models.Message{ID: uuid.New(), ChatID: uuid.New()}
+			service := &readerService{reactionService: reactionService{message: message}}
+			for i := 0; i < tt.readers; i++ {
+				service.readers = append(service.readers, &models.User{ID: uuid.New()})
+			}
+			h := NewChatHandler(service, ChatConfig{MaxSeenBy: tt.maxSeenBy})
+
+			path := "/chats/" + message.ChatID.String() + "/messages/" + message.ID.String() + "/seen-by"
+			w := serve(h.GetSeenBy, http.MethodGet, "/chats/:id/messages/:messageID/seen-by", path, &userID, nil)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body)
+			}
+
+			var resp struct {
+				SeenBy    []*models.User `json:"seen_by"`
+				Truncated bool           `json:"truncated"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if len(resp.SeenBy) != tt.wantListed || resp.Truncated != tt.wantTruncated {
+				t.Errorf("listed %d, truncated %v; want %d, %v", len(resp.SeenBy), resp.Truncated, tt.wantListed, tt.wantTruncated)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/avatar"
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// UserService defines the interface for user operations
+type UserService interface {
+	GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error)
+	ListRecentContacts(ctx *gin.Context, userID uuid.UUID, limit int) ([]*models.RecentContact, error)
+	UpdateUser(ctx *gin.Context, user *models.User) error
+	ListOnlineUsers(ctx *gin.Context) ([]*models.User, error)
+	GetAIUsage(ctx *gin.Context, userID uuid.UUID) (*models.AIUsageSummary, error)
+}
+
+// UserHandler handles user-related API endpoints
+type UserHandler struct {
+	userService UserService
+	avatars     *avatar.Generator
+	limits      ProfileLimits
+}
+
+// NewUserHandler creates a new user handler
+func NewUserHandler(userService UserService, avatars *avatar.Generator, limits ProfileLimits) *UserHandler {
+	return &UserHandler{
+		userService: userService,
+		avatars:     avatars,
+		limits:      limits.withDefaults(),
+	}
+}
+
+// GetAvatar serves a user's avatar, redirecting to the uploaded one if set and
+// otherwise rendering a generated default
+func (h *UserHandler) GetAvatar(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c, userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.AvatarURL != "" {
+		c.Redirect(http.StatusFound, user.AvatarURL)
+		return
+	}
+
+	name := user.DisplayName
+	if name == "" {
+		name = user.Username
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "image/svg+xml", h.avatars.Generate(user.ID, name))
+}
+
+// GetRecentContacts returns the users the current user has most recently
+// talked to, as suggestions for starting a direct message
+func (h *UserHandler) GetRecentContacts(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	limit, _, ok := parsePagination(c, 10, 50)
+	if !ok {
+		return
+	}
+
+	contacts, err := h.userService.ListRecentContacts(c, userID, limit)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list recent contacts")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get recent contacts"})
+		return
+	}
+
+	if contacts == nil {
+		contacts = []*models.RecentContact{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"contacts": contacts})
+}
+
+// GetOnlineUsers returns the connected users who share their online status
+func (h *UserHandler) GetOnlineUsers(c *gin.Context) {
+	users, err := h.userService.ListOnlineUsers(c)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to list online users")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get online users"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// GetAIUsage handles reporting a user's assistant token usage this month
+// against their quota. Users may see their own ("me" works as the ID); site
+// admins may see anyone's.
+func (h *UserHandler) GetAIUsage(c *gin.Context) {
+	callerID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	userID := callerID
+	if c.Param("id") != "me" {
+		id, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		userID = id
+	}
+	if userID != callerID && !middleware.IsAdmin(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view your own AI usage"})
+		return
+	}
+
+	summary, err := h.userService.GetAIUsage(c, userID)
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to get AI usage")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get AI usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// RegisterRoutes registers user routes that don't require authentication
+func (h *UserHandler) RegisterRoutes(router *gin.RouterGroup) {
+	users := router.Group("/users")
+	{
+		// Avatars are loaded by <img> tags, which can't send a bearer token
+		users.GET("/:id/avatar", h.GetAvatar)
+	}
+}
+
+// RegisterProtectedRoutes registers user routes that require authentication
+func (h *UserHandler) RegisterProtectedRoutes(router *gin.RouterGroup) {
+	users := router.Group("/users")
+	{
+		users.PATCH("/me", h.UpdateProfile)
+		users.GET("/me/recent-contacts", h.GetRecentContacts)
+		users.GET("/online", h.GetOnlineUsers)
+		users.GET("/:id/ai-usage", h.GetAIUsage)
+	}
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/avatar"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// stubUserService serves users from a map. Calling any method user handler
+// tests don't use panics.
+type stubUserService struct {
+	UserService
+
+	users map[uuid.UUID]*models.User
+}
+
+func (s *stubUserService) GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error) {
+	user, ok := s.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
+}
+
+func newAvatarHandler(users ...*models.User) *UserHandler {
+	service := &stubUserService{users: make(map[uuid.UUID]*models.User)}
+	for _, user := range users {
+		service.users[user.ID] = user
+	}
+	return NewUserHandler(service, avatar.NewGenerator(avatar.Config{}), ProfileLimits{})
+}
+
+func TestGetAvatarPrefersUploadedAvatar(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Username: "ada", AvatarURL: "https://cdn.example.com/ada.png"}
+	h := newAvatarHandler(user)
+
+	w := serve(h.GetAvatar, http.MethodGet, "/users/:id/avatar", "/users/"+user.ID.String()+"/avatar", nil, nil)
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusFound)
+	}
+	if got := w.Header().Get("Location"); got != user.AvatarURL {
+		t.Errorf("Location = %q, want %q", got, user.AvatarURL)
+	}
+}
+
+func TestGetAvatarGeneratesDefault(t *testing.T) {
+	user := &models.User{ID: uuid.New(), Username: "ada", DisplayName: "Ada Lovelace"}
+	h := newAvatarHandler(user)
+	path := "/users/" + user.ID.String() + "/avatar"
+
+	first := serve(h.GetAvatar, http.MethodGet, "/users/:id/avatar", path, nil, nil)
+	if first.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", first.Code, http.StatusOK)
+	}
+	if got := first.Header().Get("Content-Type"); got != "image/svg+xml" {
+		t.Errorf("Content-Type = %q, want image/svg+xml", got)
+	}
+	if !bytes.Contains(first.Body.Bytes(), []byte(">AL</text>")) {
+		t.Errorf("avatar = %s, want the display name's initials", first.Body)
+	}
+
+	second := serve(h.GetAvatar, http.MethodGet, "/users/:id/avatar", path, nil, nil)
+	if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) {
+		t.Error("repeated requests returned different avatars")
+	}
+}
+
+func TestGetAvatarErrors(t *testing.T) {
+	h := newAvatarHandler()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/users/not-a-uuid/avatar", http.StatusBadRequest},
+		{"/users/" + uuid.NewString() + "/avatar", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		if w := serve(h.GetAvatar, http.MethodGet, "/users/:id/avatar", tt.path, nil, nil); w.Code != tt.want {
+			t.Errorf("GET %s: status = %d, want %d", tt.path, w.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package lru provides a bounded in-memory cache that evicts the least
+// recently used entries and can expire entries after a fixed TTL.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Config bounds a Cache. A zero field leaves that bound off.
+type Config[V any] struct {
+	// TTL is how long an entry is served after it is added
+	TTL time.Duration
+	// MaxEntries bounds the number of entries
+	MaxEntries int
+	// MaxSize bounds the total size of the entries, as reported by Size.
+	// Values larger than MaxSize are not stored.
+	MaxSize int64
+	// Size returns the size of a value, counted against MaxSize
+	Size func(V) int64
+}
+
+// Cache is a concurrency-safe LRU cache
+type Cache[K comparable, V any] struct {
+	config Config[V]
+	size   int64
+	ll     *list.List
+	items  map[K]*list.Element
+	mu     sync.Mutex
+}
+
+// entry is a cached value with its size and when it expires
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	size    int64
+	expires time.Time
+}
+
+// New creates an empty cache bounded by config
+func New[K comparable, V any](config Config[V]) *Cache[K, V] {
+	return &Cache[K, V]{
+		config: config,
+		ll:     list.New(),
+		items:  make(map[K]*list.Element),
+	}
+}
+
+// Get returns an unexpired cached value
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := elem.Value.(*entry[K, V])
+	if c.config.TTL > 0 && time.Now().After(e.expires) {
+		c.removeElement(elem)
+		return zero, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return e.value, true
+}
+
+// Add stores a value, evicting the least recently used entries to stay
+// within the cache's bounds
+func (c *Cache[K, V]) Add(key K, value V) {
+	var size int64
+	if c.config.Size != nil {
+		size = c.config.Size(value)
+	}
+	if c.config.MaxSize > 0 && size > c.config.MaxSize {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var expires time.Time
+	if c.config.TTL > 0 {
+		expires = time.Now().Add(c.config.TTL)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		c.size += size - e.size
+		e.value, e.size, e.expires = value, size, expires
+		c.ll.MoveToFront(elem)
+	} else {
+		c.items[key] = c.ll.PushFront(&entry[K, V]{key: key, value: value, size: size, expires: expires})
+		c.size += size
+	}
+
+	for c.overBounds() {
+		c.removeElement(c.ll.Back())
+	}
+}
+
+// Remove drops a cached value
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// Len returns the number of cached entries, including expired ones not yet
+// dropped
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.ll.Len()
+}
+
+// Size returns the total size of the cached entries
+func (c *Cache[K, V]) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+// overBounds reports whether the cache holds more than its bounds allow.
+// Called with c.mu held.
+func (c *Cache[K, V]) overBounds() bool {
+	if c.ll.Len() == 0 {
+		return false
+	}
+	return (c.config.MaxEntries > 0 && c.ll.Len() > c.config.MaxEntries) ||
+		(c.config.MaxSize > 0 && c.size > c.config.MaxSize)
+}
+
+// removeElement drops an entry. Called with c.mu held.
+func (c *Cache[K, V]) removeElement(elem *list.Element) {
+	e := c.ll.Remove(elem).(*entry[K, V])
+	delete(c.items, e.key)
+	c.size -= e.size
+}
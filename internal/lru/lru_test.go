@@ -0,0 +1,74 @@
+package lru
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string](Config[string]{MaxEntries: 2})
+
+	c.Add("a", "a")
+	c.Add("b", "b")
+	c.Get("a") // a is now more recent than b
+	c.Add("d", "d")
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("least recently used entry survived eviction")
+	}
+	for _, key := range []string{"a", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("entry %s was evicted", key)
+		}
+	}
+}
+
+func TestCacheExpiresEntries(t *testing.T) {
+	c := New[string](Config[int]{TTL: 20 * time.Millisecond})
+	c.Add("a", 1)
+
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get before expiry = %d, %v; want 1, true", v, ok)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("expired entry still served")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len after expiry = %d, want 0", n)
+	}
+}
+
+func TestCacheBoundsTotalSize(t *testing.T) {
+	c := New[string](Config[string]{MaxSize: 10, Size: func(v string) int64 { return int64(len(v)) }})
+
+	c.Add("a", "aaaa")
+	c.Add("b", "bbbb")
+	c.Add("c", "cccc")
+	if _, ok := c.Get("a"); ok {
+		t.Error("oldest entry survived going over the size bound")
+	}
+	if size := c.Size(); size != 8 {
+		t.Errorf("Size = %d, want 8", size)
+	}
+
+	// Replacing a value counts its new size
+	c.Add("b", "bb")
+	if size := c.Size(); size != 6 {
+		t.Errorf("Size after replacing = %d, want 6", size)
+	}
+
+	// Values larger than the whole cache aren't stored and evict nothing
+	c.Add("big", "0123456789x")
+	if _, ok := c.Get("big"); ok {
+		t.Error("value larger than the cache was stored")
+	}
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len = %d, want 2", n)
+	}
+
+	c.Remove("b")
+	if size := c.Size(); size != 4 {
+		t.Errorf("Size after Remove = %d, want 4", size)
+	}
+}
@@ -1,25 +1,39 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/auth"
 )
 
+// APIKeyHeader is the header bots and integrations send their API key in
+const APIKeyHeader = "X-API-Key"
+
 // AuthService defines the interface for authentication operations
 type AuthService interface {
-	ValidateToken(tokenString string) (uuid.UUID, bool, error)
+	ParseToken(tokenString string) (*auth.Claims, error)
+	ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error)
 }
 
-// AuthMiddleware returns a gin middleware for JWT authentication
+// AuthMiddleware returns a gin middleware for authentication. A bearer JWT in
+// the Authorization header is used if present; otherwise an API key in the
+// X-API-Key header is accepted.
 func AuthMiddleware(authSvc AuthService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the Authorization header
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
+			if key := c.GetHeader(APIKeyHeader); key != "" {
+				authenticateAPIKey(c, authSvc, key)
+				return
+			}
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authorization header required"})
 			return
 		}
@@ -32,21 +46,48 @@ func AuthMiddleware(authSvc AuthService) gin.HandlerFunc {
 		}
 
 		// Validate the token
-		userID, isAdmin, err := authSvc.ValidateToken(parts[1])
+		claims, err := authSvc.ParseToken(parts[1])
+		if errors.Is(err, auth.ErrExpiredToken) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "token expired, please refresh", "code": "token_expired"})
+			return
+		}
 		if err != nil {
-			log.Debug().Err(err).Msg("Invalid token")
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid or expired token"})
+			log.Ctx(c).Debug().Err(err).Msg("Invalid token")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token", "code": "invalid_token"})
 			return
 		}
 
-		// Store user ID and admin status in context
-		c.Set("user_id", userID)
-		c.Set("is_admin", isAdmin)
-
+		setClaims(c, claims)
 		c.Next()
 	}
 }
 
+// authenticateAPIKey authenticates a request by API key
+func authenticateAPIKey(c *gin.Context, authSvc AuthService, key string) {
+	claims, err := authSvc.ValidateAPIKey(c.Request.Context(), key)
+	if errors.Is(err, auth.ErrInvalidAPIKey) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid API key", "code": "invalid_api_key"})
+		return
+	}
+	if err != nil {
+		log.Ctx(c).Error().Err(err).Msg("Failed to validate API key")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to validate API key"})
+		return
+	}
+
+	setClaims(c, claims)
+	c.Set("api_key", true)
+	c.Next()
+}
+
+// setClaims stores the authenticated user ID, admin status and permissions in
+// the context
+func setClaims(c *gin.Context, claims *auth.Claims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("is_admin", claims.Admin)
+	c.Set("claims", claims)
+}
+
 // AdminRequired returns a middleware that requires admin privileges
 func AdminRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -65,6 +106,24 @@ func AdminRequired() gin.HandlerFunc {
 	}
 }
 
+// RequirePermission returns a middleware that requires a permission granted
+// by one of the user's roles. Admins have every permission.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("claims"); !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		if !HasPermission(c, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission required", "permission": permission})
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // GetUserID extracts the user ID from the context
 func GetUserID(c *gin.Context) (uuid.UUID, bool) {
 	userID, exists := c.Get("user_id")
@@ -84,3 +143,20 @@ func IsAdmin(c *gin.Context) bool {
 
 	return isAdmin.(bool)
 }
+
+// HasPermission checks if the current user has a permission, either through
+// their roles or by being an admin
+func HasPermission(c *gin.Context, permission string) bool {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return false
+	}
+
+	return claims.(*auth.Claims).HasPermission(permission)
+}
+
+// IsAPIKeyAuth checks if the current request was authenticated by API key
+// rather than by a session token
+func IsAPIKeyAuth(c *gin.Context) bool {
+	return c.GetBool("api_key")
+}
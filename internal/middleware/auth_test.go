@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+)
+
+// tokenTable answers ParseToken from a fixed table of tokens
+type tokenTable map[string]error
+
+func (table tokenTable) ParseToken(token string) (*auth.Claims, error) {
+	err, ok := table[token]
+	if !ok {
+		return nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auth.Claims{UserID: uuid.New()}, nil
+}
+
+func (table tokenTable) ValidateAPIKey(ctx context.Context, key string) (*auth.Claims, error) {
+	return nil, auth.ErrInvalidAPIKey
+}
+
+func TestAuthMiddlewareTokenErrors(t *testing.T) {
+	service := tokenTable{
+		"good":    nil,
+		"expired": auth.ErrExpiredToken,
+		"forged":  auth.ErrInvalidToken,
+	}
+	router := gin.New()
+	router.GET("/me", AuthMiddleware(service), func(c *gin.Context) {
+		userID, _ := GetUserID(c)
+		c.JSON(http.StatusOK, gin.H{"user_id": userID})
+	})
+
+	tests := []struct {
+		token    string
+		want     int
+		wantCode string
+	}{
+		{"good", http.StatusOK, ""},
+		// Clients are told to refresh only when that would help
+		{"expired", http.StatusUnauthorized, "token_expired"},
+		{"forged", http.StatusUnauthorized, "invalid_token"},
+		{"unknown", http.StatusUnauthorized, "invalid_token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.token, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.want, w.Body)
+			}
+			var body struct {
+				Code string `json:"code"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", body.Code, tt.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Compression defaults
+const (
+	defaultCompressionMinSize = 1024
+)
+
+// Supported content encodings, in order of preference
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// CompressionConfig configures response compression
+type CompressionConfig struct {
+	// Disabled sends every response uncompressed
+	Disabled bool
+	// MinSize is the smallest body in bytes worth compressing. Defaults to
+	// 1024.
+	MinSize int
+	// Level is the compression level, from 1 (fastest) to 9 (smallest).
+	// Zero uses the default level.
+	Level int
+}
+
+// Compression returns a gin middleware that gzip- or deflate-compresses
+// responses for clients that accept it. Only text-like content types are
+// compressed, so images, archives and other already-compressed bodies pass
+// through, as do bodies under MinSize, range responses and WebSocket upgrades.
+func Compression(config CompressionConfig) gin.HandlerFunc {
+	if config.Disabled {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	if config.MinSize <= 0 {
+		config.MinSize = defaultCompressionMinSize
+	}
+	if config.Level == 0 || config.Level < flate.HuffmanOnly || config.Level > flate.BestCompression {
+		config.Level = flate.DefaultCompression
+	}
+
+	return func(c *gin.Context) {
+		// Upgraded connections hijack the writer and must see it unwrapped
+		if isWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead || c.GetHeader("Range") != "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: c.Writer,
+			encoding:       encoding,
+			level:          config.Level,
+			minSize:        config.MinSize,
+		}
+		c.Writer = writer
+		defer writer.close()
+
+		c.Next()
+	}
+}
+
+// isWebSocketUpgrade reports whether a request asks to switch to WebSocket
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// honoring q=0 refusals. It returns "" if neither is acceptable.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		ok := true
+		if q, found := strings.CutPrefix(strings.TrimSpace(params), "q="); found {
+			if value, err := strconv.ParseFloat(q, 64); err == nil && value <= 0 {
+				ok = false
+			}
+		}
+		if name == "*" {
+			wildcard = ok
+			continue
+		}
+		accepted[name] = ok
+	}
+
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		if ok, listed := accepted[encoding]; ok || (!listed && wildcard) {
+			return encoding
+		}
+	}
+	return ""
+}
+
+// isCompressible reports whether a content type is worth compressing
+func isCompressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/x-ndjson", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// compressWriter holds back the start of a response until it knows whether
+// to compress it: once the body reaches minSize, or when it is flushed.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	buf        bytes.Buffer
+	decided    bool
+	compressor io.WriteCloser
+}
+
+// Write buffers until the compression decision is made, then compresses or
+// passes the body through
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if !w.decided {
+		w.buf.Write(data)
+		if w.buf.Len() < w.minSize {
+			return len(data), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+	if w.compressor != nil {
+		return w.compressor.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString writes a string body
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush decides on compression with what has been written so far, so
+// streamed responses aren't held back
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(true)
+	}
+	if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide settles whether the response is compressed and writes out the
+// buffered start of the body. worthIt is false when the whole body came in
+// under minSize.
+func (w *compressWriter) decide(worthIt bool) error {
+	w.decided = true
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" && w.buf.Len() > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf.Bytes()))
+	}
+
+	status := w.Status()
+	compress := worthIt &&
+		!w.Written() &&
+		header.Get("Content-Encoding") == "" &&
+		header.Get("Content-Range") == "" &&
+		status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		status != http.StatusPartialContent &&
+		isCompressible(header.Get("Content-Type"))
+
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		var err error
+		if w.encoding == encodingGzip {
+			w.compressor, err = gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		} else {
+			w.compressor, err = flate.NewWriter(w.ResponseWriter, w.level)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	data := w.buf.Bytes()
+	w.buf = bytes.Buffer{}
+	if w.compressor != nil {
+		_, err := w.compressor.Write(data)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(data)
+	return err
+}
+
+// close writes out a body that stayed under minSize, or finishes the
+// compressed stream
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(false)
+	}
+	if w.compressor != nil {
+		w.compressor.Close()
+	}
+}
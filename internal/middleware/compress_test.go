@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// chatListing is a large chat list response, shaped like GET /api/chats
+func chatListing() gin.H {
+	chats := make([]gin.H, 200)
+	for i := range chats {
+		chats[i] = gin.H{
+			"id":          fmt.Sprintf("00000000-0000-0000-0000-%012d", i),
+			"name":        fmt.Sprintf("Project channel %d", i),
+			"description": "Planning and status updates for the team",
+			"is_private":  i%3 == 0,
+			"created_at":  time.Date(2024, 1, 1, 0, 0, i, 0, time.UTC),
+			"updated_at":  time.Date(2024, 6, 1, 0, 0, i, 0, time.UTC),
+		}
+	}
+	return gin.H{"chats": chats}
+}
+
+// compressed serves a request through Compression with the given
+// Accept-Encoding, answering with handler
+func compressed(config CompressionConfig, acceptEncoding string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.Use(Compression(config))
+	router.GET("/", handler)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// decode undoes a response's Content-Encoding
+func decode(t *testing.T, w *httptest.ResponseRecorder) []byte {
+	t.Helper()
+
+	var r io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gz, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("gzip.NewReader: %v", err)
+		}
+		r = gz
+	case "deflate":
+		r = flate.NewReader(w.Body)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("reading body: %v", err)
+	}
+	return body
+}
+
+func TestCompressionShrinksLargeChatListing(t *testing.T) {
+	listing := func(c *gin.Context) { c.JSON(http.StatusOK, chatListing()) }
+	plain := compressed(CompressionConfig{}, "", listing)
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("compressed without Accept-Encoding")
+	}
+	want, _ := json.Marshal(chatListing())
+
+	for _, encoding := range []string{"gzip", "deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			w := compressed(CompressionConfig{}, encoding, listing)
+
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", got, encoding)
+			}
+			if w.Header().Get("Content-Length") != "" {
+				t.Error("Content-Length set on a compressed body")
+			}
+			if !strings.Contains(w.Header().Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Vary = %q, want Accept-Encoding", w.Header().Get("Vary"))
+			}
+			if w.Body.Len()*4 > plain.Body.Len() {
+				t.Errorf("compressed to %d bytes from %d, want under a quarter", w.Body.Len(), plain.Body.Len())
+			}
+			if body := decode(t, w); !bytes.Equal(bytes.TrimSpace(body), want) {
+				t.Error("decompressed body differs from the listing")
+			}
+		})
+	}
+}
+
+func TestCompressionSkips(t *testing.T) {
+	large := strings.Repeat("hello compression ", 200)
+
+	tests := []struct {
+		name           string
+		config         CompressionConfig
+		acceptEncoding string
+		handler        gin.HandlerFunc
+	}{
+		{"small body", CompressionConfig{}, "gzip", func(c *gin.Context) { c.String(http.StatusOK, "short") }},
+		{"under configured minimum", CompressionConfig{MinSize: 1 << 20}, "gzip", func(c *gin.Context) { c.String(http.StatusOK, large) }},
+		{"already compressed type", CompressionConfig{}, "gzip", func(c *gin.Context) {
+			c.Data(http.StatusOK, "image/png", []byte(large))
+		}},
+		{"already encoded", CompressionConfig{}, "gzip", func(c *gin.Context) {
+			c.Header("Content-Encoding", "br")
+			c.Data(http.StatusOK, "application/json", []byte(large))
+		}},
+		{"disabled", CompressionConfig{Disabled: true}, "gzip", func(c *gin.Context) { c.String(http.StatusOK, large) }},
+		{"refused encodings", CompressionConfig{}, "gzip;q=0, deflate;q=0", func(c *gin.Context) { c.String(http.StatusOK, large) }},
+		{"unsupported encoding", CompressionConfig{}, "br", func(c *gin.Context) { c.String(http.StatusOK, large) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := compressed(tt.config, tt.acceptEncoding, tt.handler)
+
+			if got := w.Header().Get("Content-Encoding"); got == "gzip" || got == "deflate" {
+				t.Errorf("Content-Encoding = %q, want the body passed through", got)
+			}
+			if w.Code != http.StatusOK || w.Body.Len() == 0 {
+				t.Errorf("status %d with %d bytes, want the body intact", w.Code, w.Body.Len())
+			}
+		})
+	}
+}
+
+func TestCompressionLeavesWebSocketUpgradesAlone(t *testing.T) {
+	router := gin.New()
+	router.Use(Compression(CompressionConfig{}))
+	var wrapped bool
+	router.GET("/ws", func(c *gin.Context) {
+		_, wrapped = c.Writer.(*compressWriter)
+		c.Status(http.StatusSwitchingProtocols)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if wrapped {
+		t.Error("upgrade request got a compressing writer, which can't be hijacked")
+	}
+	if got := w.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q on an upgrade", got)
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"deflate", "deflate"},
+		{"deflate, gzip", "gzip"},
+		{"GZIP;q=0.5", "gzip"},
+		{"gzip;q=0, deflate", "deflate"},
+		{"*", "gzip"},
+		{"*, gzip;q=0", "deflate"},
+		{"*;q=0", ""},
+		{"identity, br", ""},
+	}
+
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// ConcurrencyLimiterConfig holds concurrency limiter configuration
+type ConcurrencyLimiterConfig struct {
+	// MaxInFlight is the number of requests handled at once. Defaults to 1024.
+	MaxInFlight int
+	// RetryAfter is suggested to clients turned away while the server is full
+	RetryAfter time.Duration
+}
+
+// ConcurrencyLimiter caps the number of requests being handled at once so a
+// burst of traffic can't exhaust database connections and memory
+type ConcurrencyLimiter struct {
+	config ConcurrencyLimiterConfig
+	slots  chan struct{}
+	exempt map[string]bool
+}
+
+// NewConcurrencyLimiter creates a new concurrency limiter
+func NewConcurrencyLimiter(config ConcurrencyLimiterConfig) *ConcurrencyLimiter {
+	if config.MaxInFlight <= 0 {
+		config.MaxInFlight = 1024
+	}
+	if config.RetryAfter <= 0 {
+		config.RetryAfter = time.Second
+	}
+
+	return &ConcurrencyLimiter{
+		config: config,
+		slots:  make(chan struct{}, config.MaxInFlight),
+		exempt: make(map[string]bool),
+	}
+}
+
+// Exempt excludes routes, given as registered paths, from the limit. Use it
+// for cheap probes and for long-lived connections that would otherwise hold
+// a slot indefinitely.
+func (cl *ConcurrencyLimiter) Exempt(paths ...string) {
+	for _, path := range paths {
+		cl.exempt[path] = true
+	}
+}
+
+// InFlight returns the number of requests currently holding a slot
+func (cl *ConcurrencyLimiter) InFlight() int {
+	return len(cl.slots)
+}
+
+// Middleware returns a gin middleware that enforces the limit. Requests that
+// arrive while every slot is taken are rejected with 503 rather than queued.
+func (cl *ConcurrencyLimiter) Middleware() gin.HandlerFunc {
+	retryAfter := strconv.Itoa(int((cl.config.RetryAfter + time.Second - 1) / time.Second))
+
+	return func(c *gin.Context) {
+		if cl.exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		select {
+		case cl.slots <- struct{}{}:
+		default:
+			log.Ctx(c).Warn().
+				Int("max_in_flight", cl.config.MaxInFlight).
+				Str("path", c.Request.URL.Path).
+				Msg("Concurrency limit reached")
+
+			c.Header("Retry-After", retryAfter)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error": "server is busy, try again later",
+			})
+			return
+		}
+		defer func() { <-cl.slots }()
+
+		c.Next()
+	}
+}
@@ -0,0 +1,114 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// blockingRouter serves /slow, which holds its slot until release is closed,
+// plus a cheap /fast route, an exempt /health route and a /panic route
+type blockingRouter struct {
+	limiter *ConcurrencyLimiter
+	router  *gin.Engine
+	entered chan struct{}
+	release chan struct{}
+}
+
+func newBlockingRouter(maxInFlight int) *blockingRouter {
+	br := &blockingRouter{
+		limiter: NewConcurrencyLimiter(ConcurrencyLimiterConfig{MaxInFlight: maxInFlight, RetryAfter: 1500 * time.Millisecond}),
+		router:  gin.New(),
+		entered: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	br.limiter.Exempt("/health")
+
+	br.router.Use(gin.RecoveryWithWriter(io.Discard), br.limiter.Middleware())
+	br.router.GET("/slow", func(c *gin.Context) {
+		br.entered <- struct{}{}
+		<-br.release
+		c.Status(http.StatusOK)
+	})
+	br.router.GET("/fast", func(c *gin.Context) { c.Status(http.StatusOK) })
+	br.router.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	br.router.GET("/panic", func(c *gin.Context) { panic("handler failed") })
+	return br
+}
+
+func (br *blockingRouter) get(path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	br.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestConcurrencyLimiterRejectsWhenFull(t *testing.T) {
+	br := newBlockingRouter(2)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = br.get("/slow").Code
+		}(i)
+	}
+	for range codes {
+		<-br.entered
+	}
+
+	if got := br.limiter.InFlight(); got != 2 {
+		t.Errorf("InFlight = %d with both slow requests running, want 2", got)
+	}
+
+	w := br.get("/fast")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("request over the limit: status = %d, want 503", w.Code)
+	}
+	// Retry-After is whole seconds, rounded up
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Retry-After = %q, want %q", got, "2")
+	}
+
+	if w := br.get("/health"); w.Code != http.StatusOK {
+		t.Errorf("exempt route while full: status = %d, want 200", w.Code)
+	}
+
+	close(br.release)
+	wg.Wait()
+	for i, code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("slow request %d: status = %d, want 200", i, code)
+		}
+	}
+
+	if got := br.limiter.InFlight(); got != 0 {
+		t.Errorf("InFlight = %d after requests finished, want 0", got)
+	}
+	if w := br.get("/fast"); w.Code != http.StatusOK {
+		t.Errorf("request after slots were released: status = %d, want 200", w.Code)
+	}
+}
+
+func TestConcurrencyLimiterReleasesOnPanic(t *testing.T) {
+	br := newBlockingRouter(1)
+
+	for i := 0; i < 3; i++ {
+		if w := br.get("/panic"); w.Code != http.StatusInternalServerError {
+			t.Fatalf("panicking request %d: status = %d, want 500", i, w.Code)
+		}
+	}
+
+	if got := br.limiter.InFlight(); got != 0 {
+		t.Errorf("InFlight = %d after panics, want 0", got)
+	}
+	if w := br.get("/fast"); w.Code != http.StatusOK {
+		t.Errorf("status = %d after panics, want 200", w.Code)
+	}
+}
@@ -45,12 +45,13 @@ func (tb *TokenBucket) refill() {
 	elapsed := now.Sub(tb.lastRefillTime)
 	tb.lastRefillTime = now
 
-	tokensToAdd := elapsed.Seconds() * 60 * tb.refillRate
+	tokensToAdd := float64(elapsed) * tb.refillRate
 	tb.tokens = min(tb.capacity, tb.tokens+tokensToAdd)
 }
 
-// allow checks if a request is allowed based on available tokens
-func (tb *TokenBucket) allow() bool {
+// Allow checks if a request is allowed based on available tokens, consuming
+// one if so
+func (tb *TokenBucket) Allow() bool {
 	tb.mu.Lock()
 	defer tb.mu.Unlock()
 
@@ -64,6 +65,25 @@ func (tb *TokenBucket) allow() bool {
 	return false
 }
 
+// status reports the bucket's state without consuming a token
+func (tb *TokenBucket) status() BucketStatus {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	tb.refill()
+
+	reset := tb.lastRefillTime
+	if missing := tb.capacity - tb.tokens; missing > 0 && tb.refillRate > 0 {
+		reset = reset.Add(time.Duration(missing / tb.refillRate))
+	}
+
+	return BucketStatus{
+		Limit:     int(tb.capacity),
+		Remaining: int(tb.tokens),
+		Reset:     reset,
+	}
+}
+
 // getClientBucket gets or creates a token bucket for a specific client
 func (tb *TokenBucket) getClientBucket(clientIP string) *TokenBucket {
 	tb.mu.Lock()
@@ -78,22 +98,92 @@ func (tb *TokenBucket) getClientBucket(clientIP string) *TokenBucket {
 	return bucket
 }
 
+// BucketStatus describes a client's rate limit budget
+type BucketStatus struct {
+	Enabled   bool      `json:"enabled"`
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+// RateLimiter enforces per-client request budgets
+type RateLimiter struct {
+	config  RateLimiterConfig
+	buckets *TokenBucket
+	exempt  map[string]bool
+}
+
+// NewRateLimiter creates a new rate limiter
+func NewRateLimiter(config RateLimiterConfig) *RateLimiter {
+	return &RateLimiter{
+		config:  config,
+		buckets: NewTokenBucket(config.RequestsPerMinute),
+		exempt:  make(map[string]bool),
+	}
+}
+
+// Exempt excludes routes, given as registered paths, from rate limiting
+func (rl *RateLimiter) Exempt(paths ...string) {
+	for _, path := range paths {
+		rl.exempt[path] = true
+	}
+}
+
+// Key returns the bucket key for a request
+func (rl *RateLimiter) Key(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// Status reports the budget for a bucket key without consuming from it
+func (rl *RateLimiter) Status(key string) BucketStatus {
+	if !rl.config.Enabled {
+		return BucketStatus{Enabled: false}
+	}
+
+	rl.buckets.mu.Lock()
+	bucket, exists := rl.buckets.clientBuckets[key]
+	rl.buckets.mu.Unlock()
+
+	// Clients that haven't made a request yet have a full bucket
+	if !exists {
+		return BucketStatus{
+			Enabled:   true,
+			Limit:     rl.config.RequestsPerMinute,
+			Remaining: rl.config.RequestsPerMinute,
+			Reset:     time.Now(),
+		}
+	}
+
+	status := bucket.status()
+	status.Enabled = true
+	return status
+}
+
 // RateLimiterMiddleware returns a gin middleware for rate limiting
 func RateLimiterMiddleware(config RateLimiterConfig) gin.HandlerFunc {
+	return NewRateLimiter(config).Middleware()
+}
+
+// Middleware returns a gin middleware that enforces the limiter
+func (rl *RateLimiter) Middleware() gin.HandlerFunc {
+	config := rl.config
 	if !config.Enabled {
 		return func(c *gin.Context) {
 			c.Next()
 		}
 	}
 
-	limiter := NewTokenBucket(config.RequestsPerMinute)
-
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		bucket := limiter.getClientBucket(clientIP)
+		if rl.exempt[c.FullPath()] {
+			c.Next()
+			return
+		}
+
+		clientIP := rl.Key(c)
+		bucket := rl.buckets.getClientBucket(clientIP)
 
-		if !bucket.allow() {
-			log.Debug().
+		if !bucket.Allow() {
+			log.Ctx(c).Debug().
 				Str("client_ip", clientIP).
 				Int("rate_limit", config.RequestsPerMinute).
 				Msg("Rate limit exceeded")
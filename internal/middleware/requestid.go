@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// RequestIDHeader carries a request's correlation ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength caps client-supplied request IDs
+const maxRequestIDLength = 128
+
+// RequestID tags each request with a correlation ID: the client's
+// X-Request-ID if it sent a usable one, otherwise a new UUID. The ID is echoed
+// in the response, and the request's context carries a logger that adds it
+// to every line logged with log.Ctx.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.New().String()
+		}
+
+		c.Set("request_id", id)
+		c.Header(RequestIDHeader, id)
+
+		logger := log.With().Str("request_id", id).Logger()
+		c.Request = c.Request.WithContext(logger.WithContext(c.Request.Context()))
+
+		c.Next()
+	}
+}
+
+// GetRequestID extracts the request ID from the context
+func GetRequestID(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to log
+// and echo: non-empty, bounded, and printable ASCII
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// securityHeaders lists every header SecurityHeaders can set
+var securityHeaders = []string{
+	"X-Content-Type-Options",
+	"X-Frame-Options",
+	"Content-Security-Policy",
+	"Referrer-Policy",
+	"Strict-Transport-Security",
+}
+
+// headersFor serves one request through SecurityHeaders, over TLS if secure
+func headersFor(config SecurityHeadersConfig, secure bool) http.Header {
+	router := gin.New()
+	router.Use(SecurityHeaders(config))
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if secure {
+		req.TLS = &tls.ConnectionState{}
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w.Header()
+}
+
+func TestSecurityHeadersDefaults(t *testing.T) {
+	header := headersFor(SecurityHeadersConfig{}, true)
+
+	want := map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"X-Frame-Options":           defaultFrameOptions,
+		"Content-Security-Policy":   defaultContentSecurityPolicy,
+		"Referrer-Policy":           defaultReferrerPolicy,
+		"Strict-Transport-Security": "max-age=31536000",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSecurityHeadersConfigured(t *testing.T) {
+	header := headersFor(SecurityHeadersConfig{
+		FrameOptions:          "SAMEORIGIN",
+		ContentSecurityPolicy: "default-src 'none'",
+		ReferrerPolicy:        "same-origin",
+		HSTSMaxAge:            24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+	}, true)
+
+	want := map[string]string{
+		"X-Frame-Options":           "SAMEORIGIN",
+		"Content-Security-Policy":   "default-src 'none'",
+		"Referrer-Policy":           "same-origin",
+		"Strict-Transport-Security": "max-age=86400; includeSubDomains",
+	}
+	for name, value := range want {
+		if got := header.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestSecurityHeadersHSTSOnlyOverTLS(t *testing.T) {
+	header := headersFor(SecurityHeadersConfig{}, false)
+
+	if got := header.Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security = %q over plain HTTP, want none", got)
+	}
+	if got := header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options = %q over plain HTTP, want nosniff", got)
+	}
+}
+
+func TestSecurityHeadersDisabled(t *testing.T) {
+	header := headersFor(SecurityHeadersConfig{Disabled: true, FrameOptions: "SAMEORIGIN"}, true)
+
+	for _, name := range securityHeaders {
+		if got := header.Get(name); got != "" {
+			t.Errorf("%s = %q with headers disabled, want none", name, got)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AIUsage is the tokens one AI request used on behalf of a user
+type AIUsage struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	UserID           uuid.UUID `json:"user_id" db:"user_id"`
+	Model            string    `json:"model" db:"model"`
+	PromptTokens     int       `json:"prompt_tokens" db:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens" db:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens" db:"total_tokens"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+}
+
+// AIUsageSummary is how much of their token quota a user has used in the
+// current period
+type AIUsageSummary struct {
+	UserID      uuid.UUID `json:"user_id"`
+	PeriodStart time.Time `json:"period_start"`
+	TotalTokens int       `json:"total_tokens"`
+	// MonthlyQuota is zero when there is no limit, in which case Remaining
+	// is omitted
+	MonthlyQuota int  `json:"monthly_quota"`
+	Remaining    *int `json:"remaining,omitempty"`
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"bytes"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -16,22 +18,71 @@ type Chat struct {
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 	IsPrivate   bool      `json:"is_private" db:"is_private"`
 	IsEncrypted bool      `json:"is_encrypted" db:"is_encrypted"`
+	// AIModel is the model the assistant answers with in this chat. Empty
+	// uses the configured model.
+	AIModel string `json:"ai_model" db:"ai_model"`
+	// Per-user state, only set when listing a user's chats
+	IsFavorite bool `json:"is_favorite" db:"is_favorite"`
+	IsArchived bool `json:"is_archived" db:"is_archived"`
 	// Not directly from DB, populated separately
 	Creator     *User         `json:"creator,omitempty" db:"-"`
 	Members     []*ChatMember `json:"members,omitempty" db:"-"`
 	LastMessage *Message      `json:"last_message,omitempty" db:"-"`
+	UnreadCount int           `json:"unread_count" db:"-"`
+	Draft       *MessageDraft `json:"draft,omitempty" db:"-"`
+}
+
+// Chat list sort orders
+const (
+	// ChatSortRecent lists favorites first, then the most recently active
+	ChatSortRecent = "recent"
+	// ChatSortName lists chats alphabetically
+	ChatSortName = "name"
+	// ChatSortCreated lists the newest chats first
+	ChatSortCreated = "created"
+)
+
+// ChatFilter narrows down and orders a user's chat list. Unset fields don't
+// filter.
+type ChatFilter struct {
+	// Search matches chat names containing it, ignoring case
+	Search string
+	// Private, Favorite and Archived keep only chats whose flag matches
+	Private  *bool
+	Favorite *bool
+	Archived *bool
+	// UnreadOnly keeps only chats with messages the user hasn't read
+	UnreadOnly bool
+	// Sort is one of the ChatSort orders. Empty means ChatSortRecent.
+	Sort   string
+	Limit  int
+	Offset int
 }
 
 // ChatMember represents a member of a chat
 type ChatMember struct {
-	ChatID   uuid.UUID `json:"chat_id" db:"chat_id"`
-	UserID   uuid.UUID `json:"user_id" db:"user_id"`
-	JoinedAt time.Time `json:"joined_at" db:"joined_at"`
-	IsAdmin  bool      `json:"is_admin" db:"is_admin"`
+	ChatID      uuid.UUID  `json:"chat_id" db:"chat_id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	JoinedAt    time.Time  `json:"joined_at" db:"joined_at"`
+	IsAdmin     bool       `json:"is_admin" db:"is_admin"`
+	LastReadAt  *time.Time `json:"last_read_at" db:"last_read_at"`
+	UnreadCount int        `json:"unread_count" db:"unread_count"`
+	IsFavorite  bool       `json:"is_favorite" db:"is_favorite"`
+	IsArchived  bool       `json:"is_archived" db:"is_archived"`
+	// Whether the member created the chat, only set by GetChatMember
+	IsOwner bool `json:"is_owner" db:"is_owner"`
 	// Not directly from DB, populated separately
 	User *User `json:"user,omitempty" db:"-"`
 }
 
+// MessageDraft is a user's unsent message in a chat, synced across devices
+type MessageDraft struct {
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	ChatID    uuid.UUID `json:"chat_id" db:"chat_id"`
+	Content   string    `json:"content" db:"content"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
 // Message represents a chat message
 type Message struct {
 	ID               uuid.UUID  `json:"id" db:"id"`
@@ -44,16 +95,70 @@ type Message struct {
 	IsEdited         bool       `json:"is_edited" db:"is_edited"`
 	IsDeleted        bool       `json:"is_deleted" db:"is_deleted"`
 	ReplyTo          *uuid.UUID `json:"reply_to" db:"reply_to"`
+	Depth            int        `json:"depth" db:"depth"`
 	IsAIGenerated    bool       `json:"is_ai_generated" db:"is_ai_generated"`
+	ForwardedFrom    *uuid.UUID `json:"forwarded_from,omitempty" db:"forwarded_from"`
 	// Not directly from DB, populated separately
 	User           *User         `json:"user,omitempty" db:"-"`
 	ReplyToMessage *Message      `json:"reply_to_message,omitempty" db:"-"`
 	Attachments    []*Attachment `json:"attachments,omitempty" db:"-"`
+	// Reaction counts by emoji, populated when listing messages
+	Reactions []*ReactionCount `json:"reactions,omitempty" db:"-"`
+	// Attachment references for quoting, populated on ReplyToMessage
+	AttachmentPreviews []*AttachmentPreview `json:"attachment_previews,omitempty" db:"-"`
 	// Status fields for client display, not stored in DB
 	IsSent      bool `json:"is_sent,omitempty" db:"-"`
 	IsDelivered bool `json:"is_delivered,omitempty" db:"-"`
 }
 
+// Modes for showing deleted messages in message listings
+const (
+	// DeletedMessagesPlaceholder keeps deleted messages in place, so threads
+	// keep their shape, with their content replaced by DeletedMessageContent
+	DeletedMessagesPlaceholder = "placeholder"
+	// DeletedMessagesHide leaves deleted messages out of listings entirely
+	DeletedMessagesHide = "hide"
+)
+
+// DeletedMessageContent is shown in place of a deleted message's content
+const DeletedMessageContent = "[message deleted]"
+
+// Redact replaces a deleted message's content with DeletedMessageContent and
+// drops its attachments and reactions. It does nothing to other messages.
+func (m *Message) Redact() {
+	if !m.IsDeleted {
+		return
+	}
+	m.Content = DeletedMessageContent
+	m.ContentEncrypted = false
+	m.Attachments = nil
+	m.Reactions = nil
+}
+
+// MessageEdit is a version of a message's content that was replaced by an
+// edit. EditedAt is when it was replaced.
+type MessageEdit struct {
+	ID               uuid.UUID `json:"id" db:"id"`
+	MessageID        uuid.UUID `json:"message_id" db:"message_id"`
+	Content          string    `json:"content" db:"content"`
+	ContentEncrypted bool      `json:"content_encrypted" db:"content_encrypted"`
+	EditedAt         time.Time `json:"edited_at" db:"edited_at"`
+}
+
+// MessageReaction is an emoji reaction a user left on a message
+type MessageReaction struct {
+	MessageID uuid.UUID `json:"message_id" db:"message_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Emoji     string    `json:"emoji" db:"emoji"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// ReactionCount is how many users reacted to a message with an emoji
+type ReactionCount struct {
+	Emoji string `json:"emoji" db:"emoji"`
+	Count int    `json:"count" db:"count"`
+}
+
 // DirectMessage represents a direct message between two users
 type DirectMessage struct {
 	ID               uuid.UUID  `json:"id" db:"id"`
@@ -78,6 +183,51 @@ type DirectMessage struct {
 	IsDelivered bool `json:"is_delivered,omitempty" db:"-"`
 }
 
+// Redact replaces a deleted direct message's content with
+// DeletedMessageContent and drops its attachments. It does nothing to other
+// messages.
+func (m *DirectMessage) Redact() {
+	if !m.IsDeleted {
+		return
+	}
+	m.Content = DeletedMessageContent
+	m.ContentEncrypted = false
+	m.Attachments = nil
+}
+
+// dmConversationNamespace seeds the name-based UUIDs of DM conversations
+var dmConversationNamespace = uuid.MustParse("6f1c1a9e-3b0d-4c55-9a57-2a8f3b1d7e42")
+
+// DMConversation is the direct message thread between two users. DMs aren't
+// stored as chats, so the conversation is derived from the pair: UserA and
+// UserB are the two users in a fixed order and ID is computed from them, so
+// both users resolve to the same conversation.
+type DMConversation struct {
+	ID          uuid.UUID      `json:"id"`
+	UserA       uuid.UUID      `json:"user_a"`
+	UserB       uuid.UUID      `json:"user_b"`
+	LastMessage *DirectMessage `json:"last_message,omitempty"`
+	// UnreadCount is the number of unread messages sent to the viewing user
+	UnreadCount int `json:"unread_count"`
+	// Peer is the other user in the conversation, from the viewer's side
+	Peer *User `json:"peer,omitempty"`
+}
+
+// NewDMConversation returns the conversation between two users, with the
+// same ID and user order whichever way round they are given
+func NewDMConversation(userID, otherID uuid.UUID) *DMConversation {
+	a, b := userID, otherID
+	if bytes.Compare(a[:], b[:]) > 0 {
+		a, b = b, a
+	}
+
+	return &DMConversation{
+		ID:    uuid.NewSHA1(dmConversationNamespace, append(a[:], b[:]...)),
+		UserA: a,
+		UserB: b,
+	}
+}
+
 // Attachment represents a file attached to a message
 type Attachment struct {
 	ID              uuid.UUID  `json:"id" db:"id"`
@@ -90,3 +240,25 @@ type Attachment struct {
 	IsEncrypted     bool       `json:"is_encrypted" db:"is_encrypted"`
 	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
 }
+
+// AttachmentPreview is the part of an attachment a quote shows
+type AttachmentPreview struct {
+	ID       uuid.UUID `json:"id"`
+	FileName string    `json:"file_name"`
+	FileType string    `json:"file_type"`
+	// ThumbnailURL is set for images that have a thumbnail
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+}
+
+// Preview returns the attachment trimmed down for a quote
+func (a *Attachment) Preview() *AttachmentPreview {
+	preview := &AttachmentPreview{
+		ID:       a.ID,
+		FileName: a.FileName,
+		FileType: a.FileType,
+	}
+	if !a.IsEncrypted && strings.HasPrefix(a.FileType, "image/") {
+		preview.ThumbnailURL = "/api/attachments/" + a.ID.String() + "/thumbnail"
+	}
+	return preview
+}
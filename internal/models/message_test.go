@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestNewDMConversationIsSymmetric(t *testing.T) {
+	ada, grace, linus := uuid.New(), uuid.New(), uuid.New()
+
+	ab, ba := NewDMConversation(ada, grace), NewDMConversation(grace, ada)
+	if ab.ID != ba.ID || ab.UserA != ba.UserA || ab.UserB != ba.UserB {
+		t.Errorf("(ada, grace) = %+v but (grace, ada) = %+v, want the same conversation", ab, ba)
+	}
+	if ab.UserA == ab.UserB || (ab.UserA != ada && ab.UserA != grace) || (ab.UserB != ada && ab.UserB != grace) {
+		t.Errorf("users = %s, %s; want ada and grace once each", ab.UserA, ab.UserB)
+	}
+
+	// The ID is stable across calls and distinct for every pair
+	if again := NewDMConversation(ada, grace); again.ID != ab.ID {
+		t.Error("conversation ID changed between calls")
+	}
+	for _, other := range []*DMConversation{NewDMConversation(ada, linus), NewDMConversation(grace, linus)} {
+		if other.ID == ab.ID {
+			t.Errorf("pairs (%s, %s) and (ada, grace) share conversation ID", other.UserA, other.UserB)
+		}
+	}
+}
@@ -20,6 +20,9 @@ type User struct {
 	LastLogin    *time.Time `json:"last_login" db:"last_login"`
 	IsActive     bool       `json:"is_active" db:"is_active"`
 	IsAdmin      bool       `json:"is_admin" db:"is_admin"`
+	// Login lockout state, managed by the auth service
+	FailedLoginAttempts int        `json:"-" db:"failed_login_attempts"`
+	LockedUntil         *time.Time `json:"-" db:"locked_until"`
 }
 
 // SafeUser returns a user with sensitive fields removed
@@ -36,6 +39,127 @@ func (u *User) SafeUser() map[string]interface{} {
 	}
 }
 
+// Public returns a copy of the user without private fields, for embedding in
+// responses seen by other users
+func (u *User) Public() *User {
+	return &User{
+		ID:          u.ID,
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		AvatarURL:   u.AvatarURL,
+		Bio:         u.Bio,
+		CreatedAt:   u.CreatedAt,
+		IsActive:    u.IsActive,
+		IsAdmin:     u.IsAdmin,
+	}
+}
+
+// Attribution modes for messages written by deactivated or deleted users
+const (
+	// AttributionDeleted shows such authors as "[deleted user]"
+	AttributionDeleted = "deleted"
+	// AttributionUsername keeps showing the original username
+	AttributionUsername = "username"
+	// AttributionAnonymous shows a stable pseudonym derived from the user ID
+	AttributionAnonymous = "anonymous"
+)
+
+// DeletedUserName is shown in place of authors that no longer exist
+const DeletedUserName = "[deleted user]"
+
+// DeletedUser returns a placeholder author for messages whose user was removed
+func DeletedUser() *User {
+	return &User{Username: DeletedUserName, DisplayName: DeletedUserName}
+}
+
+// Attributed returns the public view of a message author. Active users are
+// returned as-is; deactivated users are shown according to mode, with
+// profile details dropped in every mode.
+func (u *User) Attributed(mode string) *User {
+	if u.IsActive {
+		return u.Public()
+	}
+
+	switch mode {
+	case AttributionUsername:
+		return &User{ID: u.ID, Username: u.Username, DisplayName: u.Username}
+	case AttributionAnonymous:
+		name := "User-" + u.ID.String()[:8]
+		return &User{ID: u.ID, Username: name, DisplayName: name}
+	default:
+		deleted := DeletedUser()
+		deleted.ID = u.ID
+		return deleted
+	}
+}
+
+// RecentContact is a user someone has recently talked to, either directly or
+// in a shared chat
+type RecentContact struct {
+	ID                uuid.UUID `json:"id" db:"id"`
+	Username          string    `json:"username" db:"username"`
+	DisplayName       string    `json:"display_name" db:"display_name"`
+	AvatarURL         string    `json:"avatar_url" db:"avatar_url"`
+	LastInteractionAt time.Time `json:"last_interaction_at" db:"last_interaction_at"`
+}
+
+// RefreshToken is a long-lived credential that can be exchanged for a new
+// access token. Only a hash of the token is stored.
+type RefreshToken struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// PasswordReset is a single-use token for setting a new password without the
+// old one. Only a hash of the token is stored.
+type PasswordReset struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// APIKey lets bots and integrations authenticate as a user without a
+// session. Only a hash of the key is stored; Prefix identifies it in lists.
+type APIKey struct {
+	ID        uuid.UUID `json:"id" db:"id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Name      string    `json:"name" db:"name"`
+	Prefix    string    `json:"prefix" db:"prefix"`
+	KeyHash   string    `json:"-" db:"key_hash"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Permissions that roles can grant
+const (
+	// PermManageRoles allows granting and revoking roles
+	PermManageRoles = "roles.manage"
+	// PermManageChats allows updating and deleting any chat
+	PermManageChats = "chats.manage"
+	// PermModerateChats gives chat admin rights in every chat the user is a
+	// member of
+	PermModerateChats = "chats.moderate"
+)
+
+// Built-in roles, created with the schema
+const (
+	RoleOwner     = "owner"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Role is a named set of permissions that can be granted to users. Admins
+// have every permission whatever roles they hold.
+type Role struct {
+	Name        string   `json:"name" db:"name"`
+	Description string   `json:"description" db:"description"`
+	Permissions []string `json:"permissions" db:"-"`
+}
+
 // UserPreferences holds user preference settings
 type UserPreferences struct {
 	UserID               uuid.UUID `json:"user_id" db:"user_id"`
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func deactivatedUser() *User {
+	return &User{
+		ID:           uuid.MustParse("3f2a9c1e-0000-4000-8000-000000000001"),
+		Username:     "ada.lovelace",
+		Email:        "ada@example.com",
+		PasswordHash: "$2a$10$secret",
+		DisplayName:  "Ada Lovelace",
+		AvatarURL:    "https://cdn.example.com/ada.png",
+		Bio:          "Lives in London",
+		IsActive:     false,
+	}
+}
+
+func TestAttributedModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		username string
+	}{
+		{AttributionDeleted, DeletedUserName},
+		{AttributionUsername, "ada.lovelace"},
+		{AttributionAnonymous, "User-3f2a9c1e"},
+		// Unknown modes fall back to the safest choice
+		{"", DeletedUserName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			user := deactivatedUser()
+			got := user.Attributed(tt.mode)
+
+			if got.ID != user.ID {
+				t.Errorf("ID = %s, want %s so clients can group the author's messages", got.ID, user.ID)
+			}
+			if got.Username != tt.username || got.DisplayName != tt.username {
+				t.Errorf("shown as %q / %q, want %q", got.Username, got.DisplayName, tt.username)
+			}
+			if got.Email != "" || got.AvatarURL != "" || got.Bio != "" {
+				t.Errorf("profile details kept: %+v", got)
+			}
+		})
+	}
+}
+
+func TestAttributedAnonymousLeaksNothing(t *testing.T) {
+	user := deactivatedUser()
+	data, err := json.Marshal(user.Attributed(AttributionAnonymous))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pii := range []string{"ada", "Ada", "Lovelace", "London", "example.com", "secret"} {
+		if strings.Contains(string(data), pii) {
+			t.Errorf("anonymized author %s contains %q", data, pii)
+		}
+	}
+
+	other := deactivatedUser()
+	other.ID = uuid.New()
+	if other.Attributed(AttributionAnonymous).Username == user.Attributed(AttributionAnonymous).Username {
+		t.Error("different users share a pseudonym")
+	}
+}
+
+func TestAttributedActiveUser(t *testing.T) {
+	user := deactivatedUser()
+	user.IsActive = true
+
+	for _, mode := range []string{AttributionDeleted, AttributionUsername, AttributionAnonymous} {
+		got := user.Attributed(mode)
+		if got.Username != user.Username || got.DisplayName != user.DisplayName || got.AvatarURL != user.AvatarURL {
+			t.Errorf("%s: active author shown as %+v", mode, got)
+		}
+		if got.Email != "" || got.PasswordHash != "" {
+			t.Errorf("%s: private fields kept for an active author", mode)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/ai"
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/websocket"
+)
+
+// AssistantConfig holds configuration for the chat AI assistant
+type AssistantConfig struct {
+	// ContextMessages is the number of prior messages sent to the model
+	ContextMessages int
+	// ThreadContext builds context from the reply chain of a message instead
+	// of the chat's most recent messages when the message is a reply
+	ThreadContext bool
+	// MaxConcurrentPerUser caps how many replies to one user's messages can
+	// be generated at once
+	MaxConcurrentPerUser int
+}
+
+// defaultMaxConcurrentPerUser is used when no per-user cap is configured
+const defaultMaxConcurrentPerUser = 2
+
+// busyNotice is posted instead of a reply when the user is at the cap
+const busyNotice = "The assistant is still working on your earlier requests. Please wait for one to finish and try again."
+
+// Assistant posts AI replies to chat messages that address the bot
+type Assistant struct {
+	db     database.Store
+	aiSvc  *ai.Service
+	fanout *websocket.Fanout
+	config AssistantConfig
+
+	// Replies being generated, per user whose message triggered them
+	inFlight   map[uuid.UUID]int
+	inFlightMu sync.Mutex
+}
+
+// NewAssistant creates a new chat assistant
+func NewAssistant(config AssistantConfig, db database.Store, aiSvc *ai.Service, fanout *websocket.Fanout) *Assistant {
+	if config.ContextMessages <= 0 {
+		config.ContextMessages = 20
+	}
+	if config.MaxConcurrentPerUser <= 0 {
+		config.MaxConcurrentPerUser = defaultMaxConcurrentPerUser
+	}
+
+	return &Assistant{
+		db:       db,
+		aiSvc:    aiSvc,
+		fanout:   fanout,
+		config:   config,
+		inFlight: make(map[uuid.UUID]int),
+	}
+}
+
+// Respond generates and stores an AI reply to a message if it addresses the bot.
+// It runs outside the request lifecycle, so ctx should not be cancelled when
+// the request ends; it is used for its values, such as the request's logger.
+func (a *Assistant) Respond(ctx context.Context, message *models.Message) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	reply, err := a.reply(ctx, message)
+	if err != nil {
+		log.Ctx(ctx).Error().
+			Err(err).
+			Str("message_id", message.ID.String()).
+			Str("chat_id", message.ChatID.String()).
+			Msg("Failed to generate AI reply")
+		return
+	}
+
+	if reply != nil {
+		publishMessage(a.fanout, reply)
+	}
+}
+
+// reply generates and stores the AI reply, returning nil if the message did not
+// trigger the assistant
+func (a *Assistant) reply(ctx context.Context, message *models.Message) (*models.Message, error) {
+	if message.IsAIGenerated || message.ContentEncrypted || !a.aiSvc.IsAddressed(message.Content) {
+		return nil, nil
+	}
+
+	// Each reply ties up a goroutine and a provider request until it is done
+	if message.UserID != nil {
+		if !a.acquire(*message.UserID) {
+			return a.post(ctx, message, busyNotice)
+		}
+		defer a.release(*message.UserID)
+	}
+
+	history, err := a.buildContext(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+
+	// A chat can pick its own model
+	chat, err := a.db.GetChatByID(ctx, message.ChatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat: %w", err)
+	}
+
+	var userID uuid.UUID
+	if message.UserID != nil {
+		userID = *message.UserID
+	}
+	handled, response, err := a.aiSvc.ProcessMessageWithAI(ctx, userID, chat.AIModel, message.Content, history)
+	var flagged *ai.ModerationError
+	if errors.As(err, &flagged) {
+		log.Ctx(ctx).Warn().
+			Str("message_id", message.ID.String()).
+			Str("user_id", userID.String()).
+			Strs("categories", flagged.Categories).
+			Msg("Message to the assistant was flagged by moderation")
+		return a.post(ctx, message, response)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !handled {
+		return nil, nil
+	}
+
+	return a.post(ctx, message, response)
+}
+
+// post stores an assistant reply to a message
+func (a *Assistant) post(ctx context.Context, message *models.Message, content string) (*models.Message, error) {
+	// Replying to the trigger keeps the bot conversation in its own thread
+	replyTo := message.ID
+	reply := &models.Message{
+		ID:            uuid.New(),
+		ChatID:        message.ChatID,
+		Content:       content,
+		ReplyTo:       &replyTo,
+		IsAIGenerated: true,
+	}
+
+	if err := a.db.CreateMessage(ctx, reply); err != nil {
+		return nil, fmt.Errorf("failed to store AI reply: %w", err)
+	}
+
+	return reply, nil
+}
+
+// acquire takes one of a user's concurrent reply slots, reporting false if
+// they are all in use
+func (a *Assistant) acquire(userID uuid.UUID) bool {
+	a.inFlightMu.Lock()
+	defer a.inFlightMu.Unlock()
+
+	if a.inFlight[userID] >= a.config.MaxConcurrentPerUser {
+		return false
+	}
+	a.inFlight[userID]++
+	return true
+}
+
+// release frees a slot taken by acquire
+func (a *Assistant) release(userID uuid.UUID) {
+	a.inFlightMu.Lock()
+	defer a.inFlightMu.Unlock()
+
+	a.inFlight[userID]--
+	if a.inFlight[userID] <= 0 {
+		delete(a.inFlight, userID)
+	}
+}
+
+// buildContext returns the conversation history for a message. Replies use the
+// thread ancestry when thread context is enabled so parallel bot conversations
+// in the same chat don't bleed into each other.
+func (a *Assistant) buildContext(ctx context.Context, message *models.Message) ([]ai.Message, error) {
+	if a.config.ThreadContext && message.ReplyTo != nil {
+		thread, err := a.db.ListReplyChain(ctx, *message.ReplyTo, a.config.ContextMessages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load reply thread: %w", err)
+		}
+		return ai.HistoryFromMessages(thread), nil
+	}
+
+	recent, err := a.db.ListChatMessages(ctx, message.ChatID, a.config.ContextMessages+1, 0, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load recent messages: %w", err)
+	}
+
+	// Messages are listed newest first; reverse and drop the trigger itself
+	history := make([]*models.Message, 0, len(recent))
+	for i := len(recent) - 1; i >= 0; i-- {
+		if recent[i].ID != message.ID {
+			history = append(history, recent[i])
+		}
+	}
+	if len(history) > a.config.ContextMessages {
+		history = history[len(history)-a.config.ContextMessages:]
+	}
+
+	return ai.HistoryFromMessages(history), nil
+}
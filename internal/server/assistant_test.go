@@ -0,0 +1,196 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/llamasearch/llamachat/internal/ai"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func contents(history []ai.Message) []string {
+	out := make([]string, len(history))
+	for i, m := range history {
+		out[i] = m.Role + ": " + m.Content
+	}
+	return out
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestBuildContextUsesReplyThread(t *testing.T) {
+	tc := newTestChat(t)
+
+	question := tc.post(t, tc.alice, "@ai what is Go?", nil)
+	answer := tc.post(t, nil, "A programming language.", question)
+	tc.post(t, tc.bob, "@ai what's the weather?", nil)
+	tc.post(t, tc.bob, "lunch anyone?", nil)
+	followUp := tc.post(t, tc.alice, "@ai who made it?", answer)
+
+	threaded := NewAssistant(AssistantConfig{ThreadContext: true}, tc.db, nil, nil)
+	history, err := threaded.buildContext(context.Background(), followUp)
+	if err != nil {
+		t.Fatalf("buildContext: %v", err)
+	}
+	want := []string{"user: @ai what is Go?", "assistant: A programming language."}
+	if got := contents(history); !equalStrings(got, want) {
+		t.Errorf("thread context = %q, want %q", got, want)
+	}
+
+	// Without thread context the same message gets the recent chat history
+	flat := NewAssistant(AssistantConfig{}, tc.db, nil, nil)
+	history, err = flat.buildContext(context.Background(), followUp)
+	if err != nil {
+		t.Fatalf("buildContext: %v", err)
+	}
+	want = []string{
+		"user: @ai what is Go?",
+		"assistant: A programming language.",
+		"user: @ai what's the weather?",
+		"user: lunch anyone?",
+	}
+	if got := contents(history); !equalStrings(got, want) {
+		t.Errorf("flat context = %q, want %q", got, want)
+	}
+}
+
+func TestBuildContextThreadRespectsLimit(t *testing.T) {
+	tc := newTestChat(t)
+
+	var last *models.Message
+	for _, content := range []string{"@ai one", "two", "@ai three", "four"} {
+		author := tc.alice
+		if last != nil && last.UserID != nil {
+			author = nil
+		}
+		last = tc.post(t, author, content, last)
+	}
+	followUp := tc.post(t, tc.alice, "@ai five", last)
+
+	a := NewAssistant(AssistantConfig{ThreadContext: true, ContextMessages: 2}, tc.db, nil, nil)
+	history, err := a.buildContext(context.Background(), followUp)
+	if err != nil {
+		t.Fatalf("buildContext: %v", err)
+	}
+	want := []string{"user: @ai three", "assistant: four"}
+	if got := contents(history); !equalStrings(got, want) {
+		t.Errorf("context = %q, want the two nearest ancestors %q", got, want)
+	}
+}
+
+func TestBuildContextTopLevelMessageUsesRecentHistory(t *testing.T) {
+	tc := newTestChat(t)
+
+	tc.post(t, tc.bob, "earlier", nil)
+	trigger := tc.post(t, tc.alice, "@ai summarize", nil)
+
+	a := NewAssistant(AssistantConfig{ThreadContext: true}, tc.db, nil, nil)
+	history, err := a.buildContext(context.Background(), trigger)
+	if err != nil {
+		t.Fatalf("buildContext: %v", err)
+	}
+	want := []string{"user: earlier"}
+	if got := contents(history); !equalStrings(got, want) {
+		t.Errorf("context = %q, want %q", got, want)
+	}
+}
+
+func TestAssistantCapsConcurrentRepliesPerUser(t *testing.T) {
+	tc := newTestChat(t)
+	a := NewAssistant(AssistantConfig{MaxConcurrentPerUser: 2}, tc.db, nil, nil)
+
+	for i := 0; i < 2; i++ {
+		if !a.acquire(tc.alice.ID) {
+			t.Fatalf("acquire %d refused below the cap", i+1)
+		}
+	}
+	if a.acquire(tc.alice.ID) {
+		t.Fatal("acquire succeeded past the cap")
+	}
+
+	// The cap is per user
+	if !a.acquire(tc.bob.ID) {
+		t.Error("another user was refused while alice was at the cap")
+	}
+
+	// Finishing a reply frees a slot for the next one
+	a.release(tc.alice.ID)
+	if !a.acquire(tc.alice.ID) {
+		t.Error("acquire refused after a reply finished")
+	}
+
+	a.release(tc.alice.ID)
+	a.release(tc.alice.ID)
+	a.release(tc.bob.ID)
+	if len(a.inFlight) != 0 {
+		t.Errorf("inFlight = %v after every reply finished, want empty", a.inFlight)
+	}
+}
+
+func TestAssistantCapHoldsUnderConcurrency(t *testing.T) {
+	tc := newTestChat(t)
+	a := NewAssistant(AssistantConfig{MaxConcurrentPerUser: 3}, tc.db, nil, nil)
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acquired int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if a.acquire(tc.alice.ID) {
+				mu.Lock()
+				acquired++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 3 {
+		t.Errorf("%d concurrent acquires succeeded, want the cap of 3", acquired)
+	}
+}
+
+func TestAssistantPostsBusyNoticeAtCap(t *testing.T) {
+	tc := newTestChat(t)
+	// The provider is never configured: a user at the cap must not reach it
+	a := NewAssistant(AssistantConfig{MaxConcurrentPerUser: 1}, tc.db, ai.NewService(ai.Config{}), nil)
+
+	if !a.acquire(tc.alice.ID) {
+		t.Fatal("acquire refused below the cap")
+	}
+	trigger := tc.post(t, tc.alice, "@ai another question", nil)
+
+	reply, err := a.reply(context.Background(), trigger)
+	if err != nil {
+		t.Fatalf("reply: %v", err)
+	}
+	if reply == nil {
+		t.Fatal("reply = nil, want the busy notice")
+	}
+	if reply.Content != busyNotice || !reply.IsAIGenerated {
+		t.Errorf("reply = %q (AI %v), want the AI busy notice", reply.Content, reply.IsAIGenerated)
+	}
+	if reply.ReplyTo == nil || *reply.ReplyTo != trigger.ID {
+		t.Errorf("busy notice replies to %v, want the trigger %s", reply.ReplyTo, trigger.ID)
+	}
+
+	// The refused request must not have taken or freed a slot
+	if got := a.inFlight[tc.alice.ID]; got != 1 {
+		t.Errorf("inFlight = %d after the refused reply, want 1", got)
+	}
+}
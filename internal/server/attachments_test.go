@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/storage"
+)
+
+// failingDeletes is an attachment store whose Delete fails for one key
+type failingDeletes struct {
+	storage.AttachmentStore
+	key string
+}
+
+func (s failingDeletes) Delete(ctx context.Context, key string) error {
+	if key == s.key {
+		return errors.New("storage unavailable")
+	}
+	return s.AttachmentStore.Delete(ctx, key)
+}
+
+// attach stores a file and records it as an attachment of message
+func attach(t *testing.T, tc *testChat, files storage.AttachmentStore, message *models.Message, key string) {
+	t.Helper()
+	ctx := context.Background()
+
+	if err := files.Put(ctx, key, strings.NewReader("contents of "+key), "text/plain"); err != nil {
+		t.Fatalf("Put(%s): %v", key, err)
+	}
+	attachment := &models.Attachment{ID: uuid.New(), MessageID: &message.ID, FileName: key, FilePath: key, FileSize: 1, FileType: "text/plain"}
+	if err := tc.db.CreateAttachment(ctx, attachment); err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+}
+
+// stored reports whether files holds key
+func stored(files storage.AttachmentStore, key string) bool {
+	r, err := files.Get(context.Background(), key)
+	if err != nil {
+		return false
+	}
+	r.Close()
+	return true
+}
+
+func TestDeleteChatRemovesAttachmentFiles(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+	local := storage.NewLocalStore(t.TempDir())
+
+	other := &models.Chat{ID: uuid.New(), Name: "random", CreatedBy: tc.bob.ID}
+	if err := tc.db.CreateChat(ctx, other); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	first := tc.post(t, tc.alice, "two files", nil)
+	attach(t, tc, local, first, "general/a.txt")
+	attach(t, tc, local, first, "general/b.txt")
+	attach(t, tc, local, tc.post(t, tc.bob, "one more", nil), "general/c.txt")
+	kept := &models.Message{ID: uuid.New(), ChatID: other.ID, UserID: &tc.bob.ID, Content: "elsewhere"}
+	if err := tc.db.CreateMessage(ctx, kept); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	attach(t, tc, local, kept, "random/d.txt")
+
+	// One file can't be deleted; the rest still are
+	s := tc.chatService(t, 0, "")
+	s.files = failingDeletes{AttachmentStore: local, key: "general/b.txt"}
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	if err := s.DeleteChat(c, tc.chat.ID); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+
+	for key, want := range map[string]bool{
+		"general/a.txt": false,
+		"general/b.txt": true,
+		"general/c.txt": false,
+		"random/d.txt":  true,
+	} {
+		if got := stored(local, key); got != want {
+			t.Errorf("%s stored = %v, want %v", key, got, want)
+		}
+	}
+
+	if exists, _ := tc.db.ChatExists(ctx, tc.chat.ID); exists {
+		t.Error("chat still exists")
+	}
+	if attachments, err := tc.db.ListMessageAttachments(ctx, kept.ID); err != nil || len(attachments) != 1 {
+		t.Errorf("other chat's attachments = %v, %v; want it untouched", attachments, err)
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/storage"
+)
+
+func TestLastMemberLeavingEmptyChat(t *testing.T) {
+	tests := []struct {
+		name            string
+		deleteWhenEmpty bool
+		leave           bool
+	}{
+		{"leave, delete when empty", true, true},
+		{"remove, delete when empty", true, false},
+		{"leave, keep empty chats", false, true},
+		{"remove, keep empty chats", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := newTestChat(t)
+			ctx := context.Background()
+			local := storage.NewLocalStore(t.TempDir())
+
+			message := tc.post(t, tc.alice, "with a file", nil)
+			attach(t, tc, local, message, "general/a.txt")
+
+			s := tc.chatService(t, 0, "")
+			s.files = local
+			s.deleteWhenEmpty = tt.deleteWhenEmpty
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+			remove := func(userID uuid.UUID) {
+				t.Helper()
+				var err error
+				if tt.leave {
+					_, err = s.LeaveChat(c, tc.chat.ID, userID)
+				} else {
+					err = s.RemoveUserFromChat(c, tc.chat.ID, userID)
+				}
+				if err != nil {
+					t.Fatalf("removing %s: %v", userID, err)
+				}
+			}
+
+			// A chat with members left is never deleted
+			remove(tc.bob.ID)
+			if exists, _ := tc.db.ChatExists(ctx, tc.chat.ID); !exists {
+				t.Fatal("chat deleted while alice was still a member")
+			}
+
+			remove(tc.alice.ID)
+			exists, err := tc.db.ChatExists(ctx, tc.chat.ID)
+			if err != nil {
+				t.Fatalf("ChatExists: %v", err)
+			}
+			if exists == tt.deleteWhenEmpty {
+				t.Errorf("chat exists = %v after the last member left, want %v", exists, !tt.deleteWhenEmpty)
+			}
+			_, err = tc.db.GetMessageByID(ctx, message.ID)
+			if kept := err == nil; kept == tt.deleteWhenEmpty {
+				t.Errorf("message kept = %v, want %v", kept, !tt.deleteWhenEmpty)
+			}
+			if kept := stored(local, "general/a.txt"); kept == tt.deleteWhenEmpty {
+				t.Errorf("attachment file kept = %v, want %v", kept, !tt.deleteWhenEmpty)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
+)
+
+// defaultCORSMaxAge is how long browsers may cache preflight results when not configured
+const defaultCORSMaxAge = 12 * time.Hour
+
+// corsHandler applies CORS per route. Paths under a disabled prefix never get
+// CORS headers, and preflight responses only advertise the configured methods
+// that are actually registered for the requested route.
+type corsHandler struct {
+	config   CORS
+	engine   *gin.Engine
+	base     gin.HandlerFunc
+	once     sync.Once
+	routes   []gin.RouteInfo
+	handlers sync.Map // sorted method list -> gin.HandlerFunc
+}
+
+// newCORSHandler creates the CORS middleware for the server's router
+func newCORSHandler(config CORS, engine *gin.Engine) gin.HandlerFunc {
+	if config.MaxAge <= 0 {
+		config.MaxAge = defaultCORSMaxAge
+	}
+
+	h := &corsHandler{
+		config: config,
+		engine: engine,
+	}
+	h.base = cors.New(h.corsConfig(config.AllowedMethods))
+
+	return h.handle
+}
+
+// corsConfig builds a gin-contrib/cors config allowing the given methods
+func (h *corsHandler) corsConfig(methods []string) cors.Config {
+	return cors.Config{
+		AllowOrigins:     h.config.AllowedOrigins,
+		AllowMethods:     methods,
+		AllowHeaders:     h.config.AllowedHeaders,
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           h.config.MaxAge,
+	}
+}
+
+// handle is the middleware entry point
+func (h *corsHandler) handle(c *gin.Context) {
+	path := c.Request.URL.Path
+	for _, prefix := range h.config.DisabledPaths {
+		if strings.HasPrefix(path, prefix) {
+			c.Next()
+			return
+		}
+	}
+
+	if c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != "" {
+		if methods := h.preflightMethods(path); len(methods) > 0 {
+			h.handlerFor(methods)(c)
+			return
+		}
+	}
+
+	h.base(c)
+}
+
+// handlerFor returns a cached CORS handler allowing exactly the given methods
+func (h *corsHandler) handlerFor(methods []string) gin.HandlerFunc {
+	key := strings.Join(methods, ",")
+	if handler, ok := h.handlers.Load(key); ok {
+		return handler.(gin.HandlerFunc)
+	}
+
+	handler, _ := h.handlers.LoadOrStore(key, gin.HandlerFunc(cors.New(h.corsConfig(methods))))
+	return handler.(gin.HandlerFunc)
+}
+
+// preflightMethods returns the configured methods registered for a path
+func (h *corsHandler) preflightMethods(path string) []string {
+	// Routes are all registered before the server starts handling requests
+	h.once.Do(func() {
+		h.routes = h.engine.Routes()
+	})
+
+	allowed := make(map[string]bool, len(h.config.AllowedMethods))
+	for _, m := range h.config.AllowedMethods {
+		allowed[strings.ToUpper(m)] = true
+	}
+
+	var methods []string
+	seen := make(map[string]bool)
+	for _, route := range h.routes {
+		if seen[route.Method] || !matchRoute(route.Path, path) {
+			continue
+		}
+		if len(allowed) == 0 || allowed[route.Method] {
+			seen[route.Method] = true
+			methods = append(methods, route.Method)
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+
+	methods = append(methods, http.MethodOptions)
+	sort.Strings(methods)
+	return methods
+}
+
+// matchRoute reports whether a request path matches a gin route pattern
+func matchRoute(pattern, path string) bool {
+	patternParts := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range patternParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if pathParts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != pathParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(pathParts)
+}
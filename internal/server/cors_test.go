@@ -0,0 +1,140 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testOrigin = "https://app.example.com"
+
+// newCORSRouter registers a few public and admin routes behind the CORS
+// handler
+func newCORSRouter(config CORS) *gin.Engine {
+	router := gin.New()
+	router.Use(newCORSHandler(config, router))
+
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/chats", ok)
+	router.POST("/api/chats", ok)
+	router.DELETE("/api/chats/:id", ok)
+	router.PATCH("/api/chats/:id", ok)
+	router.GET("/api/admin/users", ok)
+	router.DELETE("/api/admin/users/:id", ok)
+	return router
+}
+
+func testCORSConfig() CORS {
+	return CORS{
+		AllowedOrigins: []string{testOrigin},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE"},
+		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		DisabledPaths:  []string{"/api/admin"},
+	}
+}
+
+func corsRequest(router *gin.Engine, method, path, requestMethod string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Origin", testOrigin)
+	if requestMethod != "" {
+		req.Header.Set("Access-Control-Request-Method", requestMethod)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSDisabledForAdminRoutes(t *testing.T) {
+	router := newCORSRouter(testCORSConfig())
+
+	public := corsRequest(router, http.MethodGet, "/api/chats", "")
+	if got := public.Header().Get("Access-Control-Allow-Origin"); got != testOrigin {
+		t.Errorf("public route Access-Control-Allow-Origin = %q, want %q", got, testOrigin)
+	}
+
+	admin := corsRequest(router, http.MethodGet, "/api/admin/users", "")
+	if admin.Code != http.StatusOK {
+		t.Errorf("admin route status = %d, want the handler to still run", admin.Code)
+	}
+	for _, header := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Credentials"} {
+		if got := admin.Header().Get(header); got != "" {
+			t.Errorf("admin route %s = %q, want none", header, got)
+		}
+	}
+
+	preflight := corsRequest(router, http.MethodOptions, "/api/admin/users/42", http.MethodDelete)
+	if got := preflight.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("admin preflight Access-Control-Allow-Origin = %q, want none", got)
+	}
+	if got := preflight.Header().Get("Access-Control-Allow-Methods"); got != "" {
+		t.Errorf("admin preflight Access-Control-Allow-Methods = %q, want none", got)
+	}
+}
+
+func TestCORSPreflightAdvertisesRouteMethods(t *testing.T) {
+	router := newCORSRouter(testCORSConfig())
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/api/chats", "GET,OPTIONS,POST"},
+		// PATCH is registered but not in AllowedMethods
+		{"/api/chats/42", "DELETE,OPTIONS"},
+		// Unknown routes fall back to the configured methods
+		{"/api/unknown", "GET,POST,PUT,DELETE"},
+	}
+
+	for _, tt := range tests {
+		w := corsRequest(router, http.MethodOptions, tt.path, http.MethodGet)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("OPTIONS %s: status = %d, want %d", tt.path, w.Code, http.StatusNoContent)
+		}
+		if got := w.Header().Get("Access-Control-Allow-Methods"); got != tt.want {
+			t.Errorf("OPTIONS %s: Access-Control-Allow-Methods = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestCORSMaxAge(t *testing.T) {
+	tests := []struct {
+		maxAge time.Duration
+		want   string
+	}{
+		{10 * time.Minute, "600"},
+		{0, "43200"},
+	}
+
+	for _, tt := range tests {
+		config := testCORSConfig()
+		config.MaxAge = tt.maxAge
+		w := corsRequest(newCORSRouter(config), http.MethodOptions, "/api/chats", http.MethodPost)
+		if got := w.Header().Get("Access-Control-Max-Age"); got != tt.want {
+			t.Errorf("MaxAge %v: Access-Control-Max-Age = %q, want %q", tt.maxAge, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/api/chats", "/api/chats", true},
+		{"/api/chats", "/api/chats/", true},
+		{"/api/chats/:id", "/api/chats/42", true},
+		{"/api/chats/:id", "/api/chats", false},
+		{"/api/chats/:id", "/api/chats/42/messages", false},
+		{"/api/files/*path", "/api/files/a/b/c", true},
+		{"/api/users", "/api/chats", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchRoute(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchRoute(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
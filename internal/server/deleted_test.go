@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// secret is content that must not survive deletion in any listing
+const secret = "the launch code is 0000"
+
+func TestDeletedChatMessagesInListings(t *testing.T) {
+	tc := newTestChat(t)
+	deleted := tc.post(t, tc.alice, secret, nil)
+	reply := tc.post(t, tc.bob, "replying to it", deleted)
+	tc.post(t, tc.alice, "still here", nil)
+	if err := tc.db.DeleteMessage(context.Background(), deleted.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	for _, mode := range []string{"", models.DeletedMessagesPlaceholder, models.DeletedMessagesHide} {
+		t.Run("mode "+mode, func(t *testing.T) {
+			s := tc.chatService(t, 0, "")
+			s.deletedMessages = mode
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+			messages, err := s.ListChatMessages(c, tc.chat.ID, 50, 0)
+			if err != nil {
+				t.Fatalf("ListChatMessages: %v", err)
+			}
+			data, _ := json.Marshal(messages)
+			if strings.Contains(string(data), secret) {
+				t.Fatalf("deleted content leaked: %s", data)
+			}
+
+			byID := make(map[uuid.UUID]*models.Message)
+			for _, m := range messages {
+				byID[m.ID] = m
+			}
+			placeholder, listed := byID[deleted.ID]
+			if mode == models.DeletedMessagesHide {
+				if listed || len(messages) != 2 {
+					t.Errorf("listed %d messages including the deleted one: %v; want it hidden", len(messages), listed)
+				}
+				return
+			}
+			if !listed || len(messages) != 3 {
+				t.Fatalf("listed %d messages, want all 3 with the deleted one in place", len(messages))
+			}
+			if placeholder.Content != models.DeletedMessageContent || !placeholder.IsDeleted {
+				t.Errorf("deleted message = %q (deleted %v), want the placeholder", placeholder.Content, placeholder.IsDeleted)
+			}
+			// The reply keeps its place in the thread
+			if r := byID[reply.ID]; r == nil || r.ReplyTo == nil || *r.ReplyTo != deleted.ID {
+				t.Errorf("reply lost its link to the deleted message: %+v", r)
+			}
+		})
+	}
+}
+
+func TestDeletedDirectMessagesInListings(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+	send := func(content string) *models.DirectMessage {
+		t.Helper()
+		m := &models.DirectMessage{ID: uuid.New(), SenderID: tc.alice.ID, RecipientID: tc.bob.ID, Content: content}
+		if err := tc.db.CreateDirectMessage(ctx, m); err != nil {
+			t.Fatalf("CreateDirectMessage: %v", err)
+		}
+		return m
+	}
+	deleted := send(secret)
+	send("still here")
+	if err := tc.db.DeleteDirectMessage(ctx, deleted.ID); err != nil {
+		t.Fatalf("DeleteDirectMessage: %v", err)
+	}
+
+	tests := []struct {
+		mode      string
+		wantCount int
+	}{
+		{models.DeletedMessagesPlaceholder, 2},
+		{models.DeletedMessagesHide, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s := &DMService{db: tc.db, deletedMessages: tt.mode}
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+			// Both sides of the conversation see the same
+			for _, viewer := range []*models.User{tc.alice, tc.bob} {
+				other := tc.bob
+				if viewer == tc.bob {
+					other = tc.alice
+				}
+				messages, err := s.ListDirectMessages(c, viewer.ID, other.ID, 50, 0)
+				if err != nil {
+					t.Fatalf("ListDirectMessages: %v", err)
+				}
+				if len(messages) != tt.wantCount {
+					t.Errorf("%s sees %d messages, want %d", viewer.Username, len(messages), tt.wantCount)
+				}
+				data, _ := json.Marshal(messages)
+				if strings.Contains(string(data), secret) {
+					t.Errorf("deleted content leaked to %s: %s", viewer.Username, data)
+				}
+			}
+		})
+	}
+}
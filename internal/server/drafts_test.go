@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestSendingMessageDeletesDraft(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+	s := tc.chatService(t, 0, "")
+
+	for _, user := range []*models.User{tc.alice, tc.bob} {
+		draft := &models.MessageDraft{UserID: user.ID, ChatID: tc.chat.ID, Content: user.Username + " is typing"}
+		if err := tc.db.SaveDraft(ctx, draft); err != nil {
+			t.Fatalf("SaveDraft: %v", err)
+		}
+	}
+
+	message := &models.Message{ID: uuid.New(), ChatID: tc.chat.ID, UserID: &tc.alice.ID, Content: "alice is typing"}
+	if err := s.postMessage(ctx, message); err != nil {
+		t.Fatalf("postMessage: %v", err)
+	}
+
+	if _, err := tc.db.GetDraft(ctx, tc.alice.ID, tc.chat.ID); err == nil {
+		t.Error("sender's draft is still there after sending")
+	}
+	if _, err := tc.db.GetDraft(ctx, tc.bob.ID, tc.chat.ID); err != nil {
+		t.Errorf("another member's draft was deleted: %v", err)
+	}
+}
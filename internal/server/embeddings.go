@@ -0,0 +1,146 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/ai"
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// Embedding indexer tuning
+const (
+	// embeddingQueueSize is how many messages can wait to be embedded
+	embeddingQueueSize = 1000
+	// embeddingFlushInterval is the longest a message waits for its batch
+	// to fill
+	embeddingFlushInterval = time.Second
+	// embeddingTimeout bounds the embedding and storing of one batch
+	embeddingTimeout = time.Minute
+)
+
+// pendingEmbedding is a message waiting to be embedded
+type pendingEmbedding struct {
+	messageID uuid.UUID
+	content   string
+}
+
+// EmbeddingIndexer embeds new and edited messages in the background so
+// semantic search can find them. Messages are gathered into batches so they
+// take as few embeddings requests as possible.
+type EmbeddingIndexer struct {
+	db    database.Store
+	aiSvc *ai.Service
+	queue chan pendingEmbedding
+	done  chan struct{}
+
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// NewEmbeddingIndexer creates an indexer and starts its worker
+func NewEmbeddingIndexer(db database.Store, aiSvc *ai.Service) *EmbeddingIndexer {
+	x := &EmbeddingIndexer{
+		db:    db,
+		aiSvc: aiSvc,
+		queue: make(chan pendingEmbedding, embeddingQueueSize),
+		done:  make(chan struct{}),
+	}
+	go x.run()
+	return x
+}
+
+// Index queues a message to be embedded. Encrypted and empty messages are
+// skipped, and when the queue is full the message is dropped, leaving it out
+// of semantic search.
+func (x *EmbeddingIndexer) Index(message *models.Message) {
+	if message.ContentEncrypted || message.IsDeleted || message.Content == "" {
+		return
+	}
+
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	if x.stopped {
+		return
+	}
+
+	select {
+	case x.queue <- pendingEmbedding{messageID: message.ID, content: message.Content}:
+	default:
+		log.Warn().Str("message_id", message.ID.String()).Msg("Embedding queue is full; message will not be searchable by meaning")
+	}
+}
+
+// Stop embeds the messages already queued and stops the worker
+func (x *EmbeddingIndexer) Stop() {
+	x.mu.Lock()
+	if !x.stopped {
+		x.stopped = true
+		close(x.queue)
+	}
+	x.mu.Unlock()
+	<-x.done
+}
+
+// run gathers queued messages into batches of up to the embeddings batch
+// size, flushing partial batches after embeddingFlushInterval
+func (x *EmbeddingIndexer) run() {
+	defer close(x.done)
+
+	ticker := time.NewTicker(embeddingFlushInterval)
+	defer ticker.Stop()
+
+	var batch []pendingEmbedding
+	for {
+		select {
+		case pending, ok := <-x.queue:
+			if !ok {
+				x.flush(batch)
+				return
+			}
+			batch = append(batch, pending)
+			if len(batch) >= x.aiSvc.EmbeddingsBatchSize() {
+				x.flush(batch)
+				batch = nil
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				x.flush(batch)
+				batch = nil
+			}
+		}
+	}
+}
+
+// flush embeds a batch of messages and stores the embeddings
+func (x *EmbeddingIndexer) flush(batch []pendingEmbedding) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), embeddingTimeout)
+	defer cancel()
+
+	texts := make([]string, len(batch))
+	for i, pending := range batch {
+		texts[i] = pending.content
+	}
+
+	embeddings, err := x.aiSvc.Embed(ctx, texts)
+	if err != nil {
+		log.Error().Err(err).Int("messages", len(batch)).Msg("Failed to embed messages")
+		return
+	}
+
+	model := x.aiSvc.EmbeddingsModel()
+	for i, pending := range batch {
+		if err := x.db.SaveMessageEmbedding(ctx, pending.messageID, model, embeddings[i]); err != nil {
+			log.Error().Err(err).Str("message_id", pending.messageID.String()).Msg("Failed to save message embedding")
+		}
+	}
+}
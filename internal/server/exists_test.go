@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/handlers"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// rowLoads fails any test that loads a full user, chat or member list where
+// an existence check would do
+type rowLoads struct {
+	database.Store
+	t *testing.T
+}
+
+func (s rowLoads) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	s.t.Errorf("GetUserByID(%s) called for an existence check", id)
+	return s.Store.GetUserByID(ctx, id)
+}
+
+func (s rowLoads) GetChatByID(ctx context.Context, id uuid.UUID) (*models.Chat, error) {
+	s.t.Errorf("GetChatByID(%s) called for an existence check", id)
+	return s.Store.GetChatByID(ctx, id)
+}
+
+func (s rowLoads) ListChatMembers(ctx context.Context, chatID uuid.UUID) ([]*models.ChatMember, error) {
+	s.t.Errorf("ListChatMembers(%s) called for an existence check", chatID)
+	return s.Store.ListChatMembers(ctx, chatID)
+}
+
+// Begin keeps the checks on for writes made in a transaction
+func (s rowLoads) Begin() (database.Transaction, error) {
+	tx, err := s.Store.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return rowLoadsTx{rowLoads: rowLoads{Store: tx, t: s.t}, tx: tx}, nil
+}
+
+// rowLoadsTx is a transaction with rowLoads' checks
+type rowLoadsTx struct {
+	rowLoads
+	tx database.Transaction
+}
+
+func (t rowLoadsTx) Commit() error   { return t.tx.Commit() }
+func (t rowLoadsTx) Rollback() error { return t.tx.Rollback() }
+
+func TestAddUserToChatChecksExistence(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+	s := tc.chatService(t, 0, "")
+	s.db = rowLoads{Store: tc.db, t: t}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	carol := &models.User{ID: uuid.New(), Username: "carol", Email: "carol@example.com", PasswordHash: "x", IsActive: true}
+	if err := tc.db.CreateUser(ctx, carol); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+
+	if err := s.AddUserToChat(c, uuid.New(), carol.ID, false); !errors.Is(err, handlers.ErrChatNotFound) {
+		t.Errorf("missing chat: %v, want ErrChatNotFound", err)
+	}
+	if err := s.AddUserToChat(c, tc.chat.ID, uuid.New(), false); !errors.Is(err, handlers.ErrUserNotFound) {
+		t.Errorf("missing user: %v, want ErrUserNotFound", err)
+	}
+
+	if err := s.AddUserToChat(c, tc.chat.ID, carol.ID, false); err != nil {
+		t.Fatalf("AddUserToChat: %v", err)
+	}
+	for _, tt := range []struct {
+		user *models.User
+		want bool
+	}{{carol, true}, {tc.bob, true}, {&models.User{ID: uuid.New()}, false}} {
+		member, err := s.IsChatMember(c, tc.chat.ID, tt.user.ID)
+		if err != nil {
+			t.Fatalf("IsChatMember: %v", err)
+		}
+		if member != tt.want {
+			t.Errorf("IsChatMember(%s) = %v, want %v", tt.user.Username, member, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/handlers"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+func TestGetMyMembership(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+
+	carol := &models.User{ID: uuid.New(), Username: "carol", Email: "carol@example.com", PasswordHash: "x", IsActive: true}
+	dave := &models.User{ID: uuid.New(), Username: "dave", Email: "dave@example.com", PasswordHash: "x", IsActive: true}
+	for _, user := range []*models.User{carol, dave} {
+		if err := tc.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	if err := tc.db.AddUserToChat(ctx, tc.chat.ID, carol.ID, true); err != nil {
+		t.Fatalf("AddUserToChat: %v", err)
+	}
+
+	h := handlers.NewChatHandler(tc.chatService(t, 0, ""), handlers.ChatConfig{})
+
+	tests := []struct {
+		name       string
+		user       *models.User
+		wantStatus int
+		wantAdmin  bool
+		wantOwner  bool
+	}{
+		{"owner", tc.alice, http.StatusOK, true, true},
+		{"admin", carol, http.StatusOK, true, false},
+		{"member", tc.bob, http.StatusOK, false, false},
+		{"non-member", dave, http.StatusNotFound, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/chats/:id/my-membership", func(c *gin.Context) {
+				c.Set("user_id", tt.user.ID)
+				h.GetMyMembership(c)
+			})
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/chats/"+tc.chat.ID.String()+"/my-membership", nil))
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Membership models.ChatMember `json:"membership"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			m := body.Membership
+			if m.UserID != tt.user.ID || m.ChatID != tc.chat.ID {
+				t.Errorf("membership is for user %s in chat %s, want the caller's in this chat", m.UserID, m.ChatID)
+			}
+			if m.IsAdmin != tt.wantAdmin || m.IsOwner != tt.wantOwner {
+				t.Errorf("is_admin, is_owner = %v, %v; want %v, %v", m.IsAdmin, m.IsOwner, tt.wantAdmin, tt.wantOwner)
+			}
+			if m.JoinedAt.IsZero() {
+				t.Error("joined_at is missing")
+			}
+		})
+	}
+}
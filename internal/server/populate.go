@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// populateMessageAuthors attaches author details to messages with a single
+// user lookup, attributing deactivated and deleted authors per the given mode
+func populateMessageAuthors(ctx context.Context, db database.Store, messages []*models.Message, attribution string) error {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		if message.UserID != nil {
+			ids = append(ids, *message.UserID)
+		}
+	}
+
+	users, err := db.GetUsersByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		message.User = attributeAuthor(users, message.UserID, message.IsAIGenerated, attribution)
+	}
+
+	return nil
+}
+
+// populateDirectMessageUsers attaches sender and recipient details to direct
+// messages with a single user lookup
+func populateDirectMessageUsers(ctx context.Context, db database.Store, messages []*models.DirectMessage, attribution string) error {
+	ids := make([]uuid.UUID, 0, len(messages)*2)
+	for _, message := range messages {
+		ids = append(ids, message.SenderID, message.RecipientID)
+	}
+
+	users, err := db.GetUsersByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		message.Sender = attributeAuthor(users, &message.SenderID, message.IsAIGenerated, attribution)
+		message.Recipient = attributeAuthor(users, &message.RecipientID, false, attribution)
+	}
+
+	return nil
+}
+
+// attributeAuthor resolves the user shown for a message. Authors whose
+// account is gone entirely are shown as deleted, since there is nothing left
+// to attribute; AI messages have no author.
+func attributeAuthor(users map[uuid.UUID]*models.User, userID *uuid.UUID, isAIGenerated bool, attribution string) *models.User {
+	if userID == nil {
+		if isAIGenerated {
+			return nil
+		}
+		return models.DeletedUser()
+	}
+
+	user, ok := users[*userID]
+	if !ok {
+		deleted := models.DeletedUser()
+		deleted.ID = *userID
+		return deleted
+	}
+
+	return user.Attributed(attribution)
+}
+
+// populateChatCreators attaches creator details to chats with a single user lookup
+func populateChatCreators(ctx context.Context, db database.Store, chats []*models.Chat) error {
+	ids := make([]uuid.UUID, 0, len(chats))
+	for _, chat := range chats {
+		ids = append(ids, chat.CreatedBy)
+	}
+
+	users, err := db.GetUsersByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, chat := range chats {
+		if user, ok := users[chat.CreatedBy]; ok {
+			chat.Creator = user.Public()
+		}
+	}
+
+	return nil
+}
+
+// populateChatUsers attaches creator and member details to a chat with a
+// single user lookup
+func populateChatUsers(ctx context.Context, db database.Store, chat *models.Chat) error {
+	ids := make([]uuid.UUID, 0, len(chat.Members)+1)
+	ids = append(ids, chat.CreatedBy)
+	for _, member := range chat.Members {
+		ids = append(ids, member.UserID)
+	}
+
+	users, err := db.GetUsersByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	if user, ok := users[chat.CreatedBy]; ok {
+		chat.Creator = user.Public()
+	}
+	for _, member := range chat.Members {
+		if user, ok := users[member.UserID]; ok {
+			member.User = user.Public()
+		}
+	}
+
+	return nil
+}
+
+// populateMemberUsers attaches user details to chat members with a single
+// user lookup
+func populateMemberUsers(ctx context.Context, db database.Store, members []*models.ChatMember) error {
+	ids := make([]uuid.UUID, len(members))
+	for i, member := range members {
+		ids[i] = member.UserID
+	}
+
+	users, err := db.GetUsersByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		if user, ok := users[member.UserID]; ok {
+			member.User = user.Public()
+		}
+	}
+
+	return nil
+}
+
+// populateMessageReactions attaches per-emoji reaction counts to messages with
+// a single lookup
+func populateMessageReactions(ctx context.Context, db database.Store, messages []*models.Message) error {
+	ids := make([]uuid.UUID, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+	}
+
+	counts, err := db.CountReactions(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		message.Reactions = counts[message.ID]
+	}
+
+	return nil
+}
+
+// populateReplyTargets attaches the messages that messages reply to, with their
+// authors and attachment previews, so clients can show quotes without fetching
+// each one. Deleted targets are kept as placeholders with no content or
+// attachments.
+func populateReplyTargets(ctx context.Context, db database.Store, messages []*models.Message, attribution string) error {
+	ids := make([]uuid.UUID, 0, len(messages))
+	for _, message := range messages {
+		if message.ReplyTo != nil {
+			ids = append(ids, *message.ReplyTo)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	targets, err := db.GetMessagesByIDs(ctx, uniqueIDs(ids))
+	if err != nil {
+		return err
+	}
+
+	live := make([]uuid.UUID, 0, len(targets))
+	quoted := make([]*models.Message, 0, len(targets))
+	for id, target := range targets {
+		if target.IsDeleted {
+			target.Redact()
+		} else {
+			live = append(live, id)
+		}
+		quoted = append(quoted, target)
+	}
+
+	attachments, err := db.ListAttachmentsByMessageIDs(ctx, live)
+	if err != nil {
+		return err
+	}
+	for id, list := range attachments {
+		for _, attachment := range list {
+			targets[id].AttachmentPreviews = append(targets[id].AttachmentPreviews, attachment.Preview())
+		}
+	}
+
+	if err := populateMessageAuthors(ctx, db, quoted, attribution); err != nil {
+		return err
+	}
+
+	for _, message := range messages {
+		if message.ReplyTo != nil {
+			message.ReplyToMessage = targets[*message.ReplyTo]
+		}
+	}
+
+	return nil
+}
+
+// uniqueIDs removes duplicate IDs, preserving order
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := make(map[uuid.UUID]bool, len(ids))
+	unique := ids[:0]
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// userLookups counts user queries, failing any test that loads users one at
+// a time
+type userLookups struct {
+	database.Store
+	t     *testing.T
+	batch int
+}
+
+func (s *userLookups) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	s.batch++
+	return s.Store.GetUsersByIDs(ctx, ids)
+}
+
+func (s *userLookups) GetUserByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
+	s.t.Errorf("GetUserByID(%s) called during population", id)
+	return s.Store.GetUserByID(ctx, id)
+}
+
+func TestPopulateMessageAuthorsInOneQuery(t *testing.T) {
+	tc := newTestChat(t)
+	db := &userLookups{Store: tc.db, t: t}
+	gone := uuid.New()
+
+	messages := []*models.Message{
+		tc.post(t, tc.alice, "one", nil),
+		tc.post(t, tc.bob, "two", nil),
+		tc.post(t, tc.alice, "three", nil),
+		tc.post(t, nil, "from the assistant", nil),
+		{ID: uuid.New(), UserID: &gone, Content: "from a removed account"},
+	}
+
+	if err := populateMessageAuthors(context.Background(), db, messages, models.AttributionDeleted); err != nil {
+		t.Fatalf("populateMessageAuthors: %v", err)
+	}
+	if db.batch != 1 {
+		t.Errorf("made %d user queries, want 1", db.batch)
+	}
+
+	for i, want := range []string{"alice", "bob", "alice"} {
+		if messages[i].User == nil || messages[i].User.Username != want {
+			t.Errorf("message %d author = %+v, want %s", i, messages[i].User, want)
+		}
+	}
+	if messages[3].User != nil {
+		t.Errorf("assistant message author = %+v, want none", messages[3].User)
+	}
+	if author := messages[4].User; author == nil || author.ID != gone || author.Username != models.DeletedUser().Username {
+		t.Errorf("removed author = %+v, want a deleted-user placeholder with their ID", author)
+	}
+}
+
+func TestPopulateMemberUsersInOneQuery(t *testing.T) {
+	tc := newTestChat(t)
+	db := &userLookups{Store: tc.db, t: t}
+
+	members, err := tc.db.ListChatMembers(context.Background(), tc.chat.ID)
+	if err != nil {
+		t.Fatalf("ListChatMembers: %v", err)
+	}
+	if err := populateMemberUsers(context.Background(), db, members); err != nil {
+		t.Fatalf("populateMemberUsers: %v", err)
+	}
+	if db.batch != 1 {
+		t.Errorf("made %d user queries, want 1", db.batch)
+	}
+	for _, member := range members {
+		if member.User == nil || member.User.ID != member.UserID {
+			t.Errorf("member %s has user %+v", member.UserID, member.User)
+		}
+	}
+}
+
+func TestUniqueIDs(t *testing.T) {
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+
+	got := uniqueIDs([]uuid.UUID{a, b, a, c, b})
+	want := []uuid.UUID{a, b, c}
+	if len(got) != len(want) {
+		t.Fatalf("uniqueIDs = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("uniqueIDs = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestPopulateDirectMessageUsersAttribution(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+
+	tc.bob.IsActive = false
+	if err := tc.db.UpdateUser(ctx, tc.bob); err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{models.AttributionDeleted, models.DeletedUserName},
+		{models.AttributionUsername, "bob"},
+		{models.AttributionAnonymous, "User-" + tc.bob.ID.String()[:8]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			dm := &models.DirectMessage{ID: uuid.New(), SenderID: tc.bob.ID, RecipientID: tc.alice.ID, Content: "hi"}
+			if err := populateDirectMessageUsers(ctx, tc.db, []*models.DirectMessage{dm}, tt.mode); err != nil {
+				t.Fatalf("populateDirectMessageUsers: %v", err)
+			}
+
+			if dm.Sender.Username != tt.want || dm.Sender.ID != tc.bob.ID {
+				t.Errorf("sender = %q (%s), want %q", dm.Sender.Username, dm.Sender.ID, tt.want)
+			}
+			if dm.Sender.Email != "" {
+				t.Errorf("sender email %q leaked", dm.Sender.Email)
+			}
+			if dm.Recipient.Username != "alice" {
+				t.Errorf("active recipient shown as %q, want alice", dm.Recipient.Username)
+			}
+		})
+	}
+}
+
+// attachmentLookups counts attachment queries, failing any test that loads
+// a message's attachments on its own
+type attachmentLookups struct {
+	database.Store
+	t     *testing.T
+	batch int
+}
+
+func (s *attachmentLookups) ListAttachmentsByMessageIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]*models.Attachment, error) {
+	s.batch++
+	return s.Store.ListAttachmentsByMessageIDs(ctx, ids)
+}
+
+func (s *attachmentLookups) ListMessageAttachments(ctx context.Context, id uuid.UUID) ([]*models.Attachment, error) {
+	s.t.Errorf("ListMessageAttachments(%s) called during population", id)
+	return s.Store.ListMessageAttachments(ctx, id)
+}
+
+// addAttachment stores attachment metadata on a message; no file is needed
+// to build a preview
+func addAttachment(t *testing.T, tc *testChat, message *models.Message, name, fileType string, encrypted bool) *models.Attachment {
+	t.Helper()
+
+	attachment := &models.Attachment{ID: uuid.New(), MessageID: &message.ID, FileName: name, FilePath: name, FileSize: 1, FileType: fileType, IsEncrypted: encrypted}
+	if err := tc.db.CreateAttachment(context.Background(), attachment); err != nil {
+		t.Fatalf("CreateAttachment: %v", err)
+	}
+	return attachment
+}
+
+func TestPopulateReplyTargetsWithAttachmentPreviews(t *testing.T) {
+	tc := newTestChat(t)
+	db := &attachmentLookups{Store: tc.db, t: t}
+
+	photoMessage := tc.post(t, tc.alice, "look", nil)
+	photo := addAttachment(t, tc, photoMessage, "photo.jpg", "image/jpeg", false)
+	notes := addAttachment(t, tc, photoMessage, "notes.txt", "text/plain", false)
+	sealed := tc.post(t, tc.bob, "", nil)
+	secret := addAttachment(t, tc, sealed, "secret.png", "image/png", true)
+
+	messages := []*models.Message{
+		tc.post(t, tc.bob, "nice", photoMessage),
+		tc.post(t, tc.alice, "agreed", photoMessage),
+		tc.post(t, tc.alice, "what is it?", sealed),
+		tc.post(t, tc.bob, "not a reply", nil),
+	}
+
+	if err := populateReplyTargets(context.Background(), db, messages, models.AttributionDeleted); err != nil {
+		t.Fatalf("populateReplyTargets: %v", err)
+	}
+	if db.batch != 1 {
+		t.Errorf("made %d attachment queries, want 1", db.batch)
+	}
+
+	quoted := messages[0].ReplyToMessage
+	if quoted == nil || quoted.ID != photoMessage.ID {
+		t.Fatalf("quoted = %+v, want the photo message", quoted)
+	}
+	if quoted.User == nil || quoted.User.Username != "alice" {
+		t.Errorf("quoted author = %+v, want alice", quoted.User)
+	}
+	previews := map[uuid.UUID]*models.AttachmentPreview{}
+	for _, preview := range quoted.AttachmentPreviews {
+		previews[preview.ID] = preview
+	}
+	if len(previews) != 2 {
+		t.Fatalf("quoted previews = %+v, want photo.jpg and notes.txt", quoted.AttachmentPreviews)
+	}
+	if p := previews[photo.ID]; p == nil || p.FileName != "photo.jpg" || p.FileType != "image/jpeg" || p.ThumbnailURL != "/api/attachments/"+photo.ID.String()+"/thumbnail" {
+		t.Errorf("photo preview = %+v, want name, type and thumbnail URL", p)
+	}
+	if p := previews[notes.ID]; p == nil || p.FileName != "notes.txt" || p.ThumbnailURL != "" {
+		t.Errorf("notes preview = %+v, want a name and no thumbnail", p)
+	}
+
+	// Two replies to the same message share the loaded target
+	if messages[1].ReplyToMessage != quoted {
+		t.Error("second reply to the photo message got a different target")
+	}
+
+	// Encrypted images have no server-side thumbnail
+	if got := messages[2].ReplyToMessage.AttachmentPreviews; len(got) != 1 || got[0].ID != secret.ID || got[0].ThumbnailURL != "" {
+		t.Errorf("encrypted previews = %+v, want secret.png without a thumbnail", got)
+	}
+
+	if messages[3].ReplyToMessage != nil {
+		t.Errorf("non-reply got target %+v", messages[3].ReplyToMessage)
+	}
+}
+
+func TestPopulateReplyTargetsHidesDeletedTarget(t *testing.T) {
+	tc := newTestChat(t)
+	ctx := context.Background()
+
+	original := tc.post(t, tc.alice, "here is the photo", nil)
+	addAttachment(t, tc, original, "photo.jpg", "image/jpeg", false)
+	reply := tc.post(t, tc.bob, "thanks", original)
+	if err := tc.db.DeleteMessage(ctx, original.ID); err != nil {
+		t.Fatalf("DeleteMessage: %v", err)
+	}
+
+	if err := populateReplyTargets(ctx, tc.db, []*models.Message{reply}, models.AttributionDeleted); err != nil {
+		t.Fatalf("populateReplyTargets: %v", err)
+	}
+
+	quoted := reply.ReplyToMessage
+	if quoted == nil || quoted.ID != original.ID || !quoted.IsDeleted {
+		t.Fatalf("quoted = %+v, want a deleted placeholder for the original", quoted)
+	}
+	if quoted.Content != models.DeletedMessageContent {
+		t.Errorf("deleted target content = %q, want %q", quoted.Content, models.DeletedMessageContent)
+	}
+	if len(quoted.AttachmentPreviews) != 0 {
+		t.Errorf("deleted target previews = %+v, want none", quoted.AttachmentPreviews)
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/handlers"
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/websocket"
+)
+
+// replyChain posts a top-level message and replies to it until the chain is
+// maxDepth deep, returning the messages from the root down
+func (tc *testChat) replyChain(t *testing.T, maxDepth int) []*models.Message {
+	t.Helper()
+
+	chain := []*models.Message{tc.post(t, tc.alice, "root", nil)}
+	for len(chain) <= maxDepth {
+		chain = append(chain, tc.post(t, tc.bob, "reply", chain[len(chain)-1]))
+	}
+	return chain
+}
+
+func (tc *testChat) countMessages(t *testing.T) int {
+	t.Helper()
+
+	messages, err := tc.db.ListChatMessages(context.Background(), tc.chat.ID, 100, 0, true)
+	if err != nil {
+		t.Fatalf("ListChatMessages: %v", err)
+	}
+	return len(messages)
+}
+
+func (tc *testChat) reply(author *models.User, to *models.Message) *models.Message {
+	return &models.Message{ID: uuid.New(), ChatID: tc.chat.ID, UserID: &author.ID, Content: "deep", ReplyTo: &to.ID}
+}
+
+func TestReplyBeyondMaxDepthIsRejected(t *testing.T) {
+	tc := newTestChat(t)
+	s := tc.chatService(t, 2, handlers.ReplyDepthReject)
+	chain := tc.replyChain(t, 2)
+	if chain[2].Depth != 2 {
+		t.Fatalf("depth of the third message = %d, want 2", chain[2].Depth)
+	}
+	before := tc.countMessages(t)
+
+	// A reply to the middle of the chain still fits
+	if err := s.postMessage(context.Background(), tc.reply(tc.alice, chain[1])); err != nil {
+		t.Fatalf("reply at the max depth: %v", err)
+	}
+
+	err := s.postMessage(context.Background(), tc.reply(tc.alice, chain[2]))
+	var depthErr *handlers.ReplyDepthError
+	if !errors.As(err, &depthErr) || depthErr.MaxDepth != 2 {
+		t.Fatalf("err = %v, want a ReplyDepthError for depth 2", err)
+	}
+	if got := tc.countMessages(t); got != before+1 {
+		t.Errorf("chat has %d messages, want %d: the rejected reply was stored", got, before+1)
+	}
+}
+
+func TestReplyBeyondMaxDepthIsFlattened(t *testing.T) {
+	tc := newTestChat(t)
+	s := tc.chatService(t, 2, handlers.ReplyDepthFlatten)
+	chain := tc.replyChain(t, 2)
+
+	message := tc.reply(tc.alice, chain[2])
+	if err := s.postMessage(context.Background(), message); err != nil {
+		t.Fatalf("postMessage: %v", err)
+	}
+	if message.ReplyTo == nil || *message.ReplyTo != chain[1].ID {
+		t.Errorf("reply re-targeted at %v, want the deepest allowed ancestor %s", message.ReplyTo, chain[1].ID)
+	}
+
+	stored, err := tc.db.GetMessageByID(context.Background(), message.ID)
+	if err != nil {
+		t.Fatalf("GetMessageByID: %v", err)
+	}
+	if stored.Depth != 2 || stored.ReplyTo == nil || *stored.ReplyTo != chain[1].ID {
+		t.Errorf("stored reply has depth %d under %v, want depth 2 under %s", stored.Depth, stored.ReplyTo, chain[1].ID)
+	}
+}
+
+func TestReplyDepthUnlimited(t *testing.T) {
+	tc := newTestChat(t)
+	s := tc.chatService(t, 0, handlers.ReplyDepthReject)
+	chain := tc.replyChain(t, 5)
+
+	message := tc.reply(tc.alice, chain[5])
+	if err := s.postMessage(context.Background(), message); err != nil {
+		t.Fatalf("postMessage: %v", err)
+	}
+	if message.Depth != 6 {
+		t.Errorf("depth = %d, want 6", message.Depth)
+	}
+}
+
+func TestReplyToAnotherChatIsRejected(t *testing.T) {
+	tc := newTestChat(t)
+	s := tc.chatService(t, 0, handlers.ReplyDepthReject)
+
+	// alice belongs to both chats, but a reply can't cross between them
+	other := &models.Chat{ID: uuid.New(), Name: "random", CreatedBy: tc.alice.ID}
+	if err := tc.db.CreateChat(context.Background(), other); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	elsewhere := &models.Message{ID: uuid.New(), ChatID: other.ID, UserID: &tc.alice.ID, Content: "elsewhere"}
+	if err := tc.db.CreateMessage(context.Background(), elsewhere); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+
+	missing := &models.Message{ID: uuid.New()}
+	for _, target := range []*models.Message{elsewhere, missing} {
+		if err := s.postMessage(context.Background(), tc.reply(tc.alice, target)); !errors.Is(err, handlers.ErrReplyTargetNotFound) {
+			t.Errorf("err = %v, want ErrReplyTargetNotFound", err)
+		}
+	}
+}
+
+func TestSendMessageRejectsLikeREST(t *testing.T) {
+	tc := newTestChat(t)
+	s := tc.chatService(t, 1, handlers.ReplyDepthReject)
+	chain := tc.replyChain(t, 1)
+	outsider := &models.User{ID: uuid.New()}
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		status  int
+	}{
+		{"too deep", tc.reply(tc.alice, chain[1]), http.StatusBadRequest},
+		{"not a member", tc.reply(outsider, chain[0]), http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Over the WebSocket the sender is told why
+			err := s.SendMessage(context.Background(), tt.message)
+			var rejected *websocket.RejectedError
+			if !errors.As(err, &rejected) || rejected.Reason == "" {
+				t.Fatalf("SendMessage err = %v, want a RejectedError", err)
+			}
+
+			// Over REST the same message gets a client error
+			w := postREST(t, s, tt.message)
+			if w.Code != tt.status {
+				t.Errorf("REST status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+// postREST sends a message through the chat handler's create endpoint
+func postREST(t *testing.T, s *ChatService, message *models.Message) *httptest.ResponseRecorder {
+	t.Helper()
+
+	h := handlers.NewChatHandler(s, handlers.ChatConfig{})
+	router := gin.New()
+	router.POST("/chats/:id/messages", func(c *gin.Context) {
+		c.Set("user_id", *message.UserID)
+		h.CreateChatMessage(c)
+	})
+
+	body, _ := json.Marshal(handlers.CreateMessageRequest{Content: message.Content, ReplyTo: message.ReplyTo})
+	req := httptest.NewRequest(http.MethodPost, "/chats/"+message.ChatID.String()+"/messages", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
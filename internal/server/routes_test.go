@@ -0,0 +1,101 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/llamasearch/llamachat/internal/ai"
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/storage"
+)
+
+// newTestServer builds a complete Server over a SQLite store, serving the
+// SPA from webDir
+func newTestServer(t *testing.T, webDir string) *Server {
+	t.Helper()
+
+	db, err := database.NewSQLiteStore(database.Config{Driver: database.DriverSQLite, Name: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	authSvc, err := auth.NewService(auth.Config{JWT: auth.JWTConfig{Secret: "test-secret", ExpirationHours: 1}}, db, nil)
+	if err != nil {
+		t.Fatalf("auth.NewService: %v", err)
+	}
+
+	s := NewServer(Config{WebDir: webDir, CORS: testCORSConfig()}, db, storage.NewLocalStore(t.TempDir()), authSvc, ai.NewService(ai.Config{}), nil)
+	t.Cleanup(func() {
+		s.fanout.Stop(context.Background())
+		// NewServer switches gin to release mode
+		gin.SetMode(gin.TestMode)
+	})
+	return s
+}
+
+func TestUnmatchedRoutes(t *testing.T) {
+	const page = "<!doctype html><title>LlamaChat</title>"
+	webDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(webDir, "index.html"), []byte(page), 0o644); err != nil {
+		t.Fatalf("writing index.html: %v", err)
+	}
+	s := newTestServer(t, webDir)
+
+	tests := []struct {
+		path     string
+		wantJSON bool
+	}{
+		{"/api/bogus", true},
+		{"/api/chats/not/a/route", true},
+		{"/api", true},
+		{"/some/spa/route", false},
+		{"/apiary", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if !tt.wantJSON {
+				if w.Code != http.StatusOK || w.Body.String() != page {
+					t.Errorf("status = %d, body %q; want the SPA page", w.Code, w.Body)
+				}
+				return
+			}
+
+			if w.Code != http.StatusNotFound {
+				t.Errorf("status = %d, want 404", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+				t.Errorf("Content-Type = %q, want JSON", ct)
+			}
+			var body struct {
+				Error string `json:"error"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body.Error == "" {
+				t.Errorf("body %q is not a JSON error: %v", w.Body, err)
+			}
+		})
+	}
+}
+
+func TestUnmatchedRoutesWithoutSPA(t *testing.T) {
+	s := newTestServer(t, "")
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/some/spa/route", nil))
+	if w.Code != http.StatusNotFound || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		t.Errorf("status = %d, Content-Type = %q; want a JSON 404 when no SPA is served", w.Code, w.Header().Get("Content-Type"))
+	}
+}
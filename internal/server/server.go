@@ -2,42 +2,84 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
 
 	"github.com/llamasearch/llamachat/internal/ai"
 	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/avatar"
 	"github.com/llamasearch/llamachat/internal/database"
 	"github.com/llamasearch/llamachat/internal/handlers"
+	"github.com/llamasearch/llamachat/internal/metrics"
 	"github.com/llamasearch/llamachat/internal/middleware"
 	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/storage"
 	"github.com/llamasearch/llamachat/internal/websocket"
 )
 
+// websocketPath is where clients open their WebSocket connection
+const websocketPath = "/ws"
+
+// defaultMetricsPath is where metrics are served unless configured otherwise
+const defaultMetricsPath = "/metrics"
+
+// MetricsConfig configures the Prometheus metrics endpoint
+type MetricsConfig struct {
+	Enabled bool
+	// Path is where metrics are served. Defaults to /metrics.
+	Path string
+	// ListenAddr, if set, serves metrics on a separate admin listener (e.g.
+	// ":9090") instead of the main port, so they needn't be exposed publicly
+	ListenAddr string
+}
+
 // CORS configuration
 type CORS struct {
 	AllowedOrigins []string
 	AllowedMethods []string
 	AllowedHeaders []string
+	// MaxAge is how long browsers may cache preflight results
+	MaxAge time.Duration
+	// DisabledPaths lists path prefixes that never receive CORS headers
+	DisabledPaths []string
 }
 
 // Config holds the server configuration
 type Config struct {
-	Host      string
-	Port      int
-	Debug     bool
-	CORS      CORS
-	RateLimit middleware.RateLimiterConfig
-	WebDir    string
+	Host        string
+	Port        int
+	Debug       bool
+	CORS        CORS
+	RateLimit   middleware.RateLimiterConfig
+	Concurrency middleware.ConcurrencyLimiterConfig
+	Security    middleware.SecurityHeadersConfig
+	WebDir      string
+	Assistant   AssistantConfig
+	Avatar      avatar.Config
+	Profile     handlers.ProfileLimits
+	Chat        handlers.ChatConfig
+	Attachments handlers.AttachmentConfig
+	WebSocket   websocket.HubConfig
+	Build       handlers.BuildInfo
+	Metrics     MetricsConfig
+	TLS         TLSConfig
+	Compression middleware.CompressionConfig
+	// SemanticSearch embeds messages as they are written and serves
+	// semantic search. It needs the pgvector schema on PostgreSQL.
+	SemanticSearch bool
 }
 
 // Server represents the HTTP server
@@ -48,11 +90,18 @@ type Server struct {
 	authSvc *auth.Service
 	aiSvc   *ai.Service
 	wsHub   *websocket.Hub
+	fanout  *websocket.Fanout
+	files   storage.AttachmentStore
+	limiter *middleware.RateLimiter
 	authMw  gin.HandlerFunc
+	redis   *redis.Client
+	// indexer embeds messages for semantic search, if it is enabled
+	indexer *EmbeddingIndexer
 }
 
-// NewServer creates a new server instance
-func NewServer(config Config, db database.Store, authSvc *auth.Service, aiSvc *ai.Service) *Server {
+// NewServer creates a new server instance. rdb is optional; with it, WebSocket
+// broadcasts reach clients connected to other instances.
+func NewServer(config Config, db database.Store, files storage.AttachmentStore, authSvc *auth.Service, aiSvc *ai.Service, rdb *redis.Client) *Server {
 	// Set up gin mode based on config
 	if config.Debug {
 		gin.SetMode(gin.DebugMode)
@@ -60,11 +109,10 @@ func NewServer(config Config, db database.Store, authSvc *auth.Service, aiSvc *a
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	// Create gin router
+	// Create gin router. Requests' contexts back the gin.Context, so handlers
+	// can pass it on and still carry the request's logger.
 	router := gin.New()
-
-	// Create websocket hub
-	wsHub := websocket.NewHub()
+	router.ContextWithFallback = true
 
 	// Create server
 	s := &Server{
@@ -73,12 +121,27 @@ func NewServer(config Config, db database.Store, authSvc *auth.Service, aiSvc *a
 		db:      db,
 		authSvc: authSvc,
 		aiSvc:   aiSvc,
-		wsHub:   wsHub,
+		files:   files,
+		redis:   rdb,
 	}
 
+	// Create websocket hub
+	wsHub := websocket.NewHub(config.WebSocket, s.userChatIDs)
+	if rdb != nil {
+		wsHub.UseBackplane(rdb)
+	}
+	s.wsHub = wsHub
+
+	// Deliver room events off the request path
+	s.fanout = wsHub.Fanout()
+
 	// Create auth middleware
 	s.authMw = middleware.AuthMiddleware(authSvc)
 
+	if config.SemanticSearch {
+		s.indexer = NewEmbeddingIndexer(db, aiSvc)
+	}
+
 	// Set up middleware
 	s.setupMiddleware()
 
@@ -93,18 +156,35 @@ func (s *Server) setupMiddleware() {
 	// Recovery middleware
 	s.router.Use(gin.Recovery())
 
-	// Logger middleware
+	// Tag requests with an ID for correlating their logs
+	s.router.Use(middleware.RequestID())
+
+	// Logger middleware, which also records request metrics. Metrics are
+	// labeled by route template, since raw paths carry IDs.
 	s.router.Use(func(c *gin.Context) {
 		start := time.Now()
 		path := c.Request.URL.Path
+		method := c.Request.Method
+		route := c.FullPath()
+		if route == "" {
+			route = metrics.UnmatchedRoute
+		}
+
+		inFlight := metrics.HTTPRequestsInFlight.WithLabelValues(method, route)
+		inFlight.Inc()
+		defer inFlight.Dec()
 
 		c.Next()
 
 		end := time.Now()
 		latency := end.Sub(start)
 
-		log.Info().
-			Str("method", c.Request.Method).
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequestsTotal.WithLabelValues(method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route, status).Observe(latency.Seconds())
+
+		log.Ctx(c).Info().
+			Str("method", method).
 			Str("path", path).
 			Int("status", c.Writer.Status()).
 			Dur("latency", latency).
@@ -112,33 +192,81 @@ func (s *Server) setupMiddleware() {
 			Msg("Request")
 	})
 
+	// Security headers
+	s.router.Use(middleware.SecurityHeaders(s.config.Security))
+
 	// CORS middleware
-	s.router.Use(cors.New(cors.Config{
-		AllowOrigins:     s.config.CORS.AllowedOrigins,
-		AllowMethods:     s.config.CORS.AllowedMethods,
-		AllowHeaders:     s.config.CORS.AllowedHeaders,
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	s.router.Use(newCORSHandler(s.config.CORS, s.router))
+
+	// Compress responses for clients that accept it
+	s.router.Use(middleware.Compression(s.config.Compression))
+
+	// Cap requests in flight. WebSocket connections are long-lived and would
+	// pin their slot for the life of the connection.
+	concurrency := middleware.NewConcurrencyLimiter(s.config.Concurrency)
+	concurrency.Exempt(websocketPath, handlers.LivenessPath, handlers.ReadinessPath)
+	// Scrapes shouldn't be turned away when the server is busiest
+	if s.servesMetrics() {
+		concurrency.Exempt(s.metricsPath())
+	}
+	s.router.Use(concurrency.Middleware())
 
 	// Apply rate limiting middleware
-	s.router.Use(middleware.RateLimiterMiddleware(s.config.RateLimit))
+	s.limiter = middleware.NewRateLimiter(s.config.RateLimit)
+	s.limiter.Exempt(handlers.RateLimitStatusPath, handlers.LivenessPath, handlers.ReadinessPath)
+	if s.servesMetrics() {
+		s.limiter.Exempt(s.metricsPath())
+	}
+	s.router.Use(s.limiter.Middleware())
 }
 
 // ChatService is a wrapper to adapt the database layer to the chat handlers interface
 type ChatService struct {
-	db database.Store
+	db          database.Store
+	assistant   *Assistant
+	fanout      *websocket.Fanout
+	hub         *websocket.Hub
+	files       storage.AttachmentStore
+	attribution string
+	// deleteWhenEmpty deletes chats whose last member is removed
+	deleteWhenEmpty bool
+	// deletedMessages is how listings show deleted messages, one of the
+	// models.DeletedMessages* modes
+	deletedMessages string
+	// maxReplyDepth and replyDepthMode limit reply nesting, as in
+	// handlers.ChatConfig
+	maxReplyDepth  int
+	replyDepthMode string
+	// indexer embeds messages for semantic search, if it is enabled
+	indexer *EmbeddingIndexer
+	aiSvc   *ai.Service
 }
 
 // GetChatByID retrieves a chat by ID
 func (s *ChatService) GetChatByID(ctx *gin.Context, id uuid.UUID) (*models.Chat, error) {
-	return s.db.GetChatByID(ctx, id)
+	chat, err := s.db.GetChatByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateChatUsers(ctx, s.db, chat); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("chat_id", id.String()).Msg("Failed to populate chat users")
+	}
+
+	return chat, nil
 }
 
-// CreateChat creates a new chat
+// CreateChat creates a new chat and subscribes its creator's connections to
+// it
 func (s *ChatService) CreateChat(ctx *gin.Context, chat *models.Chat) error {
-	return s.db.CreateChat(ctx, chat)
+	if err := s.db.CreateChat(ctx, chat); err != nil {
+		return err
+	}
+
+	if s.hub != nil {
+		s.hub.AddUserToRoom(chat.CreatedBy, chat.ID)
+	}
+	return nil
 }
 
 // UpdateChat updates an existing chat
@@ -146,24 +274,302 @@ func (s *ChatService) UpdateChat(ctx *gin.Context, chat *models.Chat) error {
 	return s.db.UpdateChat(ctx, chat)
 }
 
-// DeleteChat deletes a chat
+// DeleteChat deletes a chat along with its attachment files
 func (s *ChatService) DeleteChat(ctx *gin.Context, id uuid.UUID) error {
-	return s.db.DeleteChat(ctx, id)
+	var attachments []*models.Attachment
+	err := database.WithTx(s.db, func(tx database.Transaction) error {
+		var err error
+		if attachments, err = tx.DeleteChatAttachments(ctx, id); err != nil {
+			return err
+		}
+		return tx.DeleteChat(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files go only once the rows are gone for good
+	deleteAttachmentFiles(ctx, s.files, attachments)
+	return nil
 }
 
-// ListChats lists chats for a user
-func (s *ChatService) ListChats(ctx *gin.Context, userID uuid.UUID, limit, offset int) ([]*models.Chat, error) {
-	return s.db.ListChats(ctx, userID, limit, offset)
+// ListChats lists a user's chats through a filter
+func (s *ChatService) ListChats(ctx *gin.Context, userID uuid.UUID, filter models.ChatFilter) ([]*models.Chat, error) {
+	chats, err := s.db.ListChatsFiltered(ctx, userID, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateChatCreators(ctx, s.db, chats); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate chat creators")
+	}
+
+	return chats, nil
 }
 
-// AddUserToChat adds a user to a chat
+// AddUserToChat adds a user to a chat. It fails with handlers.ErrChatNotFound
+// or handlers.ErrUserNotFound if either doesn't exist. The checks and the
+// insert run in one transaction, so neither can be deleted in between. The
+// user's open connections start receiving the chat's events.
 func (s *ChatService) AddUserToChat(ctx *gin.Context, chatID, userID uuid.UUID, isAdmin bool) error {
-	return s.db.AddUserToChat(ctx, chatID, userID, isAdmin)
+	err := database.WithTx(s.db, func(tx database.Transaction) error {
+		exists, err := tx.ChatExists(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return handlers.ErrChatNotFound
+		}
+
+		exists, err = tx.UserExists(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return handlers.ErrUserNotFound
+		}
+
+		return tx.AddUserToChat(ctx, chatID, userID, isAdmin)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.hub != nil {
+		s.hub.AddUserToRoom(userID, chatID)
+	}
+	return nil
 }
 
-// RemoveUserFromChat removes a user from a chat
+// RemoveUserFromChat removes a user from a chat. It fails with
+// handlers.ErrNotChatMember if they aren't a member, and with
+// handlers.ErrLastChatAdmin rather than leave the other members without an
+// admin. With deleteWhenEmpty set, removing the last member deletes the chat,
+// its messages and attachments.
 func (s *ChatService) RemoveUserFromChat(ctx *gin.Context, chatID, userID uuid.UUID) error {
-	return s.db.RemoveUserFromChat(ctx, chatID, userID)
+	_, err := s.removeMember(ctx, chatID, userID, false)
+	return err
+}
+
+// LeaveChat removes a user from a chat at their own request. If they were the
+// only admin, the longest-standing remaining member is made admin, and their
+// ID is returned. Leaving doesn't delete the chat, even for its creator,
+// unless they were the last member and deleteWhenEmpty is set.
+func (s *ChatService) LeaveChat(ctx *gin.Context, chatID, userID uuid.UUID) (*uuid.UUID, error) {
+	return s.removeMember(ctx, chatID, userID, true)
+}
+
+// removeMember removes a user from a chat and tells the remaining members.
+// With promote set, the chat's only admin leaving hands admin rights to the
+// oldest remaining member instead of failing with handlers.ErrLastChatAdmin.
+func (s *ChatService) removeMember(ctx *gin.Context, chatID, userID uuid.UUID, promote bool) (*uuid.UUID, error) {
+	var (
+		attachments []*models.Attachment
+		promoted    *uuid.UUID
+		deleted     bool
+	)
+	err := database.WithTx(s.db, func(tx database.Transaction) error {
+		members, err := tx.ListChatMembers(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		err = checkAdminRemains(members, userID, true)
+		if errors.Is(err, handlers.ErrLastChatAdmin) && promote {
+			successor := oldestMember(members, userID)
+			if err := tx.SetChatMemberAdmin(ctx, chatID, successor.UserID, true); err != nil {
+				return err
+			}
+			promoted = &successor.UserID
+		} else if err != nil {
+			return err
+		}
+
+		if err := tx.RemoveUserFromChat(ctx, chatID, userID); err != nil {
+			return err
+		}
+		if !s.deleteWhenEmpty || len(members) > 1 {
+			return nil
+		}
+
+		if attachments, err = tx.DeleteChatAttachments(ctx, chatID); err != nil {
+			return err
+		}
+		deleted = true
+		return tx.DeleteChat(ctx, chatID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deleteAttachmentFiles(ctx, s.files, attachments)
+
+	if s.hub != nil {
+		s.hub.RemoveUserFromRoom(userID, chatID)
+		s.hub.StopTyping(chatID, userID)
+	}
+	if s.fanout != nil && !deleted {
+		payload := websocket.MemberLeavePayload{ChatID: chatID, UserID: userID, PromotedUserID: promoted}
+		if err := s.fanout.Publish(chatID, websocket.EventTypeMemberLeave, payload); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("chat_id", chatID.String()).Msg("Failed to queue member leave broadcast")
+		}
+	}
+
+	return promoted, nil
+}
+
+// ListChatMembers lists a chat's members with their user details
+func (s *ChatService) ListChatMembers(ctx *gin.Context, chatID uuid.UUID) ([]*models.ChatMember, error) {
+	members, err := s.db.ListChatMembers(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateMemberUsers(ctx, s.db, members); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate chat member users")
+	}
+
+	return members, nil
+}
+
+// SetChatMemberAdmin grants or revokes a member's admin rights. It fails with
+// handlers.ErrNotChatMember if the user isn't a member, and with
+// handlers.ErrLastChatAdmin rather than demote the chat's only admin.
+func (s *ChatService) SetChatMemberAdmin(ctx *gin.Context, chatID, userID uuid.UUID, isAdmin bool) error {
+	return database.WithTx(s.db, func(tx database.Transaction) error {
+		members, err := tx.ListChatMembers(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		if !isAdmin {
+			if err := checkAdminRemains(members, userID, false); err != nil {
+				return err
+			}
+		} else if findMember(members, userID) == nil {
+			return handlers.ErrNotChatMember
+		}
+
+		return tx.SetChatMemberAdmin(ctx, chatID, userID, isAdmin)
+	})
+}
+
+// checkAdminRemains checks that a chat still has an admin after userID is
+// removed from members or, if removing is false, loses admin rights. A chat
+// with no other members doesn't need one.
+func checkAdminRemains(members []*models.ChatMember, userID uuid.UUID, removing bool) error {
+	target := findMember(members, userID)
+	if target == nil {
+		return handlers.ErrNotChatMember
+	}
+	if !target.IsAdmin || (removing && len(members) == 1) {
+		return nil
+	}
+
+	for _, member := range members {
+		if member.IsAdmin && member.UserID != userID {
+			return nil
+		}
+	}
+	return handlers.ErrLastChatAdmin
+}
+
+// oldestMember returns the longest-standing member other than userID, or nil
+// if there is none
+func oldestMember(members []*models.ChatMember, userID uuid.UUID) *models.ChatMember {
+	var oldest *models.ChatMember
+	for _, member := range members {
+		if member.UserID == userID {
+			continue
+		}
+		if oldest == nil || member.JoinedAt.Before(oldest.JoinedAt) {
+			oldest = member
+		}
+	}
+	return oldest
+}
+
+// findMember returns the membership of userID, or nil if they aren't a member
+func findMember(members []*models.ChatMember, userID uuid.UUID) *models.ChatMember {
+	for _, member := range members {
+		if member.UserID == userID {
+			return member
+		}
+	}
+	return nil
+}
+
+// GetChatMember retrieves a user's membership in a chat
+func (s *ChatService) GetChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (*models.ChatMember, error) {
+	return s.db.GetChatMember(ctx, chatID, userID)
+}
+
+// ValidateAIModel checks a chat's assistant model against the allowlist
+func (s *ChatService) ValidateAIModel(model string) error {
+	return s.aiSvc.ValidateModel(model)
+}
+
+// IsChatMember reports whether a user belongs to a chat
+func (s *ChatService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return s.db.IsChatMember(ctx, chatID, userID)
+}
+
+// SetChatFavorite marks or unmarks a chat as one of a user's favorites
+func (s *ChatService) SetChatFavorite(ctx *gin.Context, chatID, userID uuid.UUID, favorite bool) error {
+	return s.db.SetChatFavorite(ctx, chatID, userID, favorite)
+}
+
+// SetChatArchived archives or unarchives a chat in a user's list
+func (s *ChatService) SetChatArchived(ctx *gin.Context, chatID, userID uuid.UUID, archived bool) error {
+	return s.db.SetChatArchived(ctx, chatID, userID, archived)
+}
+
+// FavoriteChat marks a chat as one of a user's favorites. It fails with
+// handlers.ErrFavoriteLimit if the user already has limit other favorites.
+func (s *ChatService) FavoriteChat(ctx *gin.Context, chatID, userID uuid.UUID, limit int) error {
+	err := s.db.FavoriteChat(ctx, chatID, userID, limit)
+	if errors.Is(err, database.ErrFavoriteLimit) {
+		return handlers.ErrFavoriteLimit
+	}
+	return err
+}
+
+// GetUnreadCounts returns unread message counts per chat for a user
+func (s *ChatService) GetUnreadCounts(ctx *gin.Context, userID uuid.UUID) (map[uuid.UUID]int, error) {
+	return s.db.GetUnreadCounts(ctx, userID)
+}
+
+// MarkChatRead marks a chat as read for a user up to the given time
+func (s *ChatService) MarkChatRead(ctx *gin.Context, chatID, userID uuid.UUID, upTo time.Time) error {
+	return s.db.MarkChatRead(ctx, chatID, userID, upTo)
+}
+
+// ListMessageReaders lists the chat members who have read a message
+func (s *ChatService) ListMessageReaders(ctx *gin.Context, messageID uuid.UUID, limit int) ([]*models.User, error) {
+	return s.db.ListMessageReaders(ctx, messageID, limit)
+}
+
+// CountMessagesByUserInChat counts each user's messages in a chat
+func (s *ChatService) CountMessagesByUserInChat(ctx *gin.Context, chatID uuid.UUID) (map[uuid.UUID]int, error) {
+	return s.db.CountMessagesByUserInChat(ctx, chatID)
+}
+
+// GetDraft retrieves a user's draft for a chat
+func (s *ChatService) GetDraft(ctx *gin.Context, userID, chatID uuid.UUID) (*models.MessageDraft, error) {
+	return s.db.GetDraft(ctx, userID, chatID)
+}
+
+// SaveDraft creates or replaces a user's draft for a chat
+func (s *ChatService) SaveDraft(ctx *gin.Context, draft *models.MessageDraft) error {
+	return s.db.SaveDraft(ctx, draft)
+}
+
+// DeleteDraft deletes a user's draft for a chat
+func (s *ChatService) DeleteDraft(ctx *gin.Context, userID, chatID uuid.UUID) error {
+	return s.db.DeleteDraft(ctx, userID, chatID)
+}
+
+// ListDrafts lists all of a user's drafts
+func (s *ChatService) ListDrafts(ctx *gin.Context, userID uuid.UUID) ([]*models.MessageDraft, error) {
+	return s.db.ListDrafts(ctx, userID)
 }
 
 // GetMessageByID retrieves a message by ID
@@ -171,14 +577,149 @@ func (s *ChatService) GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Me
 	return s.db.GetMessageByID(ctx, id)
 }
 
-// CreateMessage creates a new message
+// CreateMessage creates a new message and lets the assistant reply to it
 func (s *ChatService) CreateMessage(ctx *gin.Context, message *models.Message) error {
-	return s.db.CreateMessage(ctx, message)
+	return s.postMessage(ctx.Request.Context(), message)
+}
+
+// SendMessage implements websocket.MessageSender. Messages the checks turn
+// away are reported to the sender as a websocket.RejectedError.
+func (s *ChatService) SendMessage(ctx context.Context, message *models.Message) error {
+	err := s.postMessage(ctx, message)
+
+	var depthErr *handlers.ReplyDepthError
+	switch {
+	case errors.Is(err, handlers.ErrNotChatMember):
+		return &websocket.RejectedError{Reason: "You are not a member of this chat"}
+	case errors.Is(err, handlers.ErrReplyTargetNotFound), errors.As(err, &depthErr):
+		return &websocket.RejectedError{Reason: err.Error()}
+	}
+	return err
+}
+
+// postMessage creates a user's message in a chat and delivers it. It is the
+// one path for new messages, whether they arrive over REST or the WebSocket.
+func (s *ChatService) postMessage(ctx context.Context, message *models.Message) error {
+	if message.UserID != nil {
+		isMember, err := s.db.IsChatMember(ctx, message.ChatID, *message.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to check chat membership: %w", err)
+		}
+		if !isMember {
+			return handlers.ErrNotChatMember
+		}
+	}
+
+	if message.ReplyTo != nil {
+		replyTo, err := s.resolveReplyTarget(ctx, message.ChatID, *message.ReplyTo)
+		if err != nil {
+			return err
+		}
+		message.ReplyTo = &replyTo
+	}
+
+	if err := s.db.CreateMessage(ctx, message); err != nil {
+		return err
+	}
+
+	publishMessage(s.fanout, message)
+
+	// The sender has stopped typing, and their draft has been sent
+	if message.UserID != nil {
+		s.hub.StopTyping(message.ChatID, *message.UserID)
+		if err := s.db.DeleteDraft(ctx, *message.UserID, message.ChatID); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("chat_id", message.ChatID.String()).Msg("Failed to clear draft")
+		}
+	}
+
+	if s.indexer != nil {
+		s.indexer.Index(message)
+	}
+
+	// The reply outlives the request, but keeps its logger
+	if s.assistant != nil {
+		go s.assistant.Respond(context.WithoutCancel(ctx), message)
+	}
+
+	return nil
+}
+
+// resolveReplyTarget checks that a reply target belongs to the chat and
+// enforces the reply depth limit, returning the message to actually reply to
+func (s *ChatService) resolveReplyTarget(ctx context.Context, chatID, replyTo uuid.UUID) (uuid.UUID, error) {
+	parent, err := s.db.GetMessageByID(ctx, replyTo)
+	if err != nil || parent.ChatID != chatID {
+		return uuid.Nil, handlers.ErrReplyTargetNotFound
+	}
+
+	if s.maxReplyDepth <= 0 || parent.Depth < s.maxReplyDepth {
+		return parent.ID, nil
+	}
+
+	if s.replyDepthMode != handlers.ReplyDepthFlatten {
+		return uuid.Nil, &handlers.ReplyDepthError{MaxDepth: s.maxReplyDepth}
+	}
+
+	// Walk up to the deepest ancestor that can still take a reply
+	for parent.Depth >= s.maxReplyDepth && parent.ReplyTo != nil {
+		parent, err = s.db.GetMessageByID(ctx, *parent.ReplyTo)
+		if err != nil {
+			return uuid.Nil, handlers.ErrReplyTargetNotFound
+		}
+	}
+
+	return parent.ID, nil
+}
+
+// ForwardMessage copies a message into each of the given chats as the user,
+// creating all of the copies or none of them
+func (s *ChatService) ForwardMessage(ctx *gin.Context, message *models.Message, userID uuid.UUID, chatIDs []uuid.UUID) ([]*models.Message, error) {
+	forwarded := make([]*models.Message, 0, len(chatIDs))
+	err := database.WithTx(s.db, func(tx database.Transaction) error {
+		for _, chatID := range chatIDs {
+			source := message.ID
+			fwd := &models.Message{
+				ID:               uuid.New(),
+				ChatID:           chatID,
+				UserID:           &userID,
+				Content:          message.Content,
+				ContentEncrypted: message.ContentEncrypted,
+				ForwardedFrom:    &source,
+			}
+			if err := tx.CreateMessage(ctx, fwd); err != nil {
+				return err
+			}
+			forwarded = append(forwarded, fwd)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, fwd := range forwarded {
+		publishMessage(s.fanout, fwd)
+	}
+
+	return forwarded, nil
 }
 
 // UpdateMessage updates an existing message
 func (s *ChatService) UpdateMessage(ctx *gin.Context, message *models.Message) error {
-	return s.db.UpdateMessage(ctx, message)
+	if err := s.db.UpdateMessage(ctx, message); err != nil {
+		return err
+	}
+
+	// Edits are searched by their new meaning
+	if s.indexer != nil {
+		s.indexer.Index(message)
+	}
+	return nil
+}
+
+// ListMessageEdits lists the earlier versions of a message
+func (s *ChatService) ListMessageEdits(ctx *gin.Context, messageID uuid.UUID) ([]*models.MessageEdit, error) {
+	return s.db.ListMessageEdits(ctx, messageID)
 }
 
 // DeleteMessage deletes a message
@@ -188,7 +729,364 @@ func (s *ChatService) DeleteMessage(ctx *gin.Context, id uuid.UUID) error {
 
 // ListChatMessages lists messages for a chat
 func (s *ChatService) ListChatMessages(ctx *gin.Context, chatID uuid.UUID, limit, offset int) ([]*models.Message, error) {
-	return s.db.ListChatMessages(ctx, chatID, limit, offset)
+	includeDeleted := s.deletedMessages != models.DeletedMessagesHide
+	messages, err := s.db.ListChatMessages(ctx, chatID, limit, offset, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateMessageAuthors(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("chat_id", chatID.String()).Msg("Failed to populate message authors")
+	}
+	if err := populateMessageReactions(ctx, s.db, messages); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("chat_id", chatID.String()).Msg("Failed to populate message reactions")
+	}
+	if err := populateReplyTargets(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("chat_id", chatID.String()).Msg("Failed to populate reply targets")
+	}
+	for _, message := range messages {
+		message.Redact()
+	}
+
+	return messages, nil
+}
+
+// AddReaction adds a user's reaction to a message
+func (s *ChatService) AddReaction(ctx *gin.Context, reaction *models.MessageReaction) error {
+	return s.db.AddReaction(ctx, reaction)
+}
+
+// RemoveReaction removes a user's reaction from a message
+func (s *ChatService) RemoveReaction(ctx *gin.Context, messageID, userID uuid.UUID, emoji string) error {
+	return s.db.RemoveReaction(ctx, messageID, userID, emoji)
+}
+
+// ListThreadMessages lists a message and all of its replies
+func (s *ChatService) ListThreadMessages(ctx *gin.Context, rootMessageID uuid.UUID, limit, offset int) ([]*models.Message, error) {
+	messages, err := s.db.ListThreadMessages(ctx, rootMessageID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateMessageAuthors(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("message_id", rootMessageID.String()).Msg("Failed to populate message authors")
+	}
+	if err := populateMessageReactions(ctx, s.db, messages); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("message_id", rootMessageID.String()).Msg("Failed to populate message reactions")
+	}
+	if err := populateReplyTargets(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Str("message_id", rootMessageID.String()).Msg("Failed to populate reply targets")
+	}
+
+	return messages, nil
+}
+
+// SearchMessages searches messages in the user's chats
+func (s *ChatService) SearchMessages(ctx *gin.Context, userID uuid.UUID, query string, limit, offset int) ([]*models.Message, error) {
+	messages, err := s.db.SearchMessages(ctx, userID, query, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateMessageAuthors(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate message authors")
+	}
+	if err := populateReplyTargets(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate reply targets")
+	}
+
+	return messages, nil
+}
+
+// SemanticSearchMessages finds the messages in the user's chats closest in
+// meaning to a query
+func (s *ChatService) SemanticSearchMessages(ctx *gin.Context, userID uuid.UUID, query string, limit int) ([]*models.Message, error) {
+	if s.indexer == nil {
+		return nil, handlers.ErrSemanticSearchDisabled
+	}
+
+	embeddings, err := s.aiSvc.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	messages, err := s.db.SemanticSearchMessages(ctx, userID, embeddings[0], limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateMessageAuthors(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate message authors")
+	}
+	if err := populateReplyTargets(ctx, s.db, messages, s.attribution); err != nil {
+		log.Ctx(ctx).Warn().Err(err).Msg("Failed to populate reply targets")
+	}
+
+	return messages, nil
+}
+
+// publishMessage queues a new message for delivery to the chat's connected
+// members. Delivery is best-effort; the message is already stored.
+func publishMessage(fanout *websocket.Fanout, message *models.Message) {
+	if err := fanout.Publish(message.ChatID, websocket.EventTypeMessage, message); err != nil {
+		log.Warn().
+			Err(err).
+			Str("message_id", message.ID.String()).
+			Str("chat_id", message.ChatID.String()).
+			Msg("Failed to queue message broadcast")
+	}
+}
+
+// userChatIDs returns the chats a user belongs to. It is the hub's room lookup.
+func (s *Server) userChatIDs(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	return s.db.ListUserChatIDs(ctx, userID)
+}
+
+// deleteAttachmentFiles removes attachment files from storage. Failures are
+// logged and skipped so one missing file doesn't leave the rest behind.
+func deleteAttachmentFiles(ctx context.Context, files storage.AttachmentStore, attachments []*models.Attachment) {
+	for _, attachment := range attachments {
+		if err := files.Delete(ctx, attachment.FilePath); err != nil {
+			log.Ctx(ctx).Warn().Err(err).Str("attachment_id", attachment.ID.String()).Msg("Failed to delete attachment file")
+		}
+	}
+}
+
+// UserService is a wrapper to adapt the database layer to the user handlers interface
+type UserService struct {
+	db    database.Store
+	hub   *websocket.Hub
+	aiSvc *ai.Service
+}
+
+// GetUserByID retrieves a user by ID
+func (s *UserService) GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error) {
+	return s.db.GetUserByID(ctx, id)
+}
+
+// ListRecentContacts lists the users someone has most recently interacted with
+func (s *UserService) ListRecentContacts(ctx *gin.Context, userID uuid.UUID, limit int) ([]*models.RecentContact, error) {
+	return s.db.ListRecentContacts(ctx, userID, limit)
+}
+
+// UpdateUser updates a user
+func (s *UserService) UpdateUser(ctx *gin.Context, user *models.User) error {
+	return s.db.UpdateUser(ctx, user)
+}
+
+// ListOnlineUsers lists the users connected to this instance who share their
+// online status
+func (s *UserService) ListOnlineUsers(ctx *gin.Context) ([]*models.User, error) {
+	return s.db.ListUsersShowingOnlineStatus(ctx, s.hub.OnlineUsers())
+}
+
+// GetAIUsage reports the tokens a user's assistant requests have used this
+// month against their quota
+func (s *UserService) GetAIUsage(ctx *gin.Context, userID uuid.UUID) (*models.AIUsageSummary, error) {
+	since := ai.QuotaPeriodStart(time.Now())
+	used, err := s.db.GetUserTokenUsage(ctx, userID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.AIUsageSummary{
+		UserID:       userID,
+		PeriodStart:  since,
+		TotalTokens:  used,
+		MonthlyQuota: s.aiSvc.MonthlyTokenQuota(),
+	}
+	if summary.MonthlyQuota > 0 {
+		remaining := summary.MonthlyQuota - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		summary.Remaining = &remaining
+	}
+
+	return summary, nil
+}
+
+// RoleService is a wrapper to adapt the database layer to the role handlers interface
+type RoleService struct {
+	db database.Store
+}
+
+// UserExists reports whether a user exists
+func (s *RoleService) UserExists(ctx *gin.Context, id uuid.UUID) (bool, error) {
+	return s.db.UserExists(ctx, id)
+}
+
+// ListRoles lists every role
+func (s *RoleService) ListRoles(ctx *gin.Context) ([]*models.Role, error) {
+	return s.db.ListRoles(ctx)
+}
+
+// ListUserRoles lists the roles granted to a user
+func (s *RoleService) ListUserRoles(ctx *gin.Context, userID uuid.UUID) ([]*models.Role, error) {
+	return s.db.ListUserRoles(ctx, userID)
+}
+
+// GrantRole grants a role to a user
+func (s *RoleService) GrantRole(ctx *gin.Context, userID uuid.UUID, role string) error {
+	return s.db.GrantRole(ctx, userID, role)
+}
+
+// RevokeRole takes a role away from a user
+func (s *RoleService) RevokeRole(ctx *gin.Context, userID uuid.UUID, role string) error {
+	return s.db.RevokeRole(ctx, userID, role)
+}
+
+// DMService is a wrapper to adapt the database layer to the direct message handlers interface
+type DMService struct {
+	db          database.Store
+	attribution string
+	// deletedMessages is how listings show deleted messages, one of the
+	// models.DeletedMessages* modes
+	deletedMessages string
+}
+
+// GetUserByID retrieves a user by ID
+func (s *DMService) GetUserByID(ctx *gin.Context, id uuid.UUID) (*models.User, error) {
+	return s.db.GetUserByID(ctx, id)
+}
+
+// GetDMConversation returns the conversation between two users as seen by userID
+func (s *DMService) GetDMConversation(ctx *gin.Context, userID, otherID uuid.UUID) (*models.DMConversation, error) {
+	return s.db.GetDMConversation(ctx, userID, otherID)
+}
+
+// GetDirectMessageByID retrieves a direct message by ID
+func (s *DMService) GetDirectMessageByID(ctx *gin.Context, id uuid.UUID) (*models.DirectMessage, error) {
+	return s.db.GetDirectMessageByID(ctx, id)
+}
+
+// ListDirectMessages lists the messages between two users, with sender and
+// recipient details
+func (s *DMService) ListDirectMessages(ctx *gin.Context, userID, otherID uuid.UUID, limit, offset int) ([]*models.DirectMessage, error) {
+	includeDeleted := s.deletedMessages != models.DeletedMessagesHide
+	messages, err := s.db.ListDirectMessages(ctx, userID, otherID, limit, offset, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := populateDirectMessageUsers(ctx, s.db, messages, s.attribution); err != nil {
+		return nil, err
+	}
+	for _, message := range messages {
+		message.Redact()
+	}
+
+	return messages, nil
+}
+
+// CreateDirectMessage creates a new direct message
+func (s *DMService) CreateDirectMessage(ctx *gin.Context, message *models.DirectMessage) error {
+	return s.db.CreateDirectMessage(ctx, message)
+}
+
+// UpdateDirectMessage updates an existing direct message
+func (s *DMService) UpdateDirectMessage(ctx *gin.Context, message *models.DirectMessage) error {
+	return s.db.UpdateDirectMessage(ctx, message)
+}
+
+// DeleteDirectMessage marks a direct message as deleted
+func (s *DMService) DeleteDirectMessage(ctx *gin.Context, id uuid.UUID) error {
+	return s.db.DeleteDirectMessage(ctx, id)
+}
+
+// MarkDirectMessagesRead marks every message from sender to recipient as read
+func (s *DMService) MarkDirectMessagesRead(ctx *gin.Context, recipientID, senderID uuid.UUID) error {
+	return s.db.MarkDirectMessagesRead(ctx, recipientID, senderID)
+}
+
+// AttachmentService is a wrapper to adapt the database layer to the attachment handlers interface
+type AttachmentService struct {
+	db    database.Store
+	files storage.AttachmentStore
+}
+
+// GetAttachmentByID retrieves an attachment by ID
+func (s *AttachmentService) GetAttachmentByID(ctx *gin.Context, id uuid.UUID) (*models.Attachment, error) {
+	return s.db.GetAttachmentByID(ctx, id)
+}
+
+// CanAccessAttachment reports whether a user can see the message an attachment belongs to
+func (s *AttachmentService) CanAccessAttachment(ctx *gin.Context, attachment *models.Attachment, userID uuid.UUID) (bool, error) {
+	switch {
+	case attachment.MessageID != nil:
+		message, err := s.db.GetMessageByID(ctx, *attachment.MessageID)
+		if err != nil {
+			return false, err
+		}
+
+		return s.db.IsChatMember(ctx, message.ChatID, userID)
+
+	case attachment.DirectMessageID != nil:
+		dm, err := s.db.GetDirectMessageByID(ctx, *attachment.DirectMessageID)
+		if err != nil {
+			return false, err
+		}
+		return dm.SenderID == userID || dm.RecipientID == userID, nil
+	}
+
+	return false, nil
+}
+
+// OpenAttachment opens an attachment's stored file
+func (s *AttachmentService) OpenAttachment(ctx *gin.Context, attachment *models.Attachment) (io.ReadCloser, error) {
+	return s.files.Get(ctx, attachment.FilePath)
+}
+
+// GetMessageByID retrieves a message by ID
+func (s *AttachmentService) GetMessageByID(ctx *gin.Context, id uuid.UUID) (*models.Message, error) {
+	return s.db.GetMessageByID(ctx, id)
+}
+
+// IsChatMember checks if a user is a member of a chat
+func (s *AttachmentService) IsChatMember(ctx *gin.Context, chatID, userID uuid.UUID) (bool, error) {
+	return s.db.IsChatMember(ctx, chatID, userID)
+}
+
+// CreateAttachment stores an attachment's file and records it. The file is
+// removed again if the record can't be created.
+func (s *AttachmentService) CreateAttachment(ctx *gin.Context, attachment *models.Attachment, file io.Reader) error {
+	attachment.FilePath = fmt.Sprintf("messages/%s/%s", attachment.MessageID, attachment.ID)
+
+	counter := &countingReader{r: file}
+	if err := s.files.Put(ctx, attachment.FilePath, counter, attachment.FileType); err != nil {
+		return err
+	}
+	attachment.FileSize = counter.n
+
+	if err := s.db.CreateAttachment(ctx, attachment); err != nil {
+		deleteAttachmentFiles(ctx, s.files, []*models.Attachment{attachment})
+		return err
+	}
+
+	return nil
+}
+
+// AttachmentURL returns a pre-signed URL for downloading an attachment
+// straight from storage, or "" when the store serves files only through the
+// server
+func (s *AttachmentService) AttachmentURL(ctx *gin.Context, attachment *models.Attachment) (string, error) {
+	presigner, ok := s.files.(storage.Presigner)
+	if !ok {
+		return "", nil
+	}
+	return presigner.PresignGet(ctx, attachment.FilePath, attachment.FileName, attachment.FileType)
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
 
 // setupRoutes configures the routes for the server
@@ -197,22 +1095,70 @@ func (s *Server) setupRoutes() {
 	api := s.router.Group("/api")
 
 	// Create handlers
-	authHandler := handlers.NewAuthHandler(s.authSvc)
+	authHandler := handlers.NewAuthHandler(s.authSvc, s.config.Profile)
 
 	// Create chat service adapter
-	chatService := &ChatService{db: s.db}
-	chatHandler := handlers.NewChatHandler(chatService)
+	chatService := &ChatService{
+		db:              s.db,
+		assistant:       NewAssistant(s.config.Assistant, s.db, s.aiSvc, s.fanout),
+		fanout:          s.fanout,
+		hub:             s.wsHub,
+		files:           s.files,
+		attribution:     s.config.Chat.DeletedUserAttribution,
+		deleteWhenEmpty: s.config.Chat.DeleteWhenEmpty,
+		deletedMessages: s.config.Chat.DeletedMessages,
+		maxReplyDepth:   s.config.Chat.MaxReplyDepth,
+		replyDepthMode:  s.config.Chat.ReplyDepthMode,
+		indexer:         s.indexer,
+		aiSvc:           s.aiSvc,
+	}
+	chatHandler := handlers.NewChatHandler(chatService, s.config.Chat)
+
+	// Create user service adapter
+	userService := &UserService{db: s.db, hub: s.wsHub, aiSvc: s.aiSvc}
+	userHandler := handlers.NewUserHandler(userService, avatar.NewGenerator(s.config.Avatar), s.config.Profile)
+
+	// Create direct message service adapter
+	dmService := &DMService{
+		db:              s.db,
+		attribution:     s.config.Chat.DeletedUserAttribution,
+		deletedMessages: s.config.Chat.DeletedMessages,
+	}
+	dmHandler := handlers.NewDirectMessageHandler(dmService, s.config.Chat.MaxMessageLength, s.config.Chat.EditGrace)
+
+	// Create attachment service adapter
+	attachmentService := &AttachmentService{db: s.db, files: s.files}
+	attachmentHandler := handlers.NewAttachmentHandler(s.config.Attachments, attachmentService)
+
+	rateLimitHandler := handlers.NewRateLimitHandler(s.limiter)
+
+	roleHandler := handlers.NewRoleHandler(&RoleService{db: s.db})
 
 	// Register routes
 	authHandler.RegisterRoutes(api)
+	userHandler.RegisterRoutes(api)
+	rateLimitHandler.RegisterRoutes(api)
 
 	// Protected routes
 	protected := api.Group("")
 	protected.Use(s.authMw)
 	chatHandler.RegisterRoutes(protected)
+	attachmentHandler.RegisterRoutes(protected)
+	dmHandler.RegisterRoutes(protected)
+	authHandler.RegisterProtectedRoutes(protected)
+	userHandler.RegisterProtectedRoutes(protected)
+	roleHandler.RegisterRoutes(protected)
+
+	// Health checks
+	s.healthHandler().RegisterRoutes(s.router)
+
+	// Metrics, unless they have a listener of their own
+	if s.servesMetrics() {
+		s.router.GET(s.metricsPath(), gin.WrapH(metrics.Handler()))
+	}
 
 	// WebSocket route
-	s.router.GET("/ws", websocket.Handler(s.wsHub, s.authSvc))
+	s.router.GET(websocketPath, websocket.Handler(s.wsHub, s.authSvc, s.db, chatService))
 
 	// Start the WebSocket hub in a goroutine
 	go s.wsHub.Run()
@@ -221,12 +1167,69 @@ func (s *Server) setupRoutes() {
 	if s.config.WebDir != "" {
 		s.router.Static("/assets", fmt.Sprintf("%s/assets", s.config.WebDir))
 		s.router.StaticFile("/favicon.ico", fmt.Sprintf("%s/favicon.ico", s.config.WebDir))
+	}
+
+	// Unknown API routes get a JSON 404 that clients can parse; everything
+	// else is a client-side route for the SPA to resolve
+	s.router.NoRoute(func(c *gin.Context) {
+		if isAPIPath(c.Request.URL.Path) || s.config.WebDir == "" {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+			return
+		}
+		c.File(fmt.Sprintf("%s/index.html", s.config.WebDir))
+	})
+}
 
-		// Handle SPA routes
-		s.router.NoRoute(func(c *gin.Context) {
-			c.File(fmt.Sprintf("%s/index.html", s.config.WebDir))
+// healthHandler creates the health check handler, probing the database and,
+// when it is in use, Redis
+func (s *Server) healthHandler() *handlers.HealthHandler {
+	checks := []handlers.DependencyCheck{
+		{Name: "database", Check: s.db.Ping},
+	}
+	if s.redis != nil {
+		checks = append(checks, handlers.DependencyCheck{
+			Name: "redis",
+			Check: func(ctx context.Context) error {
+				return s.redis.Ping(ctx).Err()
+			},
 		})
 	}
+
+	return handlers.NewHealthHandler(s.config.Build, checks, s.db.Stats)
+}
+
+// metricsPath returns where metrics are served
+func (s *Server) metricsPath() string {
+	if s.config.Metrics.Path != "" {
+		return s.config.Metrics.Path
+	}
+	return defaultMetricsPath
+}
+
+// servesMetrics reports whether metrics are served on the main router rather
+// than on an admin listener of their own
+func (s *Server) servesMetrics() bool {
+	return s.config.Metrics.Enabled && s.config.Metrics.ListenAddr == ""
+}
+
+// newMetricsServer creates the admin listener for metrics, or returns nil if
+// metrics are off or served on the main router
+func (s *Server) newMetricsServer() *http.Server {
+	if !s.config.Metrics.Enabled || s.config.Metrics.ListenAddr == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(s.metricsPath(), metrics.Handler())
+	return &http.Server{
+		Addr:    s.config.Metrics.ListenAddr,
+		Handler: mux,
+	}
+}
+
+// isAPIPath reports whether a request path belongs to the JSON API
+func isAPIPath(path string) bool {
+	return path == "/api" || strings.HasPrefix(path, "/api/")
 }
 
 // Start starts the server
@@ -237,15 +1240,57 @@ func (s *Server) Start() error {
 		Handler: s.router,
 	}
 
-	// Create a channel to listen for errors coming from the listener
-	serverErrors := make(chan error, 1)
+	// With TLS, an optional second listener redirects plain HTTP to HTTPS
+	var redirectSrv *http.Server
+	if s.config.TLS.Enabled {
+		tlsConfig, redirect, err := s.tlsSetup()
+		if err != nil {
+			return err
+		}
+		srv.TLSConfig = tlsConfig
+		if s.config.TLS.RedirectAddr != "" {
+			redirectSrv = &http.Server{
+				Addr:    s.config.TLS.RedirectAddr,
+				Handler: redirect,
+			}
+		}
+	}
+
+	// Create a channel to listen for errors coming from the listeners
+	serverErrors := make(chan error, 3)
 
 	// Start the server in a goroutine
 	go func() {
+		if srv.TLSConfig != nil {
+			log.Info().Str("addr", addr).Msg("Starting HTTPS server")
+			// The certificate comes from TLSConfig
+			serverErrors <- srv.ListenAndServeTLS("", "")
+			return
+		}
 		log.Info().Str("addr", addr).Msg("Starting server")
 		serverErrors <- srv.ListenAndServe()
 	}()
 
+	if redirectSrv != nil {
+		go func() {
+			log.Info().Str("addr", redirectSrv.Addr).Msg("Starting HTTP to HTTPS redirect server")
+			if err := redirectSrv.ListenAndServe(); err != http.ErrServerClosed {
+				serverErrors <- fmt.Errorf("redirect server: %w", err)
+			}
+		}()
+	}
+
+	// Start the metrics listener, if it has one of its own
+	metricsSrv := s.newMetricsServer()
+	if metricsSrv != nil {
+		go func() {
+			log.Info().Str("addr", metricsSrv.Addr).Msg("Starting metrics server")
+			if err := metricsSrv.ListenAndServe(); err != http.ErrServerClosed {
+				serverErrors <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
 	// Create a channel to listen for interrupt signals
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
@@ -262,14 +1307,42 @@ func (s *Server) Start() error {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		// Shutdown the server gracefully
-		err := srv.Shutdown(ctx)
-		if err != nil {
-			// Force shutdown if graceful shutdown fails
-			log.Error().Err(err).Msg("Server forced to shutdown")
-			return fmt.Errorf("error shutting down server: %w", err)
+		if metricsSrv != nil {
+			if err := metricsSrv.Shutdown(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to shut down metrics server")
+			}
+		}
+		if redirectSrv != nil {
+			if err := redirectSrv.Shutdown(ctx); err != nil {
+				log.Warn().Err(err).Msg("Failed to shut down redirect server")
+			}
+		}
+
+		// Shutdown the server gracefully. Requests still running when the
+		// deadline passes are cut off, but the rest still gets drained.
+		shutdownErr := srv.Shutdown(ctx)
+		if shutdownErr != nil {
+			log.Error().Err(shutdownErr).Msg("Server forced to shutdown")
+		}
+
+		// Flush queued broadcasts
+		if err := s.fanout.Stop(ctx); err != nil {
+			log.Warn().Err(err).Msg("Timed out flushing queued broadcasts")
 		}
 
+		// Embed messages still waiting to be indexed
+		if s.indexer != nil {
+			s.indexer.Stop()
+		}
+
+		// Tell WebSocket clients to reconnect elsewhere and close them
+		if err := s.wsHub.Shutdown(ctx); err != nil {
+			log.Warn().Err(err).Msg("Timed out draining WebSocket connections")
+		}
+
+		if shutdownErr != nil {
+			return fmt.Errorf("error shutting down server: %w", shutdownErr)
+		}
 		log.Info().Msg("Server stopped gracefully")
 		return nil
 	}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/websocket"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testChat is a SQLite store holding one chat between two users
+type testChat struct {
+	db         *database.SQLiteStore
+	chat       *models.Chat
+	alice, bob *models.User
+}
+
+// newTestChat opens a SQLite store in a temporary directory and creates a
+// chat owned by alice with bob as a member
+func newTestChat(t *testing.T) *testChat {
+	t.Helper()
+	ctx := context.Background()
+
+	db, err := database.NewSQLiteStore(database.Config{Driver: database.DriverSQLite, Name: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("NewSQLiteStore: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	tc := &testChat{db: db}
+	for _, user := range []**models.User{&tc.alice, &tc.bob} {
+		*user = &models.User{ID: uuid.New(), PasswordHash: "x", IsActive: true}
+	}
+	tc.alice.Username, tc.alice.Email = "alice", "alice@example.com"
+	tc.bob.Username, tc.bob.Email = "bob", "bob@example.com"
+	for _, user := range []*models.User{tc.alice, tc.bob} {
+		if err := db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	tc.chat = &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: tc.alice.ID}
+	if err := db.CreateChat(ctx, tc.chat); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	if err := db.AddUserToChat(ctx, tc.chat.ID, tc.bob.ID, false); err != nil {
+		t.Fatalf("AddUserToChat: %v", err)
+	}
+	return tc
+}
+
+// post stores a message from author, or from the assistant if author is nil,
+// replying to replyTo if it is set
+func (tc *testChat) post(t *testing.T, author *models.User, content string, replyTo *models.Message) *models.Message {
+	t.Helper()
+
+	message := &models.Message{ID: uuid.New(), ChatID: tc.chat.ID, Content: content}
+	if author != nil {
+		message.UserID = &author.ID
+	} else {
+		message.IsAIGenerated = true
+	}
+	if replyTo != nil {
+		message.ReplyTo = &replyTo.ID
+	}
+	if err := tc.db.CreateMessage(context.Background(), message); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	return message
+}
+
+// chatService creates a ChatService over the test chat's store, with a hub
+// and fan-out but no assistant or search indexer
+func (tc *testChat) chatService(t *testing.T, maxReplyDepth int, replyDepthMode string) *ChatService {
+	t.Helper()
+
+	hub := websocket.NewHub(websocket.HubConfig{}, nil)
+	fanout := websocket.NewFanout(websocket.FanoutConfig{}, hub)
+	t.Cleanup(func() { fanout.Stop(context.Background()) })
+
+	return &ChatService{
+		db:             tc.db,
+		hub:            hub,
+		fanout:         fanout,
+		maxReplyDepth:  maxReplyDepth,
+		replyDepthMode: replyDepthMode,
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// defaultAutocertCacheDir is where Let's Encrypt certificates are kept unless
+// configured otherwise
+const defaultAutocertCacheDir = "./data/certs"
+
+// TLSConfig configures HTTPS
+type TLSConfig struct {
+	Enabled bool
+	// CertFile and KeyFile are the PEM certificate and key to serve
+	CertFile string
+	KeyFile  string
+	// AutocertDomains, if set, has certificates issued by Let's Encrypt for
+	// these domains instead of loading CertFile and KeyFile
+	AutocertDomains []string
+	// AutocertCacheDir keeps issued certificates across restarts. Defaults
+	// to ./data/certs.
+	AutocertCacheDir string
+	// AutocertEmail is given to Let's Encrypt for expiry notices
+	AutocertEmail string
+	// RedirectAddr, if set, runs a plain HTTP listener (e.g. ":80") that
+	// redirects to HTTPS. In autocert mode it also answers HTTP challenges.
+	RedirectAddr string
+}
+
+// tlsSetup returns the TLS configuration for the main listener and the
+// handler for the redirect listener. Certificate files are loaded here so a
+// bad certificate stops startup rather than failing every handshake.
+func (s *Server) tlsSetup() (*tls.Config, http.Handler, error) {
+	cfg := s.config.TLS
+
+	if len(cfg.AutocertDomains) > 0 {
+		cacheDir := cfg.AutocertCacheDir
+		if cacheDir == "" {
+			cacheDir = defaultAutocertCacheDir
+		}
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.AutocertDomains...),
+			Cache:      autocert.DirCache(cacheDir),
+			Email:      cfg.AutocertEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, manager.HTTPHandler(s.httpsRedirect()), nil
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, nil, errors.New("TLS is enabled but no certificate is configured; set cert_file and key_file, or autocert_domains")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	return tlsConfig, s.httpsRedirect(), nil
+}
+
+// httpsRedirect redirects requests to the same URL on the HTTPS listener
+func (s *Server) httpsRedirect() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if s.config.Port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(s.config.Port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	gorilla "github.com/gorilla/websocket"
+
+	"github.com/llamasearch/llamachat/internal/models"
+	"github.com/llamasearch/llamachat/internal/websocket"
+)
+
+// registerAs registers a user with the server's auth service, returning the
+// user and an access token for them
+func registerAs(t *testing.T, s *Server, username string) (*models.User, string) {
+	t.Helper()
+	ctx := context.Background()
+
+	user, err := s.authSvc.RegisterUser(ctx, username, username+"@example.com", "correct horse battery", "")
+	if err != nil {
+		t.Fatalf("RegisterUser(%s): %v", username, err)
+	}
+	token, _, err := s.authSvc.LoginUser(ctx, username, "correct horse battery")
+	if err != nil {
+		t.Fatalf("LoginUser(%s): %v", username, err)
+	}
+	return user, token
+}
+
+// readUntil reads events from a connection until one of eventType arrives
+func readUntil(t *testing.T, conn *gorilla.Conn, eventType string) websocket.Message {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		var msg websocket.Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid event %q: %v", data, err)
+		}
+		if msg.Type == eventType {
+			return msg
+		}
+	}
+}
+
+func TestSendingMessageStopsTyping(t *testing.T) {
+	s := newTestServer(t, t.TempDir())
+	srv := httptest.NewServer(s.router)
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.wsHub.Shutdown(ctx)
+	})
+	ctx := context.Background()
+
+	alice, aliceToken := registerAs(t, s, "alice")
+	bob, bobToken := registerAs(t, s, "bob")
+	chat := &models.Chat{ID: uuid.New(), Name: "general", CreatedBy: alice.ID}
+	if err := s.db.CreateChat(ctx, chat); err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	if err := s.db.AddUserToChat(ctx, chat.ID, bob.ID, false); err != nil {
+		t.Fatalf("AddUserToChat: %v", err)
+	}
+
+	// Connecting subscribes each user to their chats
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + websocketPath + "?token="
+	aliceConn, _, err := gorilla.DefaultDialer.Dial(wsURL+aliceToken, nil)
+	if err != nil {
+		t.Fatalf("dialing as alice: %v", err)
+	}
+	t.Cleanup(func() { aliceConn.Close() })
+	bobConn, _, err := gorilla.DefaultDialer.Dial(wsURL+bobToken, nil)
+	if err != nil {
+		t.Fatalf("dialing as bob: %v", err)
+	}
+	t.Cleanup(func() { bobConn.Close() })
+	readUntil(t, aliceConn, websocket.EventTypeHello)
+	readUntil(t, bobConn, websocket.EventTypeHello)
+
+	payload, _ := json.Marshal(websocket.RoomPayload{ChatID: chat.ID})
+	if err := aliceConn.WriteJSON(websocket.Message{Type: websocket.EventTypeTyping, Payload: payload}); err != nil {
+		t.Fatalf("sending typing event: %v", err)
+	}
+	readUntil(t, bobConn, websocket.EventTypeTyping)
+
+	// Alice sends over REST; bob sees her stop typing without waiting out
+	// the indicator's TTL
+	body, _ := json.Marshal(map[string]string{"content": "hello"})
+	req := httptest.NewRequest(http.MethodPost, "/api/chats/"+chat.ID.String()+"/messages", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("sending message: status = %d (body %s)", w.Code, w.Body)
+	}
+
+	msg := readUntil(t, bobConn, websocket.EventTypeTypingStop)
+	var stop websocket.TypingPayload
+	if err := json.Unmarshal(msg.Payload, &stop); err != nil {
+		t.Fatalf("invalid typing_stop payload: %v", err)
+	}
+	if stop.ChatID != chat.ID || stop.UserID != alice.ID {
+		t.Errorf("typing_stop = %+v, want alice in %s", stop, chat.ID)
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// AttachmentStore holds the files behind attachments. Attachment.FilePath is
+// the file's key in the store.
+type AttachmentStore interface {
+	// Put stores the contents of r under key. If reading r fails, nothing is
+	// left behind under key.
+	Put(ctx context.Context, key string, r io.Reader, contentType string) error
+	// Get opens a stored file for reading
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes a stored file. Deleting a missing file is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Presigner is implemented by stores that can hand out time-limited URLs
+// for downloading a file directly, bypassing the server
+type Presigner interface {
+	PresignGet(ctx context.Context, key, fileName, contentType string) (string, error)
+}
+
+// Storage backends
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+// Config selects and configures an attachment store
+type Config struct {
+	// Backend is BackendLocal (the default) or BackendS3
+	Backend string
+	// Dir is the root directory of the local backend
+	Dir string
+	// S3 configures the S3 backend
+	S3 S3Config
+}
+
+// New creates the attachment store selected by config
+func New(config Config) (AttachmentStore, error) {
+	switch config.Backend {
+	case "", BackendLocal:
+		return NewLocalStore(config.Dir), nil
+	case BackendS3:
+		return NewS3Store(config.S3)
+	default:
+		return nil, fmt.Errorf("unsupported storage backend %q", config.Backend)
+	}
+}
+
+// LocalStore keeps attachment files on the local filesystem
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a store rooted at dir. Relative keys are resolved
+// against dir; absolute keys are used as-is.
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+// Put writes r to the file for key, creating parent directories as needed.
+// The file is written under a temporary name and renamed into place, so a
+// failed upload never leaves a partial file.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, contentType string) error {
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create attachment file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write attachment file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write attachment file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store attachment file: %w", err)
+	}
+
+	return nil
+}
+
+// Get opens a stored file for reading
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open attachment file: %w", err)
+	}
+	return file, nil
+}
+
+// Delete removes a stored file
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete attachment file: %w", err)
+	}
+	return nil
+}
+
+// path returns the filesystem path for a key
+func (s *LocalStore) path(key string) string {
+	if filepath.IsAbs(key) {
+		return key
+	}
+	return filepath.Join(s.dir, filepath.Clean("/"+key))
+}
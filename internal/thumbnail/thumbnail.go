@@ -0,0 +1,191 @@
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"sync/atomic"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/lru"
+)
+
+// Sizes lists the thumbnail dimensions that may be requested; restricting them
+// keeps clients from filling the cache with arbitrary variants
+var Sizes = []int{64, 128, 256, 512}
+
+// DefaultSize is used when no size is requested
+const DefaultSize = 256
+
+// Thumbnail is a generated image ready to be served
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+}
+
+// Stats reports cache usage
+type Stats struct {
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// Cache is a size-bounded LRU cache of generated thumbnails
+type Cache struct {
+	entries *lru.Cache[string, *Thumbnail]
+	hits    atomic.Uint64
+	misses  atomic.Uint64
+}
+
+// NewCache creates a new thumbnail cache holding at most maxBytes of image data
+func NewCache(maxBytes int64) *Cache {
+	return &Cache{
+		entries: lru.New[string](lru.Config[*Thumbnail]{
+			MaxSize: maxBytes,
+			Size:    func(t *Thumbnail) int64 { return int64(len(t.Data)) },
+		}),
+	}
+}
+
+// Key returns the cache key for an attachment thumbnail of a given size
+func Key(attachmentID uuid.UUID, size int) string {
+	return fmt.Sprintf("%s:%d", attachmentID, size)
+}
+
+// NormalizeSize maps a requested size to the nearest allowed size not below it
+func NormalizeSize(size int) int {
+	if size <= 0 {
+		return DefaultSize
+	}
+	for _, s := range Sizes {
+		if size <= s {
+			return s
+		}
+	}
+	return Sizes[len(Sizes)-1]
+}
+
+// Get returns a cached thumbnail
+func (c *Cache) Get(key string) (*Thumbnail, bool) {
+	thumbnail, ok := c.entries.Get(key)
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+
+	c.hits.Add(1)
+	return thumbnail, true
+}
+
+// Add stores a thumbnail, evicting the least recently used entries to stay
+// within the size bound. Thumbnails larger than the whole cache are not stored.
+func (c *Cache) Add(key string, thumbnail *Thumbnail) {
+	c.entries.Add(key, thumbnail)
+}
+
+// Remove drops every cached size of an attachment's thumbnail
+func (c *Cache) Remove(attachmentID uuid.UUID) {
+	for _, size := range Sizes {
+		c.entries.Remove(Key(attachmentID, size))
+	}
+}
+
+// GetOrGenerate returns a cached thumbnail or generates and caches it on a miss
+func (c *Cache) GetOrGenerate(key string, generate func() (*Thumbnail, error)) (*Thumbnail, error) {
+	if thumbnail, ok := c.Get(key); ok {
+		return thumbnail, nil
+	}
+
+	thumbnail, err := generate()
+	if err != nil {
+		return nil, err
+	}
+
+	c.Add(key, thumbnail)
+	return thumbnail, nil
+}
+
+// Stats returns the cache's hit/miss counters and current size
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: c.entries.Len(),
+		Bytes:   c.entries.Size(),
+	}
+}
+
+// Generate decodes an image and scales it to fit within a size x size box.
+// Images with transparency are encoded as PNG, everything else as JPEG.
+func Generate(r io.Reader, size int) (*Thumbnail, error) {
+	src, format, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	dst := scale(src, size)
+
+	var buf bytes.Buffer
+	if format == "png" || format == "gif" {
+		if err := png.Encode(&buf, dst); err != nil {
+			return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+		}
+		return &Thumbnail{Data: buf.Bytes(), ContentType: "image/png"}, nil
+	}
+
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return &Thumbnail{Data: buf.Bytes(), ContentType: "image/jpeg"}, nil
+}
+
+// scale downsamples an image to fit within a size x size box by averaging
+// the source pixels covered by each destination pixel
+func scale(src image.Image, size int) image.Image {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	if srcW <= size && srcH <= size {
+		return src
+	}
+
+	dstW, dstH := size, size
+	if srcW > srcH {
+		dstH = max(1, srcH*size/srcW)
+	} else {
+		dstW = max(1, srcW*size/srcH)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := bounds.Min.Y + y*srcH/dstH
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcH/dstH)
+		for x := 0; x < dstW; x++ {
+			x0 := bounds.Min.X + x*srcW/dstW
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcW/dstW)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
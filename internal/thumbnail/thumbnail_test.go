@@ -0,0 +1,193 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func thumb(n int) *Thumbnail {
+	return &Thumbnail{Data: make([]byte, n), ContentType: "image/png"}
+}
+
+func TestGetOrGenerateServesRepeatsFromCache(t *testing.T) {
+	c := NewCache(1 << 20)
+	key := Key(uuid.New(), 128)
+
+	generated := 0
+	generate := func() (*Thumbnail, error) {
+		generated++
+		return thumb(10), nil
+	}
+
+	first, err := c.GetOrGenerate(key, generate)
+	if err != nil {
+		t.Fatalf("GetOrGenerate: %v", err)
+	}
+	second, err := c.GetOrGenerate(key, generate)
+	if err != nil {
+		t.Fatalf("GetOrGenerate: %v", err)
+	}
+
+	if generated != 1 {
+		t.Errorf("generated %d times, want 1", generated)
+	}
+	if first != second {
+		t.Error("second request returned a different thumbnail")
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 || stats.Bytes != 10 {
+		t.Errorf("stats = %+v, want 1 hit, 1 miss, 1 entry of 10 bytes", stats)
+	}
+}
+
+func TestGetOrGenerateDoesNotCacheErrors(t *testing.T) {
+	c := NewCache(1 << 20)
+	key := Key(uuid.New(), 64)
+
+	if _, err := c.GetOrGenerate(key, func() (*Thumbnail, error) { return nil, errors.New("bad image") }); err == nil {
+		t.Fatal("GetOrGenerate returned no error")
+	}
+	got, err := c.GetOrGenerate(key, func() (*Thumbnail, error) { return thumb(5), nil })
+	if err != nil || len(got.Data) != 5 {
+		t.Errorf("retry after error = %v, %v; want the regenerated thumbnail", got, err)
+	}
+}
+
+func TestKeyIncludesAttachmentAndSize(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if Key(a, 64) == Key(a, 128) {
+		t.Error("sizes of one attachment share a key")
+	}
+	if Key(a, 64) == Key(b, 64) {
+		t.Error("attachments share a key")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewCache(30)
+	a, b, d := Key(uuid.New(), 64), Key(uuid.New(), 64), Key(uuid.New(), 64)
+
+	c.Add(a, thumb(10))
+	c.Add(b, thumb(10))
+	c.Get(a) // a is now more recently used than b
+	c.Add(d, thumb(15))
+
+	if _, ok := c.Get(b); ok {
+		t.Error("least recently used entry was kept")
+	}
+	if _, ok := c.Get(a); !ok {
+		t.Error("recently used entry was evicted")
+	}
+	if _, ok := c.Get(d); !ok {
+		t.Error("newest entry was evicted")
+	}
+	if stats := c.Stats(); stats.Bytes != 25 || stats.Entries != 2 {
+		t.Errorf("stats = %+v, want 2 entries of 25 bytes", stats)
+	}
+}
+
+func TestCacheSkipsOversizedThumbnails(t *testing.T) {
+	c := NewCache(10)
+	c.Add("small", thumb(5))
+	c.Add("big", thumb(11))
+
+	if _, ok := c.Get("big"); ok {
+		t.Error("thumbnail larger than the cache was stored")
+	}
+	if _, ok := c.Get("small"); !ok {
+		t.Error("oversized thumbnail evicted an existing entry")
+	}
+}
+
+func TestCacheReplaceUpdatesSize(t *testing.T) {
+	c := NewCache(100)
+	c.Add("k", thumb(40))
+	c.Add("k", thumb(10))
+
+	if stats := c.Stats(); stats.Bytes != 10 || stats.Entries != 1 {
+		t.Errorf("stats = %+v, want 1 entry of 10 bytes", stats)
+	}
+}
+
+func TestRemoveDropsEverySize(t *testing.T) {
+	c := NewCache(1 << 20)
+	id, other := uuid.New(), uuid.New()
+	for _, size := range Sizes {
+		c.Add(Key(id, size), thumb(1))
+	}
+	c.Add(Key(other, 64), thumb(1))
+
+	c.Remove(id)
+
+	for _, size := range Sizes {
+		if _, ok := c.Get(Key(id, size)); ok {
+			t.Errorf("size %d still cached after Remove", size)
+		}
+	}
+	if _, ok := c.Get(Key(other, 64)); !ok {
+		t.Error("Remove dropped another attachment's thumbnail")
+	}
+	if stats := c.Stats(); stats.Bytes != 1 {
+		t.Errorf("bytes = %d, want 1", stats.Bytes)
+	}
+}
+
+func TestNormalizeSize(t *testing.T) {
+	tests := []struct{ in, want int }{
+		{0, DefaultSize},
+		{-5, DefaultSize},
+		{1, 64},
+		{64, 64},
+		{65, 128},
+		{300, 512},
+		{4096, 512},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSize(tt.in); got != tt.want {
+			t.Errorf("NormalizeSize(%d) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateScalesToFit(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			src.Set(x, y, color.RGBA{R: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Generate(&buf, 100)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if got.ContentType != "image/png" {
+		t.Errorf("content type = %q, want image/png", got.ContentType)
+	}
+
+	img, err := png.Decode(bytes.NewReader(got.Data))
+	if err != nil {
+		t.Fatalf("decoding thumbnail: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 100 || b.Dy() != 50 {
+		t.Errorf("thumbnail is %dx%d, want 100x50", b.Dx(), b.Dy())
+	}
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 != 200 {
+		t.Errorf("red channel = %d, want 200", r>>8)
+	}
+}
+
+func TestGenerateRejectsNonImages(t *testing.T) {
+	if _, err := Generate(bytes.NewReader([]byte("not an image")), 64); err == nil {
+		t.Error("Generate accepted a non-image")
+	}
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// backplaneChannelPrefix prefixes the Redis channel for each chat room
+const backplaneChannelPrefix = "llamachat:room:"
+
+// backplanePublishTimeout bounds how long delivery waits on Redis
+const backplanePublishTimeout = time.Second
+
+// backplaneEnvelope carries a broadcast between server instances
+type backplaneEnvelope struct {
+	// Node is the instance that published the broadcast
+	Node string `json:"node"`
+	// ClientID is the sending client, which doesn't receive its own message
+	ClientID string    `json:"client_id,omitempty"`
+	ChatID   uuid.UUID `json:"chat_id"`
+	// UserIDs targets specific users instead of the room's subscribers
+	UserIDs []uuid.UUID `json:"user_ids,omitempty"`
+	Message []byte      `json:"message"`
+}
+
+// UseBackplane relays broadcasts through Redis pub/sub so clients connected
+// to other server instances receive them too. Each instance delivers its own
+// broadcasts locally and ignores them when they come back from Redis. It must
+// be called before the hub starts running.
+func (h *Hub) UseBackplane(rdb *redis.Client) {
+	h.redis = rdb
+	h.nodeID = uuid.New().String()
+
+	pubsub := rdb.PSubscribe(context.Background(), backplaneChannelPrefix+"*")
+	go h.receiveBackplane(pubsub)
+
+	log.Info().Str("node_id", h.nodeID).Msg("WebSocket hub using Redis backplane")
+}
+
+// publishBackplane sends a broadcast to the other instances, if a backplane
+// is configured
+func (h *Hub) publishBackplane(envelope *backplaneEnvelope) {
+	if h.redis == nil {
+		return
+	}
+
+	envelope.Node = h.nodeID
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal backplane message")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), backplanePublishTimeout)
+	defer cancel()
+
+	if err := h.redis.Publish(ctx, backplaneChannelPrefix+envelope.ChatID.String(), data).Err(); err != nil {
+		log.Error().Err(err).Str("chat_id", envelope.ChatID.String()).Msg("Failed to publish to backplane")
+	}
+}
+
+// receiveBackplane delivers broadcasts published by other instances to this
+// instance's clients
+func (h *Hub) receiveBackplane(pubsub *redis.PubSub) {
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var envelope backplaneEnvelope
+		if err := json.Unmarshal([]byte(msg.Payload), &envelope); err != nil {
+			log.Error().Err(err).Str("channel", msg.Channel).Msg("Invalid backplane message")
+			continue
+		}
+
+		// This instance already delivered its own broadcasts
+		if envelope.Node == h.nodeID {
+			continue
+		}
+
+		h.mu.RLock()
+		if len(envelope.UserIDs) > 0 {
+			h.sendToUsers(envelope.UserIDs, envelope.Message)
+		} else {
+			h.sendToRoom(envelope.ChatID, envelope.ClientID, envelope.Message)
+		}
+		h.mu.RUnlock()
+	}
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// broadcastChunkSize is how many clients a broadcast delivers to before
+// letting go of the hub lock, so registrations aren't held up by large rooms
+const broadcastChunkSize = 256
+
+// queueBroadcast hands a client's broadcast to its room's fan-out worker,
+// dropping it if the worker stays backed up
+func (h *Hub) queueBroadcast(broadcast *Broadcast) {
+	if err := h.fanout.enqueue(broadcast); err != nil {
+		log.Warn().Err(err).Str("chat_id", broadcast.ChatID.String()).Msg("Dropping broadcast")
+	}
+}
+
+// broadcastMessage delivers a message to the clients subscribed to its chat
+// room, other than the sender. The room is delivered to in chunks, taking the
+// hub lock for each, so a large room doesn't block other hub operations for
+// the whole broadcast.
+func (h *Hub) broadcastMessage(broadcast *Broadcast) {
+	h.mu.RLock()
+	recipients := make([]*Client, 0, len(h.rooms[broadcast.ChatID]))
+	for id, client := range h.rooms[broadcast.ChatID] {
+		if id != broadcast.ClientID {
+			recipients = append(recipients, client)
+		}
+	}
+	h.mu.RUnlock()
+
+	for start := 0; start < len(recipients); start += broadcastChunkSize {
+		end := start + broadcastChunkSize
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+
+		h.mu.RLock()
+		for _, client := range recipients[start:end] {
+			// Clients that disconnected since the snapshot have a closed
+			// send channel
+			if h.clients[client.ID] != client {
+				continue
+			}
+			select {
+			case client.Send <- broadcast.Message:
+			default:
+				log.Warn().Str("client_id", client.ID).Msg("Client send buffer full, dropping message")
+				h.recordMissed(client, broadcast.Message)
+			}
+		}
+		h.mu.RUnlock()
+	}
+
+	h.publishBackplane(&backplaneEnvelope{
+		ClientID: broadcast.ClientID,
+		ChatID:   broadcast.ChatID,
+		Message:  broadcast.Message,
+	})
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRegistrationNotBlockedByLargeBroadcast(t *testing.T) {
+	const members, broadcasts = 2000, 200
+
+	h := NewHub(HubConfig{Fanout: FanoutConfig{Workers: 1, QueueSize: broadcasts}}, nil)
+	chatID := uuid.New()
+	room := make([]*Client, members)
+	for i := range room {
+		room[i] = NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, nil)
+		// Room enough for every broadcast, so none are dropped
+		room[i].Send = make(chan []byte, broadcasts+8)
+		// Added directly, since join events to a room this size would
+		// swamp the test
+		h.clients[room[i].ID] = room[i]
+		h.subscribe(room[i], chatID)
+	}
+	runHub(t, h)
+
+	sender := uuid.NewString()
+	for i := 0; i < broadcasts; i++ {
+		h.Broadcast <- &Broadcast{ChatID: chatID, ClientID: sender, Message: []byte(fmt.Sprintf(`{"type":"message","payload":%d}`, i))}
+	}
+
+	newcomer := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, nil)
+	select {
+	case h.Register <- newcomer:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't accept a registration while broadcasts were queued")
+	}
+	for registered := false; !registered; {
+		h.mu.RLock()
+		registered = h.clients[newcomer.ID] == newcomer
+		h.mu.RUnlock()
+	}
+	// The member furthest behind shows whether delivery had finished
+	last := room[0]
+	for _, c := range room {
+		if len(c.Send) < len(last.Send) {
+			last = c
+		}
+	}
+	if delivered := len(last.Send); delivered == broadcasts {
+		t.Errorf("registration waited for all %d broadcasts to be delivered", broadcasts)
+	}
+
+	// Every member still gets every broadcast, in the order sent
+	checked := []*Client{last}
+	if last != room[0] {
+		checked = append(checked, room[0])
+	}
+	for _, c := range checked {
+		for i := 0; i < broadcasts; i++ {
+			var msg Message
+			select {
+			case data := <-c.Send:
+				if err := json.Unmarshal(data, &msg); err != nil {
+					t.Fatalf("invalid JSON %q: %v", data, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("only %d of %d broadcasts delivered", i, broadcasts)
+			}
+			var n int
+			if err := json.Unmarshal(msg.Payload, &n); err != nil || n != i {
+				t.Fatalf("broadcast %d arrived as %s", i, msg.Payload)
+			}
+		}
+	}
+}
+
+func TestBroadcastsSkipSenderAndDepartedClients(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	chatID := uuid.New()
+	// More members than a delivery chunk, so every chunk is exercised
+	room := make([]*Client, broadcastChunkSize+10)
+	for i := range room {
+		room[i] = connect(h, uuid.New(), chatID)
+	}
+	for _, c := range room {
+		events(t, c)
+	}
+	sender, departed := room[0], room[len(room)-1]
+	h.unregisterClient(departed)
+
+	h.broadcastMessage(&Broadcast{ChatID: chatID, ClientID: sender.ID, Message: []byte(`{"type":"message"}`)})
+
+	if got := ofType(events(t, sender), "message"); len(got) != 0 {
+		t.Errorf("sender got its own broadcast")
+	}
+	for _, c := range room[1 : len(room)-1] {
+		if got := ofType(events(t, c), "message"); len(got) != 1 {
+			t.Fatalf("member got %d broadcasts, want 1", len(got))
+		}
+	}
+}
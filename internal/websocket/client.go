@@ -1,13 +1,22 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/middleware"
+	"github.com/llamasearch/llamachat/internal/models"
 )
 
 // Event types
@@ -16,8 +25,17 @@ const (
 	EventTypeUserJoin    = "user_join"
 	EventTypeUserLeave   = "user_leave"
 	EventTypeTyping      = "typing"
+	EventTypeTypingStop  = "typing_stop"
 	EventTypeReadReceipt = "read_receipt"
+	EventTypePresence    = "presence"
+	EventTypeSubscribe   = "subscribe"
+	EventTypeUnsubscribe = "unsubscribe"
 	EventTypeError       = "error"
+	EventTypeResync      = "resync"
+	EventTypeHello       = "hello"
+	// EventTypeMemberLeave is sent when a user leaves or is removed from a
+	// chat, unlike EventTypeUserLeave which only means they disconnected
+	EventTypeMemberLeave = "member_leave"
 )
 
 // Message represents a WebSocket message
@@ -38,6 +56,30 @@ type Client struct {
 	IsActive bool
 	JoinedAt time.Time
 	UserInfo UserInfo
+
+	// Presence reported by this connection, guarded by mu
+	presence      string
+	lastHeartbeat time.Time
+
+	// Chat rooms this connection is subscribed to, guarded by Hub.mu
+	rooms map[uuid.UUID]bool
+
+	// Rate limits on the chat messages and typing events this connection sends
+	messageLimit *middleware.TokenBucket
+	typingLimit  *middleware.TokenBucket
+
+	// store serves read receipts and replay
+	store database.Store
+	// messages creates the chat messages sent over the socket
+	messages MessageSender
+
+	// shutdown is closed by the hub when it shuts down, which takes the
+	// place of closing Send
+	shutdown chan struct{}
+
+	// When set, messages in replayChats after this one are replayed on connect
+	replaySince *uuid.UUID
+	replayChats []uuid.UUID
 }
 
 // UserInfo represents basic user information
@@ -47,27 +89,62 @@ type UserInfo struct {
 	AvatarURL   string `json:"avatar_url"`
 }
 
+// MessageSender creates chat messages sent over the socket. It is the same
+// path the REST API takes, so both apply the same checks and deliver the
+// message the same way.
+type MessageSender interface {
+	SendMessage(ctx context.Context, message *models.Message) error
+}
+
+// RejectedError is returned by a MessageSender for a message that can't be
+// sent as it is. Its reason is shown to the sender.
+type RejectedError struct {
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return e.Reason
+}
+
+// ChatMessagePayload is sent by clients to post a message to a chat
+type ChatMessagePayload struct {
+	ChatID           uuid.UUID  `json:"chat_id"`
+	Content          string     `json:"content"`
+	ContentEncrypted bool       `json:"content_encrypted"`
+	ReplyTo          *uuid.UUID `json:"reply_to"`
+}
+
 // NewClient creates a new WebSocket client
-func NewClient(id string, userID uuid.UUID, socket *websocket.Conn, hub *Hub, userInfo UserInfo) *Client {
+func NewClient(id string, userID uuid.UUID, socket *websocket.Conn, hub *Hub, userInfo UserInfo, store database.Store, messages MessageSender) *Client {
+	now := time.Now()
 	return &Client{
-		ID:       id,
-		UserID:   userID,
-		Socket:   socket,
-		Hub:      hub,
-		Send:     make(chan []byte, 256),
-		IsActive: true,
-		JoinedAt: time.Now(),
-		UserInfo: userInfo,
+		ID:            id,
+		UserID:        userID,
+		Socket:        socket,
+		Hub:           hub,
+		Send:          make(chan []byte, 256),
+		IsActive:      true,
+		JoinedAt:      now,
+		UserInfo:      userInfo,
+		presence:      PresenceActive,
+		lastHeartbeat: now,
+		rooms:         make(map[uuid.UUID]bool),
+		store:         store,
+		messages:      messages,
+		shutdown:      make(chan struct{}),
+		messageLimit:  middleware.NewTokenBucket(hub.config.MessagesPerMinute),
+		typingLimit:   middleware.NewTokenBucket(hub.config.TypingPerMinute),
 	}
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.Unregister <- c
+		c.Hub.unregister(c)
 		c.Socket.Close()
 	}()
 
+	pongWait := c.Hub.config.pongWait()
 	c.Socket.SetReadLimit(maxMessageSize)
 	c.Socket.SetReadDeadline(time.Now().Add(pongWait))
 	c.Socket.SetPongHandler(func(string) error {
@@ -75,6 +152,10 @@ func (c *Client) ReadPump() {
 		return nil
 	})
 
+	if c.replaySince != nil {
+		c.replay(*c.replaySince, c.replayChats)
+	}
+
 	for {
 		_, message, err := c.Socket.ReadMessage()
 		if err != nil {
@@ -91,10 +172,11 @@ func (c *Client) ReadPump() {
 
 // WritePump pumps messages from the hub to the WebSocket connection
 func (c *Client) WritePump() {
-	ticker := time.NewTicker(pingPeriod)
+	ticker := time.NewTicker(c.Hub.config.PingInterval)
 	defer func() {
 		ticker.Stop()
 		c.Socket.Close()
+		c.Hub.writers.Done()
 	}()
 
 	for {
@@ -107,27 +189,36 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			w, err := c.Socket.NextWriter(websocket.TextMessage)
-			if err != nil {
+			if err := c.Socket.WriteMessage(websocket.TextMessage, message); err != nil {
 				return
 			}
-			w.Write(message)
 
-			// Add queued messages to the current WebSocket message
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.Send)
-			}
-
-			if err := w.Close(); err != nil {
-				return
+			// Flush whatever else is queued, one frame per event, up to the
+			// batch size so pings still go out during a burst
+		drain:
+			for i := 1; i < c.Hub.config.WriteBatchSize; i++ {
+				select {
+				case message, ok := <-c.Send:
+					if !ok {
+						c.Socket.WriteMessage(websocket.CloseMessage, []byte{})
+						return
+					}
+					c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+					if err := c.Socket.WriteMessage(websocket.TextMessage, message); err != nil {
+						return
+					}
+				default:
+					break drain
+				}
 			}
 		case <-ticker.C:
 			c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Socket.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+		case <-c.shutdown:
+			c.drainAndClose()
+			return
 		}
 	}
 }
@@ -141,51 +232,74 @@ func (c *Client) processMessage(data []byte) {
 		return
 	}
 
-	// Process message based on type
+	// Process message based on type. Over the rate limit, the event is
+	// dropped but the connection stays open.
 	switch msg.Type {
 	case EventTypeMessage:
+		if !c.messageLimit.Allow() {
+			c.sendError("Rate limit exceeded, message not sent")
+			return
+		}
 		c.handleChatMessage(msg.Payload)
 	case EventTypeTyping:
+		if !c.typingLimit.Allow() {
+			c.sendError("Rate limit exceeded, typing event dropped")
+			return
+		}
 		c.handleTypingEvent(msg.Payload)
+	case EventTypeTypingStop:
+		c.handleTypingStop(msg.Payload)
 	case EventTypeReadReceipt:
 		c.handleReadReceipt(msg.Payload)
+	case EventTypePresence:
+		c.handlePresence(msg.Payload)
+	case EventTypeSubscribe:
+		c.handleSubscribe(msg.Payload)
+	case EventTypeUnsubscribe:
+		c.handleUnsubscribe(msg.Payload)
 	default:
 		log.Warn().Str("type", msg.Type).Str("client_id", c.ID).Msg("Unknown message type")
 		c.sendError("Unknown message type")
 	}
 }
 
-// handleChatMessage processes chat messages
+// handleChatMessage sends a chat message through the MessageSender, which
+// saves it and delivers it, sender included, to the chat's members
 func (c *Client) handleChatMessage(payload json.RawMessage) {
-	// Parse message payload and validate
-	// In a real implementation, this would save to the database and broadcast to other clients
-
-	// Example:
-	// 1. Parse the payload to get chatID and message content
-	// 2. Validate that the user has access to the chat
-	// 3. Save the message to the database
-	// 4. Broadcast the message to all clients subscribed to the chat
-
-	// For now, just broadcast to all clients
-	c.Hub.Broadcast <- &Broadcast{
-		ClientID: c.ID,
-		Message:  payload,
+	var req ChatMessagePayload
+	if err := json.Unmarshal(payload, &req); err != nil || req.ChatID == uuid.Nil {
+		c.sendError("Invalid message payload")
+		return
 	}
-}
+	if strings.TrimSpace(req.Content) == "" {
+		c.sendError("Message content is required")
+		return
+	}
+	if max := c.Hub.config.MaxMessageLength; max > 0 && utf8.RuneCountInString(req.Content) > max {
+		c.sendError(fmt.Sprintf("Message must be at most %d characters", max))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
 
-// handleTypingEvent processes typing indicator events
-func (c *Client) handleTypingEvent(payload json.RawMessage) {
-	// Broadcast typing event to appropriate recipients
-	c.Hub.Broadcast <- &Broadcast{
-		ClientID: c.ID,
-		Message:  payload,
+	userID := c.UserID
+	message := &models.Message{
+		ID:               uuid.New(),
+		ChatID:           req.ChatID,
+		UserID:           &userID,
+		Content:          req.Content,
+		ContentEncrypted: req.ContentEncrypted,
+		ReplyTo:          req.ReplyTo,
 	}
-}
 
-// handleReadReceipt processes read receipt events
-func (c *Client) handleReadReceipt(payload json.RawMessage) {
-	// Process read receipt (mark messages as read in database)
-	// Broadcast read receipts to appropriate clients
+	var rejected *RejectedError
+	if err := c.messages.SendMessage(ctx, message); errors.As(err, &rejected) {
+		c.sendError(rejected.Reason)
+	} else if err != nil {
+		log.Error().Err(err).Str("client_id", c.ID).Msg("Failed to save WebSocket message")
+		c.sendError("Failed to send message")
+	}
 }
 
 // sendError sends an error message to the client
@@ -202,7 +316,11 @@ func (c *Client) sendError(errMsg string) {
 		return
 	}
 
-	c.Send <- data
+	// Once the connection is shutting down nothing reads Send
+	select {
+	case c.Send <- data:
+	case <-c.shutdown:
+	}
 }
 
 // Constants for WebSocket connection
@@ -210,16 +328,9 @@ const (
 	// Time allowed to write a message to the peer
 	writeWait = 10 * time.Second
 
-	// Time allowed to read the next pong message from the peer
-	pongWait = 60 * time.Second
-
-	// Send pings to peer with this period (must be less than pongWait)
-	pingPeriod = (pongWait * 9) / 10
+	// Send pings to peer with this period when none is configured
+	defaultPingInterval = 54 * time.Second
 
 	// Maximum message size allowed from peer
 	maxMessageSize = 8192
 )
-
-var (
-	newline = []byte{'\n'}
-)
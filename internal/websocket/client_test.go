@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+// dialPair opens a real WebSocket connection, returning the server end, for
+// a Client, and the dialing end, for the test to read from
+func dialPair(t *testing.T) (server, peer *websocket.Conn) {
+	t.Helper()
+
+	accepted := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		accepted <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { peer.Close() })
+
+	select {
+	case server = <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("server never accepted the connection")
+	}
+	return server, peer
+}
+
+func TestWritePumpSendsOneFramePerEvent(t *testing.T) {
+	const queued = 50
+
+	h := NewHub(HubConfig{WriteBatchSize: 8}, nil)
+	server, peer := dialPair(t)
+	c := NewClient(uuid.NewString(), uuid.New(), server, h, UserInfo{}, nil, nil)
+
+	// Queue a burst before the pump starts, so it finds many events waiting
+	for i := 0; i < queued; i++ {
+		payload, _ := json.Marshal(map[string]int{"seq": i})
+		data, _ := json.Marshal(Message{Type: EventTypeMessage, Payload: payload})
+		c.Send <- data
+	}
+	close(c.Send)
+
+	h.writers.Add(1)
+	go c.WritePump()
+
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < queued; i++ {
+		kind, data, err := peer.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading frame %d: %v", i, err)
+		}
+		if kind != websocket.TextMessage {
+			t.Fatalf("frame %d is of type %d, want text", i, kind)
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("frame %d is not a single JSON event: %v (%q)", i, err, data)
+		}
+		var payload struct{ Seq int }
+		json.Unmarshal(msg.Payload, &payload)
+		if payload.Seq != i {
+			t.Fatalf("frame %d carries event %d, want events in order", i, payload.Seq)
+		}
+	}
+
+	// The closed queue ends the connection with a close frame
+	if _, _, err := peer.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure) {
+		t.Errorf("after the queue closed: %v, want a close frame", err)
+	}
+}
+
+func TestClientMessageLengthLimit(t *testing.T) {
+	h := NewHub(HubConfig{MaxMessageLength: 4}, nil)
+	sent := &sentMessages{}
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, sent)
+	chatID := uuid.New()
+
+	sendEvent(t, c, EventTypeMessage, ChatMessagePayload{ChatID: chatID, Content: "ñaña"})
+	if len(sent.contents) != 1 {
+		t.Fatalf("4-character message (6 bytes) not sent with a limit of 4")
+	}
+
+	sendEvent(t, c, EventTypeMessage, ChatMessagePayload{ChatID: chatID, Content: "ñañas"})
+	if len(sent.contents) != 1 {
+		t.Errorf("5-character message sent with a limit of 4")
+	}
+	errs := ofType(events(t, c), EventTypeError)
+	if len(errs) != 1 || !strings.Contains(string(errs[0].Payload), "at most 4 characters") {
+		t.Errorf("errors = %v, want one naming the limit", errs)
+	}
+}
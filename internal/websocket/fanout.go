@@ -0,0 +1,205 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// ErrFanoutQueueFull is returned when a room's delivery queue stays full for
+// longer than the enqueue timeout
+var ErrFanoutQueueFull = errors.New("broadcast queue is full")
+
+// ErrFanoutStopped is returned when publishing after the fan-out has stopped
+var ErrFanoutStopped = errors.New("broadcast fan-out is stopped")
+
+// FanoutConfig holds broadcast fan-out configuration
+type FanoutConfig struct {
+	// Workers is the number of delivery goroutines. Each room is always served
+	// by the same worker, which keeps its events in order.
+	Workers int
+	// QueueSize is the number of pending events each worker buffers
+	QueueSize int
+	// EnqueueTimeout is how long Publish waits for space in a full queue
+	// before giving up
+	EnqueueTimeout time.Duration
+}
+
+// Fanout delivers room events to the clients subscribed to the room on a
+// bounded pool of workers so that publishers don't wait on delivery. Each hub
+// has one, which carries both the events the server publishes and those
+// clients send.
+type Fanout struct {
+	hub    *Hub
+	config FanoutConfig
+	queues []chan *Broadcast
+
+	mu      sync.RWMutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// NewFanout creates a fan-out and starts its workers
+func NewFanout(config FanoutConfig, hub *Hub) *Fanout {
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = 256
+	}
+	if config.EnqueueTimeout <= 0 {
+		config.EnqueueTimeout = 100 * time.Millisecond
+	}
+
+	f := &Fanout{
+		hub:    hub,
+		config: config,
+		queues: make([]chan *Broadcast, config.Workers),
+	}
+
+	for i := range f.queues {
+		f.queues[i] = make(chan *Broadcast, config.QueueSize)
+		f.wg.Add(1)
+		go f.work(f.queues[i])
+	}
+
+	return f
+}
+
+// Publish queues an event for delivery to the clients subscribed to a room.
+// It returns once the event is queued, not when it is delivered.
+func (f *Fanout) Publish(roomID uuid.UUID, eventType string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+	data, err := json.Marshal(Message{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Payload:   body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	return f.enqueue(&Broadcast{ChatID: roomID, Message: data})
+}
+
+// enqueue hands a broadcast to its room's worker, waiting up to the enqueue
+// timeout for space in a full queue
+func (f *Fanout) enqueue(job *Broadcast) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	if f.stopped {
+		return ErrFanoutStopped
+	}
+
+	queue := f.queues[roomQueueIndex(job.ChatID, len(f.queues))]
+
+	select {
+	case queue <- job:
+		return nil
+	default:
+	}
+
+	// The queue is full; wait briefly for the worker to catch up
+	timer := time.NewTimer(f.config.EnqueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case queue <- job:
+		return nil
+	case <-timer.C:
+		return ErrFanoutQueueFull
+	}
+}
+
+// Stop stops accepting events and waits for queued events to be delivered,
+// or for ctx to be done. Events still queued when ctx is done are delivered
+// in the background.
+func (f *Fanout) Stop(ctx context.Context) error {
+	f.mu.Lock()
+	if !f.stopped {
+		f.stopped = true
+		for _, queue := range f.queues {
+			close(queue)
+		}
+	}
+	f.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// roomQueueIndex picks the worker for a room
+func roomQueueIndex(roomID uuid.UUID, workers int) int {
+	h := fnv.New32a()
+	h.Write(roomID[:])
+	return int(h.Sum32() % uint32(workers))
+}
+
+// work delivers events from a queue in order
+func (f *Fanout) work(queue chan *Broadcast) {
+	defer f.wg.Done()
+
+	for job := range queue {
+		f.hub.broadcastMessage(job)
+	}
+}
+
+// SendToUsers sends a room event to every connection of the given users,
+// including those connected to other instances through the backplane.
+// Clients whose send buffer is full miss the message rather than blocking
+// delivery to everyone else. roomID is the chat the event belongs to, or
+// the DM conversation for direct message events.
+func (h *Hub) SendToUsers(roomID uuid.UUID, userIDs []uuid.UUID, data []byte) {
+	h.mu.RLock()
+	h.sendToUsers(userIDs, data)
+	h.mu.RUnlock()
+
+	h.publishBackplane(&backplaneEnvelope{
+		ChatID:  roomID,
+		UserIDs: userIDs,
+		Message: data,
+	})
+}
+
+// sendToUsers delivers data to this instance's connections of the given
+// users. The caller must hold h.mu.
+func (h *Hub) sendToUsers(userIDs []uuid.UUID, data []byte) {
+	recipients := make(map[uuid.UUID]bool, len(userIDs))
+	for _, userID := range userIDs {
+		if recipients[userID] {
+			continue
+		}
+		recipients[userID] = true
+
+		for id := range h.userClients[userID] {
+			client := h.clients[id]
+			select {
+			case client.Send <- data:
+			default:
+				log.Warn().Str("client_id", id).Msg("Client send buffer full, dropping message")
+				h.recordMissed(client, data)
+			}
+		}
+	}
+}
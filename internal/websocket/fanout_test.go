@@ -0,0 +1,206 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// holdDelivery blocks fan-out workers, like a large room holding up
+// delivery, until the returned function is called
+func holdDelivery(h *Hub) (release func()) {
+	h.mu.Lock()
+	var once sync.Once
+	return func() { once.Do(h.mu.Unlock) }
+}
+
+// waitTaken waits until a worker has taken everything from its queue
+func waitTaken(t *testing.T, queue chan *Broadcast) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for len(queue) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("worker never took the queued event")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPublishDoesNotWaitForDelivery(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	chatID := uuid.New()
+	c := connect(h, uuid.New(), chatID)
+	events(t, c)
+
+	f := NewFanout(FanoutConfig{Workers: 1}, h)
+	t.Cleanup(func() { f.Stop(context.Background()) })
+	release := holdDelivery(h)
+	t.Cleanup(release)
+
+	start := time.Now()
+	if err := f.Publish(chatID, EventTypeMessage, map[string]string{"content": "hi"}); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("Publish took %v while delivery was blocked", elapsed)
+	}
+
+	// Delivery is underway but still blocked, so nothing has arrived yet
+	waitTaken(t, f.queues[0])
+	if n := len(c.Send); n != 0 {
+		t.Fatalf("client got %d events before delivery finished", n)
+	}
+
+	release()
+	waitForEvent(t, c, EventTypeMessage, time.Second)
+}
+
+func TestFanoutPreservesRoomOrder(t *testing.T) {
+	const perRoom = 100
+	h := NewHub(HubConfig{}, nil)
+	rooms := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	c := connect(h, uuid.New(), rooms...)
+	c.Send = make(chan []byte, 4*perRoom)
+	events(t, c)
+
+	f := NewFanout(FanoutConfig{Workers: 4}, h)
+
+	type event struct {
+		Room uuid.UUID `json:"room"`
+		Seq  int       `json:"seq"`
+	}
+	for seq := 0; seq < perRoom; seq++ {
+		for _, room := range rooms {
+			if err := f.Publish(room, EventTypeMessage, event{Room: room, Seq: seq}); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+		}
+	}
+	f.Stop(context.Background())
+
+	next := make(map[uuid.UUID]int)
+	for _, msg := range events(t, c) {
+		var e event
+		if err := json.Unmarshal(msg.Payload, &e); err != nil {
+			t.Fatalf("invalid payload: %v", err)
+		}
+		if e.Seq != next[e.Room] {
+			t.Fatalf("room %s: got event %d, want %d", e.Room, e.Seq, next[e.Room])
+		}
+		next[e.Room]++
+	}
+	for _, room := range rooms {
+		if next[room] != perRoom {
+			t.Errorf("room %s: got %d events, want %d", room, next[room], perRoom)
+		}
+	}
+}
+
+func TestPublishBackpressure(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	f := NewFanout(FanoutConfig{Workers: 1, QueueSize: 1, EnqueueTimeout: 20 * time.Millisecond}, h)
+	t.Cleanup(func() { f.Stop(context.Background()) })
+	release := holdDelivery(h)
+	t.Cleanup(release)
+	room := uuid.New()
+
+	// The worker takes the first event and blocks on it; the second fills the queue
+	if err := f.Publish(room, EventTypeMessage, 1); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitTaken(t, f.queues[0])
+	if err := f.Publish(room, EventTypeMessage, 2); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+
+	start := time.Now()
+	err := f.Publish(room, EventTypeMessage, 3)
+	if !errors.Is(err, ErrFanoutQueueFull) {
+		t.Fatalf("err = %v, want ErrFanoutQueueFull", err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("gave up after %v, want to wait the enqueue timeout", elapsed)
+	}
+
+	// Once the worker catches up there is room again
+	release()
+	deadline := time.Now().Add(time.Second)
+	for f.Publish(room, EventTypeMessage, 4) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("queue never drained")
+		}
+	}
+}
+
+func TestFanoutStop(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	chatID := uuid.New()
+	c := connect(h, uuid.New(), chatID)
+	events(t, c)
+
+	f := NewFanout(FanoutConfig{}, h)
+	for i := 0; i < 10; i++ {
+		if err := f.Publish(chatID, EventTypeMessage, i); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+	}
+
+	// Stop delivers what was already queued
+	f.Stop(context.Background())
+	if got := ofType(events(t, c), EventTypeMessage); len(got) != 10 {
+		t.Errorf("delivered %d events before stopping, want 10", len(got))
+	}
+
+	if err := f.Publish(uuid.New(), EventTypeMessage, 0); !errors.Is(err, ErrFanoutStopped) {
+		t.Errorf("Publish after Stop: err = %v, want ErrFanoutStopped", err)
+	}
+	f.Stop(context.Background())
+}
+
+func TestFanoutStopIsBoundedByContext(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	f := NewFanout(FanoutConfig{Workers: 1}, h)
+	release := holdDelivery(h)
+	t.Cleanup(release)
+
+	if err := f.Publish(uuid.New(), EventTypeMessage, 1); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	waitTaken(t, f.queues[0])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := f.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop with delivery held: err = %v, want context.DeadlineExceeded", err)
+	}
+
+	// The held event is still delivered, and a later Stop waits for it
+	release()
+	if err := f.Stop(context.Background()); err != nil {
+		t.Errorf("Stop after releasing delivery: %v", err)
+	}
+}
+
+func TestRoomQueueIndexIsStable(t *testing.T) {
+	used := make(map[int]bool)
+	for i := 0; i < 64; i++ {
+		chatID := uuid.New()
+		idx := roomQueueIndex(chatID, 4)
+		if idx < 0 || idx >= 4 {
+			t.Fatalf("index %d out of range", idx)
+		}
+		if again := roomQueueIndex(chatID, 4); again != idx {
+			t.Fatalf("room moved from worker %d to %d", idx, again)
+		}
+		used[idx] = true
+	}
+	if len(used) < 2 {
+		t.Errorf("64 rooms all went to one worker")
+	}
+}
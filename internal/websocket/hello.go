@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ProtocolVersion is the version of the WebSocket event protocol, bumped on
+// incompatible changes
+const ProtocolVersion = 1
+
+// HelloPayload is the first event sent on every connection. It tells the
+// client how the server will treat the connection so it doesn't have to
+// hardcode it.
+type HelloPayload struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	ClientID        string `json:"client_id"`
+	// PingIntervalMillis is how often the server pings the client
+	PingIntervalMillis int64 `json:"ping_interval_ms"`
+	// PongTimeoutMillis is how long the server waits for a pong before
+	// closing the connection
+	PongTimeoutMillis int64 `json:"pong_timeout_ms"`
+	// MaxMessageSize is the largest frame in bytes the server will read
+	MaxMessageSize int `json:"max_message_size"`
+}
+
+// sendHello queues the hello event. It must be called before the client is
+// registered with the hub, so nothing can be queued ahead of it.
+func (c *Client) sendHello() {
+	payload, err := json.Marshal(HelloPayload{
+		ProtocolVersion:    ProtocolVersion,
+		ClientID:           c.ID,
+		PingIntervalMillis: c.Hub.config.PingInterval.Milliseconds(),
+		PongTimeoutMillis:  c.Hub.config.pongWait().Milliseconds(),
+		MaxMessageSize:     maxMessageSize,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal hello payload")
+		return
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypeHello,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal hello event")
+		return
+	}
+
+	c.Send <- data
+}
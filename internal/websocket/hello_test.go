@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHelloIsFirstFrame(t *testing.T) {
+	h := NewHub(HubConfig{PingInterval: 9 * time.Second}, nil)
+	server, peer := dialPair(t)
+	c := NewClient(uuid.NewString(), uuid.New(), server, h, UserInfo{}, nil, nil)
+	c.rooms[uuid.New()] = true
+
+	// The same order the connection handler uses
+	c.sendHello()
+	h.registerClient(c)
+	c.sendError("queued after registration")
+	close(c.Send)
+	go c.WritePump()
+
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var frames []Message
+	for {
+		_, data, err := peer.ReadMessage()
+		if err != nil {
+			break
+		}
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("invalid frame %q: %v", data, err)
+		}
+		frames = append(frames, msg)
+	}
+	if len(frames) < 2 {
+		t.Fatalf("got %d frames, want the hello and the later error", len(frames))
+	}
+	if frames[0].Type != EventTypeHello {
+		t.Fatalf("first frame is %s, want hello", frames[0].Type)
+	}
+	if last := frames[len(frames)-1]; last.Type != EventTypeError {
+		t.Errorf("last frame is %s, want the error queued after registration", last.Type)
+	}
+
+	var hello HelloPayload
+	if err := json.Unmarshal(frames[0].Payload, &hello); err != nil {
+		t.Fatalf("decoding hello: %v", err)
+	}
+	want := HelloPayload{
+		ProtocolVersion:    ProtocolVersion,
+		ClientID:           c.ID,
+		PingIntervalMillis: 9000,
+		PongTimeoutMillis:  10000,
+		MaxMessageSize:     maxMessageSize,
+	}
+	if hello != want {
+		t.Errorf("hello = %+v, want %+v", hello, want)
+	}
+}
+
+func TestHelloReportsDefaultPingInterval(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, nil)
+
+	c.sendHello()
+	msg := waitForEvent(t, c, EventTypeHello, time.Second)
+
+	var hello HelloPayload
+	if err := json.Unmarshal(msg.Payload, &hello); err != nil {
+		t.Fatalf("decoding hello: %v", err)
+	}
+	if hello.PingIntervalMillis != defaultPingInterval.Milliseconds() {
+		t.Errorf("ping interval = %dms, want the default %dms", hello.PingIntervalMillis, defaultPingInterval.Milliseconds())
+	}
+	// The server allows a pong a little longer than the ping interval
+	if hello.PongTimeoutMillis <= hello.PingIntervalMillis {
+		t.Errorf("pong timeout %dms isn't longer than the ping interval %dms", hello.PongTimeoutMillis, hello.PingIntervalMillis)
+	}
+}
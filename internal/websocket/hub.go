@@ -1,63 +1,232 @@
 package websocket
 
 import (
+	"errors"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/auth"
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/metrics"
 )
 
-// Broadcast represents a message to be broadcast to clients
+// Broadcast represents a message to be broadcast to the clients in a chat room
 type Broadcast struct {
+	// ClientID is the sender, which doesn't receive its own broadcast
 	ClientID string
+	ChatID   uuid.UUID
 	Message  []byte
 }
 
+// defaultPresenceIdleTimeout is used when no idle timeout is configured
+const defaultPresenceIdleTimeout = 5 * time.Minute
+
+// defaultWriteBatchSize is used when no write batch size is configured
+const defaultWriteBatchSize = 64
+
+// Per-connection rate limit defaults
+const (
+	defaultMessagesPerMinute = 30
+	defaultTypingPerMinute   = 120
+)
+
+// HubConfig holds hub configuration
+type HubConfig struct {
+	// PresenceIdleTimeout is how long a connection can go without a presence
+	// heartbeat before it is considered away
+	PresenceIdleTimeout time.Duration
+	// WriteBatchSize is the most queued events a connection writes in one go
+	// before checking for pings again. Each event is still its own frame.
+	WriteBatchSize int
+	// ReadReceiptWindow is how long read receipts for a chat are collected
+	// before they are broadcast as one event
+	ReadReceiptWindow time.Duration
+	// MissedBufferSize is how many undelivered events are kept per user for
+	// when they reconnect
+	MissedBufferSize int
+	// MissedBufferTTL is how long undelivered events are kept
+	MissedBufferTTL time.Duration
+	// MaxReplay is the most missed messages replayed to a reconnecting
+	// client before it is told to reload instead
+	MaxReplay int
+	// MessagesPerMinute limits the chat messages each connection can send
+	MessagesPerMinute int
+	// TypingPerMinute limits each connection's typing events separately,
+	// so they don't use up the message budget
+	TypingPerMinute int
+	// TypingTTL is how long a typing indicator lasts without another typing
+	// event before the room is told the user stopped
+	TypingTTL time.Duration
+	// PingInterval is how often connections are pinged. A connection that
+	// hasn't answered within a little over this long is closed.
+	PingInterval time.Duration
+	// MaxMessageLength caps chat message content, in characters. Zero means
+	// no limit.
+	MaxMessageLength int
+	// Fanout configures the workers delivering room events, both those the
+	// server publishes and those clients send, so a large room doesn't stall
+	// registrations on the Run loop
+	Fanout FanoutConfig
+}
+
+// pongWait is how long to wait for a pong before giving up on a connection
+func (c HubConfig) pongWait() time.Duration {
+	return c.PingInterval * 10 / 9
+}
+
 // Hub maintains the set of active clients and broadcasts messages to them
 type Hub struct {
 	// All registered clients
 	clients map[string]*Client
 
-	// Map of user ID to client ID for efficient lookup
-	userClients map[uuid.UUID]string
+	// IDs of each user's open connections. A user with several devices is
+	// online until the last of them disconnects.
+	userClients map[uuid.UUID]map[string]bool
+
+	// Clients subscribed to each chat room, by client ID
+	rooms map[uuid.UUID]map[string]*Client
+
+	// Chats a user belongs to, for subscriptions
+	roomLookup RoomLookup
+
+	// Optional Redis backplane shared with other instances
+	redis  *redis.Client
+	nodeID string
 
 	// Inbound messages from clients
 	Broadcast chan *Broadcast
 
+	// Delivers room events off the Run loop
+	fanout *Fanout
+
 	// Register requests from clients
 	Register chan *Client
 
 	// Unregister requests from clients
 	Unregister chan *Client
 
+	// Aggregate presence per connected user
+	presence map[uuid.UUID]string
+
+	// Read receipts waiting to be broadcast, by chat and then reader
+	pendingReceipts map[uuid.UUID]map[uuid.UUID]uuid.UUID
+	receiptsMu      sync.Mutex
+
+	// Users typing in each chat
+	typing   map[uuid.UUID]map[uuid.UUID]*typingState
+	typingMu sync.Mutex
+
+	// Events each user's connections were too far behind to take
+	missed   map[uuid.UUID]*missedRing
+	missedMu sync.Mutex
+
+	config HubConfig
+
+	// stop is closed to ask Run to shut down, and done once it has
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+
+	// Write pumps of registered clients, waited on at shutdown
+	writers sync.WaitGroup
+
 	// Mutex for concurrent access to maps
 	mu sync.RWMutex
 }
 
-// NewHub creates a new chat hub
-func NewHub() *Hub {
-	return &Hub{
+// NewHub creates a new chat hub. rooms is used to subscribe clients to their
+// chats when they connect.
+func NewHub(config HubConfig, rooms RoomLookup) *Hub {
+	if config.PresenceIdleTimeout <= 0 {
+		config.PresenceIdleTimeout = defaultPresenceIdleTimeout
+	}
+	if config.WriteBatchSize <= 0 {
+		config.WriteBatchSize = defaultWriteBatchSize
+	}
+	if config.ReadReceiptWindow <= 0 {
+		config.ReadReceiptWindow = defaultReadReceiptWindow
+	}
+	if config.MissedBufferSize <= 0 {
+		config.MissedBufferSize = defaultMissedBufferSize
+	}
+	if config.MissedBufferTTL <= 0 {
+		config.MissedBufferTTL = defaultMissedBufferTTL
+	}
+	if config.MaxReplay <= 0 {
+		config.MaxReplay = defaultMaxReplay
+	}
+	if config.MessagesPerMinute <= 0 {
+		config.MessagesPerMinute = defaultMessagesPerMinute
+	}
+	if config.TypingPerMinute <= 0 {
+		config.TypingPerMinute = defaultTypingPerMinute
+	}
+	if config.TypingTTL <= 0 {
+		config.TypingTTL = defaultTypingTTL
+	}
+	if config.PingInterval <= 0 {
+		config.PingInterval = defaultPingInterval
+	}
+
+	h := &Hub{
 		Broadcast:   make(chan *Broadcast),
 		Register:    make(chan *Client),
 		Unregister:  make(chan *Client),
 		clients:     make(map[string]*Client),
-		userClients: make(map[uuid.UUID]string),
+		userClients: make(map[uuid.UUID]map[string]bool),
+		rooms:       make(map[uuid.UUID]map[string]*Client),
+		roomLookup:  rooms,
+		presence:    make(map[uuid.UUID]string),
+		config:      config,
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+
+		pendingReceipts: make(map[uuid.UUID]map[uuid.UUID]uuid.UUID),
+		missed:          make(map[uuid.UUID]*missedRing),
+		typing:          make(map[uuid.UUID]map[uuid.UUID]*typingState),
 	}
+	h.fanout = NewFanout(config.Fanout, h)
+	return h
 }
 
-// Run starts the hub
+// Fanout returns the hub's fan-out, for publishing events to chat rooms
+func (h *Hub) Fanout() *Fanout {
+	return h.fanout
+}
+
+// Run starts the hub. It returns once Shutdown is called.
 func (h *Hub) Run() {
+	idleTicker := time.NewTicker(h.config.PresenceIdleTimeout / 2)
+	defer idleTicker.Stop()
+	typingTicker := time.NewTicker(h.config.TypingTTL / 2)
+	defer typingTicker.Stop()
+
+	defer close(h.done)
+
 	for {
 		select {
 		case client := <-h.Register:
 			h.registerClient(client)
 		case client := <-h.Unregister:
 			h.unregisterClient(client)
+			h.expireTyping(time.Now(), client.ID)
 		case broadcast := <-h.Broadcast:
-			h.broadcastMessage(broadcast)
+			h.queueBroadcast(broadcast)
+		case now := <-idleTicker.C:
+			h.expireIdlePresence(now)
+			h.pruneMissed(now)
+		case now := <-typingTicker.C:
+			h.expireTyping(now, "")
+		case <-h.stop:
+			h.closeClients()
+			return
 		}
 	}
 }
@@ -68,15 +237,30 @@ func (h *Hub) registerClient(client *Client) {
 	defer h.mu.Unlock()
 
 	h.clients[client.ID] = client
-	h.userClients[client.UserID] = client.ID
+	h.writers.Add(1)
+	metrics.WebSocketClients.Set(float64(len(h.clients)))
+	ids, ok := h.userClients[client.UserID]
+	if !ok {
+		ids = make(map[string]bool)
+		h.userClients[client.UserID] = ids
+	}
+	ids[client.ID] = true
+	for chatID := range client.rooms {
+		h.subscribe(client, chatID)
+	}
+	h.deliverMissed(client)
 
 	log.Info().
 		Str("client_id", client.ID).
 		Str("user_id", client.UserID.String()).
 		Msg("Client registered")
 
-	// Notify other clients of new user
-	h.notifyUserJoin(client)
+	// Notify other clients of new user, unless they were already connected
+	// from another device
+	if len(ids) == 1 {
+		h.notifyUserJoin(client)
+	}
+	h.refreshPresence(client.UserID)
 }
 
 // unregisterClient unregisters a client
@@ -85,8 +269,15 @@ func (h *Hub) unregisterClient(client *Client) {
 	defer h.mu.Unlock()
 
 	if _, ok := h.clients[client.ID]; ok {
+		// Recompute presence while the client's rooms still count as the
+		// user's peers, so the last disconnect reaches them as offline
+		client.mu.Lock()
+		client.presence = PresenceOffline
+		client.mu.Unlock()
+		h.refreshPresence(client.UserID)
+
 		delete(h.clients, client.ID)
-		delete(h.userClients, client.UserID)
+		metrics.WebSocketClients.Set(float64(len(h.clients)))
 		close(client.Send)
 
 		log.Info().
@@ -94,40 +285,29 @@ func (h *Hub) unregisterClient(client *Client) {
 			Str("user_id", client.UserID.String()).
 			Msg("Client unregistered")
 
-		// Notify other clients of user leaving
-		h.notifyUserLeave(client)
-	}
-}
+		// Notify other clients of user leaving once their last connection
+		// is gone
+		ids := h.userClients[client.UserID]
+		delete(ids, client.ID)
+		if len(ids) == 0 {
+			delete(h.userClients, client.UserID)
+			h.notifyUserLeave(client)
+		}
 
-// broadcastMessage broadcasts a message to all clients
-func (h *Hub) broadcastMessage(broadcast *Broadcast) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-
-	for id, client := range h.clients {
-		if id != broadcast.ClientID {
-			select {
-			case client.Send <- broadcast.Message:
-				// Message sent successfully
-			default:
-				// Client send buffer is full, close the connection
-				close(client.Send)
-				h.mu.RUnlock()
-				h.Unregister <- client
-				h.mu.RLock()
-			}
+		for chatID := range client.rooms {
+			h.unsubscribe(client, chatID)
 		}
 	}
 }
 
-// notifyUserJoin notifies all clients of a new user joining
+// notifyUserJoin notifies the client's rooms of a new user joining
 func (h *Hub) notifyUserJoin(client *Client) {
-	// Implementation would create a user join event and broadcast to all clients
+	h.notifyRooms(client, EventTypeUserJoin)
 }
 
-// notifyUserLeave notifies all clients of a user leaving
+// notifyUserLeave notifies the client's rooms of a user leaving
 func (h *Hub) notifyUserLeave(client *Client) {
-	// Implementation would create a user leave event and broadcast to all clients
+	h.notifyRooms(client, EventTypeUserLeave)
 }
 
 // Upgrader specifies parameters for upgrading an HTTP connection to a WebSocket connection
@@ -142,7 +322,7 @@ var Upgrader = websocket.Upgrader{
 }
 
 // Handler creates a WebSocket handler for Gin
-func Handler(hub *Hub, authService AuthService) gin.HandlerFunc {
+func Handler(hub *Hub, authService AuthService, store database.Store, messages MessageSender) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get the token from the query parameters
 		token := c.Query("token")
@@ -151,11 +331,33 @@ func Handler(hub *Hub, authService AuthService) gin.HandlerFunc {
 			return
 		}
 
+		// A reconnecting client passes the last message it saw
+		var since *uuid.UUID
+		if sinceParam := c.Query("since"); sinceParam != "" {
+			id, err := uuid.Parse(sinceParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since message ID"})
+				return
+			}
+			since = &id
+		}
+
 		// Validate the token
 		userID, _, err := authService.ValidateToken(token)
+		if errors.Is(err, auth.ErrExpiredToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired, please refresh", "code": "token_expired"})
+			return
+		}
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "code": "invalid_token"})
+			return
+		}
+
+		select {
+		case <-hub.done:
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
 			return
+		default:
 		}
 
 		// Upgrade HTTP connection to WebSocket
@@ -181,10 +383,30 @@ func Handler(hub *Hub, authService AuthService) gin.HandlerFunc {
 			AvatarURL:   user.AvatarURL,
 		}
 
-		client := NewClient(clientID, userID, conn, hub, userInfo)
+		client := NewClient(clientID, userID, conn, hub, userInfo, store, messages)
 
-		// Register the client
-		hub.Register <- client
+		// Subscribe to the user's chats; the hub adds them on registration
+		if hub.roomLookup != nil {
+			chatIDs, err := hub.roomLookup(c.Request.Context(), userID)
+			if err != nil {
+				log.Error().Err(err).Str("user_id", userID.String()).Msg("Failed to look up chats to subscribe to")
+			}
+			for _, chatID := range chatIDs {
+				client.rooms[chatID] = true
+			}
+			client.replayChats = chatIDs
+		}
+		client.replaySince = since
+
+		// The hello goes out before registration so it is the first event
+		// the client sees
+		client.sendHello()
+
+		// Register the client, unless the hub is shutting down
+		if !hub.register(client) {
+			conn.Close()
+			return
+		}
 
 		// Start the client
 		go client.WritePump()
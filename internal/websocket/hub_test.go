@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// connect registers a client for userID, subscribed to chats, directly with
+// the hub. The client has no socket, so tests read what it would be sent
+// from its Send channel.
+func connect(h *Hub, userID uuid.UUID, chats ...uuid.UUID) *Client {
+	c := NewClient(uuid.NewString(), userID, nil, h, UserInfo{}, nil, nil)
+	for _, chatID := range chats {
+		c.rooms[chatID] = true
+	}
+	h.registerClient(c)
+	return c
+}
+
+// events decodes every event queued for a client, emptying its Send channel
+func events(t *testing.T, c *Client) []Message {
+	t.Helper()
+
+	var out []Message
+	for {
+		select {
+		case data, ok := <-c.Send:
+			if !ok {
+				return out
+			}
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("client got invalid JSON %q: %v", data, err)
+			}
+			out = append(out, msg)
+		default:
+			return out
+		}
+	}
+}
+
+// ofType returns the events of one type
+func ofType(msgs []Message, eventType string) []Message {
+	var out []Message
+	for _, m := range msgs {
+		if m.Type == eventType {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// waitForEvent reads a client's events until one of the given type arrives
+func waitForEvent(t *testing.T, c *Client, eventType string, timeout time.Duration) Message {
+	t.Helper()
+
+	deadline := time.After(timeout)
+	for {
+		select {
+		case data := <-c.Send:
+			var msg Message
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("client got invalid JSON %q: %v", data, err)
+			}
+			if msg.Type == eventType {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("no %s event within %v", eventType, timeout)
+		}
+	}
+}
+
+func TestUserStaysConnectedWhileAnyClientRemains(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	chatID := uuid.New()
+	alice := uuid.New()
+	peer := connect(h, uuid.New(), chatID)
+
+	laptop := connect(h, alice, chatID)
+	phone := connect(h, alice, chatID)
+	events(t, peer)
+
+	h.unregisterClient(laptop)
+	if !h.IsOnline(alice) {
+		t.Fatal("user went offline with a connection still open")
+	}
+	if left := ofType(events(t, peer), EventTypeUserLeave); len(left) != 0 {
+		t.Errorf("peer was told the user left while a connection remains")
+	}
+
+	// Delivery to the user reaches the connection that is left
+	h.SendToUsers(chatID, []uuid.UUID{alice}, []byte(`{"type":"ping"}`))
+	select {
+	case data := <-phone.Send:
+		if string(data) != `{"type":"ping"}` {
+			t.Errorf("phone got %q", data)
+		}
+	default:
+		t.Error("remaining connection wasn't sent the user's event")
+	}
+
+	h.unregisterClient(phone)
+	if h.IsOnline(alice) {
+		t.Error("user still online after the last connection closed")
+	}
+	for _, userID := range h.OnlineUsers() {
+		if userID == alice {
+			t.Error("OnlineUsers still lists the user")
+		}
+	}
+	if left := ofType(events(t, peer), EventTypeUserLeave); len(left) != 1 {
+		t.Errorf("peer got %d user left events after the last disconnect, want 1", len(left))
+	}
+}
@@ -0,0 +1,177 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Presence statuses
+const (
+	PresenceActive       = "active"
+	PresenceDoNotDisturb = "do_not_disturb"
+	PresenceAway         = "away"
+	PresenceOffline      = "offline"
+)
+
+// presenceRank orders statuses so the most active of a user's connections wins
+var presenceRank = map[string]int{
+	PresenceOffline:      0,
+	PresenceAway:         1,
+	PresenceDoNotDisturb: 2,
+	PresenceActive:       3,
+}
+
+// PresencePayload is sent by clients as a heartbeat and broadcast when a
+// user's aggregate presence changes
+type PresencePayload struct {
+	UserID uuid.UUID `json:"user_id,omitempty"`
+	Status string    `json:"status"`
+}
+
+// handlePresence processes presence heartbeats
+func (c *Client) handlePresence(payload json.RawMessage) {
+	var presence PresencePayload
+	if err := json.Unmarshal(payload, &presence); err != nil {
+		c.sendError("Invalid presence payload")
+		return
+	}
+
+	// Offline is only ever derived from disconnects
+	if rank, ok := presenceRank[presence.Status]; !ok || rank == presenceRank[PresenceOffline] {
+		c.sendError("Invalid presence status")
+		return
+	}
+
+	c.Hub.UpdatePresence(c, presence.Status)
+}
+
+// UpdatePresence records a heartbeat from a client and broadcasts the user's
+// aggregate presence if it changed
+func (h *Hub) UpdatePresence(client *Client, status string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client.mu.Lock()
+	client.presence = status
+	client.lastHeartbeat = time.Now()
+	client.mu.Unlock()
+
+	h.refreshPresence(client.UserID)
+}
+
+// Presence returns a user's aggregate presence
+func (h *Hub) Presence(userID uuid.UUID) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if status, ok := h.presence[userID]; ok {
+		return status
+	}
+	return PresenceOffline
+}
+
+// IsOnline reports whether a user has at least one open connection to this
+// instance
+func (h *Hub) IsOnline(userID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return len(h.userClients[userID]) > 0
+}
+
+// OnlineUsers returns the users with at least one open connection to this
+// instance
+func (h *Hub) OnlineUsers() []uuid.UUID {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	users := make([]uuid.UUID, 0, len(h.userClients))
+	for userID := range h.userClients {
+		users = append(users, userID)
+	}
+	return users
+}
+
+// expireIdlePresence marks active connections that haven't sent a heartbeat
+// within the idle timeout as away
+func (h *Hub) expireIdlePresence(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	idle := make(map[uuid.UUID]bool)
+	for _, client := range h.clients {
+		client.mu.Lock()
+		if client.presence == PresenceActive && now.Sub(client.lastHeartbeat) >= h.config.PresenceIdleTimeout {
+			client.presence = PresenceAway
+			idle[client.UserID] = true
+		}
+		client.mu.Unlock()
+	}
+
+	for userID := range idle {
+		h.refreshPresence(userID)
+	}
+}
+
+// refreshPresence recomputes a user's aggregate presence across all of their
+// connections and broadcasts it to the members of their chats if it changed.
+// The caller must hold h.mu.
+func (h *Hub) refreshPresence(userID uuid.UUID) {
+	status := PresenceOffline
+	rooms := make(map[uuid.UUID]bool)
+	for id := range h.userClients[userID] {
+		client := h.clients[id]
+		client.mu.Lock()
+		if presenceRank[client.presence] > presenceRank[status] {
+			status = client.presence
+		}
+		client.mu.Unlock()
+		for chatID := range client.rooms {
+			rooms[chatID] = true
+		}
+	}
+
+	if previous, ok := h.presence[userID]; ok && previous == status {
+		return
+	}
+	if status == PresenceOffline {
+		delete(h.presence, userID)
+	} else {
+		h.presence[userID] = status
+	}
+
+	payload, err := json.Marshal(PresencePayload{UserID: userID, Status: status})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal presence payload")
+		return
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypePresence,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal presence event")
+		return
+	}
+
+	// Presence is advisory, so drop it for clients that are falling behind
+	// rather than disconnecting them. A peer sharing several chats with the
+	// user gets it once.
+	sent := make(map[string]bool)
+	for chatID := range rooms {
+		for id, client := range h.rooms[chatID] {
+			if sent[id] {
+				continue
+			}
+			sent[id] = true
+			select {
+			case client.Send <- data:
+			default:
+			}
+		}
+	}
+}
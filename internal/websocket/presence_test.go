@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// presenceUpdates returns the presence statuses broadcast to a client, in order
+func presenceUpdates(t *testing.T, c *Client, userID uuid.UUID) []string {
+	t.Helper()
+
+	var statuses []string
+	for _, msg := range ofType(events(t, c), EventTypePresence) {
+		var p PresencePayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			t.Fatalf("invalid presence payload: %v", err)
+		}
+		if p.UserID == userID {
+			statuses = append(statuses, p.Status)
+		}
+	}
+	return statuses
+}
+
+func TestIdleConnectionBecomesAway(t *testing.T) {
+	const timeout = time.Minute
+	h := NewHub(HubConfig{PresenceIdleTimeout: timeout}, nil)
+	chatID := uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+
+	aliceConn := connect(h, alice, chatID)
+	peer := connect(h, bob, chatID)
+	events(t, peer)
+
+	start := aliceConn.lastHeartbeat
+
+	h.expireIdlePresence(start.Add(timeout - time.Second))
+	if got := h.Presence(alice); got != PresenceActive {
+		t.Fatalf("presence before the idle timeout = %q, want active", got)
+	}
+	if got := presenceUpdates(t, peer, alice); len(got) != 0 {
+		t.Fatalf("peer got %v before the idle timeout", got)
+	}
+
+	h.expireIdlePresence(start.Add(timeout))
+	if got := h.Presence(alice); got != PresenceAway {
+		t.Fatalf("presence after the idle timeout = %q, want away", got)
+	}
+	if got := presenceUpdates(t, peer, alice); len(got) != 1 || got[0] != PresenceAway {
+		t.Errorf("peer got %v, want [away]", got)
+	}
+
+	// Expiring again changes nothing, so nothing is rebroadcast
+	h.expireIdlePresence(start.Add(2 * timeout))
+	if got := presenceUpdates(t, peer, alice); len(got) != 0 {
+		t.Errorf("peer got %v for an unchanged status", got)
+	}
+
+	// A heartbeat brings the user back
+	h.UpdatePresence(aliceConn, PresenceActive)
+	if got := presenceUpdates(t, peer, alice); len(got) != 1 || got[0] != PresenceActive {
+		t.Errorf("peer got %v after a heartbeat, want [active]", got)
+	}
+}
+
+func TestIdleTransitionFiresFromRunLoop(t *testing.T) {
+	h := NewHub(HubConfig{PresenceIdleTimeout: 40 * time.Millisecond}, nil)
+	go h.Run()
+	t.Cleanup(func() {
+		h.stopOnce.Do(func() { close(h.stop) })
+		<-h.done
+	})
+
+	chatID := uuid.New()
+	alice := uuid.New()
+	aliceConn := NewClient("alice", alice, nil, h, UserInfo{}, nil, nil)
+	aliceConn.rooms[chatID] = true
+	peer := NewClient("bob", uuid.New(), nil, h, UserInfo{}, nil, nil)
+	peer.rooms[chatID] = true
+	h.Register <- peer
+	h.Register <- aliceConn
+
+	// Alice connects as active, then goes quiet until the idle check runs
+	for _, want := range []string{PresenceActive, PresenceAway} {
+		var p PresencePayload
+		for p.UserID != alice {
+			msg := waitForEvent(t, peer, EventTypePresence, time.Second)
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				t.Fatalf("invalid presence payload: %v", err)
+			}
+		}
+		if p.Status != want {
+			t.Fatalf("alice's presence = %q, want %q", p.Status, want)
+		}
+	}
+}
+
+func TestPresenceAggregatesConnections(t *testing.T) {
+	const timeout = time.Minute
+	h := NewHub(HubConfig{PresenceIdleTimeout: timeout}, nil)
+	chatID := uuid.New()
+	alice := uuid.New()
+	peer := connect(h, uuid.New(), chatID)
+
+	laptop := connect(h, alice, chatID)
+	phone := connect(h, alice, chatID)
+	events(t, peer)
+
+	// The phone goes quiet but the laptop keeps sending heartbeats
+	phone.lastHeartbeat = phone.lastHeartbeat.Add(-timeout)
+	h.expireIdlePresence(time.Now())
+	if got := h.Presence(alice); got != PresenceActive {
+		t.Errorf("presence = %q, want active while one connection is active", got)
+	}
+	if got := presenceUpdates(t, peer, alice); len(got) != 0 {
+		t.Errorf("peer got %v though the aggregate didn't change", got)
+	}
+
+	h.UpdatePresence(laptop, PresenceDoNotDisturb)
+	if got := h.Presence(alice); got != PresenceDoNotDisturb {
+		t.Errorf("presence = %q, want do_not_disturb over away", got)
+	}
+
+	// Do not disturb is a choice, not idleness, so it doesn't expire
+	h.expireIdlePresence(time.Now().Add(2 * timeout))
+	if got := h.Presence(alice); got != PresenceDoNotDisturb {
+		t.Errorf("presence = %q, want do_not_disturb to survive the idle check", got)
+	}
+
+	h.unregisterClient(laptop)
+	if got := h.Presence(alice); got != PresenceAway {
+		t.Errorf("presence = %q, want away from the remaining connection", got)
+	}
+	h.unregisterClient(phone)
+	if got := h.Presence(alice); got != PresenceOffline {
+		t.Errorf("presence = %q, want offline once every connection is gone", got)
+	}
+
+	want := []string{PresenceDoNotDisturb, PresenceAway, PresenceOffline}
+	got := presenceUpdates(t, peer, alice)
+	if len(got) != len(want) {
+		t.Fatalf("peer got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("peer got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestHandlePresenceRejectsInvalidStatus(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	c := connect(h, uuid.New())
+	events(t, c)
+
+	for _, payload := range []string{`{"status":"offline"}`, `{"status":"sleeping"}`, `not json`} {
+		c.handlePresence(json.RawMessage(payload))
+		if got := ofType(events(t, c), EventTypeError); len(got) != 1 {
+			t.Errorf("payload %s: got %d error events, want 1", payload, len(got))
+		}
+	}
+	if got := h.Presence(c.UserID); got != PresenceActive {
+		t.Errorf("presence = %q after invalid heartbeats, want active", got)
+	}
+}
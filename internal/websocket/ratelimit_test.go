@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// sentMessages records the chat messages a client got past its limits
+type sentMessages struct {
+	contents []string
+}
+
+func (s *sentMessages) SendMessage(ctx context.Context, message *models.Message) error {
+	s.contents = append(s.contents, message.Content)
+	return nil
+}
+
+// sendEvent feeds a client an event as if it had arrived on its socket
+func sendEvent(t *testing.T, c *Client, eventType string, payload any) {
+	t.Helper()
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal payload: %v", err)
+	}
+	data, err := json.Marshal(Message{Type: eventType, Payload: raw})
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	c.processMessage(data)
+}
+
+// rateLimited counts the rate limit errors queued for a client
+func rateLimited(t *testing.T, c *Client) int {
+	t.Helper()
+
+	n := 0
+	for _, msg := range ofType(events(t, c), EventTypeError) {
+		if strings.Contains(string(msg.Payload), "Rate limit exceeded") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestClientMessageBurstIsLimited(t *testing.T) {
+	h := NewHub(HubConfig{MessagesPerMinute: 3}, nil)
+	sent := &sentMessages{}
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, sent)
+	chatID := uuid.New()
+
+	for i := 0; i < 5; i++ {
+		sendEvent(t, c, EventTypeMessage, ChatMessagePayload{ChatID: chatID, Content: "spam"})
+	}
+
+	if len(sent.contents) != 3 {
+		t.Errorf("%d messages sent from a burst of 5, want the limit of 3", len(sent.contents))
+	}
+	if got := rateLimited(t, c); got != 2 {
+		t.Errorf("%d rate limit errors, want one per dropped message (2)", got)
+	}
+
+	// Dropping messages doesn't close the connection
+	select {
+	case <-c.shutdown:
+		t.Error("client shut down after hitting the rate limit")
+	default:
+	}
+
+	// Each connection has its own budget
+	other := NewClient(uuid.NewString(), c.UserID, nil, h, UserInfo{}, nil, sent)
+	sendEvent(t, other, EventTypeMessage, ChatMessagePayload{ChatID: chatID, Content: "from another tab"})
+	if got := rateLimited(t, other); got != 0 {
+		t.Errorf("a second connection was rate limited %d times on its first message", got)
+	}
+}
+
+func TestClientTypingHasItsOwnLimit(t *testing.T) {
+	h := NewHub(HubConfig{MessagesPerMinute: 2, TypingPerMinute: 5}, nil)
+	sent := &sentMessages{}
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, nil, sent)
+	chatID := uuid.New()
+
+	// Typing events past their limit are dropped with an error
+	for i := 0; i < 7; i++ {
+		sendEvent(t, c, EventTypeTyping, RoomPayload{ChatID: chatID})
+	}
+	if got := rateLimited(t, c); got != 2 {
+		t.Errorf("%d rate limit errors for 7 typing events, want 2 past the limit of 5", got)
+	}
+
+	// ...without using up the message budget
+	for i := 0; i < 2; i++ {
+		sendEvent(t, c, EventTypeMessage, ChatMessagePayload{ChatID: chatID, Content: "hello"})
+	}
+	if len(sent.contents) != 2 {
+		t.Errorf("%d messages sent after typing, want 2", len(sent.contents))
+	}
+	if got := rateLimited(t, c); got != 0 {
+		t.Errorf("messages were rate limited %d times after only typing events", got)
+	}
+}
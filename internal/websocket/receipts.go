@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// defaultReadReceiptWindow is used when no read receipt window is configured
+const defaultReadReceiptWindow = 500 * time.Millisecond
+
+// ReadReceiptPayload is sent by clients when they have read a chat up to a
+// message, or their direct messages from another user up to DirectMessageID
+type ReadReceiptPayload struct {
+	ChatID          uuid.UUID `json:"chat_id"`
+	MessageID       uuid.UUID `json:"message_id"`
+	DirectMessageID uuid.UUID `json:"direct_message_id"`
+}
+
+// DirectReadReceiptPayload is sent to the sender of direct messages when the
+// recipient has read them up to DirectMessageID
+type DirectReadReceiptPayload struct {
+	DirectMessageID uuid.UUID `json:"direct_message_id"`
+	UserID          uuid.UUID `json:"user_id"`
+}
+
+// ReadReceiptBatchPayload is broadcast to a room once per window with the
+// latest message each reader reported during it
+type ReadReceiptBatchPayload struct {
+	ChatID uuid.UUID               `json:"chat_id"`
+	Reads  map[uuid.UUID]uuid.UUID `json:"reads"`
+}
+
+// QueueReadReceipt records that a user has read a chat up to a message. The
+// receipts for a chat are broadcast together when its window closes, with
+// only the latest marker kept for each user.
+func (h *Hub) QueueReadReceipt(chatID, userID, messageID uuid.UUID) {
+	h.receiptsMu.Lock()
+	defer h.receiptsMu.Unlock()
+
+	reads, ok := h.pendingReceipts[chatID]
+	if !ok {
+		reads = make(map[uuid.UUID]uuid.UUID)
+		h.pendingReceipts[chatID] = reads
+		time.AfterFunc(h.config.ReadReceiptWindow, func() {
+			h.flushReadReceipts(chatID)
+		})
+	}
+	reads[userID] = messageID
+}
+
+// flushReadReceipts broadcasts a chat's pending read receipts as one event
+func (h *Hub) flushReadReceipts(chatID uuid.UUID) {
+	h.receiptsMu.Lock()
+	reads := h.pendingReceipts[chatID]
+	delete(h.pendingReceipts, chatID)
+	h.receiptsMu.Unlock()
+
+	if len(reads) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(ReadReceiptBatchPayload{ChatID: chatID, Reads: reads})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal read receipts")
+		return
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypeReadReceipt,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal read receipt event")
+		return
+	}
+
+	h.broadcastMessage(&Broadcast{ChatID: chatID, Message: data})
+}
+
+// handleReadReceipt moves the sender's read marker in the chat it names up to
+// the message, which lowers their unread count, and queues a read receipt for
+// the room. A receipt for a direct message is handled by
+// handleDirectReadReceipt.
+func (c *Client) handleReadReceipt(payload json.RawMessage) {
+	var receipt ReadReceiptPayload
+	if err := json.Unmarshal(payload, &receipt); err != nil {
+		c.sendError("Invalid read receipt payload")
+		return
+	}
+	if receipt.DirectMessageID != uuid.Nil {
+		c.handleDirectReadReceipt(receipt.DirectMessageID)
+		return
+	}
+	if receipt.ChatID == uuid.Nil || receipt.MessageID == uuid.Nil {
+		c.sendError("Invalid read receipt payload")
+		return
+	}
+	if !c.Hub.IsSubscribed(c.ID, receipt.ChatID) {
+		c.sendError("You are not subscribed to this chat")
+		return
+	}
+
+	if c.store != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		// The subscription may predate leaving the chat
+		isMember, err := c.store.IsChatMember(ctx, receipt.ChatID, c.UserID)
+		if err != nil {
+			log.Error().Err(err).Str("client_id", c.ID).Msg("Failed to check chat membership for read receipt")
+			c.sendError("Failed to record read receipt")
+			return
+		}
+		if !isMember {
+			c.sendError("You are not a member of this chat")
+			return
+		}
+
+		message, err := c.store.GetMessageByID(ctx, receipt.MessageID)
+		if err != nil || message.ChatID != receipt.ChatID {
+			c.sendError("Message not found in this chat")
+			return
+		}
+		if err := c.store.MarkChatRead(ctx, receipt.ChatID, c.UserID, message.CreatedAt); err != nil {
+			log.Warn().Err(err).Msg("Failed to mark chat read from read receipt")
+		}
+	}
+
+	c.Hub.QueueReadReceipt(receipt.ChatID, c.UserID, receipt.MessageID)
+}
+
+// handleDirectReadReceipt marks the direct messages sent to the client's user
+// by the sender of messageID, up to and including it, as read, and tells the
+// sender
+func (c *Client) handleDirectReadReceipt(messageID uuid.UUID) {
+	if c.store == nil {
+		c.sendError("Read receipts are not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	message, err := c.store.GetDirectMessageByID(ctx, messageID)
+	if err != nil || message.RecipientID != c.UserID {
+		c.sendError("Direct message not found")
+		return
+	}
+	if err := c.store.MarkDirectMessagesReadUpTo(ctx, c.UserID, message.SenderID, message.CreatedAt); err != nil {
+		log.Warn().Err(err).Msg("Failed to mark direct messages read from read receipt")
+		c.sendError("Failed to record read receipt")
+		return
+	}
+
+	payload, err := json.Marshal(DirectReadReceiptPayload{DirectMessageID: messageID, UserID: c.UserID})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal direct read receipt")
+		return
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypeReadReceipt,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal direct read receipt event")
+		return
+	}
+
+	conversation := models.NewDMConversation(message.SenderID, message.RecipientID)
+	c.Hub.SendToUsers(conversation.ID, []uuid.UUID{message.SenderID}, data)
+}
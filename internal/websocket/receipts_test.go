@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestReadReceiptsAreBatchedPerChat(t *testing.T) {
+	const window = 50 * time.Millisecond
+	h := NewHub(HubConfig{ReadReceiptWindow: window}, nil)
+
+	general, random := uuid.New(), uuid.New()
+	watcher := connect(h, uuid.New(), general)
+	elsewhere := connect(h, uuid.New(), random)
+
+	// Three readers race through twenty messages; only where each of them
+	// ended up matters
+	readers := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	latest := make(map[uuid.UUID]uuid.UUID)
+	for i := 0; i < 20; i++ {
+		reader, message := readers[i%len(readers)], uuid.New()
+		h.QueueReadReceipt(general, reader, message)
+		latest[reader] = message
+	}
+
+	event := waitForEvent(t, watcher, EventTypeReadReceipt, 10*window)
+	var batch ReadReceiptBatchPayload
+	if err := json.Unmarshal(event.Payload, &batch); err != nil {
+		t.Fatalf("decoding batch: %v", err)
+	}
+	if batch.ChatID != general {
+		t.Errorf("batch is for chat %s, want %s", batch.ChatID, general)
+	}
+	if len(batch.Reads) != len(readers) {
+		t.Errorf("batch has %d readers, want %d", len(batch.Reads), len(readers))
+	}
+	for reader, message := range latest {
+		if batch.Reads[reader] != message {
+			t.Errorf("reader %s at %s, want their latest marker %s", reader, batch.Reads[reader], message)
+		}
+	}
+
+	// Everything was in that one event
+	time.Sleep(2 * window)
+	if extra := ofType(events(t, watcher), EventTypeReadReceipt); len(extra) != 0 {
+		t.Errorf("got %d more read receipt events, want one batch", len(extra))
+	}
+	if leaked := ofType(events(t, elsewhere), EventTypeReadReceipt); len(leaked) != 0 {
+		t.Errorf("another chat's subscriber got %d read receipt events", len(leaked))
+	}
+
+	// A receipt after the window starts a new batch
+	h.QueueReadReceipt(general, readers[0], uuid.New())
+	waitForEvent(t, watcher, EventTypeReadReceipt, 10*window)
+}
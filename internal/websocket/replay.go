@@ -0,0 +1,240 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// Replay defaults
+const (
+	defaultMissedBufferSize = 100
+	defaultMissedBufferTTL  = 5 * time.Minute
+	defaultMaxReplay        = 500
+
+	// replayTimeout bounds the database work done for one reconnect
+	replayTimeout = 10 * time.Second
+)
+
+// Reasons a client is told to reload from the server
+const (
+	ResyncUnknownCursor = "unknown_cursor"
+	ResyncTooManyMissed = "too_many_missed"
+	ResyncReplayFailed  = "replay_failed"
+)
+
+// ResyncPayload tells a reconnecting client that its missed messages could
+// not be replayed, so it should reload its chats from the REST API
+type ResyncPayload struct {
+	Reason string `json:"reason"`
+}
+
+// missedEvent is an event that could not be delivered because the
+// connection's send buffer was full
+type missedEvent struct {
+	data []byte
+	at   time.Time
+}
+
+// missedRing keeps the most recent missed events for a user, overwriting the
+// oldest once full
+type missedRing struct {
+	events []missedEvent
+	start  int
+	count  int
+}
+
+func newMissedRing(size int) *missedRing {
+	return &missedRing{events: make([]missedEvent, size)}
+}
+
+// push adds an event, dropping the oldest if the ring is full
+func (r *missedRing) push(event missedEvent) {
+	end := (r.start + r.count) % len(r.events)
+	r.events[end] = event
+	if r.count < len(r.events) {
+		r.count++
+	} else {
+		r.start = (r.start + 1) % len(r.events)
+	}
+}
+
+// since returns the events recorded after cutoff, oldest first
+func (r *missedRing) since(cutoff time.Time) []missedEvent {
+	events := make([]missedEvent, 0, r.count)
+	for i := 0; i < r.count; i++ {
+		event := r.events[(r.start+i)%len(r.events)]
+		if event.at.After(cutoff) {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// recordMissed keeps an event a client's full send buffer could not take, so
+// it can be delivered when the user reconnects. It is safe to call while
+// holding h.mu for reading.
+func (h *Hub) recordMissed(client *Client, data []byte) {
+	h.missedMu.Lock()
+	defer h.missedMu.Unlock()
+
+	ring, ok := h.missed[client.UserID]
+	if !ok {
+		ring = newMissedRing(h.config.MissedBufferSize)
+		h.missed[client.UserID] = ring
+	}
+	ring.push(missedEvent{data: data, at: time.Now()})
+}
+
+// deliverMissed sends a newly registered client the events its user missed.
+// Chat messages are left out when the client is replaying them from the
+// database, so they aren't delivered twice.
+func (h *Hub) deliverMissed(client *Client) {
+	h.missedMu.Lock()
+	ring, ok := h.missed[client.UserID]
+	delete(h.missed, client.UserID)
+	h.missedMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, event := range ring.since(time.Now().Add(-h.config.MissedBufferTTL)) {
+		if client.replaySince != nil && eventType(event.data) == EventTypeMessage {
+			continue
+		}
+		select {
+		case client.Send <- event.data:
+		default:
+			return
+		}
+	}
+}
+
+// pruneMissed drops missed events older than the buffer TTL, and the buffers
+// of users with none left
+func (h *Hub) pruneMissed(now time.Time) {
+	h.missedMu.Lock()
+	defer h.missedMu.Unlock()
+
+	cutoff := now.Add(-h.config.MissedBufferTTL)
+	for userID, ring := range h.missed {
+		events := ring.since(cutoff)
+		if len(events) == 0 {
+			delete(h.missed, userID)
+			continue
+		}
+		if len(events) < ring.count {
+			pruned := newMissedRing(len(ring.events))
+			for _, event := range events {
+				pruned.push(event)
+			}
+			h.missed[userID] = pruned
+		}
+	}
+}
+
+// eventType returns the type of an encoded event
+func eventType(data []byte) string {
+	var event struct {
+		Type string `json:"type"`
+	}
+	json.Unmarshal(data, &event)
+	return event.Type
+}
+
+// replay sends a reconnecting client the messages posted to its chats after
+// the message it last saw. If that message is unknown or too much was missed,
+// the client is told to resync instead. It runs on the read pump before any
+// client events are read, so the hub cannot close c.Send underneath it.
+func (c *Client) replay(since uuid.UUID, chatIDs []uuid.UUID) {
+	ctx, cancel := context.WithTimeout(context.Background(), replayTimeout)
+	defer cancel()
+
+	cursor, err := c.store.GetMessageByID(ctx, since)
+	if err != nil || !containsID(chatIDs, cursor.ChatID) {
+		c.sendResync(ResyncUnknownCursor)
+		return
+	}
+
+	limit := c.Hub.config.MaxReplay
+	messages, err := c.store.ListMessagesAfter(ctx, chatIDs, cursor.CreatedAt, cursor.ID, limit+1)
+	if err != nil {
+		log.Error().Err(err).Str("client_id", c.ID).Msg("Failed to load missed messages")
+		c.sendResync(ResyncReplayFailed)
+		return
+	}
+	if len(messages) > limit {
+		c.sendResync(ResyncTooManyMissed)
+		return
+	}
+
+	for _, message := range messages {
+		// Deleted messages are for the REST API to show, if at all
+		if message.IsDeleted {
+			continue
+		}
+		payload, err := json.Marshal(message)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal replayed message")
+			c.sendResync(ResyncReplayFailed)
+			return
+		}
+		data, err := json.Marshal(Message{
+			Type:      EventTypeMessage,
+			Timestamp: message.CreatedAt,
+			Payload:   payload,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal replayed message event")
+			c.sendResync(ResyncReplayFailed)
+			return
+		}
+
+		// A client that can't keep up with its own replay is better off
+		// reloading
+		select {
+		case c.Send <- data:
+		default:
+			c.sendResync(ResyncTooManyMissed)
+			return
+		}
+	}
+}
+
+// sendResync tells the client to reload from the server
+func (c *Client) sendResync(reason string) {
+	payload, err := json.Marshal(ResyncPayload{Reason: reason})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal resync payload")
+		return
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypeResync,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal resync event")
+		return
+	}
+
+	select {
+	case c.Send <- data:
+	default:
+		log.Warn().Str("client_id", c.ID).Msg("Client send buffer full, dropping resync")
+	}
+}
+
+// containsID reports whether ids contains id
+func containsID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/llamasearch/llamachat/internal/database"
+	"github.com/llamasearch/llamachat/internal/models"
+)
+
+// history is a message store holding chat messages in the order posted
+type history struct {
+	database.Store
+	messages []*models.Message
+	listErr  error
+}
+
+// post adds a message to a chat, a second after the previous one
+func (s *history) post(chatID uuid.UUID, content string) *models.Message {
+	m := &models.Message{ID: uuid.New(), ChatID: chatID, Content: content, CreatedAt: time.Unix(int64(1000+len(s.messages)), 0)}
+	s.messages = append(s.messages, m)
+	return m
+}
+
+func (s *history) GetMessageByID(ctx context.Context, id uuid.UUID) (*models.Message, error) {
+	for _, m := range s.messages {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, errors.New("message not found")
+}
+
+func (s *history) ListMessagesAfter(ctx context.Context, chatIDs []uuid.UUID, after time.Time, afterID uuid.UUID, limit int) ([]*models.Message, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	var out []*models.Message
+	for _, m := range s.messages {
+		if containsID(chatIDs, m.ChatID) && m.CreatedAt.After(after) && len(out) < limit {
+			out = append(out, m)
+		}
+	}
+	return out, nil
+}
+
+// replayed decodes the message contents and resync reasons sent to a client
+func replayed(t *testing.T, c *Client) (contents []string, resync string) {
+	t.Helper()
+
+	for _, msg := range events(t, c) {
+		switch msg.Type {
+		case EventTypeMessage:
+			var m models.Message
+			if err := json.Unmarshal(msg.Payload, &m); err != nil {
+				t.Fatalf("invalid replayed message: %v", err)
+			}
+			contents = append(contents, m.Content)
+		case EventTypeResync:
+			var p ResyncPayload
+			if err := json.Unmarshal(msg.Payload, &p); err != nil {
+				t.Fatalf("invalid resync payload: %v", err)
+			}
+			resync = p.Reason
+		}
+	}
+	return contents, resync
+}
+
+func TestReplayMissedMessages(t *testing.T) {
+	general, random, private := uuid.New(), uuid.New(), uuid.New()
+	store := &history{}
+	seen := store.post(general, "seen")
+	store.post(random, "one")
+	store.post(private, "not a member")
+	store.post(general, "two")
+	store.post(general, "deleted").IsDeleted = true
+	store.post(random, "three")
+
+	h := NewHub(HubConfig{}, nil)
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, store, nil)
+	c.replay(seen.ID, []uuid.UUID{general, random})
+
+	contents, resync := replayed(t, c)
+	if resync != "" {
+		t.Fatalf("told to resync (%s), want a replay", resync)
+	}
+	// In order, from the client's chats only, without deleted messages
+	if want := []string{"one", "two", "three"}; fmt.Sprint(contents) != fmt.Sprint(want) {
+		t.Errorf("replayed %q, want %q", contents, want)
+	}
+}
+
+func TestReplayFallsBackToResync(t *testing.T) {
+	general, other := uuid.New(), uuid.New()
+
+	tests := []struct {
+		name  string
+		setup func(s *history) (since uuid.UUID, chats []uuid.UUID)
+		max   int
+		want  string
+	}{
+		{"unknown cursor", func(s *history) (uuid.UUID, []uuid.UUID) {
+			s.post(general, "hi")
+			return uuid.New(), []uuid.UUID{general}
+		}, 0, ResyncUnknownCursor},
+		// A cursor from a chat the user isn't in reveals nothing
+		{"cursor outside the client's chats", func(s *history) (uuid.UUID, []uuid.UUID) {
+			cursor := s.post(other, "elsewhere")
+			s.post(general, "hi")
+			return cursor.ID, []uuid.UUID{general}
+		}, 0, ResyncUnknownCursor},
+		{"gap over the cap", func(s *history) (uuid.UUID, []uuid.UUID) {
+			cursor := s.post(general, "seen")
+			for i := 0; i < 4; i++ {
+				s.post(general, "missed")
+			}
+			return cursor.ID, []uuid.UUID{general}
+		}, 3, ResyncTooManyMissed},
+		{"store failure", func(s *history) (uuid.UUID, []uuid.UUID) {
+			cursor := s.post(general, "seen")
+			s.listErr = errors.New("database is down")
+			return cursor.ID, []uuid.UUID{general}
+		}, 0, ResyncReplayFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &history{}
+			since, chats := tt.setup(store)
+
+			h := NewHub(HubConfig{MaxReplay: tt.max}, nil)
+			c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, store, nil)
+			c.replay(since, chats)
+
+			contents, resync := replayed(t, c)
+			if resync != tt.want {
+				t.Errorf("resync = %q, want %q", resync, tt.want)
+			}
+			if len(contents) != 0 {
+				t.Errorf("replayed %q before resyncing", contents)
+			}
+		})
+	}
+
+	// At the cap is still replayed
+	store := &history{}
+	cursor := store.post(general, "seen")
+	for i := 0; i < 3; i++ {
+		store.post(general, "missed")
+	}
+	h := NewHub(HubConfig{MaxReplay: 3}, nil)
+	c := NewClient(uuid.NewString(), uuid.New(), nil, h, UserInfo{}, store, nil)
+	c.replay(cursor.ID, []uuid.UUID{general})
+	if contents, resync := replayed(t, c); len(contents) != 3 || resync != "" {
+		t.Errorf("at the cap: replayed %d, resync %q; want all 3", len(contents), resync)
+	}
+}
+
+func TestMissedEventsDeliveredOnReconnect(t *testing.T) {
+	h := NewHub(HubConfig{MissedBufferSize: 3}, nil)
+	chatID := uuid.New()
+	userID := uuid.New()
+
+	// A connection with no room in its send buffer misses what is sent
+	slow := connect(h, userID, chatID)
+	events(t, slow)
+	slow.Send = make(chan []byte)
+	for i := 0; i < 5; i++ {
+		h.broadcastMessage(&Broadcast{ChatID: chatID, Message: []byte(fmt.Sprintf(`{"type":"notice","payload":%d}`, i))})
+	}
+	h.unregisterClient(slow)
+
+	// Reconnecting gets the newest missed events, oldest first
+	back := connect(h, userID, chatID)
+	var got []string
+	for _, msg := range ofType(events(t, back), "notice") {
+		got = append(got, string(msg.Payload))
+	}
+	if want := []string{"2", "3", "4"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("delivered %v, want the last 3 missed", got)
+	}
+
+	// They're delivered once
+	h.unregisterClient(back)
+	again := connect(h, userID, chatID)
+	if n := len(ofType(events(t, again), "notice")); n != 0 {
+		t.Errorf("missed events delivered again: %d", n)
+	}
+}
+
+func TestMissedMessagesLeftToDatabaseReplay(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	userID := uuid.New()
+	h.recordMissed(&Client{UserID: userID}, []byte(`{"type":"message","payload":{}}`))
+	h.recordMissed(&Client{UserID: userID}, []byte(`{"type":"presence","payload":{}}`))
+
+	// A client replaying from the database would get the message twice
+	c := NewClient(uuid.NewString(), userID, nil, h, UserInfo{}, nil, nil)
+	since := uuid.New()
+	c.replaySince = &since
+	h.registerClient(c)
+
+	msgs := events(t, c)
+	if n := len(ofType(msgs, EventTypeMessage)); n != 0 {
+		t.Errorf("buffered message delivered alongside the database replay")
+	}
+	if n := len(ofType(msgs, "presence")); n != 1 {
+		t.Errorf("got %d buffered presence events, want 1", n)
+	}
+}
+
+func TestPruneMissed(t *testing.T) {
+	h := NewHub(HubConfig{MissedBufferTTL: time.Minute}, nil)
+	stale, fresh := uuid.New(), uuid.New()
+	now := time.Now()
+
+	h.missed[stale] = newMissedRing(4)
+	h.missed[stale].push(missedEvent{data: []byte("old"), at: now.Add(-2 * time.Minute)})
+	h.missed[fresh] = newMissedRing(4)
+	h.missed[fresh].push(missedEvent{data: []byte("old"), at: now.Add(-2 * time.Minute)})
+	h.missed[fresh].push(missedEvent{data: []byte("new"), at: now})
+
+	h.pruneMissed(now)
+
+	if _, ok := h.missed[stale]; ok {
+		t.Error("buffer with only expired events kept")
+	}
+	events := h.missed[fresh].since(time.Time{})
+	if len(events) != 1 || string(events[0].data) != "new" {
+		t.Errorf("fresh buffer holds %d events, want only the new one", len(events))
+	}
+}
@@ -0,0 +1,209 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// RoomLookup returns the chats a user belongs to. Clients are subscribed to
+// these rooms when they connect, and may only subscribe to these rooms.
+type RoomLookup func(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+// RoomPayload identifies the room a client event applies to
+type RoomPayload struct {
+	ChatID uuid.UUID `json:"chat_id"`
+}
+
+// UserPresencePayload is broadcast to a room when a member connects or
+// disconnects
+type UserPresencePayload struct {
+	ChatID uuid.UUID `json:"chat_id"`
+	UserID uuid.UUID `json:"user_id"`
+	User   UserInfo  `json:"user"`
+}
+
+// MemberLeavePayload is published to a chat when a member leaves or is
+// removed from it
+type MemberLeavePayload struct {
+	ChatID uuid.UUID `json:"chat_id"`
+	UserID uuid.UUID `json:"user_id"`
+	// PromotedUserID is the member made admin because the leaver was the
+	// chat's only admin
+	PromotedUserID *uuid.UUID `json:"promoted_user_id,omitempty"`
+}
+
+// Subscribe adds a client to a chat room so it receives the room's broadcasts
+func (h *Hub) Subscribe(clientID string, chatID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client, ok := h.clients[clientID]
+	if !ok {
+		return
+	}
+	h.subscribe(client, chatID)
+}
+
+// Unsubscribe removes a client from a chat room
+func (h *Hub) Unsubscribe(clientID string, chatID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client, ok := h.clients[clientID]
+	if !ok {
+		return
+	}
+	h.unsubscribe(client, chatID)
+}
+
+// AddUserToRoom subscribes all of a user's connections to a chat room, for
+// when they become a member
+func (h *Hub) AddUserToRoom(userID, chatID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id := range h.userClients[userID] {
+		if client, ok := h.clients[id]; ok {
+			h.subscribe(client, chatID)
+		}
+	}
+}
+
+// RemoveUserFromRoom unsubscribes all of a user's connections from a chat
+// room, for when they are no longer a member
+func (h *Hub) RemoveUserFromRoom(userID, chatID uuid.UUID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for id := range h.userClients[userID] {
+		if client, ok := h.clients[id]; ok {
+			h.unsubscribe(client, chatID)
+		}
+	}
+}
+
+// IsSubscribed reports whether a client is in a chat room
+func (h *Hub) IsSubscribed(clientID string, chatID uuid.UUID) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	client, ok := h.clients[clientID]
+	return ok && client.rooms[chatID]
+}
+
+// subscribe adds a client to a room. The caller must hold h.mu.
+func (h *Hub) subscribe(client *Client, chatID uuid.UUID) {
+	room, ok := h.rooms[chatID]
+	if !ok {
+		room = make(map[string]*Client)
+		h.rooms[chatID] = room
+	}
+	room[client.ID] = client
+	client.rooms[chatID] = true
+}
+
+// unsubscribe removes a client from a room, dropping the room once it is
+// empty. The caller must hold h.mu.
+func (h *Hub) unsubscribe(client *Client, chatID uuid.UUID) {
+	delete(client.rooms, chatID)
+
+	room, ok := h.rooms[chatID]
+	if !ok {
+		return
+	}
+	delete(room, client.ID)
+	if len(room) == 0 {
+		delete(h.rooms, chatID)
+	}
+}
+
+// sendToRoom delivers data to every client in a room except the one with
+// skipClientID. Clients whose send buffer is full miss the message. The
+// caller must hold h.mu.
+func (h *Hub) sendToRoom(chatID uuid.UUID, skipClientID string, data []byte) {
+	for id, client := range h.rooms[chatID] {
+		if id == skipClientID {
+			continue
+		}
+		select {
+		case client.Send <- data:
+		default:
+			log.Warn().Str("client_id", id).Msg("Client send buffer full, dropping message")
+			h.recordMissed(client, data)
+		}
+	}
+}
+
+// notifyRooms tells the other members of each of a client's rooms that its
+// user connected or disconnected. The caller must hold h.mu.
+func (h *Hub) notifyRooms(client *Client, eventType string) {
+	for chatID := range client.rooms {
+		payload, err := json.Marshal(UserPresencePayload{
+			ChatID: chatID,
+			UserID: client.UserID,
+			User:   client.UserInfo,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal user presence payload")
+			return
+		}
+		data, err := json.Marshal(Message{
+			Type:      eventType,
+			Timestamp: time.Now(),
+			Payload:   payload,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal user presence event")
+			return
+		}
+
+		h.sendToRoom(chatID, client.ID, data)
+	}
+}
+
+// handleSubscribe processes a client's request to join a room it belongs to
+func (c *Client) handleSubscribe(payload json.RawMessage) {
+	var room RoomPayload
+	if err := json.Unmarshal(payload, &room); err != nil || room.ChatID == uuid.Nil {
+		c.sendError("Invalid subscribe payload")
+		return
+	}
+
+	if c.Hub.roomLookup == nil {
+		c.sendError("Subscriptions are not available")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	chatIDs, err := c.Hub.roomLookup(ctx, c.UserID)
+	if err != nil {
+		log.Error().Err(err).Str("client_id", c.ID).Msg("Failed to look up chats for subscription")
+		c.sendError("Failed to subscribe")
+		return
+	}
+	for _, chatID := range chatIDs {
+		if chatID == room.ChatID {
+			c.Hub.Subscribe(c.ID, room.ChatID)
+			return
+		}
+	}
+
+	c.sendError("You are not a member of this chat")
+}
+
+// handleUnsubscribe processes a client's request to leave a room
+func (c *Client) handleUnsubscribe(payload json.RawMessage) {
+	var room RoomPayload
+	if err := json.Unmarshal(payload, &room); err != nil || room.ChatID == uuid.Nil {
+		c.sendError("Invalid unsubscribe payload")
+		return
+	}
+
+	c.Hub.Unsubscribe(c.ID, room.ChatID)
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRoomSubscriptionsControlDelivery(t *testing.T) {
+	h := NewHub(HubConfig{}, nil)
+	f := NewFanout(FanoutConfig{}, h)
+	t.Cleanup(func() { f.Stop(context.Background()) })
+
+	chatID := uuid.New()
+	alice, bob := uuid.New(), uuid.New()
+	aliceClient := connect(h, alice, chatID)
+	bobPhone, bobLaptop := connect(h, bob), connect(h, bob)
+	for _, c := range []*Client{aliceClient, bobPhone, bobLaptop} {
+		events(t, c)
+	}
+
+	// publish sends a message and waits until it reaches to, then returns
+	// whether each other client got it too
+	publish := func(to *Client, others ...*Client) []bool {
+		t.Helper()
+		if err := f.Publish(chatID, EventTypeMessage, "hi"); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		waitForEvent(t, to, EventTypeMessage, time.Second)
+
+		got := make([]bool, len(others))
+		for i, c := range others {
+			got[i] = len(ofType(events(t, c), EventTypeMessage)) > 0
+		}
+		return got
+	}
+
+	if got := publish(aliceClient, bobPhone); got[0] {
+		t.Error("message reached a user who isn't in the room")
+	}
+
+	// Joining the chat subscribes every connection the user has open
+	h.AddUserToRoom(bob, chatID)
+	if got := publish(aliceClient, bobPhone, bobLaptop); !got[0] || !got[1] {
+		t.Errorf("after joining, connections got the message: %v, want both", got)
+	}
+
+	// A client that unsubscribes stops getting the room's messages
+	h.Unsubscribe(aliceClient.ID, chatID)
+	if got := publish(bobPhone, aliceClient, bobLaptop); got[0] {
+		t.Error("message reached a client that unsubscribed")
+	}
+
+	h.RemoveUserFromRoom(bob, chatID)
+	h.Subscribe(aliceClient.ID, chatID)
+	if got := publish(aliceClient, bobPhone, bobLaptop); got[0] || got[1] {
+		t.Errorf("after leaving, connections got the message: %v, want neither", got)
+	}
+}
@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/metrics"
+)
+
+// EventTypeShutdown tells clients the server is going away, so they can
+// reconnect elsewhere
+const EventTypeShutdown = "shutdown"
+
+// shutdownReason is sent in the shutdown event and the close frame
+const shutdownReason = "server shutting down"
+
+// ShutdownPayload is the payload of a shutdown event
+type ShutdownPayload struct {
+	Reason string `json:"reason"`
+}
+
+// Shutdown stops the hub: every client is sent a shutdown event, has what is
+// already queued for it written out, and is closed with a going-away close
+// frame. The Run loop then exits. Shutdown returns once every connection has
+// been written out, or with ctx's error if that takes too long. It is safe to
+// call more than once.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.stopOnce.Do(func() { close(h.stop) })
+
+	select {
+	case <-h.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		log.Info().Msg("WebSocket connections drained")
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closeClients sends every client the shutdown event and tells its write pump
+// to finish up. Clients are removed from the hub first, so nothing else sends
+// to them once they are closing. Called from Run.
+func (h *Hub) closeClients() {
+	payload, err := json.Marshal(ShutdownPayload{Reason: shutdownReason})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal shutdown payload")
+	}
+	data, err := json.Marshal(Message{
+		Type:      EventTypeShutdown,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal shutdown event")
+	}
+
+	h.mu.Lock()
+	clients := h.clients
+	h.clients = make(map[string]*Client)
+	h.userClients = make(map[uuid.UUID]map[string]bool)
+	h.rooms = make(map[uuid.UUID]map[string]*Client)
+	metrics.WebSocketClients.Set(0)
+	h.mu.Unlock()
+
+	for _, client := range clients {
+		if data != nil {
+			select {
+			case client.Send <- data:
+			default:
+			}
+		}
+		close(client.shutdown)
+	}
+
+	log.Info().Int("clients", len(clients)).Msg("Closing WebSocket connections")
+}
+
+// drainAndClose writes out what is already queued for the client, then sends
+// a going-away close frame. Called from WritePump on shutdown.
+func (c *Client) drainAndClose() {
+	for {
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				c.Socket.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.Socket.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		default:
+			c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+			c.Socket.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, shutdownReason))
+			return
+		}
+	}
+}
+
+// register hands a client to the Run loop, reporting false once the hub has
+// stopped
+func (h *Hub) register(client *Client) bool {
+	select {
+	case h.Register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// unregister hands a client to the Run loop, unless the hub has stopped and
+// already let go of it
+func (h *Hub) unregister(client *Client) {
+	select {
+	case h.Unregister <- client:
+	case <-h.done:
+	}
+}
+
+// broadcast hands a broadcast to the Run loop, dropping it once the hub has
+// stopped
+func (h *Hub) broadcast(broadcast *Broadcast) {
+	select {
+	case h.Broadcast <- broadcast:
+	case <-h.done:
+	}
+}
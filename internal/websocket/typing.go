@@ -0,0 +1,193 @@
+package websocket
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// defaultTypingTTL is how long a typing indicator lasts without another
+// typing event when none is configured
+const defaultTypingTTL = 5 * time.Second
+
+// typingState is a user's typing indicator in a chat
+type typingState struct {
+	// clientID is the connection the user last typed from
+	clientID string
+	expires  time.Time
+}
+
+// TypingPayload is broadcast to a room when a member starts or stops typing
+type TypingPayload struct {
+	ChatID uuid.UUID `json:"chat_id"`
+	UserID uuid.UUID `json:"user_id"`
+	// User is included when typing starts
+	User *UserInfo `json:"user,omitempty"`
+}
+
+// handleTypingEvent marks the sender as typing in the chat room it names for
+// the next TypingTTL. Only the first of a run of typing events is passed on
+// to the rest of the room; the rest just keep the indicator alive.
+func (c *Client) handleTypingEvent(payload json.RawMessage) {
+	chatID, ok := c.typingRoom(payload)
+	if !ok {
+		return
+	}
+
+	if !c.Hub.startTyping(chatID, c.UserID, c.ID, time.Now()) {
+		return
+	}
+	c.Hub.broadcastTyping(c.ID, EventTypeTyping, TypingPayload{
+		ChatID: chatID,
+		UserID: c.UserID,
+		User:   &c.UserInfo,
+	})
+}
+
+// handleTypingStop clears the sender's typing state in the chat room it
+// names, telling the room if they were typing
+func (c *Client) handleTypingStop(payload json.RawMessage) {
+	chatID, ok := c.typingRoom(payload)
+	if !ok {
+		return
+	}
+
+	if c.Hub.stopTyping(chatID, c.UserID) {
+		c.Hub.broadcastTyping(c.ID, EventTypeTypingStop, TypingPayload{ChatID: chatID, UserID: c.UserID})
+	}
+}
+
+// typingRoom returns the chat room a typing event names, sending the client
+// an error and returning false unless it is subscribed to it
+func (c *Client) typingRoom(payload json.RawMessage) (uuid.UUID, bool) {
+	var room RoomPayload
+	if err := json.Unmarshal(payload, &room); err != nil || room.ChatID == uuid.Nil {
+		c.sendError("Missing chat ID")
+		return uuid.Nil, false
+	}
+	if !c.Hub.IsSubscribed(c.ID, room.ChatID) {
+		c.sendError("You are not subscribed to this chat")
+		return uuid.Nil, false
+	}
+	return room.ChatID, true
+}
+
+// StopTyping clears a user's typing state in a chat and, if they were typing,
+// tells the room. It is called when the user's message arrives, so peers
+// don't keep seeing them typing. It must not be called from the hub's own
+// goroutine.
+func (h *Hub) StopTyping(chatID, userID uuid.UUID) {
+	if h.stopTyping(chatID, userID) {
+		h.broadcastTyping("", EventTypeTypingStop, TypingPayload{ChatID: chatID, UserID: userID})
+	}
+}
+
+// startTyping records that a user is typing in a chat from a connection,
+// until TypingTTL from now, and reports whether they weren't already
+func (h *Hub) startTyping(chatID, userID uuid.UUID, clientID string, now time.Time) bool {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	users, ok := h.typing[chatID]
+	if !ok {
+		users = make(map[uuid.UUID]*typingState)
+		h.typing[chatID] = users
+	}
+	state, typing := users[userID]
+	if !typing || !now.Before(state.expires) {
+		state = &typingState{}
+		users[userID] = state
+		typing = false
+	}
+	state.clientID = clientID
+	state.expires = now.Add(h.config.TypingTTL)
+	return !typing
+}
+
+// stopTyping clears a user's typing state in a chat and reports whether they
+// were typing
+func (h *Hub) stopTyping(chatID, userID uuid.UUID) bool {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	if _, ok := h.typing[chatID][userID]; !ok {
+		return false
+	}
+	h.deleteTyping(chatID, userID)
+	return true
+}
+
+// clearTyping clears the typing states that have expired by now, or that
+// were set from the connection with clientID if it isn't empty, and returns
+// them as typing_stop payloads
+func (h *Hub) clearTyping(now time.Time, clientID string) []TypingPayload {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	var cleared []TypingPayload
+	for chatID, users := range h.typing {
+		for userID, state := range users {
+			if now.Before(state.expires) && (clientID == "" || state.clientID != clientID) {
+				continue
+			}
+			h.deleteTyping(chatID, userID)
+			cleared = append(cleared, TypingPayload{ChatID: chatID, UserID: userID})
+		}
+	}
+	return cleared
+}
+
+// deleteTyping removes a user's typing state, dropping the chat's map once it
+// is empty. The caller must hold h.typingMu.
+func (h *Hub) deleteTyping(chatID, userID uuid.UUID) {
+	users := h.typing[chatID]
+	delete(users, userID)
+	if len(users) == 0 {
+		delete(h.typing, chatID)
+	}
+}
+
+// expireTyping tells rooms that users whose typing indicator has lapsed, or
+// whose connection closed (clientID), have stopped typing. Called from Run,
+// so broadcasts are queued directly rather than sent to the Run loop.
+func (h *Hub) expireTyping(now time.Time, clientID string) {
+	for _, typing := range h.clearTyping(now, clientID) {
+		data, err := typingEvent(EventTypeTypingStop, typing)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to marshal typing event")
+			continue
+		}
+		h.queueBroadcast(&Broadcast{ChatID: typing.ChatID, Message: data})
+	}
+}
+
+// broadcastTyping sends a typing event to a chat room, other than to the
+// client with skipClientID
+func (h *Hub) broadcastTyping(skipClientID, eventType string, typing TypingPayload) {
+	data, err := typingEvent(eventType, typing)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to marshal typing event")
+		return
+	}
+
+	h.broadcast(&Broadcast{
+		ClientID: skipClientID,
+		ChatID:   typing.ChatID,
+		Message:  data,
+	})
+}
+
+// typingEvent encodes a typing or typing_stop event
+func typingEvent(eventType string, typing TypingPayload) ([]byte, error) {
+	payload, err := json.Marshal(typing)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Message{
+		Type:      eventType,
+		Timestamp: time.Now(),
+		Payload:   payload,
+	})
+}
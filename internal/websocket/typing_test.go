@@ -0,0 +1,212 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// typingUsers decodes the user IDs of a client's queued events of one type
+func typingUsers(t *testing.T, c *Client, eventType string) []uuid.UUID {
+	t.Helper()
+
+	var users []uuid.UUID
+	for _, msg := range ofType(events(t, c), eventType) {
+		var p TypingPayload
+		if err := json.Unmarshal(msg.Payload, &p); err != nil {
+			t.Fatalf("invalid typing payload: %v", err)
+		}
+		users = append(users, p.UserID)
+	}
+	return users
+}
+
+// runHub starts a hub's Run loop until the test ends
+func runHub(t *testing.T, h *Hub) {
+	go h.Run()
+	t.Cleanup(func() {
+		h.stopOnce.Do(func() { close(h.stop) })
+		<-h.done
+	})
+}
+
+// settle gives the Run loop time to deliver queued broadcasts
+func settle() {
+	time.Sleep(50 * time.Millisecond)
+}
+
+func TestTypingStartAndExplicitStop(t *testing.T) {
+	h := NewHub(HubConfig{TypingTTL: time.Minute}, nil)
+	runHub(t, h)
+	chatID := uuid.New()
+	alice := connect(h, uuid.New(), chatID)
+	peer := connect(h, uuid.New(), chatID)
+	settle()
+	events(t, peer)
+	events(t, alice)
+
+	// A run of typing events is announced once
+	for i := 0; i < 3; i++ {
+		sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	}
+	settle()
+	if got := typingUsers(t, peer, EventTypeTyping); len(got) != 1 || got[0] != alice.UserID {
+		t.Errorf("peer got typing from %v, want alice once", got)
+	}
+	if got := typingUsers(t, alice, EventTypeTyping); len(got) != 0 {
+		t.Errorf("alice was told about her own typing: %v", got)
+	}
+
+	sendEvent(t, alice, EventTypeTypingStop, RoomPayload{ChatID: chatID})
+	settle()
+	if got := typingUsers(t, peer, EventTypeTypingStop); len(got) != 1 || got[0] != alice.UserID {
+		t.Errorf("peer got typing_stop from %v, want alice", got)
+	}
+
+	// Stopping again, or typing anew, is handled from a clean state
+	sendEvent(t, alice, EventTypeTypingStop, RoomPayload{ChatID: chatID})
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	settle()
+	msgs := events(t, peer)
+	if n := len(ofType(msgs, EventTypeTypingStop)); n != 0 {
+		t.Errorf("peer got %d typing_stop events for a user who wasn't typing", n)
+	}
+	if n := len(ofType(msgs, EventTypeTyping)); n != 1 {
+		t.Errorf("peer got %d typing events after a stop, want 1", n)
+	}
+}
+
+func TestStopTypingOnSend(t *testing.T) {
+	h := NewHub(HubConfig{TypingTTL: time.Minute}, nil)
+	runHub(t, h)
+	chatID, otherChat := uuid.New(), uuid.New()
+	alice := connect(h, uuid.New(), chatID, otherChat)
+	peer := connect(h, uuid.New(), chatID, otherChat)
+	settle()
+
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: otherChat})
+	settle()
+	events(t, peer)
+
+	// Alice's message lands in one chat
+	h.StopTyping(chatID, alice.UserID)
+	settle()
+	msgs := ofType(events(t, peer), EventTypeTypingStop)
+	if len(msgs) != 1 {
+		t.Fatalf("peer got %d typing_stop events, want 1", len(msgs))
+	}
+	var p TypingPayload
+	json.Unmarshal(msgs[0].Payload, &p)
+	if p.ChatID != chatID || p.UserID != alice.UserID {
+		t.Errorf("typing_stop = %+v, want alice in the chat she sent to", p)
+	}
+
+	h.typingMu.Lock()
+	_, stillTyping := h.typing[chatID][alice.UserID]
+	_, otherTyping := h.typing[otherChat][alice.UserID]
+	h.typingMu.Unlock()
+	if stillTyping {
+		t.Error("alice is still typing in the chat she sent to")
+	}
+	if !otherTyping {
+		t.Error("sending in one chat cleared alice's typing in another")
+	}
+
+	// A user who wasn't typing sends nothing extra
+	h.StopTyping(chatID, alice.UserID)
+	settle()
+	if n := len(ofType(events(t, peer), EventTypeTypingStop)); n != 0 {
+		t.Errorf("peer got %d typing_stop events for a user who wasn't typing", n)
+	}
+}
+
+func TestClearTypingExpiredAndDisconnected(t *testing.T) {
+	h := NewHub(HubConfig{TypingTTL: time.Second}, nil)
+	chatID := uuid.New()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	start := time.Now()
+
+	h.startTyping(chatID, alice, "alice-laptop", start)
+	h.startTyping(chatID, bob, "bob-phone", start.Add(900*time.Millisecond))
+	h.startTyping(chatID, carol, "carol-phone", start.Add(900*time.Millisecond))
+
+	// Alice's indicator lapses first
+	cleared := h.clearTyping(start.Add(time.Second), "")
+	if len(cleared) != 1 || cleared[0].UserID != alice {
+		t.Errorf("cleared %+v after alice's TTL, want only alice", cleared)
+	}
+
+	// Bob's connection closing clears his at once
+	cleared = h.clearTyping(start.Add(time.Second), "bob-phone")
+	if len(cleared) != 1 || cleared[0].UserID != bob {
+		t.Errorf("cleared %+v when bob disconnected, want only bob", cleared)
+	}
+
+	if cleared := h.clearTyping(start.Add(2*time.Second), ""); len(cleared) != 1 || cleared[0].UserID != carol {
+		t.Errorf("cleared %+v after carol's TTL, want only carol", cleared)
+	}
+	if len(h.typing) != 0 {
+		t.Errorf("typing state left behind: %v", h.typing)
+	}
+}
+
+func TestTypingClearedOnDisconnect(t *testing.T) {
+	h := NewHub(HubConfig{TypingTTL: time.Minute}, nil)
+	runHub(t, h)
+	chatID := uuid.New()
+	alice := connect(h, uuid.New(), chatID)
+	peer := connect(h, uuid.New(), chatID)
+	outsider := connect(h, uuid.New(), uuid.New())
+	settle()
+
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	settle()
+	events(t, peer)
+
+	// Alice's connection drops well before her indicator would lapse
+	h.Unregister <- alice
+	msg := waitForEvent(t, peer, EventTypeTypingStop, time.Second)
+	var p TypingPayload
+	if err := json.Unmarshal(msg.Payload, &p); err != nil {
+		t.Fatalf("invalid typing payload: %v", err)
+	}
+	if p.ChatID != chatID || p.UserID != alice.UserID {
+		t.Errorf("typing_stop = %+v, want alice in her chat", p)
+	}
+
+	h.typingMu.Lock()
+	left := len(h.typing)
+	h.typingMu.Unlock()
+	if left != 0 {
+		t.Errorf("typing state left behind for %d chats", left)
+	}
+	// Typing events stay in the room they're about
+	if got := typingUsers(t, outsider, EventTypeTyping); len(got) != 0 {
+		t.Errorf("client in another room got typing from %v", got)
+	}
+}
+
+func TestTypingExpiresWithoutRefresh(t *testing.T) {
+	h := NewHub(HubConfig{TypingTTL: 100 * time.Millisecond}, nil)
+	runHub(t, h)
+	chatID := uuid.New()
+	alice := connect(h, uuid.New(), chatID)
+	peer := connect(h, uuid.New(), chatID)
+	settle()
+
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	waitForEvent(t, peer, EventTypeTyping, time.Second)
+	start := time.Now()
+
+	waitForEvent(t, peer, EventTypeTypingStop, time.Second)
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("typing_stop after %v, before the TTL could lapse", elapsed)
+	}
+
+	// Alice is still connected, so typing again is announced afresh
+	sendEvent(t, alice, EventTypeTyping, RoomPayload{ChatID: chatID})
+	waitForEvent(t, peer, EventTypeTyping, time.Second)
+}
@@ -16,7 +16,9 @@ CREATE TABLE IF NOT EXISTS users (
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     last_login TIMESTAMP WITH TIME ZONE,
     is_active BOOLEAN NOT NULL DEFAULT TRUE,
-    is_admin BOOLEAN NOT NULL DEFAULT FALSE
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    failed_login_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP WITH TIME ZONE
 );
 
 -- User preferences table
@@ -40,7 +42,8 @@ CREATE TABLE IF NOT EXISTS chats (
     created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     is_private BOOLEAN NOT NULL DEFAULT FALSE,
-    is_encrypted BOOLEAN NOT NULL DEFAULT FALSE
+    is_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    ai_model VARCHAR(100) NOT NULL DEFAULT ''
 );
 
 -- Chat members table
@@ -49,6 +52,10 @@ CREATE TABLE IF NOT EXISTS chat_members (
     user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
     joined_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+    last_read_at TIMESTAMP WITH TIME ZONE,
+    unread_count INTEGER NOT NULL DEFAULT 0,
+    is_favorite BOOLEAN NOT NULL DEFAULT FALSE,
+    is_archived BOOLEAN NOT NULL DEFAULT FALSE,
     PRIMARY KEY (chat_id, user_id)
 );
 
@@ -64,7 +71,36 @@ CREATE TABLE IF NOT EXISTS messages (
     is_edited BOOLEAN NOT NULL DEFAULT FALSE,
     is_deleted BOOLEAN NOT NULL DEFAULT FALSE,
     reply_to UUID REFERENCES messages(id),
-    is_ai_generated BOOLEAN NOT NULL DEFAULT FALSE
+    depth INTEGER NOT NULL DEFAULT 0,
+    is_ai_generated BOOLEAN NOT NULL DEFAULT FALSE,
+    forwarded_from UUID REFERENCES messages(id) ON DELETE SET NULL
+);
+
+-- Message edit history table
+CREATE TABLE IF NOT EXISTS message_edits (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    content_encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    edited_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Message drafts table
+CREATE TABLE IF NOT EXISTS message_drafts (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    chat_id UUID NOT NULL REFERENCES chats(id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, chat_id)
+);
+
+-- Message reactions table
+CREATE TABLE IF NOT EXISTS message_reactions (
+    message_id UUID NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    emoji VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (message_id, user_id, emoji)
 );
 
 -- Direct messages table
@@ -100,6 +136,14 @@ CREATE TABLE IF NOT EXISTS attachments (
     )
 );
 
+-- User blocks table
+CREATE TABLE IF NOT EXISTS user_blocks (
+    blocker_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    blocked_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id)
+);
+
 -- User sessions table
 CREATE TABLE IF NOT EXISTS user_sessions (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -112,6 +156,66 @@ CREATE TABLE IF NOT EXISTS user_sessions (
     last_active_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
 );
 
+-- Refresh tokens table
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Password reset tokens table
+CREATE TABLE IF NOT EXISTS password_resets (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- API keys table
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- AI usage table
+CREATE TABLE IF NOT EXISTS ai_usage (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    model VARCHAR(100) NOT NULL,
+    prompt_tokens INTEGER NOT NULL DEFAULT 0,
+    completion_tokens INTEGER NOT NULL DEFAULT 0,
+    total_tokens INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Roles table
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+-- Role permissions table
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL,
+    PRIMARY KEY (role_name, permission)
+);
+
+-- User roles table
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    granted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, role_name)
+);
+
 -- Blacklisted tokens table (for logout)
 CREATE TABLE IF NOT EXISTS blacklisted_tokens (
     token VARCHAR(255) PRIMARY KEY,
@@ -125,6 +229,8 @@ CREATE INDEX idx_messages_chat_id ON messages(chat_id);
 CREATE INDEX idx_messages_user_id ON messages(user_id);
 CREATE INDEX idx_messages_created_at ON messages(created_at);
 CREATE INDEX idx_messages_reply_to ON messages(reply_to);
+CREATE INDEX idx_message_edits_message_id ON message_edits(message_id);
+CREATE INDEX idx_messages_content_search ON messages USING GIN (to_tsvector('english', content));
 
 CREATE INDEX idx_direct_messages_sender_id ON direct_messages(sender_id);
 CREATE INDEX idx_direct_messages_recipient_id ON direct_messages(recipient_id);
@@ -132,12 +238,33 @@ CREATE INDEX idx_direct_messages_created_at ON direct_messages(created_at);
 CREATE INDEX idx_direct_messages_is_read ON direct_messages(is_read);
 
 CREATE INDEX idx_chat_members_user_id ON chat_members(user_id);
+CREATE INDEX idx_user_blocks_blocked_id ON user_blocks(blocked_id);
 CREATE INDEX idx_attachments_message_id ON attachments(message_id);
 CREATE INDEX idx_attachments_direct_message_id ON attachments(direct_message_id);
 
 CREATE INDEX idx_user_sessions_user_id ON user_sessions(user_id);
 CREATE INDEX idx_user_sessions_expires_at ON user_sessions(expires_at);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens(user_id);
+CREATE INDEX idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
 CREATE INDEX idx_blacklisted_tokens_expires_at ON blacklisted_tokens(expires_at);
+CREATE INDEX idx_api_keys_user_id ON api_keys(user_id);
+CREATE INDEX idx_ai_usage_user_id_created_at ON ai_usage(user_id, created_at);
+CREATE INDEX idx_user_roles_role_name ON user_roles(role_name);
+
+-- Built-in roles
+INSERT INTO roles (name, description) VALUES
+    ('owner', 'Manages roles and every chat'),
+    ('moderator', 'Moderates every chat they are a member of'),
+    ('member', 'A regular user')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+    ('owner', 'roles.manage'),
+    ('owner', 'chats.manage'),
+    ('owner', 'chats.moderate'),
+    ('moderator', 'chats.moderate')
+ON CONFLICT (role_name, permission) DO NOTHING;
 
 -- Functions and triggers for updated_at timestamp
 CREATE OR REPLACE FUNCTION update_timestamp()
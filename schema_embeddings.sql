@@ -0,0 +1,20 @@
+-- LlamaChat semantic search schema
+--
+-- Only needed with semantic search enabled ("semantic_search" in the "ai"
+-- config section). Requires the pgvector extension. The vector size must
+-- match the embeddings model: 1536 suits text-embedding-3-small. Changing
+-- models means recreating the table, since old and new vectors can't be
+-- compared.
+
+CREATE EXTENSION IF NOT EXISTS vector;
+
+-- Message embeddings table
+CREATE TABLE IF NOT EXISTS message_embeddings (
+    message_id UUID PRIMARY KEY REFERENCES messages(id) ON DELETE CASCADE,
+    model VARCHAR(100) NOT NULL,
+    embedding vector(1536) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- Approximate nearest-neighbour index for cosine distance
+CREATE INDEX IF NOT EXISTS idx_message_embeddings_embedding ON message_embeddings USING hnsw (embedding vector_cosine_ops);
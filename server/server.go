@@ -14,6 +14,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/llamasearch/llamachat/internal/middleware"
 )
 
 // Config holds the server configuration
@@ -102,6 +104,9 @@ func (s *Server) setupMiddleware() {
 	// Recovery middleware
 	s.router.Use(gin.Recovery())
 
+	// Tag requests with an ID for correlating their logs
+	s.router.Use(middleware.RequestID())
+
 	// Logger middleware
 	s.router.Use(func(c *gin.Context) {
 		start := time.Now()
@@ -113,6 +118,7 @@ func (s *Server) setupMiddleware() {
 		latency := end.Sub(start)
 
 		s.logger.Info().
+			Str("request_id", middleware.GetRequestID(c)).
 			Str("method", c.Request.Method).
 			Str("path", path).
 			Int("status", c.Writer.Status()).
@@ -126,7 +132,7 @@ func (s *Server) setupMiddleware() {
 		AllowOrigins:     s.config.CORS.AllowedOrigins,
 		AllowMethods:     s.config.CORS.AllowedMethods,
 		AllowHeaders:     s.config.CORS.AllowedHeaders,
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", middleware.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))